@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"transogov2/app/models"
+)
+
+// artworkExtensions are the image formats picked up as artwork, in order of preference
+var artworkExtensions = []string{".jpg", ".jpeg", ".png", ".webp"}
+
+// Artwork file names, without extension, in order of preference. Names are
+// matched case-insensitively.
+var (
+	folderPosterNames = []string{"poster", "folder", "cover", "movie"}
+	folderFanartNames = []string{"fanart", "backdrop", "background", "art"}
+	showPosterNames   = []string{"poster", "folder", "show"}
+	showFanartNames   = []string{"fanart", "backdrop", "background"}
+	seasonPosterNames = []string{"poster", "folder", "cover"}
+)
+
+// findArtwork returns the path of the first image in dir with one of the given
+// names, or an invalid value if there is none
+func findArtwork(dirs *dirListings, dir string, names []string) sql.NullString {
+	entries, err := dirs.read(dir)
+	if err != nil {
+		log.Printf("Error reading directory %s: %v", dir, err)
+		return sql.NullString{}
+	}
+	files := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files[strings.ToLower(entry.Name())] = entry.Name()
+		}
+	}
+	for _, name := range names {
+		for _, ext := range artworkExtensions {
+			if file, ok := files[strings.ToLower(name)+ext]; ok {
+				return nullString(filepath.Join(dir, file))
+			}
+		}
+	}
+	return sql.NullString{}
+}
+
+// movieArtwork finds the poster and fanart of a movie: images named after the
+// video, as in "Heat-poster.jpg", or in a movie folder also "poster.jpg",
+// "folder.jpg", "fanart.jpg" and the like
+func movieArtwork(dirs *dirListings, root, path string) (poster, fanart sql.NullString) {
+	dir := filepath.Dir(path)
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	posterNames := []string{stem + "-poster", stem}
+	fanartNames := []string{stem + "-fanart"}
+	if dir != root {
+		posterNames = append(posterNames, folderPosterNames...)
+		fanartNames = append(fanartNames, folderFanartNames...)
+	}
+	return findArtwork(dirs, dir, posterNames), findArtwork(dirs, dir, fanartNames)
+}
+
+// seasonPoster finds the poster of a season: "season01-poster.jpg" and the like
+// in the show's folder ("season-specials-poster.jpg" for season 0), or a poster
+// inside the season's own folder
+func seasonPoster(dirs *dirListings, tvShowPath string, season models.Season) sql.NullString {
+	names := []string{
+		fmt.Sprintf("season%02d-poster", season.Number),
+		fmt.Sprintf("season%d-poster", season.Number),
+		fmt.Sprintf("season%02d", season.Number),
+	}
+	if season.Number == 0 {
+		names = append([]string{"season-specials-poster"}, names...)
+	}
+	if poster := findArtwork(dirs, tvShowPath, names); poster.Valid || season.Path == tvShowPath {
+		return poster
+	}
+	return findArtwork(dirs, season.Path, seasonPosterNames)
+}
+
+// keepDownloaded returns the artwork found in dir, or if there is none the
+// current artwork when it was downloaded from a metadata provider rather than
+// found in dir
+func keepDownloaded(found, current sql.NullString, dir string) sql.NullString {
+	if found.Valid || !current.Valid || filepath.Dir(current.String) == dir {
+		return found
+	}
+	return current
+}
+
+// updateMovieArtwork stores the artwork found for a movie if it changed
+func updateMovieArtwork(ctx context.Context, repo MediaRepository, media models.Media, s *scanSession) {
+	root, _ := s.filter.root(media.Path)
+	poster, fanart := movieArtwork(s.dirs, root, media.Path)
+	dir := filepath.Dir(media.Path)
+	poster, fanart = keepDownloaded(poster, media.PosterPath, dir), keepDownloaded(fanart, media.FanartPath, dir)
+	if poster == media.PosterPath && fanart == media.FanartPath {
+		return
+	}
+	if err := repo.SetMediaArtwork(ctx, media.ID, poster, fanart); err != nil {
+		log.Printf("Error saving artwork for %s: %v", media.Path, err)
+		s.fail()
+	}
+}
+
+// updateTVShowArtwork stores the artwork found in a show's folder if it changed
+func updateTVShowArtwork(ctx context.Context, repo MediaRepository, tvShow models.TVShow, s *scanSession) {
+	poster := keepDownloaded(findArtwork(s.dirs, tvShow.Path, showPosterNames), tvShow.PosterPath, tvShow.Path)
+	fanart := keepDownloaded(findArtwork(s.dirs, tvShow.Path, showFanartNames), tvShow.FanartPath, tvShow.Path)
+	if poster == tvShow.PosterPath && fanart == tvShow.FanartPath {
+		return
+	}
+	if err := repo.SetTVShowArtwork(ctx, tvShow.ID, poster, fanart); err != nil {
+		log.Printf("Error saving artwork for %s: %v", tvShow.Path, err)
+		s.fail()
+	}
+}
+
+// updateSeasonPoster stores the poster found for a season if it changed
+func updateSeasonPoster(ctx context.Context, repo MediaRepository, tvShowPath string, season models.Season, s *scanSession) {
+	poster := seasonPoster(s.dirs, tvShowPath, season)
+	if poster == season.PosterPath {
+		return
+	}
+	if err := repo.SetSeasonPoster(ctx, season.ID, poster); err != nil {
+		log.Printf("Error saving artwork for %s: %v", season.Path, err)
+		s.fail()
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanFindsArtwork(t *testing.T) {
+	cfg := newTestLibrary(t)
+	movieDir := filepath.Join(cfg.MoviesDir, "Heat (1995)")
+	writeFile(t, filepath.Join(movieDir, "heat.1080p.mkv"), "heat")
+	writeFile(t, filepath.Join(movieDir, "Folder.JPG"), "poster")
+	writeFile(t, filepath.Join(movieDir, "fanart.png"), "fanart")
+	// Loose movies only get artwork named after them
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Alien.1979.mkv"), "alien")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Alien.1979-poster.jpg"), "poster")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Brazil.1985.mkv"), "brazil")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "poster.jpg"), "poster")
+
+	show := filepath.Join(cfg.TVDir, "The Wire")
+	writeFile(t, filepath.Join(show, "Season 1", "The.Wire.S01E01.mkv"), "episode")
+	writeFile(t, filepath.Join(show, "Season 2", "The.Wire.S02E01.mkv"), "episode")
+	writeFile(t, filepath.Join(show, "Specials", "The.Wire.S00E01.mkv"), "episode")
+	writeFile(t, filepath.Join(show, "poster.jpg"), "poster")
+	writeFile(t, filepath.Join(show, "backdrop.jpg"), "fanart")
+	writeFile(t, filepath.Join(show, "season01-poster.jpg"), "season")
+	writeFile(t, filepath.Join(show, "season-specials-poster.jpg"), "specials")
+	writeFile(t, filepath.Join(show, "Season 2", "folder.jpg"), "season")
+	flat := filepath.Join(cfg.TVDir, "Flat Show")
+	writeFile(t, filepath.Join(flat, "Flat.Show.S03E01.mkv"), "episode")
+	writeFile(t, filepath.Join(flat, "season3-poster.webp"), "season")
+
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	heat, _ := repo.GetMediaByPath(ctx, filepath.Join(movieDir, "heat.1080p.mkv"))
+	if heat.PosterPath.String != filepath.Join(movieDir, "Folder.JPG") || heat.FanartPath.String != filepath.Join(movieDir, "fanart.png") {
+		t.Errorf("Heat artwork = %q, %q, want Folder.JPG and fanart.png", heat.PosterPath.String, heat.FanartPath.String)
+	}
+	alien, _ := repo.GetMediaByPath(ctx, filepath.Join(cfg.MoviesDir, "Alien.1979.mkv"))
+	if alien.PosterPath.String != filepath.Join(cfg.MoviesDir, "Alien.1979-poster.jpg") {
+		t.Errorf("Alien poster = %q, want Alien.1979-poster.jpg", alien.PosterPath.String)
+	}
+	if brazil, _ := repo.GetMediaByPath(ctx, filepath.Join(cfg.MoviesDir, "Brazil.1985.mkv")); brazil.PosterPath.Valid {
+		t.Errorf("Brazil poster = %q, want none: poster.jpg in the library root belongs to no movie", brazil.PosterPath.String)
+	}
+
+	tvshow, _ := repo.GetTVShowByPath(ctx, show)
+	if tvshow.PosterPath.String != filepath.Join(show, "poster.jpg") || tvshow.FanartPath.String != filepath.Join(show, "backdrop.jpg") {
+		t.Errorf("show artwork = %q, %q, want poster.jpg and backdrop.jpg", tvshow.PosterPath.String, tvshow.FanartPath.String)
+	}
+	seasons, _ := repo.GetSeasonsByTVShowID(ctx, tvshow.ID)
+	want := map[int]string{
+		0: filepath.Join(show, "season-specials-poster.jpg"),
+		1: filepath.Join(show, "season01-poster.jpg"),
+		2: filepath.Join(show, "Season 2", "folder.jpg"),
+	}
+	for _, season := range seasons {
+		if season.PosterPath.String != want[season.Number] {
+			t.Errorf("season %d poster = %q, want %q", season.Number, season.PosterPath.String, want[season.Number])
+		}
+	}
+	if season, _ := repo.GetSeasonByPathAndNumber(ctx, flat, 3); season.PosterPath.String != filepath.Join(flat, "season3-poster.webp") {
+		t.Errorf("flat season 3 poster = %q, want season3-poster.webp", season.PosterPath.String)
+	}
+
+	// Artwork removed from disk is forgotten by the next full scan
+	if err := os.Remove(filepath.Join(movieDir, "fanart.png")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanMedia(ctx, repo, cfg, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if heat, _ := repo.GetMediaByPath(ctx, filepath.Join(movieDir, "heat.1080p.mkv")); heat.FanartPath.Valid {
+		t.Errorf("Heat fanart = %q after deleting it, want none", heat.FanartPath.String)
+	}
+}
+
+func TestIncrementalScanFindsAddedArtwork(t *testing.T) {
+	cfg := newTestLibrary(t)
+	movieDir := filepath.Join(cfg.MoviesDir, "Heat (1995)")
+	movie := filepath.Join(movieDir, "heat.1080p.mkv")
+	writeFile(t, movie, "heat")
+	show := filepath.Join(cfg.TVDir, "The Wire")
+	writeFile(t, filepath.Join(show, "Season 1", "The.Wire.S01E01.mkv"), "episode")
+	flat := filepath.Join(cfg.TVDir, "Flat Show")
+	writeFile(t, filepath.Join(flat, "Flat.Show.S03E01.mkv"), "episode")
+	// Dotfiles name no video, so they leave folder artwork to every video
+	roninDir := filepath.Join(cfg.MoviesDir, "Ronin (1998)")
+	ronin := filepath.Join(roninDir, "ronin.mkv")
+	writeFile(t, ronin, "ronin")
+	writeFile(t, filepath.Join(roninDir, ".DS_Store"), "")
+	writeFile(t, filepath.Join(roninDir, ignoreFileName), "")
+	writeFile(t, filepath.Join(flat, ".DS_Store"), "")
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// None of the videos or season folders change
+	writeFile(t, filepath.Join(movieDir, "poster.jpg"), "poster")
+	writeFile(t, filepath.Join(movieDir, "heat.1080p-fanart.jpg"), "fanart")
+	writeFile(t, filepath.Join(roninDir, "poster.jpg"), "poster")
+	writeFile(t, filepath.Join(show, "fanart.jpg"), "fanart")
+	writeFile(t, filepath.Join(show, "season01-poster.jpg"), "season")
+	writeFile(t, filepath.Join(flat, "season03-poster.jpg"), "season")
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	heat, _ := repo.GetMediaByPath(ctx, movie)
+	if heat.PosterPath.String != filepath.Join(movieDir, "poster.jpg") || heat.FanartPath.String != filepath.Join(movieDir, "heat.1080p-fanart.jpg") {
+		t.Errorf("Heat artwork = %q, %q, want the added poster and fanart", heat.PosterPath.String, heat.FanartPath.String)
+	}
+	if ronin, _ := repo.GetMediaByPath(ctx, ronin); ronin.PosterPath.String != filepath.Join(roninDir, "poster.jpg") {
+		t.Errorf("Ronin poster = %q, want the poster added next to the dotfiles", ronin.PosterPath.String)
+	}
+	tvshow, _ := repo.GetTVShowByPath(ctx, show)
+	if tvshow.FanartPath.String != filepath.Join(show, "fanart.jpg") {
+		t.Errorf("show fanart = %q, want the added fanart.jpg", tvshow.FanartPath.String)
+	}
+	if season, _ := repo.GetSeasonByPath(ctx, filepath.Join(show, "Season 1")); season.PosterPath.String != filepath.Join(show, "season01-poster.jpg") {
+		t.Errorf("season 1 poster = %q, want the added season01-poster.jpg", season.PosterPath.String)
+	}
+	if season, _ := repo.GetSeasonByPathAndNumber(ctx, flat, 3); season.PosterPath.String != filepath.Join(flat, "season03-poster.jpg") {
+		t.Errorf("flat season 3 poster = %q, want the added season03-poster.jpg", season.PosterPath.String)
+	}
+}
+
+func TestArtworkHandler(t *testing.T) {
+	cfg := newTestLibrary(t)
+	movieDir := filepath.Join(cfg.MoviesDir, "Heat (1995)")
+	writeFile(t, filepath.Join(movieDir, "heat.1080p.mkv"), "heat")
+	writeFile(t, filepath.Join(movieDir, "poster.jpg"), "poster")
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	heat, _ := repo.GetMediaByPath(ctx, filepath.Join(movieDir, "heat.1080p.mkv"))
+	mux := newTestMux(repo)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/artwork/media-poster/%d", heat.ID), nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "poster" {
+		t.Fatalf("poster: status %d, body %q, want 200 with the image", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Errorf("Content-Type = %q, want image/jpeg", ct)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("Cache-Control = %q, want no-cache", cc)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/artwork/media-poster/%d", heat.ID), nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("revalidation: status %d, want 304", rec.Code)
+	}
+
+	// Artwork paths that are not images, unknown kinds and unknown IDs are
+	// not found
+	repo.SetMediaArtwork(ctx, heat.ID, heat.PosterPath, nullString(heat.Path))
+	for _, path := range []string{
+		fmt.Sprintf("/artwork/media-fanart/%d", heat.ID),
+		fmt.Sprintf("/artwork/media-file/%d", heat.ID),
+		"/artwork/tvshow-poster/999",
+		"/artwork/season-poster/999",
+	} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s: status %d, want 404", path, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"transogov2/app/mediainfo"
+)
+
+// ScanConfig holds the media scanner configuration
+type ScanConfig struct {
+	MoviesDir string
+	TVDir     string
+	// MissingGracePeriod is how long a row may point at a vanished file
+	// before it is purged from the database
+	MissingGracePeriod time.Duration
+	// Workers is the number of files looked up and saved concurrently
+	Workers int
+	// Exclude holds gitignore-style patterns applied at the library roots in
+	// addition to the built-in ones and any .transgoignore files
+	Exclude []string
+	// MinFileSize is the size in bytes below which video files are skipped as samples
+	MinFileSize int64
+	// MovieExtensions and TVExtensions are the file extensions recognised as video
+	// in each library; empty means the default list. Folders unchanged since the
+	// last scan only pick up a changed list on a full rescan.
+	MovieExtensions []string
+	TVExtensions    []string
+	// Sniff classifies files with unrecognised extensions, or none, by checking
+	// their content for a known video container
+	Sniff bool
+	// FFprobePath is the ffprobe executable used for the video formats not read
+	// natively, such as AVI and MPEG transport streams; empty disables it
+	FFprobePath string
+	// FFprobeTimeout is how long ffprobe may take over a file before it is
+	// killed and the file skipped; zero means no limit
+	FFprobeTimeout time.Duration
+
+	// Watch enables incremental scans triggered by filesystem changes
+	Watch bool
+	// WatchMode is one of WatchModeAuto, WatchModeNative or WatchModePolling
+	WatchMode string
+	// WatchPollInterval is how often directories are walked in polling mode
+	WatchPollInterval time.Duration
+	// WatchDebounce is how long a path must be free of events before it is scanned
+	WatchDebounce time.Duration
+	// WatchSettle is how long file sizes must stay unchanged before a scan starts
+	WatchSettle time.Duration
+
+	// Metadata, when set, looks up movies and TV shows online after each scan
+	Metadata MetadataProvider
+	// ArtworkDir is where artwork downloaded from Metadata is kept
+	ArtworkDir string
+}
+
+// NewScanConfig creates a new ScanConfig from the environment
+func NewScanConfig() *ScanConfig {
+	return &ScanConfig{
+		MoviesDir:          envString("MOVIES_DIR", "./media/movies"),
+		TVDir:              envString("TV_DIR", "./media/tv"),
+		MissingGracePeriod: envDuration("SCAN_MISSING_GRACE", 7*24*time.Hour),
+		Workers:            envInt("SCAN_WORKERS", 4),
+		Exclude:            envList("SCAN_EXCLUDE"),
+		MinFileSize:        envSize("SCAN_MIN_FILE_SIZE", defaultMinFileSize),
+		MovieExtensions:    envList("SCAN_MOVIE_EXTENSIONS"),
+		TVExtensions:       envList("SCAN_TV_EXTENSIONS"),
+		Sniff:              envBool("SCAN_SNIFF", false),
+		FFprobePath:        envString("FFPROBE_PATH", ""),
+		FFprobeTimeout:     envDuration("FFPROBE_TIMEOUT", 30*time.Second),
+		Watch:              envBool("SCAN_WATCH", false),
+		WatchMode:          envString("SCAN_WATCH_MODE", WatchModeAuto),
+		WatchPollInterval:  envDuration("SCAN_WATCH_POLL_INTERVAL", time.Minute),
+		WatchDebounce:      envDuration("SCAN_WATCH_DEBOUNCE", 5*time.Second),
+		WatchSettle:        envDuration("SCAN_WATCH_SETTLE", 10*time.Second),
+	}
+}
+
+// MetadataConfig configures online metadata lookups
+type MetadataConfig struct {
+	// TMDBAPIKey is a TMDB API key, or TMDBAccessToken an API read access
+	// token; lookups are disabled without either
+	TMDBAPIKey      string
+	TMDBAccessToken string
+	// TMDBBaseURL and TMDBImageBaseURL point at a TMDB-compatible API and the
+	// server its images are downloaded from
+	TMDBBaseURL      string
+	TMDBImageBaseURL string
+	// Language is the language metadata is requested in, such as "en-US"
+	Language string
+	// RateLimit is the maximum number of API requests per second
+	RateLimit float64
+	// CacheDir holds cached API responses and downloaded artwork; responses
+	// are reused for CacheTTL
+	CacheDir string
+	CacheTTL time.Duration
+}
+
+// NewMetadataConfig creates a new MetadataConfig from the environment
+func NewMetadataConfig() *MetadataConfig {
+	return &MetadataConfig{
+		TMDBAPIKey:       os.Getenv("TMDB_API_KEY"),
+		TMDBAccessToken:  os.Getenv("TMDB_ACCESS_TOKEN"),
+		TMDBBaseURL:      envString("TMDB_BASE_URL", "https://api.themoviedb.org/3"),
+		TMDBImageBaseURL: envString("TMDB_IMAGE_BASE_URL", "https://image.tmdb.org/t/p/original"),
+		Language:         envString("METADATA_LANGUAGE", "en-US"),
+		RateLimit:        envFloat("METADATA_RATE_LIMIT", 20),
+		CacheDir:         envString("METADATA_CACHE_DIR", "./cache/metadata"),
+		CacheTTL:         envDuration("METADATA_CACHE_TTL", 7*24*time.Hour),
+	}
+}
+
+// Provider returns the configured metadata provider, or nil if lookups are
+// disabled
+func (c *MetadataConfig) Provider() MetadataProvider {
+	if c.TMDBAPIKey == "" && c.TMDBAccessToken == "" {
+		return nil
+	}
+	return NewTMDBProvider(c)
+}
+
+// ArtworkDir returns the directory downloaded artwork is kept in
+func (c *MetadataConfig) ArtworkDir() string {
+	return filepath.Join(c.CacheDir, "artwork")
+}
+
+// scanFilter creates the filter deciding which library paths are scanned
+func (c *ScanConfig) scanFilter() *scanFilter {
+	f := newScanFilter([]string{c.MoviesDir, c.TVDir}, c.Exclude, c.MinFileSize)
+	f.extensions = make(map[string]map[string]bool)
+	if len(c.MovieExtensions) > 0 {
+		f.extensions[c.MoviesDir] = extensionSet(c.MovieExtensions)
+	}
+	if len(c.TVExtensions) > 0 {
+		f.extensions[c.TVDir] = extensionSet(c.TVExtensions)
+	}
+	f.sniff = c.Sniff
+	return f
+}
+
+// prober creates the prober reading the streams of video files: the native
+// reader, falling back to ffprobe for other formats when it is configured
+func (c *ScanConfig) prober() mediainfo.Prober {
+	if c.FFprobePath == "" {
+		return mediainfo.Native{}
+	}
+	path, err := exec.LookPath(c.FFprobePath)
+	if err != nil {
+		log.Printf("Error finding ffprobe, probing without it: %v", err)
+		return mediainfo.Native{}
+	}
+	return mediainfo.Fallback{mediainfo.Native{}, &mediainfo.FFprobe{Path: path, Timeout: c.FFprobeTimeout}}
+}
+
+// extensionSet normalises a list of extensions such as "MKV" or ".ts" into a set
+// of lower-case extensions with a leading dot
+func extensionSet(exts []string) map[string]bool {
+	set := make(map[string]bool, len(exts))
+	for _, ext := range exts {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		set[ext] = true
+	}
+	return set
+}
+
+// envString returns the value of an environment variable or a default
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envBool parses a boolean environment variable, falling back to a default
+func envBool(key string, def bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid boolean for %s (%q), using default %v: %v", key, v, def, err)
+		return def
+	}
+	return b
+}
+
+// envList splits a comma-separated environment variable, dropping empty items
+func envList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// envSize parses a size environment variable such as "50MB" or "1GiB", falling
+// back to a default
+func envSize(key string, def int64) int64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := parseSize(v)
+	if err != nil {
+		log.Printf("Invalid size for %s (%q), using default %d: %v", key, v, def, err)
+		return def
+	}
+	return n
+}
+
+// sizeUnits maps size suffixes to their multipliers; KB, MB and GB are treated as
+// binary units like most file managers do
+var sizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+}
+
+// parseSize parses a byte count with an optional unit suffix
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[strings.ToLower(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("unknown size unit %q", s[i:])
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// envInt parses an integer environment variable, falling back to a default
+func envInt(key string, def int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid integer for %s (%q), using default %d: %v", key, v, def, err)
+		return def
+	}
+	return n
+}
+
+// envFloat parses a floating-point environment variable, falling back to a default
+func envFloat(key string, def float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		log.Printf("Invalid number for %s (%q), using default %v: %v", key, v, def, err)
+		return def
+	}
+	return f
+}
+
+// envDuration parses a duration environment variable, falling back to a default
+func envDuration(key string, def time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		log.Printf("Invalid duration for %s (%q), using default %s: %v", key, v, def, err)
+		return def
+	}
+	return d
+}
@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"transogov2/app/models"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 // DBTX represents a database transaction
@@ -68,10 +71,53 @@ func (r *Repository) GetAllMedia(ctx context.Context) ([]models.Media, error) {
 	return media, nil
 }
 
-// GetMediaByType retrieves all media of a specific type from the database
+// GetMediaUnder retrieves the media whose file is path or inside it, at any depth
+func (r *Repository) GetMediaUnder(ctx context.Context, path string) ([]models.Media, error) {
+	var media []models.Media
+	err := r.db.SelectContext(ctx, &media, "SELECT * FROM media WHERE path = $1 OR path LIKE $2", path, likePrefix(path))
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// GetMediaIn retrieves the media whose file is directly inside dir
+func (r *Repository) GetMediaIn(ctx context.Context, dir string) ([]models.Media, error) {
+	var media []models.Media
+	pattern := likePrefix(dir)
+	err := r.db.SelectContext(ctx, &media, "SELECT * FROM media WHERE path LIKE $1 AND path NOT LIKE $2",
+		pattern, pattern+string(filepath.Separator)+"%")
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// GetMoviesByTitle retrieves the movies with a title, ignoring case
+func (r *Repository) GetMoviesByTitle(ctx context.Context, title string) ([]models.Media, error) {
+	var media []models.Media
+	err := r.db.SelectContext(ctx, &media, "SELECT * FROM media WHERE media_type = $1 AND lower(title) = lower($2)",
+		models.MediaTypeMovie, title)
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// likePrefix returns a LIKE pattern matching the paths inside dir, with the
+// wildcards LIKE gives a meaning escaped
+func likePrefix(dir string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(dir)
+	return strings.TrimSuffix(escaped, string(filepath.Separator)) + string(filepath.Separator) + "%"
+}
+
+// GetMediaByType retrieves the media of a specific type shown in the library:
+// those present on disk, leaving out movie parts, the extras of a movie and
+// other versions. Extras whose movie was not found are shown on their own.
 func (r *Repository) GetMediaByType(ctx context.Context, mediaType string) ([]models.Media, error) {
 	var media []models.Media
-	err := r.db.SelectContext(ctx, &media, "SELECT * FROM media WHERE media_type = $1", mediaType)
+	err := r.db.SelectContext(ctx, &media, `SELECT * FROM media
+	WHERE media_type = $1 AND missing_since IS NULL AND parent_id IS NULL AND version_of IS NULL`, mediaType)
 	if err != nil {
 		return nil, err
 	}
@@ -85,15 +131,171 @@ func (r *Repository) GetMediaByPath(ctx context.Context, path string) (models.Me
 	return media, err
 }
 
+// GetMediaByID retrieves a media file by its ID
+func (r *Repository) GetMediaByID(ctx context.Context, id int64) (models.Media, error) {
+	var media models.Media
+	err := r.db.GetContext(ctx, &media, "SELECT * FROM media WHERE id = $1", id)
+	return media, err
+}
+
+// GetMediaChildren retrieves the parts and extras of a movie that are present on
+// disk, parts first in order
+func (r *Repository) GetMediaChildren(ctx context.Context, parentID int64) ([]models.Media, error) {
+	var media []models.Media
+	err := r.db.SelectContext(ctx, &media, `SELECT * FROM media
+	WHERE parent_id = $1 AND missing_since IS NULL
+	ORDER BY extra_type NULLS FIRST, part, title, path`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// GetMediaVersions retrieves the other versions of a movie that are present on
+// disk, oldest first
+func (r *Repository) GetMediaVersions(ctx context.Context, id int64) ([]models.Media, error) {
+	var media []models.Media
+	err := r.db.SelectContext(ctx, &media, "SELECT * FROM media WHERE version_of = $1 AND missing_since IS NULL ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// SetMediaVersionOf makes a movie file another version of a movie, or its own
+// movie when versionOf is not valid
+func (r *Repository) SetMediaVersionOf(ctx context.Context, id int64, versionOf sql.NullInt64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE media SET version_of = $1 WHERE id = $2", versionOf, id)
+	return err
+}
+
+// LinkMedia sets the movie a movie part or extra belongs to and the part number
+// of a part; invalid values detach it
+func (r *Repository) LinkMedia(ctx context.Context, id int64, parentID, part sql.NullInt64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE media SET parent_id = $1, part = $2 WHERE id = $3", parentID, part, id)
+	return err
+}
+
+// UpdateMediaMetadata stores the valid fields of meta on a media file
+func (r *Repository) UpdateMediaMetadata(ctx context.Context, id int64, meta models.Metadata) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE media SET title = COALESCE($1, title), year = COALESCE($2, year),
+		description = COALESCE($3, description), rating = COALESCE($4, rating),
+		imdb_id = COALESCE($5, imdb_id), tmdb_id = COALESCE($6, tmdb_id), tvdb_id = COALESCE($7, tvdb_id)
+	WHERE id = $8`, meta.Title, meta.Year, meta.Description, meta.Rating, meta.IMDbID, meta.TMDbID, meta.TVDbID, id)
+	return err
+}
+
+// SetMediaArtwork sets the poster and fanart image files of a media file
+func (r *Repository) SetMediaArtwork(ctx context.Context, id int64, poster, fanart sql.NullString) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE media SET poster_path = $1, fanart_path = $2 WHERE id = $3", poster, fanart, id)
+	return err
+}
+
+// SetMediaMetadataLookup records a metadata lookup of a media file
+func (r *Repository) SetMediaMetadataLookup(ctx context.Context, id int64, lookup models.MetadataLookup) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE media SET metadata_checked_at = $1, metadata_misses = $2 WHERE id = $3", lookup.CheckedAt, lookup.Misses, id)
+	return err
+}
+
 // SaveMedia saves a media file to the database
 func (r *Repository) SaveMedia(ctx context.Context, media *models.Media) (int64, error) {
-	query := `INSERT INTO media (title, path, media_type, file_size, file_extension)
-	VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	query := `INSERT INTO media (title, path, media_type, file_size, file_extension, fingerprint, year,
+		resolution, source, video_codec, audio_codec, hdr, release_group, edition, release_parsed, part, extra_type)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id`
 	var id int64
-	err := r.db.QueryRowxContext(ctx, query, media.Title, media.Path, media.MediaType, media.FileSize, media.FileExtension).Scan(&id)
+	err := r.db.QueryRowxContext(ctx, query, media.Title, media.Path, media.MediaType, media.FileSize, media.FileExtension, media.Fingerprint, media.Year,
+		media.Resolution, media.Source, media.VideoCodec, media.AudioCodec, media.HDR, media.ReleaseGroup, media.Edition, media.ReleaseParsed,
+		media.Part, media.ExtraType).Scan(&id)
 	return id, err
 }
 
+// GetMediaWithoutRelease retrieves the media present on disk whose release
+// details have not been parsed from their file names
+func (r *Repository) GetMediaWithoutRelease(ctx context.Context) ([]models.Media, error) {
+	var media []models.Media
+	err := r.db.SelectContext(ctx, &media, "SELECT * FROM media WHERE NOT release_parsed AND missing_since IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// SetMediaRelease stores the release details parsed from a media file's name.
+// Details already known, such as a resolution read from the file's headers, are
+// kept.
+func (r *Repository) SetMediaRelease(ctx context.Context, id int64, release models.Release) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE media SET resolution = COALESCE(resolution, $1), source = COALESCE(source, $2),
+		video_codec = COALESCE(video_codec, $3), audio_codec = COALESCE(audio_codec, $4), hdr = hdr OR $5,
+		release_group = COALESCE(release_group, $6), edition = COALESCE(edition, $7), release_parsed = TRUE
+	WHERE id = $8`, release.Resolution, release.Source, release.VideoCodec, release.AudioCodec, release.HDR,
+		release.ReleaseGroup, release.Edition, id)
+	return err
+}
+
+// FindMissingMediaByFingerprint finds a media file marked missing whose content fingerprint matches
+func (r *Repository) FindMissingMediaByFingerprint(ctx context.Context, fingerprint string) (models.Media, error) {
+	var media models.Media
+	err := r.db.GetContext(ctx, &media, `SELECT * FROM media
+	WHERE fingerprint = $1 AND missing_since IS NOT NULL ORDER BY missing_since DESC LIMIT 1`, fingerprint)
+	return media, err
+}
+
+// UpdateMediaPath moves a media file to a new path and clears its missing mark
+func (r *Repository) UpdateMediaPath(ctx context.Context, id int64, path string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE media SET path = $1, missing_since = NULL WHERE id = $2", path, id)
+	return err
+}
+
+// UpdateMediaFingerprint stores the content fingerprint of a media file
+func (r *Repository) UpdateMediaFingerprint(ctx context.Context, id int64, fingerprint string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE media SET fingerprint = $1 WHERE id = $2", fingerprint, id)
+	return err
+}
+
+// SaveMediaInfo stores the duration, streams and chapters read from a media
+// file's headers, replacing any streams and chapters stored before. The valid
+// resolution and codecs replace those parsed from the file name.
+func (r *Repository) SaveMediaInfo(ctx context.Context, id int64, info models.MediaInfo) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `UPDATE media SET duration_ms = COALESCE($1, duration_ms),
+		resolution = COALESCE($2, resolution), video_codec = COALESCE($3, video_codec), audio_codec = COALESCE($4, audio_codec)
+	WHERE id = $5`, info.DurationMS, info.Resolution, info.VideoCodec, info.AudioCodec, id)
+	if err != nil {
+		return err
+	}
+	if err := saveStreams(ctx, tx, "media_id", id, info.Streams); err != nil {
+		return err
+	}
+	if err := saveChapters(ctx, tx, "media_id", id, info.Chapters); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetMediaStreams retrieves the streams of a media file in file order
+func (r *Repository) GetMediaStreams(ctx context.Context, mediaID int64) ([]models.MediaStream, error) {
+	var streams []models.MediaStream
+	err := r.db.SelectContext(ctx, &streams, "SELECT * FROM media_streams WHERE media_id = $1 ORDER BY stream_index", mediaID)
+	return streams, err
+}
+
+// SetMediaMissingSince marks a media file as missing from disk, or clears the mark when since is not valid
+func (r *Repository) SetMediaMissingSince(ctx context.Context, id int64, since sql.NullTime) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE media SET missing_since = $1 WHERE id = $2", since, id)
+	return err
+}
+
+// DeleteMedia deletes a media file from the database
+func (r *Repository) DeleteMedia(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM media WHERE id = $1", id)
+	return err
+}
+
 // GetAllTVShows retrieves all TV shows from the database
 func (r *Repository) GetAllTVShows(ctx context.Context) ([]models.TVShow, error) {
 	var tvshows []models.TVShow
@@ -127,6 +329,50 @@ func (r *Repository) SaveTVShow(ctx context.Context, tvshow *models.TVShow) (int
 	return id, err
 }
 
+// UpdateTVShowMetadata stores the valid fields of meta on a TV show
+func (r *Repository) UpdateTVShowMetadata(ctx context.Context, id int64, meta models.Metadata) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE tvshows SET title = COALESCE($1, title), year = COALESCE($2, year),
+		description = COALESCE($3, description), rating = COALESCE($4, rating),
+		imdb_id = COALESCE($5, imdb_id), tmdb_id = COALESCE($6, tmdb_id), tvdb_id = COALESCE($7, tvdb_id)
+	WHERE id = $8`, meta.Title, meta.Year, meta.Description, meta.Rating, meta.IMDbID, meta.TMDbID, meta.TVDbID, id)
+	return err
+}
+
+// SetTVShowArtwork sets the poster and fanart image files of a TV show
+func (r *Repository) SetTVShowArtwork(ctx context.Context, id int64, poster, fanart sql.NullString) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE tvshows SET poster_path = $1, fanart_path = $2 WHERE id = $3", poster, fanart, id)
+	return err
+}
+
+// SetTVShowMetadataLookup records a metadata lookup of a TV show
+func (r *Repository) SetTVShowMetadataLookup(ctx context.Context, id int64, lookup models.MetadataLookup) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE tvshows SET metadata_checked_at = $1, metadata_misses = $2 WHERE id = $3", lookup.CheckedAt, lookup.Misses, id)
+	return err
+}
+
+// SetTVShowEpisodeOrder sets how a TV show's season pages order episodes
+func (r *Repository) SetTVShowEpisodeOrder(ctx context.Context, id int64, order string) error {
+	result, err := r.db.ExecContext(ctx, "UPDATE tvshows SET episode_order = $1 WHERE id = $2", order, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteTVShowIfEmpty deletes a TV show that has no seasons left
+func (r *Repository) DeleteTVShowIfEmpty(ctx context.Context, id int64) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM tvshows WHERE id = $1
+	AND NOT EXISTS (SELECT 1 FROM seasons WHERE tvshow_id = $1)`, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
 // GetSeasonsByTVShowID retrieves all seasons for a TV show
 func (r *Repository) GetSeasonsByTVShowID(ctx context.Context, tvshowID int64) ([]models.Season, error) {
 	var seasons []models.Season
@@ -137,6 +383,13 @@ func (r *Repository) GetSeasonsByTVShowID(ctx context.Context, tvshowID int64) (
 	return seasons, nil
 }
 
+// GetSeasonByID retrieves a season by its ID
+func (r *Repository) GetSeasonByID(ctx context.Context, id int64) (models.Season, error) {
+	var season models.Season
+	err := r.db.GetContext(ctx, &season, "SELECT * FROM seasons WHERE id = $1", id)
+	return season, err
+}
+
 // GetSeasonByPath retrieves a season by its path
 func (r *Repository) GetSeasonByPath(ctx context.Context, path string) (models.Season, error) {
 	var season models.Season
@@ -144,6 +397,24 @@ func (r *Repository) GetSeasonByPath(ctx context.Context, path string) (models.S
 	return season, err
 }
 
+// GetSeasonByPathAndNumber retrieves a season by its path and number. The seasons
+// of a TV show without season folders all have the show's path.
+func (r *Repository) GetSeasonByPathAndNumber(ctx context.Context, path string, number int) (models.Season, error) {
+	var season models.Season
+	err := r.db.GetContext(ctx, &season, "SELECT * FROM seasons WHERE path = $1 AND number = $2 ORDER BY id LIMIT 1", path, number)
+	return season, err
+}
+
+// DeleteSeasonIfEmpty deletes a season that has no episodes left and returns its TV show ID.
+// sql.ErrNoRows is returned when the season still has episodes.
+func (r *Repository) DeleteSeasonIfEmpty(ctx context.Context, id int64) (int64, error) {
+	query := `DELETE FROM seasons WHERE id = $1
+	AND NOT EXISTS (SELECT 1 FROM episodes WHERE season_id = $1) RETURNING tvshow_id`
+	var tvshowID int64
+	err := r.db.QueryRowxContext(ctx, query, id).Scan(&tvshowID)
+	return tvshowID, err
+}
+
 // SaveSeason saves a season to the database
 func (r *Repository) SaveSeason(ctx context.Context, season *models.Season) (int64, error) {
 	query := `INSERT INTO seasons (tvshow_id, number, title, path)
@@ -153,10 +424,36 @@ func (r *Repository) SaveSeason(ctx context.Context, season *models.Season) (int
 	return id, err
 }
 
+// SetSeasonPoster sets the poster image file of a season
+func (r *Repository) SetSeasonPoster(ctx context.Context, id int64, poster sql.NullString) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE seasons SET poster_path = $1 WHERE id = $2", poster, id)
+	return err
+}
+
 // GetEpisodesBySeasonID retrieves all episodes for a season
 func (r *Repository) GetEpisodesBySeasonID(ctx context.Context, seasonID int64) ([]models.Episode, error) {
 	var episodes []models.Episode
-	err := r.db.SelectContext(ctx, &episodes, "SELECT * FROM episodes WHERE season_id = $1 ORDER BY number", seasonID)
+	err := r.db.SelectContext(ctx, &episodes, "SELECT * FROM episodes WHERE season_id = $1 AND missing_since IS NULL ORDER BY number", seasonID)
+	if err != nil {
+		return nil, err
+	}
+	return episodes, nil
+}
+
+// GetAllEpisodes retrieves all episodes from the database
+func (r *Repository) GetAllEpisodes(ctx context.Context) ([]models.Episode, error) {
+	var episodes []models.Episode
+	err := r.db.SelectContext(ctx, &episodes, "SELECT * FROM episodes")
+	if err != nil {
+		return nil, err
+	}
+	return episodes, nil
+}
+
+// GetEpisodesUnder retrieves the episodes whose file is path or inside it, at any depth
+func (r *Repository) GetEpisodesUnder(ctx context.Context, path string) ([]models.Episode, error) {
+	var episodes []models.Episode
+	err := r.db.SelectContext(ctx, &episodes, "SELECT * FROM episodes WHERE path = $1 OR path LIKE $2", path, likePrefix(path))
 	if err != nil {
 		return nil, err
 	}
@@ -172,9 +469,285 @@ func (r *Repository) GetEpisodeByPath(ctx context.Context, path string) (models.
 
 // SaveEpisode saves an episode to the database
 func (r *Repository) SaveEpisode(ctx context.Context, episode *models.Episode) (int64, error) {
-	query := `INSERT INTO episodes (season_id, number, title, path, file_size)
-	VALUES ($1, $2, $3, $4, $5) RETURNING id`
+	query := `INSERT INTO episodes (season_id, number, last_number, air_date, absolute_number, named_season, title, path, file_size, fingerprint)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
 	var id int64
-	err := r.db.QueryRowxContext(ctx, query, episode.SeasonID, episode.Number, episode.Title, episode.Path, episode.FileSize).Scan(&id)
+	err := r.db.QueryRowxContext(ctx, query, episode.SeasonID, episode.Number, episode.LastNumber, episode.AirDate, episode.AbsoluteNumber,
+		episode.NamedSeason, episode.Title, episode.Path, episode.FileSize, episode.Fingerprint).Scan(&id)
 	return id, err
 }
+
+// UpdateEpisodeMetadata stores the valid fields of meta on an episode; episodes
+// have no year
+func (r *Repository) UpdateEpisodeMetadata(ctx context.Context, id int64, meta models.Metadata) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE episodes SET title = COALESCE($1, title), air_date = COALESCE($2, air_date),
+		description = COALESCE($3, description), rating = COALESCE($4, rating),
+		imdb_id = COALESCE($5, imdb_id), tmdb_id = COALESCE($6, tmdb_id), tvdb_id = COALESCE($7, tvdb_id)
+	WHERE id = $8`, meta.Title, meta.AirDate, meta.Description, meta.Rating, meta.IMDbID, meta.TMDbID, meta.TVDbID, id)
+	return err
+}
+
+// FindMissingEpisodeByFingerprint finds an episode marked missing whose content fingerprint matches
+func (r *Repository) FindMissingEpisodeByFingerprint(ctx context.Context, fingerprint string) (models.Episode, error) {
+	var episode models.Episode
+	err := r.db.GetContext(ctx, &episode, `SELECT * FROM episodes
+	WHERE fingerprint = $1 AND missing_since IS NOT NULL ORDER BY missing_since DESC LIMIT 1`, fingerprint)
+	return episode, err
+}
+
+// UpdateEpisodePath moves an episode to a new path and season and clears its missing mark
+func (r *Repository) UpdateEpisodePath(ctx context.Context, id, seasonID int64, path string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE episodes SET season_id = $1, path = $2, missing_since = NULL WHERE id = $3", seasonID, path, id)
+	return err
+}
+
+// SetEpisodeNamedSeason stores the season given by an episode file's name
+func (r *Repository) SetEpisodeNamedSeason(ctx context.Context, id int64, season sql.NullInt64) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE episodes SET named_season = $1 WHERE id = $2", season, id)
+	return err
+}
+
+// UpdateEpisodeFingerprint stores the content fingerprint of an episode
+func (r *Repository) UpdateEpisodeFingerprint(ctx context.Context, id int64, fingerprint string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE episodes SET fingerprint = $1 WHERE id = $2", fingerprint, id)
+	return err
+}
+
+// SaveEpisodeInfo stores the duration, streams and chapters read from an
+// episode file's headers, replacing any streams and chapters stored before
+func (r *Repository) SaveEpisodeInfo(ctx context.Context, id int64, info models.MediaInfo) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "UPDATE episodes SET duration_ms = COALESCE($1, duration_ms) WHERE id = $2", info.DurationMS, id)
+	if err != nil {
+		return err
+	}
+	if err := saveStreams(ctx, tx, "episode_id", id, info.Streams); err != nil {
+		return err
+	}
+	if err := saveChapters(ctx, tx, "episode_id", id, info.Chapters); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetMediaChapters retrieves the chapters of a media file in file order
+func (r *Repository) GetMediaChapters(ctx context.Context, mediaID int64) ([]models.Chapter, error) {
+	var chapters []models.Chapter
+	err := r.db.SelectContext(ctx, &chapters, "SELECT * FROM chapters WHERE media_id = $1 ORDER BY chapter_index", mediaID)
+	return chapters, err
+}
+
+// GetEpisodeStreams retrieves the streams of an episode file in file order
+func (r *Repository) GetEpisodeStreams(ctx context.Context, episodeID int64) ([]models.MediaStream, error) {
+	var streams []models.MediaStream
+	err := r.db.SelectContext(ctx, &streams, "SELECT * FROM media_streams WHERE episode_id = $1 ORDER BY stream_index", episodeID)
+	return streams, err
+}
+
+// saveStreams replaces the streams of the media file or episode whose ID is in
+// the given column of media_streams
+func saveStreams(ctx context.Context, tx *sqlx.Tx, column string, id int64, streams []models.MediaStream) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM media_streams WHERE "+column+" = $1", id); err != nil {
+		return err
+	}
+	if len(streams) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO media_streams (`+column+`, stream_index, stream_type, codec, codec_id,
+		language, title, is_default, forced, width, height, frame_rate, channels, sample_rate)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, st := range streams {
+		_, err := stmt.ExecContext(ctx, id, st.Index, st.Type, st.Codec, st.CodecID, st.Language, st.Title, st.Default, st.Forced,
+			st.Width, st.Height, st.FrameRate, st.Channels, st.SampleRate)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveChapters replaces the chapters of the media file or episode whose ID is
+// in the given column of chapters
+func saveChapters(ctx context.Context, tx *sqlx.Tx, column string, id int64, chapters []models.Chapter) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM chapters WHERE "+column+" = $1", id); err != nil {
+		return err
+	}
+	if len(chapters) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT INTO chapters (`+column+`, chapter_index, start_ms, end_ms, title)
+	VALUES ($1, $2, $3, $4, $5)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, c := range chapters {
+		if _, err := stmt.ExecContext(ctx, id, c.Index, c.StartMS, c.EndMS, c.Title); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetMediaSubtitles replaces the subtitle files of a media file
+func (r *Repository) SetMediaSubtitles(ctx context.Context, mediaID int64, subtitles []models.Subtitle) error {
+	return r.setSubtitles(ctx, "media_id", mediaID, subtitles)
+}
+
+// GetMediaSubtitles retrieves the subtitle files of a media file by path
+func (r *Repository) GetMediaSubtitles(ctx context.Context, mediaID int64) ([]models.Subtitle, error) {
+	var subtitles []models.Subtitle
+	err := r.db.SelectContext(ctx, &subtitles, "SELECT * FROM subtitles WHERE media_id = $1 ORDER BY path", mediaID)
+	return subtitles, err
+}
+
+// SetEpisodeSubtitles replaces the subtitle files of an episode
+func (r *Repository) SetEpisodeSubtitles(ctx context.Context, episodeID int64, subtitles []models.Subtitle) error {
+	return r.setSubtitles(ctx, "episode_id", episodeID, subtitles)
+}
+
+// GetEpisodeSubtitles retrieves the subtitle files of an episode by path
+func (r *Repository) GetEpisodeSubtitles(ctx context.Context, episodeID int64) ([]models.Subtitle, error) {
+	var subtitles []models.Subtitle
+	err := r.db.SelectContext(ctx, &subtitles, "SELECT * FROM subtitles WHERE episode_id = $1 ORDER BY path", episodeID)
+	return subtitles, err
+}
+
+// GetSeasonSubtitles retrieves the subtitle files of all episodes in a season
+// by path
+func (r *Repository) GetSeasonSubtitles(ctx context.Context, seasonID int64) ([]models.Subtitle, error) {
+	var subtitles []models.Subtitle
+	err := r.db.SelectContext(ctx, &subtitles, `SELECT s.* FROM subtitles s JOIN episodes e ON e.id = s.episode_id
+	WHERE e.season_id = $1 ORDER BY s.path`, seasonID)
+	return subtitles, err
+}
+
+// GetSubtitleByID retrieves a subtitle file by its ID
+func (r *Repository) GetSubtitleByID(ctx context.Context, id int64) (models.Subtitle, error) {
+	var subtitle models.Subtitle
+	err := r.db.GetContext(ctx, &subtitle, "SELECT * FROM subtitles WHERE id = $1", id)
+	return subtitle, err
+}
+
+// setSubtitles replaces the subtitle files of the media file or episode whose ID
+// is in the given column of subtitles
+func (r *Repository) setSubtitles(ctx context.Context, column string, id int64, subtitles []models.Subtitle) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM subtitles WHERE "+column+" = $1", id); err != nil {
+		return err
+	}
+	if len(subtitles) > 0 {
+		stmt, err := tx.PrepareContext(ctx, `INSERT INTO subtitles (`+column+`, path, format, language, forced, sdh)
+		VALUES ($1, $2, $3, $4, $5, $6)`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, sub := range subtitles {
+			if _, err := stmt.ExecContext(ctx, id, sub.Path, sub.Format, sub.Language, sub.Forced, sub.SDH); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// SetEpisodeMissingSince marks an episode as missing from disk, or clears the mark when since is not valid
+func (r *Repository) SetEpisodeMissingSince(ctx context.Context, id int64, since sql.NullTime) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE episodes SET missing_since = $1 WHERE id = $2", since, id)
+	return err
+}
+
+// DeleteEpisode deletes an episode from the database
+func (r *Repository) DeleteEpisode(ctx context.Context, id int64) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM episodes WHERE id = $1", id)
+	return err
+}
+
+// CreateScanRun records the start of a scan run
+func (r *Repository) CreateScanRun(ctx context.Context, run *models.ScanRun) (int64, error) {
+	query := `INSERT INTO scan_runs (started_at, status)
+	VALUES ($1, $2) RETURNING id`
+	var id int64
+	err := r.db.QueryRowxContext(ctx, query, run.StartedAt, run.Status).Scan(&id)
+	return id, err
+}
+
+// FinishScanRun records the outcome of a scan run
+func (r *Repository) FinishScanRun(ctx context.Context, run *models.ScanRun) error {
+	query := `UPDATE scan_runs SET finished_at = $1, status = $2, added = $3, updated = $4,
+	removed = $5, errors = $6, warnings = $7, error = $8 WHERE id = $9`
+	_, err := r.db.ExecContext(ctx, query, run.FinishedAt, run.Status, run.Added, run.Updated,
+		run.Removed, run.Errors, run.Warnings, run.Error, run.ID)
+	return err
+}
+
+// GetRecentScanRuns retrieves the most recent scan runs, newest first
+func (r *Repository) GetRecentScanRuns(ctx context.Context, limit int) ([]models.ScanRun, error) {
+	var runs []models.ScanRun
+	err := r.db.SelectContext(ctx, &runs, "SELECT * FROM scan_runs ORDER BY started_at DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+// GetScanStates retrieves the state of every directory and file recorded by past scans
+func (r *Repository) GetScanStates(ctx context.Context) ([]models.ScanState, error) {
+	var states []models.ScanState
+	err := r.db.SelectContext(ctx, &states, "SELECT * FROM scan_state")
+	if err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+// SaveScanStates inserts or updates scan state entries in a single transaction
+func (r *Repository) SaveScanStates(ctx context.Context, states []models.ScanState) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareNamedContext(ctx, `INSERT INTO scan_state (path, is_dir, size, mod_time, rules, sidecars)
+	VALUES (:path, :is_dir, :size, :mod_time, :rules, :sidecars)
+	ON CONFLICT (path) DO UPDATE SET is_dir = EXCLUDED.is_dir, size = EXCLUDED.size, mod_time = EXCLUDED.mod_time,
+		rules = EXCLUDED.rules, sidecars = EXCLUDED.sidecars`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, state := range states {
+		if _, err := stmt.ExecContext(ctx, state); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteScanStates deletes the scan state entries for the given paths
+func (r *Repository) DeleteScanStates(ctx context.Context, paths []string) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM scan_state WHERE path = ANY($1)", pq.Array(paths))
+	return err
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EpisodeInfo is the episode numbering and title parsed from an episode file name
+type EpisodeInfo struct {
+	Season int
+	// HasSeason is set when the name gives the season, as in "S01E05" or "1x05".
+	// Otherwise Season is a guess: 1 for episode numbers alone, the year for
+	// daily shows, and 0 if there is no episode number either.
+	HasSeason bool
+	Episode   int // 0 if no episode number was found
+	// LastEpisode is the last episode in a multi-episode file such as
+	// "Show.S01E01E02.mkv"; it equals Episode for single episodes
+	LastEpisode int
+	// AirDate is set for daily shows named by date, such as "Show.2024.03.15.mkv"
+	AirDate time.Time
+	// Absolute is the absolute episode number of names like "[Group] Show - 137",
+	// common for anime; such episodes are also numbered as episodes of season 1
+	Absolute int
+	Title    string
+}
+
+// Episode numbering patterns, tried in order. Group 1 is the season (if any)
+// and group 2 the episode.
+var episodePatterns = []struct {
+	re *regexp.Regexp
+	// next matches a further episode of a multi-episode file directly after the
+	// previous one; group 1 is its number
+	next *regexp.Regexp
+	// season is used when the pattern has no season group
+	season int
+}{
+	// Show.S01E01, Show.S01E01E02, Show.S01E01-E03, Show.S01E01-02
+	{
+		re:   regexp.MustCompile(`(?i)(?:^|[^a-z0-9])s(\d{1,3})[ ._-]?e(\d{1,4})(?:[^0-9]|$)`),
+		next: regexp.MustCompile(`(?i)^(?:[ ._]?-?[ ._]?(?:s\d{1,3})?e(\d{1,4})(?:[^0-9]|$)|-(\d{1,4})(?:[^0-9a-z]|$))`),
+	},
+	// Show - 1x01, Show - 1x01-1x02
+	{
+		re:   regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(\d{1,2})x(\d{2,3})(?:[^0-9a-z]|$)`),
+		next: regexp.MustCompile(`(?i)^[ ._]?-[ ._]?(?:\d{1,2}x)?(\d{2,3})(?:[^0-9a-z]|$)`),
+	},
+	// Show.Season.1.Episode.5
+	{
+		re: regexp.MustCompile(`(?i)(?:^|[^a-z0-9])season[ ._-]?(\d{1,3})[ ._-]*episode[ ._-]?(\d{1,4})(?:[^0-9]|$)`),
+	},
+	// Show.E05, Show.Ep.5, Show.Episode.5 (assuming a single season)
+	{
+		re:     regexp.MustCompile(`(?i)(?:^|[^a-z0-9])()(?:e|ep|episode)[ ._-]?(\d{1,4})(?:[^0-9]|$)`),
+		next:   regexp.MustCompile(`(?i)^[ ._]?-?[ ._]?(?:e|ep)?(\d{1,4})(?:[^0-9a-z]|$)`),
+		season: 1,
+	},
+}
+
+// ExtractEpisodeInfo extracts the season, episode numbers and title from a file path.
+// Titles are taken from the text after the episode number with release details
+// removed, so "Show.S01E05.The.Title.720p.WEB.x264-GRP.mkv" gives "The Title".
+func ExtractEpisodeInfo(filePath string) EpisodeInfo {
+	name := stripReleaseExtension(filepath.Base(filePath))
+
+	for _, p := range episodePatterns {
+		m := p.re.FindStringSubmatchIndex(name)
+		if m == nil {
+			continue
+		}
+		info := EpisodeInfo{Season: p.season}
+		if m[2] < m[3] {
+			info.Season, _ = strconv.Atoi(name[m[2]:m[3]])
+			info.HasSeason = true
+		}
+		info.Episode, _ = strconv.Atoi(name[m[4]:m[5]])
+		info.LastEpisode = info.Episode
+
+		// Further episodes of a multi-episode file
+		end := m[5]
+		for p.next != nil {
+			n := p.next.FindStringSubmatchIndex(name[end:])
+			if n == nil {
+				break
+			}
+			group := 2
+			if n[2] < 0 {
+				group = 4
+			}
+			number, _ := strconv.Atoi(name[end+n[group] : end+n[group+1]])
+			if number <= info.LastEpisode {
+				break
+			}
+			// A bare number, as in "Show.S01E01-02", may start the title
+			// instead, as in "Show.S01E01-12.Days", so it only ends a range
+			// when nothing but release details follow it
+			bare := strings.IndexFunc(name[end+n[0]:end+n[group]], unicode.IsLetter) < 0
+			if bare && parseReleaseName(strings.TrimLeft(name[end+n[group+1]:], " ._-"), false).Title != "" {
+				break
+			}
+			info.LastEpisode = number
+			end += n[group+1]
+		}
+
+		info.Title = episodeTitle(name[end:], info)
+		return info
+	}
+
+	if m := datedEpisodeRe.FindStringSubmatchIndex(name); m != nil {
+		if info, ok := extractDatedEpisode(name, m); ok {
+			return info
+		}
+	}
+	if m := absoluteEpisodeRe.FindStringSubmatchIndex(name); m != nil && !yearRe.MatchString(name[m[2]:m[3]]) {
+		absolute, _ := strconv.Atoi(name[m[2]:m[3]])
+		info := EpisodeInfo{Season: 1, Episode: absolute, LastEpisode: absolute, Absolute: absolute}
+		end := m[3]
+		if m[4] >= 0 {
+			end = m[5] // version suffix
+		}
+		info.Title = episodeTitle(name[end:], info)
+		return info
+	}
+
+	// No clear episode info, use cleaned filename as title
+	return EpisodeInfo{Title: cleanTitle(filepath.Base(filePath))}
+}
+
+// extractSeasonFolderEpisode extracts the episode info of a file in the folder
+// of a season. Names like "The Expanse - 101 - Dulcinea.mkv" there give the
+// season and episode run together, so a three or four digit number starting
+// with the folder's season reads as SXXEYY. Fansub releases named "[Group] Show
+// - 137" keep their absolute numbers.
+func extractSeasonFolderEpisode(filePath string, season int) EpisodeInfo {
+	info := ExtractEpisodeInfo(filePath)
+	if info.Absolute < 100 || strings.HasPrefix(filepath.Base(filePath), "[") {
+		return info
+	}
+	if info.Absolute/100 != season || info.Absolute%100 == 0 {
+		return info
+	}
+	generic := info.Title == fmt.Sprintf("Episode %d", info.Absolute)
+	info.Season, info.HasSeason = season, true
+	info.Episode, info.Absolute = info.Absolute%100, 0
+	info.LastEpisode = info.Episode
+	if generic {
+		info.Title = fmt.Sprintf("Episode %d", info.Episode)
+	}
+	return info
+}
+
+// datedEpisodeRe matches an air date written year first, as in "Show.2024.03.15"
+// or "Show - 2024-03-15"
+var datedEpisodeRe = regexp.MustCompile(`(?:^|[^0-9])((?:19|20)\d\d)[ ._-](\d\d)[ ._-](\d\d)(?:[^0-9]|$)`)
+
+// extractDatedEpisode builds the episode info for a datedEpisodeRe match. Daily
+// shows are numbered by year, like their season folders, with no episode number.
+func extractDatedEpisode(name string, m []int) (EpisodeInfo, bool) {
+	date, err := time.Parse("2006-01-02", name[m[2]:m[3]]+"-"+name[m[4]:m[5]]+"-"+name[m[6]:m[7]])
+	if err != nil {
+		return EpisodeInfo{}, false
+	}
+	info := EpisodeInfo{Season: date.Year(), AirDate: date}
+	info.Title = parseReleaseName(strings.TrimLeft(name[m[7]:], " ._-"), false).Title
+	if info.Title == "" {
+		info.Title = date.Format("January 2, 2006")
+	}
+	return info, true
+}
+
+// absoluteEpisodeRe matches the absolute numbering of fansub releases, such as
+// "[Group] Show - 137 [1080p]" or "Show - 137v2"; the number must follow " - ".
+// Group 2 is the release version, if any.
+var absoluteEpisodeRe = regexp.MustCompile(`\s-\s(\d{1,4})(v\d)?(?:[\s\[(._-]|$)`)
+
+// episodeTitle cleans up the text after an episode number, falling back to a
+// generic title when there is none
+func episodeTitle(rest string, info EpisodeInfo) string {
+	if title := parseReleaseName(strings.TrimLeft(rest, " ._-"), false).Title; title != "" {
+		return title
+	}
+	if info.LastEpisode > info.Episode {
+		return fmt.Sprintf("Episodes %d–%d", info.Episode, info.LastEpisode)
+	}
+	return fmt.Sprintf("Episode %d", info.Episode)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtractEpisodeInfo(t *testing.T) {
+	tests := []struct {
+		path string
+		want EpisodeInfo
+	}{
+		// Single episodes
+		{"/tv/Show/Season 1/Show.S01E05.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 5, LastEpisode: 5, Title: "Episode 5"}},
+		{"Show.S01E05.The.Title.720p.WEB.x264-GRP.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 5, LastEpisode: 5, Title: "The Title"}},
+		{"Show - S02E10 - The Title.mkv", EpisodeInfo{Season: 2, HasSeason: true, Episode: 10, LastEpisode: 10, Title: "The Title"}},
+		{"show.s10e100.mkv", EpisodeInfo{Season: 10, HasSeason: true, Episode: 100, LastEpisode: 100, Title: "Episode 100"}},
+		{"Show S01 E05 Title.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 5, LastEpisode: 5, Title: "Title"}},
+		{"Show.2019.S01E01.1080p.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 1, Title: "Episode 1"}},
+		{"Show - 1x05 - Title.avi", EpisodeInfo{Season: 1, HasSeason: true, Episode: 5, LastEpisode: 5, Title: "Title"}},
+		{"Show.Season.2.Episode.3.Title.mkv", EpisodeInfo{Season: 2, HasSeason: true, Episode: 3, LastEpisode: 3, Title: "Title"}},
+		{"Show.E07.Title.mkv", EpisodeInfo{Season: 1, Episode: 7, LastEpisode: 7, Title: "Title"}},
+		{"Show Episode 12.mkv", EpisodeInfo{Season: 1, Episode: 12, LastEpisode: 12, Title: "Episode 12"}},
+		// Multi-episode files
+		{"Show.S02E01E02.mkv", EpisodeInfo{Season: 2, HasSeason: true, Episode: 1, LastEpisode: 2, Title: "Episodes 1–2"}},
+		{"Show.S02E01E02E03.Title.mkv", EpisodeInfo{Season: 2, HasSeason: true, Episode: 1, LastEpisode: 3, Title: "Title"}},
+		{"Show.S01E01-E03.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 3, Title: "Episodes 1–3"}},
+		{"Show.S01E01-02.720p.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 2, Title: "Episodes 1–2"}},
+		{"Show - S01E01 - E02 - Title.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 2, Title: "Title"}},
+		{"Show.S01E01.E02.Title.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 2, Title: "Title"}},
+		{"Show - 1x01-1x02 - Title.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 2, Title: "Title"}},
+		{"Show - 1x01-02.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 2, Title: "Episodes 1–2"}},
+		{"Show.E01-E02.mkv", EpisodeInfo{Season: 1, Episode: 1, LastEpisode: 2, Title: "Episodes 1–2"}},
+		// Daily shows
+		{"Show.2024.03.15.mkv", EpisodeInfo{Season: 2024, AirDate: date(2024, 3, 15), Title: "March 15, 2024"}},
+		{"Show - 2024-03-15 - Guest Name.720p.WEB.mkv", EpisodeInfo{Season: 2024, AirDate: date(2024, 3, 15), Title: "Guest Name"}},
+		{"The.Daily.Show.2019.11.04.Some.Guest.1080p.WEB.x264-GRP.mkv", EpisodeInfo{Season: 2019, AirDate: date(2019, 11, 4), Title: "Some Guest"}},
+		// Absolute numbering
+		{"[Group] Show - 137 [1080p].mkv", EpisodeInfo{Season: 1, Episode: 137, LastEpisode: 137, Absolute: 137, Title: "Episode 137"}},
+		{"[Group] Show - 05v2 (1080p) [ABCD1234].mkv", EpisodeInfo{Season: 1, Episode: 5, LastEpisode: 5, Absolute: 5, Title: "Episode 5"}},
+		{"Show - 1024 - The Title.mkv", EpisodeInfo{Season: 1, Episode: 1024, LastEpisode: 1024, Absolute: 1024, Title: "The Title"}},
+		{"Show - 2019 - Recap.mkv", EpisodeInfo{Title: "Show"}},
+		// Season and episode numbering wins over other schemes
+		{"[Group] Show - S02E03 - 137 [1080p].mkv", EpisodeInfo{Season: 2, HasSeason: true, Episode: 3, LastEpisode: 3, Title: "137"}},
+		// A following number that is not a later episode is part of the title
+		{"Show.S01E01-12.Days.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 1, Title: "12 Days"}},
+		{"Show - 1x01-02 - Title.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 1, Title: "02 - Title"}},
+		{"Show.S01E05-03.Title.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 5, LastEpisode: 5, Title: "03 Title"}},
+		{"Show.S01E01.2001.A.Space.Title.mkv", EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 1, Title: "2001 A Space Title"}},
+		// No episode number
+		{"Show.Special.mkv", EpisodeInfo{Title: "Show"}},
+	}
+	for _, tt := range tests {
+		if got := ExtractEpisodeInfo(tt.path); got != tt.want {
+			t.Errorf("ExtractEpisodeInfo(%q) = %+v, want %+v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestExtractSeasonFolderEpisode(t *testing.T) {
+	tests := []struct {
+		path   string
+		season int
+		want   EpisodeInfo
+	}{
+		{"The Expanse - 101 - Dulcinea.mkv", 1, EpisodeInfo{Season: 1, HasSeason: true, Episode: 1, LastEpisode: 1, Title: "Dulcinea"}},
+		{"Show - 1012.mkv", 10, EpisodeInfo{Season: 10, HasSeason: true, Episode: 12, LastEpisode: 12, Title: "Episode 12"}},
+		// Numbers that do not start with the folder's season stay absolute
+		{"Show - 205 - Title.mkv", 1, EpisodeInfo{Season: 1, Episode: 205, LastEpisode: 205, Absolute: 205, Title: "Title"}},
+		{"[Group] Show - 137 [1080p].mkv", 1, EpisodeInfo{Season: 1, Episode: 137, LastEpisode: 137, Absolute: 137, Title: "Episode 137"}},
+		{"Show.S01E05.mkv", 1, EpisodeInfo{Season: 1, HasSeason: true, Episode: 5, LastEpisode: 5, Title: "Episode 5"}},
+	}
+	for _, tt := range tests {
+		if got := extractSeasonFolderEpisode(tt.path, tt.season); got != tt.want {
+			t.Errorf("extractSeasonFolderEpisode(%q, %d) = %+v, want %+v", tt.path, tt.season, got, tt.want)
+		}
+	}
+}
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestScanTVShowsStoresEpisodeRanges(t *testing.T) {
+	cfg := newTestLibrary(t)
+	season := filepath.Join(cfg.TVDir, "Show", "Season 2")
+	writeFile(t, filepath.Join(season, "Show.S02E01E02.mkv"), "double")
+	writeFile(t, filepath.Join(season, "Show.S02E03.mkv"), "single")
+
+	repo := newFakeRepo()
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	double, err := repo.GetEpisodeByPath(context.Background(), filepath.Join(season, "Show.S02E01E02.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if double.Number != 1 || !double.LastNumber.Valid || double.LastNumber.Int64 != 2 {
+		t.Errorf("double episode saved as %d-%v, want 1-2", double.Number, double.LastNumber)
+	}
+	single, err := repo.GetEpisodeByPath(context.Background(), filepath.Join(season, "Show.S02E03.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if single.Number != 3 || single.LastNumber.Valid {
+		t.Errorf("single episode saved as %d-%v, want 3", single.Number, single.LastNumber)
+	}
+}
+
+func TestScanTVShowsStoresAirDatesAndAbsoluteNumbers(t *testing.T) {
+	cfg := newTestLibrary(t)
+	daily := filepath.Join(cfg.TVDir, "Daily Show", "Season 2024", "Daily.Show.2024.03.15.mkv")
+	anime := filepath.Join(cfg.TVDir, "Anime", "Season 1", "[Group] Anime - 137 [1080p].mkv")
+	writeFile(t, daily, "daily")
+	writeFile(t, anime, "anime")
+
+	repo := newFakeRepo()
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	episode, err := repo.GetEpisodeByPath(context.Background(), daily)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !episode.AirDate.Valid || !episode.AirDate.Time.Equal(date(2024, 3, 15)) || episode.AbsoluteNumber.Valid {
+		t.Errorf("daily episode saved with air date %v and absolute number %v", episode.AirDate, episode.AbsoluteNumber)
+	}
+	episode, err = repo.GetEpisodeByPath(context.Background(), anime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if episode.AbsoluteNumber.Int64 != 137 || episode.Number != 137 || episode.AirDate.Valid {
+		t.Errorf("anime episode saved as %d with absolute number %v and air date %v", episode.Number, episode.AbsoluteNumber, episode.AirDate)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"sync"
+)
+
+// Event names published on the EventBus
+const (
+	EventScanProgress = "scan-progress"
+)
+
+// Event is a message published on the EventBus
+type Event struct {
+	Name string
+	Data any
+}
+
+// ScanProgress reports how far a running scan has got
+type ScanProgress struct {
+	Dir    string // directory currently being scanned
+	Seen   int    // video files examined so far
+	Added  int    // rows added so far
+	Errors int    // errors so far
+	Done   bool   // set on the final event of a scan
+	// Cancelled or Failed is set on the final event of a scan that was
+	// cancelled, or that could not reconcile the library completely
+	Cancelled bool
+	Failed    bool
+}
+
+// EventBus fans published events out to every subscriber. Publishing never blocks:
+// a subscriber that falls behind misses events rather than stalling the publisher.
+type EventBus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// NewEventBus creates a new EventBus
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a subscriber with the given channel buffer size. The returned
+// function unsubscribes and closes the channel.
+func (b *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends an event to all subscribers. It is safe to call on a nil bus.
+func (b *EventBus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
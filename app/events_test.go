@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventBusFansOutAndUnsubscribes(t *testing.T) {
+	bus := NewEventBus()
+	a, unsubscribeA := bus.Subscribe(1)
+	b, unsubscribeB := bus.Subscribe(1)
+	defer unsubscribeB()
+
+	bus.Publish(Event{Name: "test", Data: 1})
+	if e := <-a; e.Data != 1 {
+		t.Errorf("subscriber a got %v, want 1", e.Data)
+	}
+	if e := <-b; e.Data != 1 {
+		t.Errorf("subscriber b got %v, want 1", e.Data)
+	}
+
+	unsubscribeA()
+	unsubscribeA() // unsubscribing twice is harmless
+	if _, ok := <-a; ok {
+		t.Errorf("channel still open after unsubscribe")
+	}
+
+	// A full subscriber drops events instead of blocking the publisher
+	bus.Publish(Event{Name: "test", Data: 2})
+	bus.Publish(Event{Name: "test", Data: 3})
+	if e := <-b; e.Data != 2 {
+		t.Errorf("subscriber b got %v, want 2", e.Data)
+	}
+}
+
+func TestScanMediaPublishesProgress(t *testing.T) {
+	cfg := newTestLibrary(t)
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Alien.1979.mkv"), "alien")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Aliens.1986.mkv"), "aliens")
+	writeFile(t, filepath.Join(cfg.TVDir, "Show", "Season 1", "Show.S01E01.mkv"), "pilot")
+
+	bus := NewEventBus()
+	events, unsubscribe := bus.Subscribe(100)
+	defer unsubscribe()
+
+	if _, err := ScanMedia(context.Background(), newFakeRepo(), cfg, bus, false); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []ScanProgress
+	for len(progress) == 0 || !progress[len(progress)-1].Done {
+		select {
+		case e := <-events:
+			if e.Name != EventScanProgress {
+				t.Fatalf("unexpected event %q", e.Name)
+			}
+			progress = append(progress, e.Data.(ScanProgress))
+		default:
+			t.Fatalf("scan finished without a final progress event; got %+v", progress)
+		}
+	}
+
+	if len(progress) != 4 {
+		t.Fatalf("got %d progress events, want one per file plus a final one: %+v", len(progress), progress)
+	}
+	if progress[0].Dir != cfg.MoviesDir || progress[0].Seen != 1 {
+		t.Errorf("first event = %+v, want 1 file seen in %s", progress[0], cfg.MoviesDir)
+	}
+	if dir := filepath.Join(cfg.TVDir, "Show", "Season 1"); progress[2].Dir != dir {
+		t.Errorf("third event dir = %q, want %q", progress[2].Dir, dir)
+	}
+	final := progress[len(progress)-1]
+	if final.Seen != 3 || final.Added != 3 || final.Errors != 0 || final.Cancelled || final.Failed {
+		t.Errorf("final event = %+v, want 3 seen, 3 added, 0 errors", final)
+	}
+}
+
+func TestCancelledScanPublishesCancelledProgress(t *testing.T) {
+	cfg := newTestLibrary(t)
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Alien.1979.mkv"), "alien")
+
+	bus := NewEventBus()
+	events, unsubscribe := bus.Subscribe(100)
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ScanMedia(ctx, newFakeRepo(), cfg, bus, false)
+
+	var final ScanProgress
+	for !final.Done {
+		select {
+		case e := <-events:
+			final = e.Data.(ScanProgress)
+		default:
+			t.Fatal("scan finished without a final progress event")
+		}
+	}
+	if !final.Cancelled || final.Failed {
+		t.Errorf("final event = %+v, want a cancelled scan", final)
+	}
+}
+
+func TestWriteSSERendersScanStates(t *testing.T) {
+	tests := []struct {
+		progress ScanProgress
+		want     string
+		removed  bool
+	}{
+		{ScanProgress{Dir: "/media/tv/Show"}, "Scanning…", false},
+		{ScanProgress{Done: true}, "Scan complete", true},
+		{ScanProgress{Done: true, Cancelled: true}, "Scan cancelled", true},
+		{ScanProgress{Done: true, Failed: true}, "Scan failed", true},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		if err := writeSSE(rec, httptest.NewRequest(http.MethodGet, "/events", nil), Event{Name: EventScanProgress, Data: tt.progress}); err != nil {
+			t.Fatal(err)
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, tt.want) {
+			t.Errorf("event for %+v = %q, want %q", tt.progress, body, tt.want)
+		}
+		// The toast of a scan that ended goes away by itself
+		if removed := strings.Contains(body, `remove-me="8s"`); removed != tt.removed {
+			t.Errorf("event for %+v removes itself: %v, want %v", tt.progress, removed, tt.removed)
+		}
+	}
+}
+
+func TestEventsHandlerStreamsScanProgress(t *testing.T) {
+	bus := NewEventBus()
+	h := NewHandlers(nil, nil, bus)
+	server := httptest.NewServer(http.HandlerFunc(h.EventsHandler))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", ct)
+	}
+
+	bus.Publish(Event{Name: EventScanProgress, Data: ScanProgress{Dir: "/media/tv/Show", Seen: 7, Added: 2}})
+
+	var lines []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" && len(lines) > 0 {
+			break
+		}
+		lines = append(lines, line)
+	}
+	body := strings.Join(lines, "\n")
+	if lines[0] != "event: scan-progress" {
+		t.Errorf("first line = %q, want the event name", lines[0])
+	}
+	for _, want := range []string{"/media/tv/Show", "7 files seen, 2 added"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("event %q does not contain %q", body, want)
+		}
+	}
+}
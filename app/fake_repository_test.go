@@ -0,0 +1,915 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"transogov2/app/models"
+)
+
+var _ MediaRepository = (*fakeRepo)(nil)
+
+// fakeRepo is an in-memory MediaRepository for scanner tests
+type fakeRepo struct {
+	mu       sync.Mutex
+	nextID   int64
+	media    map[int64]models.Media
+	tvshows  map[int64]models.TVShow
+	seasons  map[int64]models.Season
+	episodes map[int64]models.Episode
+	scanRuns []models.ScanRun
+	states   map[string]models.ScanState
+	// Streams, chapters and subtitle files of media files and of episodes, by
+	// their ID
+	mediaStreams     map[int64][]models.MediaStream
+	episodeStreams   map[int64][]models.MediaStream
+	mediaChapters    map[int64][]models.Chapter
+	episodeChapters  map[int64][]models.Chapter
+	mediaSubtitles   map[int64][]models.Subtitle
+	episodeSubtitles map[int64][]models.Subtitle
+}
+
+func newFakeRepo() *fakeRepo {
+	return &fakeRepo{
+		media:            make(map[int64]models.Media),
+		tvshows:          make(map[int64]models.TVShow),
+		seasons:          make(map[int64]models.Season),
+		episodes:         make(map[int64]models.Episode),
+		states:           make(map[string]models.ScanState),
+		mediaStreams:     make(map[int64][]models.MediaStream),
+		episodeStreams:   make(map[int64][]models.MediaStream),
+		mediaChapters:    make(map[int64][]models.Chapter),
+		episodeChapters:  make(map[int64][]models.Chapter),
+		mediaSubtitles:   make(map[int64][]models.Subtitle),
+		episodeSubtitles: make(map[int64][]models.Subtitle),
+	}
+}
+
+func (f *fakeRepo) id() int64 {
+	f.nextID++
+	return f.nextID
+}
+
+func (f *fakeRepo) SaveMedia(ctx context.Context, media *models.Media) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m := *media
+	m.ID = f.id()
+	f.media[m.ID] = m
+	return m.ID, nil
+}
+
+func (f *fakeRepo) GetMediaByPath(ctx context.Context, path string) (models.Media, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.media {
+		if m.Path == path {
+			return m, nil
+		}
+	}
+	return models.Media{}, sql.ErrNoRows
+}
+
+func (f *fakeRepo) GetMediaUnder(ctx context.Context, path string) ([]models.Media, error) {
+	media, _ := f.GetAllMedia(ctx)
+	var under []models.Media
+	for _, m := range media {
+		if m.Path == path || isWithin(path, m.Path) {
+			under = append(under, m)
+		}
+	}
+	return under, nil
+}
+
+func (f *fakeRepo) GetMediaIn(ctx context.Context, dir string) ([]models.Media, error) {
+	media, _ := f.GetAllMedia(ctx)
+	var in []models.Media
+	for _, m := range media {
+		if filepath.Dir(m.Path) == dir {
+			in = append(in, m)
+		}
+	}
+	return in, nil
+}
+
+func (f *fakeRepo) GetMoviesByTitle(ctx context.Context, title string) ([]models.Media, error) {
+	media, _ := f.GetAllMedia(ctx)
+	var movies []models.Media
+	for _, m := range media {
+		if m.MediaType == models.MediaTypeMovie && strings.EqualFold(m.Title, title) {
+			movies = append(movies, m)
+		}
+	}
+	return movies, nil
+}
+
+func (f *fakeRepo) GetAllMedia(ctx context.Context) ([]models.Media, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var media []models.Media
+	for _, m := range f.media {
+		media = append(media, m)
+	}
+	sort.Slice(media, func(i, j int) bool { return media[i].ID < media[j].ID })
+	return media, nil
+}
+
+func (f *fakeRepo) GetMediaByType(ctx context.Context, mediaType string) ([]models.Media, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var media []models.Media
+	for _, m := range f.media {
+		if m.MediaType == mediaType && !m.MissingSince.Valid && !m.ParentID.Valid && !m.VersionOf.Valid {
+			media = append(media, m)
+		}
+	}
+	sort.Slice(media, func(i, j int) bool { return media[i].ID < media[j].ID })
+	return media, nil
+}
+
+func (f *fakeRepo) GetMediaByID(ctx context.Context, id int64) (models.Media, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return models.Media{}, sql.ErrNoRows
+	}
+	return m, nil
+}
+
+func (f *fakeRepo) GetMediaChildren(ctx context.Context, parentID int64) ([]models.Media, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var media []models.Media
+	for _, m := range f.media {
+		if m.ParentID.Valid && m.ParentID.Int64 == parentID && !m.MissingSince.Valid {
+			media = append(media, m)
+		}
+	}
+	sort.Slice(media, func(i, j int) bool {
+		a, b := media[i], media[j]
+		if a.ExtraType != b.ExtraType {
+			return !a.ExtraType.Valid || (b.ExtraType.Valid && a.ExtraType.String < b.ExtraType.String)
+		}
+		if a.Part != b.Part {
+			return a.Part.Int64 < b.Part.Int64
+		}
+		if a.Title != b.Title {
+			return a.Title < b.Title
+		}
+		return a.Path < b.Path
+	})
+	return media, nil
+}
+
+func (f *fakeRepo) LinkMedia(ctx context.Context, id int64, parentID, part sql.NullInt64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	m.ParentID = parentID
+	m.Part = part
+	f.media[id] = m
+	return nil
+}
+
+func (f *fakeRepo) GetMediaVersions(ctx context.Context, id int64) ([]models.Media, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var media []models.Media
+	for _, m := range f.media {
+		if m.VersionOf.Valid && m.VersionOf.Int64 == id && !m.MissingSince.Valid {
+			media = append(media, m)
+		}
+	}
+	sort.Slice(media, func(i, j int) bool { return media[i].ID < media[j].ID })
+	return media, nil
+}
+
+func (f *fakeRepo) SetMediaVersionOf(ctx context.Context, id int64, versionOf sql.NullInt64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	m.VersionOf = versionOf
+	f.media[id] = m
+	return nil
+}
+
+func (f *fakeRepo) SetMediaMissingSince(ctx context.Context, id int64, since sql.NullTime) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	m.MissingSince = since
+	f.media[id] = m
+	return nil
+}
+
+func (f *fakeRepo) DeleteMedia(ctx context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.media, id)
+	delete(f.mediaStreams, id)
+	delete(f.mediaChapters, id)
+	delete(f.mediaSubtitles, id)
+	for _, m := range f.media {
+		if m.ParentID.Valid && m.ParentID.Int64 == id {
+			m.ParentID = sql.NullInt64{}
+		}
+		if m.VersionOf.Valid && m.VersionOf.Int64 == id {
+			m.VersionOf = sql.NullInt64{}
+		}
+		f.media[m.ID] = m
+	}
+	return nil
+}
+
+func (f *fakeRepo) SaveTVShow(ctx context.Context, tvshow *models.TVShow) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := *tvshow
+	s.ID = f.id()
+	f.tvshows[s.ID] = s
+	return s.ID, nil
+}
+
+func (f *fakeRepo) GetTVShowByPath(ctx context.Context, path string) (models.TVShow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.tvshows {
+		if s.Path == path {
+			return s, nil
+		}
+	}
+	return models.TVShow{}, sql.ErrNoRows
+}
+
+func (f *fakeRepo) GetAllTVShows(ctx context.Context) ([]models.TVShow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var shows []models.TVShow
+	for _, s := range f.tvshows {
+		shows = append(shows, s)
+	}
+	sort.Slice(shows, func(i, j int) bool { return shows[i].ID < shows[j].ID })
+	return shows, nil
+}
+
+func (f *fakeRepo) GetTVShowByID(ctx context.Context, id int64) (models.TVShow, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.tvshows[id]
+	if !ok {
+		return models.TVShow{}, sql.ErrNoRows
+	}
+	return s, nil
+}
+
+func (f *fakeRepo) SetTVShowEpisodeOrder(ctx context.Context, id int64, order string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.tvshows[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	s.EpisodeOrder = order
+	f.tvshows[id] = s
+	return nil
+}
+
+func (f *fakeRepo) DeleteTVShowIfEmpty(ctx context.Context, id int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.seasons {
+		if s.TVShowID == id {
+			return false, nil
+		}
+	}
+	_, ok := f.tvshows[id]
+	delete(f.tvshows, id)
+	return ok, nil
+}
+
+func (f *fakeRepo) GetSeasonsByTVShowID(ctx context.Context, tvshowID int64) ([]models.Season, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var seasons []models.Season
+	for _, s := range f.seasons {
+		if s.TVShowID == tvshowID {
+			seasons = append(seasons, s)
+		}
+	}
+	sort.Slice(seasons, func(i, j int) bool { return seasons[i].Number < seasons[j].Number })
+	return seasons, nil
+}
+
+func (f *fakeRepo) GetSeasonByID(ctx context.Context, id int64) (models.Season, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.seasons[id]
+	if !ok {
+		return models.Season{}, sql.ErrNoRows
+	}
+	return s, nil
+}
+
+func (f *fakeRepo) GetSeasonByPath(ctx context.Context, path string) (models.Season, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.seasons {
+		if s.Path == path {
+			return s, nil
+		}
+	}
+	return models.Season{}, sql.ErrNoRows
+}
+
+func (f *fakeRepo) GetSeasonByPathAndNumber(ctx context.Context, path string, number int) (models.Season, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found models.Season
+	for _, s := range f.seasons {
+		if s.Path == path && s.Number == number && (found.ID == 0 || s.ID < found.ID) {
+			found = s
+		}
+	}
+	if found.ID == 0 {
+		return models.Season{}, sql.ErrNoRows
+	}
+	return found, nil
+}
+
+func (f *fakeRepo) SaveSeason(ctx context.Context, season *models.Season) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := *season
+	s.ID = f.id()
+	f.seasons[s.ID] = s
+	return s.ID, nil
+}
+
+func (f *fakeRepo) SetSeasonPoster(ctx context.Context, id int64, poster sql.NullString) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.seasons[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	s.PosterPath = poster
+	f.seasons[id] = s
+	return nil
+}
+
+func (f *fakeRepo) DeleteSeasonIfEmpty(ctx context.Context, id int64) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.episodes {
+		if e.SeasonID == id {
+			return 0, sql.ErrNoRows
+		}
+	}
+	s, ok := f.seasons[id]
+	if !ok {
+		return 0, sql.ErrNoRows
+	}
+	delete(f.seasons, id)
+	return s.TVShowID, nil
+}
+
+func (f *fakeRepo) GetEpisodesBySeasonID(ctx context.Context, seasonID int64) ([]models.Episode, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var episodes []models.Episode
+	for _, e := range f.episodes {
+		if e.SeasonID == seasonID {
+			episodes = append(episodes, e)
+		}
+	}
+	sort.Slice(episodes, func(i, j int) bool { return episodes[i].Number < episodes[j].Number })
+	return episodes, nil
+}
+
+func (f *fakeRepo) GetEpisodeByPath(ctx context.Context, path string) (models.Episode, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.episodes {
+		if e.Path == path {
+			return e, nil
+		}
+	}
+	return models.Episode{}, sql.ErrNoRows
+}
+
+func (f *fakeRepo) SaveEpisode(ctx context.Context, episode *models.Episode) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e := *episode
+	e.ID = f.id()
+	f.episodes[e.ID] = e
+	return e.ID, nil
+}
+
+func (f *fakeRepo) GetEpisodesUnder(ctx context.Context, path string) ([]models.Episode, error) {
+	episodes, _ := f.GetAllEpisodes(ctx)
+	var under []models.Episode
+	for _, e := range episodes {
+		if e.Path == path || isWithin(path, e.Path) {
+			under = append(under, e)
+		}
+	}
+	return under, nil
+}
+
+func (f *fakeRepo) GetAllEpisodes(ctx context.Context) ([]models.Episode, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var episodes []models.Episode
+	for _, e := range f.episodes {
+		episodes = append(episodes, e)
+	}
+	sort.Slice(episodes, func(i, j int) bool { return episodes[i].ID < episodes[j].ID })
+	return episodes, nil
+}
+
+func (f *fakeRepo) SetEpisodeMissingSince(ctx context.Context, id int64, since sql.NullTime) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.episodes[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	e.MissingSince = since
+	f.episodes[id] = e
+	return nil
+}
+
+func (f *fakeRepo) DeleteEpisode(ctx context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.episodes, id)
+	delete(f.episodeStreams, id)
+	delete(f.episodeChapters, id)
+	delete(f.episodeSubtitles, id)
+	return nil
+}
+
+func (f *fakeRepo) FindMissingMediaByFingerprint(ctx context.Context, fingerprint string) (models.Media, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, m := range f.media {
+		if m.MissingSince.Valid && m.Fingerprint.String == fingerprint {
+			return m, nil
+		}
+	}
+	return models.Media{}, sql.ErrNoRows
+}
+
+func (f *fakeRepo) UpdateMediaPath(ctx context.Context, id int64, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	m.Path = path
+	m.MissingSince = sql.NullTime{}
+	f.media[id] = m
+	return nil
+}
+
+func (f *fakeRepo) UpdateMediaFingerprint(ctx context.Context, id int64, fingerprint string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	m.Fingerprint = sql.NullString{String: fingerprint, Valid: true}
+	f.media[id] = m
+	return nil
+}
+
+func (f *fakeRepo) GetMediaWithoutRelease(ctx context.Context) ([]models.Media, error) {
+	media, _ := f.GetAllMedia(ctx)
+	var without []models.Media
+	for _, m := range media {
+		if !m.ReleaseParsed && !m.MissingSince.Valid {
+			without = append(without, m)
+		}
+	}
+	return without, nil
+}
+
+func (f *fakeRepo) SetMediaRelease(ctx context.Context, id int64, release models.Release) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	keep := func(field *sql.NullString, value sql.NullString) {
+		if !field.Valid {
+			*field = value
+		}
+	}
+	keep(&m.Resolution, release.Resolution)
+	keep(&m.Source, release.Source)
+	keep(&m.VideoCodec, release.VideoCodec)
+	keep(&m.AudioCodec, release.AudioCodec)
+	keep(&m.ReleaseGroup, release.ReleaseGroup)
+	keep(&m.Edition, release.Edition)
+	m.HDR = m.HDR || release.HDR
+	m.ReleaseParsed = true
+	f.media[id] = m
+	return nil
+}
+
+func (f *fakeRepo) SaveMediaInfo(ctx context.Context, id int64, info models.MediaInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if info.DurationMS.Valid {
+		m.DurationMS = info.DurationMS
+	}
+	if info.Resolution.Valid {
+		m.Resolution = info.Resolution
+	}
+	if info.VideoCodec.Valid {
+		m.VideoCodec = info.VideoCodec
+	}
+	if info.AudioCodec.Valid {
+		m.AudioCodec = info.AudioCodec
+	}
+	f.media[id] = m
+	f.mediaStreams[id] = f.streamsOf(info.Streams, sql.NullInt64{Int64: id, Valid: true}, sql.NullInt64{})
+	f.mediaChapters[id] = f.chaptersOf(info.Chapters, sql.NullInt64{Int64: id, Valid: true}, sql.NullInt64{})
+	return nil
+}
+
+func (f *fakeRepo) GetMediaStreams(ctx context.Context, mediaID int64) ([]models.MediaStream, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mediaStreams[mediaID], nil
+}
+
+func (f *fakeRepo) GetMediaChapters(ctx context.Context, mediaID int64) ([]models.Chapter, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mediaChapters[mediaID], nil
+}
+
+func (f *fakeRepo) SaveEpisodeInfo(ctx context.Context, id int64, info models.MediaInfo) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.episodes[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if info.DurationMS.Valid {
+		e.DurationMS = info.DurationMS
+	}
+	f.episodes[id] = e
+	f.episodeStreams[id] = f.streamsOf(info.Streams, sql.NullInt64{}, sql.NullInt64{Int64: id, Valid: true})
+	f.episodeChapters[id] = f.chaptersOf(info.Chapters, sql.NullInt64{}, sql.NullInt64{Int64: id, Valid: true})
+	return nil
+}
+
+func (f *fakeRepo) GetEpisodeStreams(ctx context.Context, episodeID int64) ([]models.MediaStream, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.episodeStreams[episodeID], nil
+}
+
+// streamsOf gives streams IDs and their owner, as saving them would
+func (f *fakeRepo) streamsOf(streams []models.MediaStream, mediaID, episodeID sql.NullInt64) []models.MediaStream {
+	saved := make([]models.MediaStream, len(streams))
+	for i, st := range streams {
+		st.ID = f.id()
+		st.MediaID, st.EpisodeID = mediaID, episodeID
+		saved[i] = st
+	}
+	return saved
+}
+
+// chaptersOf gives chapters IDs and their owner, as saving them would
+func (f *fakeRepo) chaptersOf(chapters []models.Chapter, mediaID, episodeID sql.NullInt64) []models.Chapter {
+	saved := make([]models.Chapter, len(chapters))
+	for i, c := range chapters {
+		c.ID = f.id()
+		c.MediaID, c.EpisodeID = mediaID, episodeID
+		saved[i] = c
+	}
+	return saved
+}
+
+func (f *fakeRepo) SetMediaSubtitles(ctx context.Context, mediaID int64, subtitles []models.Subtitle) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.media[mediaID]; !ok {
+		return sql.ErrNoRows
+	}
+	f.mediaSubtitles[mediaID] = f.subtitlesOf(subtitles, sql.NullInt64{Int64: mediaID, Valid: true}, sql.NullInt64{})
+	return nil
+}
+
+func (f *fakeRepo) GetMediaSubtitles(ctx context.Context, mediaID int64) ([]models.Subtitle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.mediaSubtitles[mediaID], nil
+}
+
+func (f *fakeRepo) SetEpisodeSubtitles(ctx context.Context, episodeID int64, subtitles []models.Subtitle) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.episodes[episodeID]; !ok {
+		return sql.ErrNoRows
+	}
+	f.episodeSubtitles[episodeID] = f.subtitlesOf(subtitles, sql.NullInt64{}, sql.NullInt64{Int64: episodeID, Valid: true})
+	return nil
+}
+
+func (f *fakeRepo) GetEpisodeSubtitles(ctx context.Context, episodeID int64) ([]models.Subtitle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.episodeSubtitles[episodeID], nil
+}
+
+func (f *fakeRepo) GetSeasonSubtitles(ctx context.Context, seasonID int64) ([]models.Subtitle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var subtitles []models.Subtitle
+	for id, subs := range f.episodeSubtitles {
+		if f.episodes[id].SeasonID == seasonID {
+			subtitles = append(subtitles, subs...)
+		}
+	}
+	sort.Slice(subtitles, func(i, j int) bool { return subtitles[i].Path < subtitles[j].Path })
+	return subtitles, nil
+}
+
+func (f *fakeRepo) GetSubtitleByID(ctx context.Context, id int64) (models.Subtitle, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, owners := range []map[int64][]models.Subtitle{f.mediaSubtitles, f.episodeSubtitles} {
+		for _, subs := range owners {
+			for _, sub := range subs {
+				if sub.ID == id {
+					return sub, nil
+				}
+			}
+		}
+	}
+	return models.Subtitle{}, sql.ErrNoRows
+}
+
+// subtitlesOf gives subtitle files IDs and their owner, as saving them would
+func (f *fakeRepo) subtitlesOf(subtitles []models.Subtitle, mediaID, episodeID sql.NullInt64) []models.Subtitle {
+	saved := make([]models.Subtitle, len(subtitles))
+	for i, sub := range subtitles {
+		sub.ID = f.id()
+		sub.MediaID, sub.EpisodeID = mediaID, episodeID
+		saved[i] = sub
+	}
+	return saved
+}
+
+func (f *fakeRepo) FindMissingEpisodeByFingerprint(ctx context.Context, fingerprint string) (models.Episode, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range f.episodes {
+		if e.MissingSince.Valid && e.Fingerprint.String == fingerprint {
+			return e, nil
+		}
+	}
+	return models.Episode{}, sql.ErrNoRows
+}
+
+func (f *fakeRepo) UpdateEpisodePath(ctx context.Context, id, seasonID int64, path string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.episodes[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	e.SeasonID = seasonID
+	e.Path = path
+	e.MissingSince = sql.NullTime{}
+	f.episodes[id] = e
+	return nil
+}
+
+func (f *fakeRepo) SetEpisodeNamedSeason(ctx context.Context, id int64, season sql.NullInt64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.episodes[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	e.NamedSeason = season
+	f.episodes[id] = e
+	return nil
+}
+
+func (f *fakeRepo) UpdateEpisodeFingerprint(ctx context.Context, id int64, fingerprint string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.episodes[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	e.Fingerprint = sql.NullString{String: fingerprint, Valid: true}
+	f.episodes[id] = e
+	return nil
+}
+
+func (f *fakeRepo) CreateScanRun(ctx context.Context, run *models.ScanRun) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r := *run
+	r.ID = f.id()
+	f.scanRuns = append(f.scanRuns, r)
+	return r.ID, nil
+}
+
+func (f *fakeRepo) FinishScanRun(ctx context.Context, run *models.ScanRun) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.scanRuns {
+		if f.scanRuns[i].ID == run.ID {
+			f.scanRuns[i] = *run
+			return nil
+		}
+	}
+	return sql.ErrNoRows
+}
+
+func (f *fakeRepo) GetRecentScanRuns(ctx context.Context, limit int) ([]models.ScanRun, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var runs []models.ScanRun
+	for i := len(f.scanRuns) - 1; i >= 0 && len(runs) < limit; i-- {
+		runs = append(runs, f.scanRuns[i])
+	}
+	return runs, nil
+}
+
+func (f *fakeRepo) GetScanStates(ctx context.Context) ([]models.ScanState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var states []models.ScanState
+	for _, state := range f.states {
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func (f *fakeRepo) SaveScanStates(ctx context.Context, states []models.ScanState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, state := range states {
+		f.states[state.Path] = state
+	}
+	return nil
+}
+
+func (f *fakeRepo) DeleteScanStates(ctx context.Context, paths []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, path := range paths {
+		delete(f.states, path)
+	}
+	return nil
+}
+
+func (f *fakeRepo) UpdateMediaMetadata(ctx context.Context, id int64, meta models.Metadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if meta.Title.Valid {
+		m.Title = meta.Title.String
+	}
+	m.Year = coalesce(meta.Year, m.Year)
+	m.Description = coalesce(meta.Description, m.Description)
+	m.Rating = coalesce(meta.Rating, m.Rating)
+	m.ExternalIDs = coalesceIDs(meta.ExternalIDs, m.ExternalIDs)
+	f.media[id] = m
+	return nil
+}
+
+func (f *fakeRepo) SetMediaArtwork(ctx context.Context, id int64, poster, fanart sql.NullString) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	m.PosterPath, m.FanartPath = poster, fanart
+	f.media[id] = m
+	return nil
+}
+
+func (f *fakeRepo) SetMediaMetadataLookup(ctx context.Context, id int64, lookup models.MetadataLookup) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.media[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	m.MetadataLookup = lookup
+	f.media[id] = m
+	return nil
+}
+
+func (f *fakeRepo) SetTVShowArtwork(ctx context.Context, id int64, poster, fanart sql.NullString) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.tvshows[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	s.PosterPath, s.FanartPath = poster, fanart
+	f.tvshows[id] = s
+	return nil
+}
+
+func (f *fakeRepo) SetTVShowMetadataLookup(ctx context.Context, id int64, lookup models.MetadataLookup) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.tvshows[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	s.MetadataLookup = lookup
+	f.tvshows[id] = s
+	return nil
+}
+
+func (f *fakeRepo) UpdateTVShowMetadata(ctx context.Context, id int64, meta models.Metadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.tvshows[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if meta.Title.Valid {
+		s.Title = meta.Title.String
+	}
+	s.Year = coalesce(meta.Year, s.Year)
+	s.Description = coalesce(meta.Description, s.Description)
+	s.Rating = coalesce(meta.Rating, s.Rating)
+	s.ExternalIDs = coalesceIDs(meta.ExternalIDs, s.ExternalIDs)
+	f.tvshows[id] = s
+	return nil
+}
+
+func (f *fakeRepo) UpdateEpisodeMetadata(ctx context.Context, id int64, meta models.Metadata) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.episodes[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if meta.Title.Valid {
+		e.Title = meta.Title.String
+	}
+	e.AirDate = coalesce(meta.AirDate, e.AirDate)
+	e.Description = coalesce(meta.Description, e.Description)
+	e.Rating = coalesce(meta.Rating, e.Rating)
+	e.ExternalIDs = coalesceIDs(meta.ExternalIDs, e.ExternalIDs)
+	f.episodes[id] = e
+	return nil
+}
+
+// coalesce returns v if it is valid and old otherwise, like SQL's COALESCE
+func coalesce[T sql.NullString | sql.NullInt64 | sql.NullTime](v, old T) T {
+	var zero T
+	if v == zero {
+		return old
+	}
+	return v
+}
+
+func coalesceIDs(ids, old models.ExternalIDs) models.ExternalIDs {
+	return models.ExternalIDs{
+		IMDbID: coalesce(ids.IMDbID, old.IMDbID),
+		TMDbID: coalesce(ids.TMDbID, old.TMDbID),
+		TVDbID: coalesce(ids.TVDbID, old.TVDbID),
+	}
+}
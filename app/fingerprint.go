@@ -0,0 +1,37 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+)
+
+// fingerprintBlockSize is the number of bytes hashed from each end of a file
+const fingerprintBlockSize = 64 * 1024
+
+// fileFingerprint identifies a file's content cheaply by combining its size with a
+// hash of its first and last blocks, so a renamed or moved file can be recognised
+// without reading it in full.
+func fileFingerprint(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, min(size, fingerprintBlockSize)); err != nil && err != io.EOF {
+		return "", err
+	}
+	if size > fingerprintBlockSize {
+		offset := max(size-fingerprintBlockSize, fingerprintBlockSize)
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(h, f, size-offset); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%d:%x", size, h.Sum(nil)), nil
+}
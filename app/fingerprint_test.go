@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	large := strings.Repeat("a", 3*fingerprintBlockSize)
+
+	tests := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"identical small files", "hello", "hello", true},
+		{"different small files", "hello", "world", false},
+		{"identical large files", large, large, true},
+		{"large files differing in the tail", large + "x", large + "y", false},
+		{"large files differing only in the middle", large[:100000] + "b" + large[100001:], large, true},
+		{"different sizes", "hello", "hello!", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pathA := filepath.Join(dir, "a.mkv")
+			pathB := filepath.Join(dir, "sub", "b.mkv")
+			writeFile(t, pathA, tt.a)
+			writeFile(t, pathB, tt.b)
+
+			fpA, err := fileFingerprint(pathA, int64(len(tt.a)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fpB, err := fileFingerprint(pathB, int64(len(tt.b)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (fpA == fpB) != tt.same {
+				t.Errorf("fingerprints %q and %q: same = %v, want %v", fpA, fpB, fpA == fpB, tt.same)
+			}
+		})
+	}
+}
+
+func TestFileFingerprintMissingFile(t *testing.T) {
+	if _, err := fileFingerprint(filepath.Join(t.TempDir(), "nope.mkv"), 10); !os.IsNotExist(err) {
+		t.Errorf("fileFingerprint on missing file: err = %v, want not exist", err)
+	}
+}
@@ -1,25 +1,39 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
-	"os" // Added for environment variables
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"transogov2/app/models"
+	"transogov2/app/views/components"
 	"transogov2/app/views/pages"
 )
 
 // Handlers holds the repository dependencies
 type Handlers struct {
-	repo *Repository
+	repo      MediaRepository
+	scans     *ScanJobs
+	events    *EventBus
+	subtitles vttCache
 }
 
 // NewHandlers creates a new Handlers instance
-func NewHandlers(repo *Repository) *Handlers {
-	return &Handlers{repo: repo}
+func NewHandlers(repo MediaRepository, scans *ScanJobs, events *EventBus) *Handlers {
+	return &Handlers{repo: repo, scans: scans, events: events}
 }
 
 // LibraryHandler handles the main library page
@@ -94,6 +108,7 @@ func (h *Handlers) TVShowHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	sortSeasons(seasons)
 
 	// Render the page
 	err = pages.TVShow(tvshow, seasons).Render(context.Background(), w)
@@ -170,9 +185,22 @@ func (h *Handlers) SeasonHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	sortEpisodes(episodes, tvshow.EpisodeOrder)
+
+	// Group the subtitle files by episode
+	seasonSubtitles, err := h.repo.GetSeasonSubtitles(context.Background(), season.ID)
+	if err != nil {
+		log.Printf("Error retrieving subtitles for Season ID %d: %v", season.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	subtitles := make(map[int64][]models.Subtitle)
+	for _, sub := range seasonSubtitles {
+		subtitles[sub.EpisodeID.Int64] = append(subtitles[sub.EpisodeID.Int64], sub)
+	}
 
 	// Render the page
-	err = pages.Season(tvshow, *season, episodes).Render(context.Background(), w)
+	err = pages.Season(tvshow, *season, episodes, subtitles).Render(context.Background(), w)
 	if err != nil {
 		log.Printf("Error rendering Season page for TV Show ID %d, Season %d: %v", tvshowID, seasonNum, err)
 		http.Error(w, "Error rendering page", http.StatusInternalServerError)
@@ -180,35 +208,411 @@ func (h *Handlers) SeasonHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// MediaHandler handles the media detail page
+// sortSeasons orders a show's seasons by number, with the specials of season 0
+// listed last
+func sortSeasons(seasons []models.Season) {
+	sort.SliceStable(seasons, func(i, j int) bool {
+		a, b := seasons[i].Number, seasons[j].Number
+		if (a == 0) != (b == 0) {
+			return b == 0
+		}
+		return a < b
+	})
+}
+
+// sortEpisodes orders a season's episodes for display. Episodes without an
+// absolute number or air date come after those with one, by episode number.
+// Episodes with the same number, such as those of daily shows which have none,
+// are ordered by air date.
+func sortEpisodes(episodes []models.Episode, order string) {
+	sort.SliceStable(episodes, func(i, j int) bool {
+		a, b := episodes[i], episodes[j]
+		switch order {
+		case models.EpisodeOrderAbsolute:
+			if a.AbsoluteNumber.Valid != b.AbsoluteNumber.Valid {
+				return a.AbsoluteNumber.Valid
+			}
+			if a.AbsoluteNumber.Int64 != b.AbsoluteNumber.Int64 {
+				return a.AbsoluteNumber.Int64 < b.AbsoluteNumber.Int64
+			}
+		case models.EpisodeOrderDate:
+			if a.AirDate.Valid != b.AirDate.Valid {
+				return a.AirDate.Valid
+			}
+			if !a.AirDate.Time.Equal(b.AirDate.Time) {
+				return a.AirDate.Time.Before(b.AirDate.Time)
+			}
+		}
+		if a.Number != b.Number {
+			return a.Number < b.Number
+		}
+		return a.AirDate.Valid && (!b.AirDate.Valid || a.AirDate.Time.Before(b.AirDate.Time))
+	})
+}
+
+// EpisodeOrderHandler sets how a TV show's season pages order episodes
+func (h *Handlers) EpisodeOrderHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid TV Show ID", http.StatusBadRequest)
+		return
+	}
+	order := r.FormValue("order")
+	switch order {
+	case models.EpisodeOrderAired, models.EpisodeOrderAbsolute, models.EpisodeOrderDate:
+	default:
+		http.Error(w, "Invalid episode order", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.repo.SetTVShowEpisodeOrder(r.Context(), id, order); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "TV Show not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("Error setting episode order for TV Show ID %d: %v", id, err)
+		http.Error(w, "Error saving episode order", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, fmt.Sprintf("/tvshow/%d", id), http.StatusSeeOther)
+}
+
+// MediaHandler handles the media detail page, which lists the versions, parts
+// and extras of a movie
 func (h *Handlers) MediaHandler(w http.ResponseWriter, r *http.Request) {
-	id := strings.TrimPrefix(r.URL.Path, "/media/")
-	if id == "" {
-		http.Error(w, "Media ID required", http.StatusBadRequest)
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid Media ID", http.StatusBadRequest)
 		return
 	}
 
-	media, err := h.repo.GetMediaByPath(context.Background(), id)
+	media, err := h.repo.GetMediaByID(context.Background(), id)
 	if err != nil {
 		http.Error(w, "Media not found", http.StatusNotFound)
 		return
 	}
-	pages.Media(media).Render(context.Background(), w)
+
+	// Versions and extras hang off the main version
+	main := media
+	if media.VersionOf.Valid {
+		main, err = h.repo.GetMediaByID(context.Background(), media.VersionOf.Int64)
+		if err != nil {
+			log.Printf("Error retrieving main version %d of Media ID %d: %v", media.VersionOf.Int64, media.ID, err)
+			main = media
+		}
+	}
+	versions, err := h.repo.GetMediaVersions(context.Background(), main.ID)
+	if err != nil {
+		log.Printf("Error retrieving versions of Media ID %d: %v", main.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(versions) > 0 {
+		versions = append([]models.Media{main}, versions...)
+	}
+
+	// Later parts of a multi-part movie and its extras
+	parts, _, err := h.mediaChildren(media.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(parts) > 0 {
+		parts = append([]models.Media{media}, parts...)
+	}
+	_, extras, err := h.mediaChildren(main.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	streams, err := h.repo.GetMediaStreams(context.Background(), media.ID)
+	if err != nil {
+		log.Printf("Error retrieving streams for Media ID %d: %v", media.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	chapters, err := h.repo.GetMediaChapters(context.Background(), media.ID)
+	if err != nil {
+		log.Printf("Error retrieving chapters for Media ID %d: %v", media.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	subtitles, err := h.repo.GetMediaSubtitles(context.Background(), media.ID)
+	if err != nil {
+		log.Printf("Error retrieving subtitles for Media ID %d: %v", media.ID, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Chapter links start the player at ?t=<seconds>
+	var start time.Duration
+	if t, err := strconv.ParseFloat(r.URL.Query().Get("t"), 64); err == nil && t > 0 {
+		start = time.Duration(t * float64(time.Second))
+	}
+	pages.Media(media, versions, parts, extras, streams, chapters, subtitles, start).Render(context.Background(), w)
 }
 
-// ScanHandler handles the media scan request
-func (h *Handlers) ScanHandler(w http.ResponseWriter, r *http.Request) {
-	moviesDir := os.Getenv("MOVIES_DIR")
-	if moviesDir == "" {
-		moviesDir = "./media/movies" // Default to a local path
+// videoTypes are the content types of the video files browsers may play
+var videoTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".webm": "video/webm",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".ogv":  "video/ogg",
+}
+
+// VideoHandler serves the video file of a media row for the player, with range
+// requests so it can seek
+func (h *Handlers) VideoHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid Media ID", http.StatusBadRequest)
+		return
+	}
+	media, err := h.repo.GetMediaByID(r.Context(), id)
+	if err != nil || media.MissingSince.Valid {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(media.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	if contentType, ok := videoTypes[strings.ToLower(filepath.Ext(media.Path))]; ok {
+		w.Header().Set("Content-Type", contentType)
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// SubtitleHandler serves a subtitle file converted to WebVTT for the player, as
+// /subtitles/{id}.vtt. A file out of sync with its video can be shifted by the
+// seconds in ?offset=, which may be negative.
+func (h *Handlers) SubtitleHandler(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutSuffix(r.PathValue("file"), ".vtt")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	id, err := strconv.ParseInt(name, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid Subtitle ID", http.StatusBadRequest)
+		return
+	}
+	var offset time.Duration
+	if v := r.URL.Query().Get("offset"); v != "" {
+		seconds, err := strconv.ParseFloat(v, 64)
+		if err != nil || math.IsNaN(seconds) || math.Abs(seconds) > 24*60*60 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		offset = time.Duration(seconds * float64(time.Second))
+	}
+
+	sub, err := h.repo.GetSubtitleByID(r.Context(), id)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	info, err := os.Stat(sub.Path)
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := h.subtitles.convert(sub, info, offset)
+	if err != nil {
+		log.Printf("Error converting subtitles %s: %v", sub.Path, err)
+		http.Error(w, "Error converting subtitles", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(data))
+}
+
+// mediaChildren retrieves the later parts and the extras of a movie
+func (h *Handlers) mediaChildren(id int64) (parts, extras []models.Media, err error) {
+	children, err := h.repo.GetMediaChildren(context.Background(), id)
+	if err != nil {
+		log.Printf("Error retrieving parts and extras for Media ID %d: %v", id, err)
+		return nil, nil, err
+	}
+	for _, child := range children {
+		if child.ExtraType.Valid {
+			extras = append(extras, child)
+		} else {
+			parts = append(parts, child)
+		}
+	}
+	return parts, extras, nil
+}
+
+// ArtworkHandler serves the poster or fanart image of a media file, TV show or
+// season. Only image files the scanner found are served, looked up by kind and
+// ID, so no path on disk is ever taken from the request.
+func (h *Handlers) ArtworkHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	path, err := h.artworkPath(r.Context(), r.PathValue("kind"), id)
+	if err != nil || !path.Valid || !slices.Contains(artworkExtensions, strings.ToLower(filepath.Ext(path.String))) {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(path.String)
+	if err != nil {
+		http.NotFound(w, r)
+		return
 	}
-	tvDir := os.Getenv("TV_DIR")
-	if tvDir == "" {
-		tvDir = "./media/tv" // Default to a local path
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	// Artwork URLs stay the same when the image is replaced, so browsers
+	// revalidate with the ETag every time
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// artworkPath returns the image file of an artwork kind: media-poster,
+// media-fanart, tvshow-poster, tvshow-fanart or season-poster
+func (h *Handlers) artworkPath(ctx context.Context, kind string, id int64) (sql.NullString, error) {
+	switch kind {
+	case "media-poster", "media-fanart":
+		media, err := h.repo.GetMediaByID(ctx, id)
+		if kind == "media-poster" {
+			return media.PosterPath, err
+		}
+		return media.FanartPath, err
+	case "tvshow-poster", "tvshow-fanart":
+		tvShow, err := h.repo.GetTVShowByID(ctx, id)
+		if kind == "tvshow-poster" {
+			return tvShow.PosterPath, err
+		}
+		return tvShow.FanartPath, err
+	case "season-poster":
+		season, err := h.repo.GetSeasonByID(ctx, id)
+		return season.PosterPath, err
 	}
+	return sql.NullString{}, sql.ErrNoRows
+}
 
-	go ScanMedia(h.repo, moviesDir, tvDir)
+// ScanHandler handles the media scan request. A scan requested while another is
+// running joins the running scan instead of starting a second one. Pass full=true
+// to rescan directories that have not changed since the last scan.
+func (h *Handlers) ScanHandler(w http.ResponseWriter, r *http.Request) {
+	full, _ := strconv.ParseBool(r.FormValue("full"))
+	run, started := h.scans.Start(full)
+	if !started {
+		log.Printf("Scan already running (run %d), not starting another", run.ID)
+	}
 	w.WriteHeader(http.StatusAccepted)
+	components.ScanStatus(true, run).Render(r.Context(), w)
+}
+
+// CancelScanHandler cancels the running scan and responds with the recorded run
+func (h *Handlers) CancelScanHandler(w http.ResponseWriter, r *http.Request) {
+	run, cancelled := h.scans.Cancel()
+	if !cancelled {
+		http.Error(w, "No scan is running", http.StatusConflict)
+		return
+	}
+	log.Printf("Scan run %d cancelled", run.ID)
+
+	if r.Header.Get("HX-Request") == "true" {
+		components.ScanStatus(false, run).Render(r.Context(), w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(newScanRunJSON(run)); err != nil {
+		log.Printf("Error encoding scan run: %v", err)
+	}
+}
+
+// scanRunJSON is the JSON representation of a scan run
+type scanRunJSON struct {
+	ID         int64      `json:"id"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Status     string     `json:"status"`
+	Added      int        `json:"added"`
+	Updated    int        `json:"updated"`
+	Removed    int        `json:"removed"`
+	Errors     int        `json:"errors"`
+	Warnings   int        `json:"warnings"`
+	Error      string     `json:"error,omitempty"`
+}
+
+func newScanRunJSON(run models.ScanRun) scanRunJSON {
+	j := scanRunJSON{
+		ID:        run.ID,
+		StartedAt: run.StartedAt,
+		Status:    run.Status,
+		Added:     run.Added,
+		Updated:   run.Updated,
+		Removed:   run.Removed,
+		Errors:    run.Errors,
+		Warnings:  run.Warnings,
+		Error:     run.Error.String,
+	}
+	if run.FinishedAt.Valid {
+		j.FinishedAt = &run.FinishedAt.Time
+	}
+	return j
+}
+
+// ScanStatusHandler reports the scan status. htmx requests get the nav partial,
+// everything else gets JSON including the recent scan history.
+func (h *Handlers) ScanStatusHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := h.scans.Status(r.Context())
+	if err != nil {
+		log.Printf("Error retrieving scan history: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		run := status.Current
+		if !status.Running {
+			for _, past := range status.History {
+				if past.Status != models.ScanStatusRunning {
+					run = past
+					break
+				}
+			}
+		}
+		components.ScanStatus(status.Running, run).Render(r.Context(), w)
+		return
+	}
+
+	resp := struct {
+		Running bool          `json:"running"`
+		Current *scanRunJSON  `json:"current,omitempty"`
+		History []scanRunJSON `json:"history"`
+	}{Running: status.Running, History: []scanRunJSON{}}
+	if status.Running {
+		current := newScanRunJSON(status.Current)
+		resp.Current = &current
+	}
+	for _, run := range status.History {
+		resp.History = append(resp.History, newScanRunJSON(run))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding scan status: %v", err)
+	}
 }
 
 // HelloHandler handles the hello world page
@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"transogov2/app/models"
+)
+
+// newTestMux routes requests to handlers backed by repo
+func newTestMux(repo MediaRepository) *http.ServeMux {
+	h := NewHandlers(repo, nil, nil)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tvshow/{id}/season/{seasonNum}", h.SeasonHandler)
+	mux.HandleFunc("GET /tvshow/{id}", h.TVShowHandler)
+	mux.HandleFunc("POST /tvshow/{id}/order", h.EpisodeOrderHandler)
+	mux.HandleFunc("GET /movies", h.MoviesHandler)
+	mux.HandleFunc("GET /media/{id}", h.MediaHandler)
+	mux.HandleFunc("GET /media/{id}/video", h.VideoHandler)
+	mux.HandleFunc("GET /subtitles/{file}", h.SubtitleHandler)
+	mux.HandleFunc("GET /artwork/{kind}/{id}", h.ArtworkHandler)
+	return mux
+}
+
+func TestEpisodeOrderHandler(t *testing.T) {
+	repo := newFakeRepo()
+	id, _ := repo.SaveTVShow(context.Background(), &models.TVShow{Title: "Show", Path: "/tv/Show"})
+	mux := newTestMux(repo)
+
+	post := func(path, order string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(url.Values{"order": {order}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/tvshow/1/order", models.EpisodeOrderAbsolute)
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/tvshow/1" {
+		t.Fatalf("POST order = %d to %q, want 303 to /tvshow/1", rec.Code, rec.Header().Get("Location"))
+	}
+	if show, _ := repo.GetTVShowByID(context.Background(), id); show.EpisodeOrder != models.EpisodeOrderAbsolute {
+		t.Errorf("episode order = %q, want %q", show.EpisodeOrder, models.EpisodeOrderAbsolute)
+	}
+
+	if rec := post("/tvshow/1/order", "alphabetical"); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid order gave %d, want 400", rec.Code)
+	}
+	if rec := post("/tvshow/99/order", models.EpisodeOrderDate); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown show gave %d, want 404", rec.Code)
+	}
+}
+
+func TestSeasonHandlerUsesEpisodeOrder(t *testing.T) {
+	repo := newFakeRepo()
+	ctx := context.Background()
+	showID, _ := repo.SaveTVShow(ctx, &models.TVShow{Title: "Show", Path: "/tv/Show"})
+	seasonID, _ := repo.SaveSeason(ctx, &models.Season{TVShowID: showID, Number: 1, Title: "Season 1", Path: "/tv/Show/Season 1"})
+	day := func(d int) sql.NullTime {
+		return sql.NullTime{Time: time.Date(2024, 3, d, 0, 0, 0, 0, time.UTC), Valid: true}
+	}
+	for _, e := range []models.Episode{
+		{Number: 1, Title: "First", AbsoluteNumber: sql.NullInt64{Int64: 30, Valid: true}, AirDate: day(20)},
+		{Number: 2, Title: "Second", AbsoluteNumber: sql.NullInt64{Int64: 10, Valid: true}, AirDate: day(5)},
+		{Number: 3, Title: "Third", AirDate: day(10)},
+	} {
+		e.SeasonID = seasonID
+		e.Path = "/tv/Show/Season 1/" + e.Title + ".mkv"
+		repo.SaveEpisode(ctx, &e)
+	}
+	mux := newTestMux(repo)
+
+	for _, tt := range []struct {
+		order string
+		want  []string
+	}{
+		{"", []string{"First", "Second", "Third"}},
+		{models.EpisodeOrderAbsolute, []string{"Second", "First", "Third"}},
+		{models.EpisodeOrderDate, []string{"Second", "Third", "First"}},
+	} {
+		repo.SetTVShowEpisodeOrder(ctx, showID, tt.order)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tvshow/1/season/1", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET season = %d", rec.Code)
+		}
+		body := rec.Body.String()
+		last := -1
+		for _, title := range tt.want {
+			i := strings.Index(body, ">"+title+"<")
+			if i < 0 || i < last {
+				t.Errorf("order %q: %q is out of order, want %v", tt.order, title, tt.want)
+			}
+			last = i
+		}
+	}
+}
+
+func TestSeasonHandlerOrdersDailyEpisodesByAirDate(t *testing.T) {
+	cfg := newTestLibrary(t)
+	season := filepath.Join(cfg.TVDir, "Daily Show", "2024")
+	for _, name := range []string{"Daily.Show.2024.03.20.Late.mkv", "daily.show.2024.03.05.Early.mkv", "Daily.Show.2024.03.10.Middle.mkv"} {
+		writeFile(t, filepath.Join(season, name), name)
+	}
+	repo := newFakeRepo()
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	newTestMux(repo).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tvshow/1/season/2024", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET season = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	last := -1
+	for _, title := range []string{"Early", "Middle", "Late"} {
+		i := strings.Index(body, ">"+title+"<")
+		if i < 0 || i < last {
+			t.Errorf("%q is out of order", title)
+		}
+		last = i
+	}
+	if !strings.Contains(body, "Mar 5") {
+		t.Errorf("daily episodes are not numbered by air date")
+	}
+}
+
+func TestSeasonHandlerFlagsSeasonMismatch(t *testing.T) {
+	cfg := newTestLibrary(t)
+	season := filepath.Join(cfg.TVDir, "Show", "Season 2")
+	writeFile(t, filepath.Join(season, "Show.S02E01.mkv"), "right")
+	writeFile(t, filepath.Join(season, "Show.S03E01.mkv"), "wrong")
+	repo := newFakeRepo()
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	// The warning outlives the scan that found it
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Warnings) != 0 {
+		t.Fatalf("cached rescan warned %q", summary.Warnings)
+	}
+
+	rec := httptest.NewRecorder()
+	newTestMux(repo).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tvshow/1/season/2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET season = %d", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Count(body, "Named as season") != 1 || !strings.Contains(body, "Named as season 3") {
+		t.Errorf("season page does not flag the one mismatched episode")
+	}
+}
+
+func TestTVShowHandlerListsSpecialsLast(t *testing.T) {
+	cfg := newTestLibrary(t)
+	show := filepath.Join(cfg.TVDir, "Show")
+	writeFile(t, filepath.Join(show, "Specials", "Show.S00E01.Christmas.Special.mkv"), "special")
+	writeFile(t, filepath.Join(show, "Season 1", "Show.S01E01.mkv"), "s1")
+	writeFile(t, filepath.Join(show, "Season 2", "Show.S02E01.mkv"), "s2")
+	repo := newFakeRepo()
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	mux := newTestMux(repo)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tvshow/1", nil))
+	body := rec.Body.String()
+	season1, season2, specials := strings.Index(body, ">Season 1<"), strings.Index(body, ">Season 2<"), strings.Index(body, ">Specials<")
+	if season1 < 0 || season2 < season1 || specials < season2 {
+		t.Errorf("seasons at %d, %d and specials at %d, want specials last", season1, season2, specials)
+	}
+	if !strings.Contains(body, `href="/tvshow/1/season/0"`) {
+		t.Error("no link to the specials season")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/tvshow/1/season/0", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Christmas Special") {
+		t.Errorf("GET /tvshow/1/season/0 = %d, want the specials page", rec.Code)
+	}
+}
+
+func TestMediaHandlerListsPartsAndExtras(t *testing.T) {
+	cfg := newTestLibrary(t)
+	writeMovieFixtures(t, cfg.MoviesDir)
+	repo := newFakeRepo()
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	mux := newTestMux(repo)
+	get := func(path string) string {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", path, rec.Code)
+		}
+		return rec.Body.String()
+	}
+
+	abyss, _ := repo.GetMediaByPath(context.Background(), filepath.Join(cfg.MoviesDir, "The Abyss (1989)", "The.Abyss.cd1.avi"))
+	movies := get("/movies")
+	if strings.Count(movies, ">The Abyss<") != 1 || strings.Contains(movies, ">Teaser<") {
+		t.Error("the movies page should show The Abyss once and no extras")
+	}
+	if !strings.Contains(movies, fmt.Sprintf(`href="/media/%d"`, abyss.ID)) {
+		t.Error("the movies page does not link to The Abyss by ID")
+	}
+
+	body := get(fmt.Sprintf("/media/%d", abyss.ID))
+	for _, want := range []string{"Part 1: <span", "The.Abyss.cd1.avi", "Part 2: <span", "The.Abyss.cd2.avi", "Extras", ">Trailer<"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("media page is missing %q", want)
+		}
+	}
+
+	trailer, _ := repo.GetMediaByPath(context.Background(), filepath.Join(cfg.MoviesDir, "The Abyss (1989)", "The.Abyss-trailer.avi"))
+	if body := get(fmt.Sprintf("/media/%d", trailer.ID)); !strings.Contains(body, fmt.Sprintf(`href="/media/%d"`, abyss.ID)) {
+		t.Error("the trailer page does not link back to its movie")
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/media/abc", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("GET /media/abc = %d, want 400", rec.Code)
+	}
+}
+
+func TestMediaHandlerOffersVersions(t *testing.T) {
+	repo := newFakeRepo()
+	ctx := context.Background()
+	mainID, _ := repo.SaveMedia(ctx, &models.Media{Title: "Heat", Path: "/movies/Heat/Heat.1080p.mkv", MediaType: models.MediaTypeMovie,
+		Resolution: sql.NullString{String: "1080p", Valid: true}})
+	otherID, _ := repo.SaveMedia(ctx, &models.Media{Title: "Heat", Path: "/movies/Heat/Heat.2160p.mkv", MediaType: models.MediaTypeMovie,
+		Resolution: sql.NullString{String: "2160p", Valid: true}, VersionOf: sql.NullInt64{Int64: 1, Valid: true}})
+	repo.SaveMedia(ctx, &models.Media{Title: "Teaser", Path: "/movies/Heat/Trailers/Teaser.mkv", MediaType: models.MediaTypeMovie,
+		ExtraType: sql.NullString{String: models.ExtraTypeTrailer, Valid: true}, ParentID: sql.NullInt64{Int64: mainID, Valid: true}})
+	mux := newTestMux(repo)
+
+	// Both versions offer the picker and the main version's extras
+	for _, id := range []int64{mainID, otherID} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/media/%d", id), nil))
+		body := rec.Body.String()
+		for _, want := range []string{"Versions", ">1080p · 0 B<", ">2160p · 0 B<", fmt.Sprintf(`href="/media/%d" aria-current="page"`, id), ">Teaser<"} {
+			if !strings.Contains(body, want) {
+				t.Errorf("media page %d is missing %q", id, want)
+			}
+		}
+	}
+}
+
+func TestMediaHandlerPlaysFromChapter(t *testing.T) {
+	cfg := newTestLibrary(t)
+	moviePath := filepath.Join(cfg.MoviesDir, "Heat.1995.mkv")
+	copySample(t, "sample.mkv", moviePath)
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	heat, _ := repo.GetMediaByPath(ctx, moviePath)
+	mux := newTestMux(repo)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, fmt.Sprintf("/media/%d?t=3", heat.ID), nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"Chapters",
+		fmt.Sprintf(`href="/media/%d?t=3#player"`, heat.ID),
+		">0:00:03</span>",
+		"The Heist",
+		fmt.Sprintf(`src="/media/%d/video#t=3"`, heat.ID),
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("media page is missing %q", want)
+		}
+	}
+}
+
+func TestVideoHandler(t *testing.T) {
+	cfg := newTestLibrary(t)
+	moviePath := filepath.Join(cfg.MoviesDir, "Heat.1995.mkv")
+	writeFile(t, moviePath, "0123456789")
+	repo := newFakeRepo()
+	ctx := context.Background()
+	id, _ := repo.SaveMedia(ctx, &models.Media{Title: "Heat", Path: moviePath, MediaType: models.MediaTypeMovie})
+	missingID, _ := repo.SaveMedia(ctx, &models.Media{Title: "Alien", Path: filepath.Join(cfg.MoviesDir, "Alien.1979.mkv"), MediaType: models.MediaTypeMovie,
+		MissingSince: sql.NullTime{Time: time.Now(), Valid: true}})
+	mux := newTestMux(repo)
+
+	req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/media/%d/video", id), nil)
+	req.Header.Set("Range", "bytes=2-5")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" || rec.Header().Get("Content-Type") != "video/x-matroska" {
+		t.Errorf("range request = %d %q as %q, want 206 with bytes 2-5 as Matroska", rec.Code, rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+
+	for _, path := range []string{fmt.Sprintf("/media/%d/video", missingID), "/media/99/video"} {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, rec.Code)
+		}
+	}
+}
+
+func TestSubtitleHandler(t *testing.T) {
+	cfg := newTestLibrary(t)
+	moviePath := filepath.Join(cfg.MoviesDir, "Heat.1995.mkv")
+	writeFile(t, moviePath, "movie")
+	subPath := filepath.Join(cfg.MoviesDir, "Heat.1995.en.srt")
+	writeFile(t, subPath, "1\n00:00:01,000 --> 00:00:02,500\n<i>Hello</i> & goodbye\n")
+	repo := newFakeRepo()
+	ctx := context.Background()
+	id, _ := repo.SaveMedia(ctx, &models.Media{Title: "Heat", Path: moviePath, MediaType: models.MediaTypeMovie})
+	repo.SetMediaSubtitles(ctx, id, []models.Subtitle{
+		{Path: subPath, Format: "srt"},
+		{Path: filepath.Join(cfg.MoviesDir, "Heat.1995.fr.srt"), Format: "srt"},
+	})
+	subtitles, _ := repo.GetMediaSubtitles(ctx, id)
+	mux := newTestMux(repo)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	rec := get(fmt.Sprintf("/subtitles/%d.vtt", subtitles[0].ID))
+	want := "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\n<i>Hello</i> &amp; goodbye\n"
+	if rec.Code != http.StatusOK || rec.Body.String() != want || rec.Header().Get("Content-Type") != "text/vtt; charset=utf-8" {
+		t.Errorf("GET subtitles = %d %q as %q, want the WebVTT conversion", rec.Code, rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+	rec = get(fmt.Sprintf("/subtitles/%d.vtt?offset=-0.5", subtitles[0].ID))
+	if !strings.Contains(rec.Body.String(), "00:00:00.500 --> 00:00:02.000") {
+		t.Errorf("GET subtitles with an offset = %q, want cues half a second earlier", rec.Body.String())
+	}
+
+	for path, code := range map[string]int{
+		fmt.Sprintf("/subtitles/%d.vtt?offset=soon", subtitles[0].ID): http.StatusBadRequest,
+		"/subtitles/abc.vtt":                              http.StatusBadRequest,
+		fmt.Sprintf("/subtitles/%d.srt", subtitles[0].ID): http.StatusNotFound,
+		fmt.Sprintf("/subtitles/%d.vtt", subtitles[1].ID): http.StatusNotFound, // the file is gone
+		"/subtitles/99.vtt":                               http.StatusNotFound,
+	} {
+		if rec := get(path); rec.Code != code {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, code)
+		}
+	}
+}
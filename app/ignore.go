@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ignoreFileName is the name of the per-directory ignore files honoured by the scanner
+const ignoreFileName = ".transgoignore"
+
+// defaultMinFileSize is the size below which video files are assumed to be samples
+const defaultMinFileSize = 50 << 20 // 50 MiB
+
+// defaultExcludePatterns are always applied at the library roots, before the
+// configured patterns, so they can be re-included with a "!" pattern
+var defaultExcludePatterns = []string{
+	"@eaDir/",       // Synology thumbnails
+	`\#recycle/`,    // Synology recycle bin
+	`\#snapshot/`,   // Synology snapshots
+	".AppleDouble/", // macOS file server metadata
+	"._*",           // macOS resource forks
+	"lost+found/",
+	"sample/",
+	"samples/",
+	"sample.*",
+	"*-sample.*",
+	"*.sample.*",
+	"*.part",    // partial downloads
+	"*.partial", // partial downloads
+}
+
+// ignorePattern is a single compiled gitignore-style pattern
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules are the patterns from one ignore file (or the global list), which
+// match paths relative to base
+type ignoreRules struct {
+	base     string
+	patterns []ignorePattern
+}
+
+// parseIgnoreRules compiles gitignore-style pattern lines. Blank lines and lines
+// starting with "#" are skipped. Matching is case-insensitive.
+func parseIgnoreRules(base string, lines []string) *ignoreRules {
+	rules := &ignoreRules{base: base}
+	for _, line := range lines {
+		if p, ok := compileIgnorePattern(line); ok {
+			rules.patterns = append(rules.patterns, p)
+		}
+	}
+	return rules
+}
+
+// compileIgnorePattern turns one gitignore-style line into a pattern
+func compileIgnorePattern(line string) (ignorePattern, bool) {
+	var p ignorePattern
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return p, false
+	}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return p, false
+	}
+
+	// A pattern containing a slash is relative to the ignore file's directory;
+	// otherwise it matches a name at any depth
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var re strings.Builder
+	re.WriteString("(?i)^")
+	if !anchored {
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case strings.HasPrefix(line[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(line[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(line[i+1:], ']')
+			if end < 0 {
+				re.WriteString(`\[`)
+				continue
+			}
+			class := line[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(line):
+			i++
+			re.WriteString(regexp.QuoteMeta(string(line[i])))
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		log.Printf("Invalid ignore pattern %q: %v", line, err)
+		return p, false
+	}
+	p.re = compiled
+	return p, true
+}
+
+// match applies the rules to path. It returns whether a pattern matched and, if
+// so, whether the last matching pattern ignores the path.
+func (r *ignoreRules) match(path string, isDir bool) (matched, ignored bool) {
+	rel, err := filepath.Rel(r.base, path)
+	if err != nil || rel == "." {
+		return false, false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, p := range r.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.re.MatchString(rel) {
+			matched, ignored = true, !p.negate
+		}
+	}
+	return matched, ignored
+}
+
+// scanFilter decides which files and directories the scanner skips: paths matched
+// by the global patterns or by a .transgoignore file in the same directory or
+// above it (up to the library root), files that are not videos, and video files
+// smaller than a minimum size.
+type scanFilter struct {
+	roots   []string
+	global  []string
+	minSize int64
+	// extensions maps a library root to its video extensions; roots without an
+	// entry use the default extensions
+	extensions map[string]map[string]bool
+	// sniff classifies files with unrecognised extensions by their content
+	sniff bool
+
+	mu    sync.Mutex
+	files map[string]ignoreFile // directory -> its .transgoignore
+}
+
+// ignoreFile is a parsed .transgoignore file, with nil rules if there is none
+type ignoreFile struct {
+	rules   *ignoreRules
+	modTime int64
+}
+
+// newScanFilter creates a filter for the given library roots. The default exclude
+// patterns are applied first, then patterns.
+func newScanFilter(roots, patterns []string, minSize int64) *scanFilter {
+	return &scanFilter{
+		roots:   roots,
+		global:  append(append([]string(nil), defaultExcludePatterns...), patterns...),
+		minSize: minSize,
+		files:   make(map[string]ignoreFile),
+	}
+}
+
+// root returns the library root containing path
+func (f *scanFilter) root(path string) (string, bool) {
+	if f == nil {
+		return "", false
+	}
+	for _, root := range f.roots {
+		if path == root || isWithin(root, path) {
+			return root, true
+		}
+	}
+	return "", false
+}
+
+// ignored reports whether path is matched by an ignore pattern. Its parent
+// directories are assumed not to be ignored; see excluded.
+func (f *scanFilter) ignored(path string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	root, ok := f.root(path)
+	if !ok || path == root {
+		return false
+	}
+
+	ignored := false
+	apply := func(rules *ignoreRules) {
+		if matched, ign := rules.match(path, isDir); matched {
+			ignored = ign
+		}
+	}
+	apply(f.rules(root, true))
+
+	// Ignore files from the root down to the directory containing path; rules
+	// further down take precedence
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == root || !isWithin(root, dir) {
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if rules := f.rules(dirs[i], false); rules != nil {
+			apply(rules)
+		}
+	}
+	return ignored
+}
+
+// excluded reports whether path or any directory between it and its library
+// root is ignored. Walks check entries with ignored as they go; excluded is for
+// paths that are scanned directly.
+func (f *scanFilter) excluded(path string, isDir bool) bool {
+	if f == nil {
+		return false
+	}
+	root, ok := f.root(path)
+	if !ok {
+		return false
+	}
+	var dirs []string
+	for dir := filepath.Dir(path); dir != root && isWithin(root, dir); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if f.ignored(dirs[i], true) {
+			return true
+		}
+	}
+	return f.ignored(path, isDir)
+}
+
+// isVideo reports whether a file is a video: its extension is one of the library's
+// video extensions or, when sniffing, its content is a known video container
+func (f *scanFilter) isVideo(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if f == nil {
+		return isVideoFile(ext)
+	}
+	root, _ := f.root(path)
+	if exts, ok := f.extensions[root]; ok {
+		if exts[ext] {
+			return true
+		}
+	} else if isVideoFile(ext) {
+		return true
+	}
+	if !f.sniff {
+		return false
+	}
+	container, err := sniffContainer(path)
+	if err != nil {
+		log.Printf("Error sniffing %s: %v", path, err)
+		return false
+	}
+	return container != ""
+}
+
+// tooSmall reports whether a video file is below the minimum size
+func (f *scanFilter) tooSmall(size int64) bool {
+	return f != nil && size < f.minSize
+}
+
+// rules returns the global rules for a root, or the .transgoignore rules of a
+// directory (nil if it has none). Ignore files are read once per scan.
+func (f *scanFilter) rules(dir string, global bool) *ignoreRules {
+	return f.ignoreFile(dir, global).rules
+}
+
+// ignoreFile returns the global rules for a root or the .transgoignore file of a
+// directory, reading it on first use
+func (f *scanFilter) ignoreFile(dir string, global bool) ignoreFile {
+	key := dir
+	if global {
+		key = "\x00" + dir
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if file, ok := f.files[key]; ok {
+		return file
+	}
+
+	var file ignoreFile
+	if global {
+		file.rules = parseIgnoreRules(dir, f.global)
+	} else {
+		file = readIgnoreFile(dir)
+	}
+	f.files[key] = file
+	return file
+}
+
+// stamp returns a hash of everything that decides which entries of dir are
+// scanned: the global patterns, the minimum size, the video extensions and the
+// modification times of the ignore files from the library root down to dir. The
+// scan cache keeps it with the directory, so changing any of them rereads it.
+func (f *scanFilter) stamp(dir string) int64 {
+	if f == nil {
+		return 0
+	}
+	root, ok := f.root(dir)
+	if !ok {
+		return 0
+	}
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%q %d %v", f.global, f.minSize, f.sniff)
+	exts := make([]string, 0, len(f.extensions[root]))
+	for ext := range f.extensions[root] {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	fmt.Fprintf(h, " %q", exts)
+
+	var dirs []string
+	for d := dir; ; d = filepath.Dir(d) {
+		dirs = append(dirs, d)
+		if d == root || !isWithin(root, d) {
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if file := f.ignoreFile(dirs[i], false); file.rules != nil {
+			fmt.Fprintf(h, " %q %d", dirs[i], file.modTime)
+		}
+	}
+	return int64(h.Sum64())
+}
+
+// readIgnoreFile parses the .transgoignore file in dir, if there is one
+func readIgnoreFile(dir string) ignoreFile {
+	path := filepath.Join(dir, ignoreFileName)
+	info, err := os.Stat(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error reading %s in %s: %v", ignoreFileName, dir, err)
+		}
+		return ignoreFile{}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("Error reading %s in %s: %v", ignoreFileName, dir, err)
+		return ignoreFile{}
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return ignoreFile{rules: parseIgnoreRules(dir, lines), modTime: info.ModTime().UnixNano()}
+}
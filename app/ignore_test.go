@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIgnorePatternMatching(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		// Names match at any depth
+		{"Sample", "Movie/Sample", true, true},
+		{"sample", "Movie/SAMPLE", true, true},
+		{"sample", "Movie/Sample/clip.mkv", false, false},
+		{"*.part", "Show/Show.S01E01.mkv.part", false, true},
+		{"*-sample.*", "Movie/movie-sample.mkv", false, true},
+		{"*-sample.*", "Movie/movie-samples.mkv", false, false},
+		// Directory-only patterns
+		{"extras/", "Movie/Extras", true, true},
+		{"extras/", "Movie/extras", false, false},
+		// Anchored patterns are relative to the ignore file
+		{"/Old", "Old", true, true},
+		{"/Old", "Show/Old", true, false},
+		{"Show/Season 1", "Show/Season 1", true, true},
+		{"Show/Season 1", "Other/Show/Season 1", true, false},
+		// Wildcards
+		{"Season ?", "Show/Season 2", true, true},
+		{"Season ?", "Show/Season 12", true, false},
+		{"Season [12]", "Show/Season 2", true, true},
+		{"Season [!12]", "Show/Season 2", true, false},
+		{"Show/*/Behind*", "Show/Season 1/Behind the Scenes", true, true},
+		{"Show/*/Behind*", "Show/Season 1/Extras/Behind the Scenes", true, false},
+		{"**/Featurettes", "A/B/C/Featurettes", true, true},
+		{"Show/**/clip.mkv", "Show/Season 1/Extras/clip.mkv", false, true},
+		{"Show/**/clip.mkv", "Show/clip.mkv", false, true},
+		{"Show/**", "Show/Season 1/clip.mkv", false, true},
+		// Escapes and literal characters
+		{`\#recycle`, "#recycle", true, true},
+		{"#comment", "#comment", true, false},
+		{"movie (2001).mkv", "Movie (2001)/movie (2001).mkv", false, true},
+		{"movie+extra.mkv", "movie+extra.mkv", false, true},
+	}
+	for _, tt := range tests {
+		rules := parseIgnoreRules("/lib", []string{tt.pattern})
+		_, got := rules.match(filepath.Join("/lib", filepath.FromSlash(tt.path)), tt.isDir)
+		if got != tt.want {
+			t.Errorf("pattern %q on %q (dir=%v) = %v, want %v", tt.pattern, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreRulesLastMatchWins(t *testing.T) {
+	rules := parseIgnoreRules("/lib", []string{"*.mkv", "!keep.mkv", "# comment", "", "keep.mkv.bak"})
+	for path, want := range map[string]bool{
+		"/lib/drop.mkv":      true,
+		"/lib/keep.mkv":      false,
+		"/lib/dir/keep.mkv":  false,
+		"/lib/keep.mkv.bak":  true,
+		"/lib/other.mp4":     false,
+		"/lib/dir/drop2.mkv": true,
+	} {
+		if _, got := rules.match(path, false); got != want {
+			t.Errorf("match(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+// scanTree writes files into a temp library, scans it and returns the paths of
+// the files found relative to the library root
+func scanTree(t *testing.T, files map[string]string, exclude []string, minSize int64) []string {
+	t.Helper()
+	root := t.TempDir()
+	for name, contents := range files {
+		writeFile(t, filepath.Join(root, filepath.FromSlash(name)), contents)
+	}
+	filter := newScanFilter([]string{root}, exclude, minSize)
+	var found []string
+	err := walkMediaFiles(context.Background(), filter, nil, root, func(file MediaFile) error {
+		rel, _ := filepath.Rel(root, file.Path)
+		found = append(found, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(found)
+	return found
+}
+
+func TestScanFilterDefaults(t *testing.T) {
+	found := scanTree(t, map[string]string{
+		"Heat (1995)/Heat.1995.mkv":               "movie",
+		"Heat (1995)/Sample/heat-sample.mkv":      "sample",
+		"Heat (1995)/heat-sample.mkv":             "sample",
+		"Heat (1995)/Trailers/trailer.mp4":        "trailer",
+		"Heat (1995)/Heat-trailer.mp4":            "trailer",
+		"Heat (1995)/._Heat.1995.mkv":             "resource fork",
+		"@eaDir/Heat.1995.mkv/SYNOVIDEO_INFO.mkv": "thumbnail",
+		"#recycle/Old.Movie.mkv":                  "deleted",
+		"Downloading.mkv.part/Downloading.mkv":    "partial",
+	}, nil, 0)
+
+	// Trailers are scanned as extras
+	want := []string{"Heat (1995)/Heat-trailer.mp4", "Heat (1995)/Heat.1995.mkv", "Heat (1995)/Trailers/trailer.mp4"}
+	if strings.Join(found, ",") != strings.Join(want, ",") {
+		t.Errorf("found %v, want %v", found, want)
+	}
+}
+
+func TestScanFilterNestedIgnoreFiles(t *testing.T) {
+	found := scanTree(t, map[string]string{
+		".transgoignore":                     "Unsorted/\n*.avi\n",
+		"Unsorted/Random.mkv":                "movie",
+		"Movie (2001)/Movie.2001.mkv":        "movie",
+		"Movie (2001)/Movie.2001.avi":        "movie",
+		"Old (1990)/.transgoignore":          "!*.avi\nDeleted Scenes/\n",
+		"Old (1990)/Old.1990.avi":            "movie",
+		"Old (1990)/Deleted Scenes/a.mkv":    "extra",
+		"Old (1990)/Extras/b.mkv":            "extra",
+		"Other (2002)/.transgoignore":        "/Other.2002.mkv\n",
+		"Other (2002)/Other.2002.mkv":        "movie",
+		"Other (2002)/Nested/Other.2002.mkv": "movie",
+	}, []string{"Extras/"}, 0)
+
+	want := []string{
+		"Movie (2001)/Movie.2001.mkv",
+		"Old (1990)/Old.1990.avi",
+		"Other (2002)/Nested/Other.2002.mkv",
+	}
+	if strings.Join(found, ",") != strings.Join(want, ",") {
+		t.Errorf("found %v, want %v", found, want)
+	}
+}
+
+func TestScanFilterConfiguredPatternsCanReincludeDefaults(t *testing.T) {
+	found := scanTree(t, map[string]string{
+		"Movie (2001)/Movie.2001.mkv":     "movie",
+		"Movie (2001)/Sample/clip.mkv":    "sample",
+		"Movie (2001)/Movie-sample.mkv":   "sample",
+		"Movie (2001)/lost+found/old.mkv": "lost",
+	}, []string{"!sample/"}, 0)
+
+	want := []string{"Movie (2001)/Movie.2001.mkv", "Movie (2001)/Sample/clip.mkv"}
+	if strings.Join(found, ",") != strings.Join(want, ",") {
+		t.Errorf("found %v, want %v", found, want)
+	}
+}
+
+func TestScanFilterMinimumSize(t *testing.T) {
+	found := scanTree(t, map[string]string{
+		"Movie (2001)/Movie.2001.mkv":    strings.Repeat("x", 2048),
+		"Movie (2001)/clip.mkv":          strings.Repeat("x", 100),
+		"Movie (2001)/notes.txt":         strings.Repeat("x", 4096),
+		"Movie (2001)/Movie-trailer.mkv": strings.Repeat("x", 100),
+	}, nil, 1024)
+
+	// Extras are kept however small
+	if want := []string{"Movie (2001)/Movie-trailer.mkv", "Movie (2001)/Movie.2001.mkv"}; strings.Join(found, ",") != strings.Join(want, ",") {
+		t.Errorf("found %v, want %v", found, want)
+	}
+}
+
+func TestScanMediaHonoursIgnoreRules(t *testing.T) {
+	cfg := newTestLibrary(t)
+	cfg.Exclude = []string{"Specials/"}
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Heat (1995)", "Heat.1995.mkv"), "movie")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Heat (1995)", "Sample", "Heat.1995.mkv"), "sample")
+	writeFile(t, filepath.Join(cfg.TVDir, "Show", "Season 1", "Show.S01E01.mkv"), "episode")
+	writeFile(t, filepath.Join(cfg.TVDir, "Show", "Specials", "Show.S00E01.mkv"), "special")
+	writeFile(t, filepath.Join(cfg.TVDir, "Hidden Show", "Season 1", "Hidden.S01E01.mkv"), "episode")
+	writeFile(t, filepath.Join(cfg.TVDir, ignoreFileName), "Hidden Show/\n")
+
+	repo := newFakeRepo()
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 2 {
+		t.Errorf("scan added %d, want 2", summary.Added)
+	}
+	if len(repo.tvshows) != 1 || len(repo.seasons) != 1 {
+		t.Errorf("scan saved %d TV shows and %d seasons, want 1 each", len(repo.tvshows), len(repo.seasons))
+	}
+
+	// Incremental scans of excluded paths do nothing
+	summary, err = ScanPaths(context.Background(), repo, cfg, nil, []string{filepath.Join(cfg.TVDir, "Hidden Show")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 0 || len(repo.tvshows) != 1 {
+		t.Errorf("incremental scan of an ignored show added %d", summary.Added)
+	}
+}
+
+func TestRescanFollowsIgnoreFileEdits(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestLibrary(t)
+	heat := filepath.Join(cfg.MoviesDir, "Heat (1995)", "Heat.1995.mkv")
+	alien := filepath.Join(cfg.MoviesDir, "Alien (1979)", "Alien.1979.mkv")
+	ignoreFile := filepath.Join(cfg.MoviesDir, ignoreFileName)
+	writeFile(t, heat, "heat")
+	writeFile(t, alien, "alien")
+	writeFile(t, ignoreFile, "Alien (1979)/\n")
+
+	repo := newFakeRepo()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewriting the ignore file in place leaves every directory unchanged, yet
+	// the next incremental scan follows it
+	if err := os.WriteFile(ignoreFile, []byte("Heat (1995)/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(ignoreFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := ScanMedia(ctx, repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 1 || summary.Reconcile.Missing != 1 {
+		t.Errorf("rescan added %d and marked %d missing, want 1 each", summary.Added, summary.Reconcile.Missing)
+	}
+	if m, err := repo.GetMediaByPath(ctx, heat); err != nil || !m.MissingSince.Valid {
+		t.Errorf("newly ignored movie was not marked missing: %+v, %v", m, err)
+	}
+	if _, err := repo.GetMediaByPath(ctx, alien); err != nil {
+		t.Errorf("movie no longer ignored was not added: %v", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"1024", 1024, true},
+		{"50MB", 50 << 20, true},
+		{"50 mb", 50 << 20, true},
+		{"1.5GiB", 3 << 29, true},
+		{"10k", 10 << 10, true},
+		{"10 parsecs", 0, false},
+		{"-5MB", 0, false},
+		{"MB", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseSize(%q) = %d, %v; want %d, ok=%v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"context"
 	"embed"
+	"errors"
 	"log"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 //go:embed views
@@ -14,6 +20,10 @@ var viewsFS embed.FS
 const staticDir = "./static"
 
 func main() {
+	// Stop gracefully on interrupt so a running scan is cancelled cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Load database configuration
 	cfg := NewConfig()
 
@@ -27,8 +37,31 @@ func main() {
 	// Initialize repository
 	repo := NewRepository(database)
 
+	// Load scanner configuration
+	scanCfg := NewScanConfig()
+
+	// Look up metadata online if a provider is configured
+	metadataCfg := NewMetadataConfig()
+	if provider := metadataCfg.Provider(); provider != nil {
+		scanCfg.Metadata = provider
+		scanCfg.ArtworkDir = metadataCfg.ArtworkDir()
+	}
+
+	// Initialize the event bus and the scan job manager
+	events := NewEventBus()
+	scans := NewScanJobs(repo, scanCfg, events)
+
+	// Watch the library for changes if enabled
+	if scanCfg.Watch {
+		watcher, err := NewWatcher(scanCfg, scans)
+		if err != nil {
+			log.Fatalf("Failed to watch media directories: %v", err)
+		}
+		go watcher.Run(ctx)
+	}
+
 	// Initialize handlers
-	handlers := NewHandlers(repo)
+	handlers := NewHandlers(repo, scans, events)
 
 	// Setup HTTP routes
 	mux := http.NewServeMux()
@@ -52,8 +85,15 @@ func main() {
 	mux.HandleFunc("GET /tvshows", handlers.TVShowsHandler)
 	mux.HandleFunc("GET /tvshow/{id}/season/{seasonNum}", handlers.SeasonHandler)
 	mux.HandleFunc("GET /tvshow/{id}", handlers.TVShowHandler)
+	mux.HandleFunc("POST /tvshow/{id}/order", handlers.EpisodeOrderHandler)
 	mux.HandleFunc("GET /media/{id}", handlers.MediaHandler)
+	mux.HandleFunc("GET /media/{id}/video", handlers.VideoHandler)
+	mux.HandleFunc("GET /subtitles/{file}", handlers.SubtitleHandler)
+	mux.HandleFunc("GET /artwork/{kind}/{id}", handlers.ArtworkHandler)
 	mux.HandleFunc("POST /scan", handlers.ScanHandler)
+	mux.HandleFunc("POST /scan/cancel", handlers.CancelScanHandler)
+	mux.HandleFunc("GET /scan/status", handlers.ScanStatusHandler)
+	mux.HandleFunc("GET /events", handlers.EventsHandler)
 	mux.HandleFunc("GET /hello", handlers.HelloHandler)
 	mux.HandleFunc("GET /standalone", handlers.StandaloneHandler)
 
@@ -62,10 +102,31 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
+	server := &http.Server{
+		Addr:    ":" + port,
+		Handler: mux,
+		// Cancel request contexts on shutdown so event streams end
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		log.Printf("Shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
 	log.Printf("Server listening on :%s", port)
-	if err := http.ListenAndServe(":"+port, mux); err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Server failed to start: %v", err)
 	}
+
+	// Stop any running scan before the database connection is closed
+	if run, cancelled := scans.Cancel(); cancelled {
+		log.Printf("Cancelled scan run %d", run.ID)
+	}
 }
 
 // Other existing code in main.go can remain unchanged
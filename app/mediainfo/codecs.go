@@ -0,0 +1,163 @@
+package mediainfo
+
+import "strings"
+
+// matroskaCodecs maps Matroska codec IDs to display names. IDs are matched by
+// prefix, so "A_AAC" covers "A_AAC/MPEG4/LC" and the like.
+var matroskaCodecs = []struct{ prefix, name string }{
+	{"V_MPEG4/ISO/AVC", "H.264"},
+	{"V_MPEGH/ISO/HEVC", "H.265"},
+	{"V_AV1", "AV1"},
+	{"V_VP9", "VP9"},
+	{"V_VP8", "VP8"},
+	{"V_MPEG4/ISO/", "MPEG-4"},
+	{"V_MPEG4/MS/V3", "DivX"},
+	{"V_MPEG2", "MPEG-2"},
+	{"V_MPEG1", "MPEG-1"},
+	{"V_MS/VFW/FOURCC", "VFW"},
+	{"V_THEORA", "Theora"},
+	{"A_AAC", "AAC"},
+	{"A_EAC3", "E-AC3"},
+	{"A_AC3", "AC3"},
+	{"A_DTS", "DTS"},
+	{"A_TRUEHD", "TrueHD"},
+	{"A_FLAC", "FLAC"},
+	{"A_OPUS", "Opus"},
+	{"A_VORBIS", "Vorbis"},
+	{"A_MPEG/L3", "MP3"},
+	{"A_MPEG/L2", "MP2"},
+	{"A_PCM", "PCM"},
+	{"S_TEXT/UTF8", "SubRip"},
+	{"S_TEXT/ASCII", "SubRip"},
+	{"S_TEXT/ASS", "ASS"},
+	{"S_TEXT/SSA", "SSA"},
+	{"S_TEXT/WEBVTT", "WebVTT"},
+	{"D_WEBVTT", "WebVTT"},
+	{"S_HDMV/PGS", "PGS"},
+	{"S_VOBSUB", "VobSub"},
+	{"S_DVBSUB", "DVB"},
+}
+
+// mp4Codecs maps MP4 sample entry types to display names
+var mp4Codecs = map[string]string{
+	"avc1": "H.264",
+	"avc3": "H.264",
+	"hvc1": "H.265",
+	"hev1": "H.265",
+	"dvh1": "H.265",
+	"dvhe": "H.265",
+	"av01": "AV1",
+	"vp09": "VP9",
+	"mp4v": "MPEG-4",
+	"mp4a": "AAC",
+	"ac-3": "AC3",
+	"ec-3": "E-AC3",
+	"dtsc": "DTS",
+	"dtsh": "DTS-HD",
+	"dtsl": "DTS-HD MA",
+	"mlpa": "TrueHD",
+	"fLaC": "FLAC",
+	"Opus": "Opus",
+	".mp3": "MP3",
+	"lpcm": "PCM",
+	"sowt": "PCM",
+	"twos": "PCM",
+	"tx3g": "Timed Text",
+	"text": "Timed Text",
+	"wvtt": "WebVTT",
+	"stpp": "TTML",
+	"c608": "CEA-608",
+	"apcn": "ProRes",
+	"apch": "ProRes",
+	"apcs": "ProRes",
+	"apco": "ProRes",
+	"ap4h": "ProRes",
+	"jpeg": "Motion JPEG",
+}
+
+// ffprobeCodecs maps ffprobe codec names to display names
+var ffprobeCodecs = map[string]string{
+	"h264":              "H.264",
+	"hevc":              "H.265",
+	"av1":               "AV1",
+	"vp9":               "VP9",
+	"vp8":               "VP8",
+	"mpeg4":             "MPEG-4",
+	"msmpeg4v3":         "DivX",
+	"msmpeg4v2":         "MPEG-4",
+	"mpeg2video":        "MPEG-2",
+	"mpeg1video":        "MPEG-1",
+	"vc1":               "VC-1",
+	"wmv3":              "WMV",
+	"wmv2":              "WMV",
+	"wmv1":              "WMV",
+	"flv1":              "Sorenson Spark",
+	"theora":            "Theora",
+	"prores":            "ProRes",
+	"mjpeg":             "Motion JPEG",
+	"aac":               "AAC",
+	"ac3":               "AC3",
+	"eac3":              "E-AC3",
+	"dts":               "DTS",
+	"truehd":            "TrueHD",
+	"mlp":               "TrueHD",
+	"flac":              "FLAC",
+	"opus":              "Opus",
+	"vorbis":            "Vorbis",
+	"mp3":               "MP3",
+	"mp2":               "MP2",
+	"wmav1":             "WMA",
+	"wmav2":             "WMA",
+	"wmapro":            "WMA Pro",
+	"subrip":            "SubRip",
+	"srt":               "SubRip",
+	"ass":               "ASS",
+	"ssa":               "SSA",
+	"webvtt":            "WebVTT",
+	"mov_text":          "Timed Text",
+	"hdmv_pgs_subtitle": "PGS",
+	"dvd_subtitle":      "VobSub",
+	"dvb_subtitle":      "DVB",
+	"eia_608":           "CEA-608",
+}
+
+// matroskaCodec returns the display name of a Matroska codec ID
+func matroskaCodec(id string) string {
+	for _, c := range matroskaCodecs {
+		if strings.HasPrefix(id, c.prefix) {
+			return c.name
+		}
+	}
+	return id
+}
+
+// mp4Codec returns the display name of an MP4 sample entry type
+func mp4Codec(typ string) string {
+	if name, ok := mp4Codecs[typ]; ok {
+		return name
+	}
+	return strings.TrimSpace(typ)
+}
+
+// ffprobeCodec returns the display name of an ffprobe codec. MPEG-4 video is
+// told apart by its FourCC and DTS by its profile, as release names do.
+func ffprobeCodec(name, fourCC, profile string) string {
+	switch {
+	case name == "mpeg4" && strings.EqualFold(fourCC, "XVID"):
+		return "XviD"
+	case name == "mpeg4" && (strings.EqualFold(fourCC, "DIVX") || strings.EqualFold(fourCC, "DX50")):
+		return "DivX"
+	case name == "dts" && strings.Contains(profile, "DTS:X"):
+		return "DTS:X"
+	case name == "dts" && profile == "DTS-HD MA":
+		return "DTS-HD MA"
+	case name == "dts" && strings.HasPrefix(profile, "DTS-HD"):
+		return "DTS-HD"
+	case strings.HasPrefix(name, "pcm_"):
+		return "PCM"
+	}
+	if display, ok := ffprobeCodecs[name]; ok {
+		return display
+	}
+	return name
+}
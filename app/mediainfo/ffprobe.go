@@ -0,0 +1,204 @@
+package mediainfo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FFprobe is a Prober running ffprobe, for the formats the native reader does
+// not understand, such as AVI, WMV, FLV and MPEG transport streams
+type FFprobe struct {
+	// Path is the ffprobe executable
+	Path string
+	// Timeout bounds each run, so a file ffprobe hangs on cannot stall a scan;
+	// zero means no limit
+	Timeout time.Duration
+}
+
+// ffprobeWaitDelay is how long Probe waits for ffprobe's output to close once
+// it has been killed, in case a child process still holds it
+const ffprobeWaitDelay = time.Second
+
+// ffprobeArgs make ffprobe print the container, streams and chapters as JSON
+var ffprobeArgs = []string{"-v", "error", "-print_format", "json", "-show_format", "-show_streams", "-show_chapters"}
+
+// ffprobeOutput is the part of ffprobe's JSON output that is used
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string            `json:"format_name"`
+		Duration   string            `json:"duration"`
+		Tags       map[string]string `json:"tags"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		CodecTag     string            `json:"codec_tag_string"`
+		Profile      string            `json:"profile"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		Channels     int               `json:"channels"`
+		SampleRate   string            `json:"sample_rate"`
+		Disposition  map[string]int    `json:"disposition"`
+		Tags         map[string]string `json:"tags"`
+	} `json:"streams"`
+	Chapters []struct {
+		StartTime string            `json:"start_time"`
+		EndTime   string            `json:"end_time"`
+		Tags      map[string]string `json:"tags"`
+	} `json:"chapters"`
+}
+
+// Probe runs ffprobe on a file. Files ffprobe cannot read give its error
+// message.
+func (f *FFprobe) Probe(ctx context.Context, path string) (Info, error) {
+	runCtx := ctx
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(runCtx, f.Path, append(ffprobeArgs, path)...)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	cmd.WaitDelay = ffprobeWaitDelay
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+			return Info{}, fmt.Errorf("ffprobe timed out after %v", f.Timeout)
+		}
+		var exitErr *exec.ExitError
+		if msg := strings.TrimSpace(stderr.String()); errors.As(err, &exitErr) && msg != "" {
+			return Info{}, fmt.Errorf("ffprobe: %s", msg)
+		}
+		return Info{}, fmt.Errorf("running ffprobe: %w", err)
+	}
+	return parseFFprobe(stdout.Bytes())
+}
+
+// parseFFprobe converts ffprobe's JSON output to the stream model the native
+// reader uses. Streams other than video, audio and subtitles, such as
+// attachments and data streams, are left out.
+func parseFFprobe(data []byte) (Info, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return Info{}, fmt.Errorf("reading ffprobe output: %w", err)
+	}
+	if out.Format.FormatName == "" {
+		return Info{}, ErrUnknownFormat
+	}
+
+	info := Info{
+		Format:   ffprobeFormat(out.Format.FormatName, out.Format.Tags["major_brand"]),
+		Title:    tag(out.Format.Tags, "title"),
+		Duration: seconds(out.Format.Duration),
+	}
+	for _, st := range out.Streams {
+		s := Stream{
+			Index:    len(info.Streams),
+			CodecID:  st.CodecName,
+			Codec:    ffprobeCodec(st.CodecName, st.CodecTag, st.Profile),
+			Language: tag(st.Tags, "language"),
+			Title:    tag(st.Tags, "title"),
+			Default:  st.Disposition["default"] != 0,
+			Forced:   st.Disposition["forced"] != 0,
+		}
+		if s.Language == "und" {
+			s.Language = ""
+		}
+		switch st.CodecType {
+		case "video":
+			if st.Disposition["attached_pic"] != 0 {
+				// Cover art stored as a video stream
+				continue
+			}
+			s.Type = StreamVideo
+			s.Width, s.Height = st.Width, st.Height
+			fps := rational(st.AvgFrameRate)
+			if fps == 0 {
+				fps = rational(st.RFrameRate)
+			}
+			if fps > 0 {
+				s.FrameRate = frameRate(fps)
+			}
+		case "audio":
+			s.Type = StreamAudio
+			s.Channels = st.Channels
+			s.SampleRate, _ = strconv.Atoi(st.SampleRate)
+		case "subtitle":
+			s.Type = StreamSubtitle
+		default:
+			continue
+		}
+		info.Streams = append(info.Streams, s)
+	}
+	for _, ch := range out.Chapters {
+		info.Chapters = append(info.Chapters, Chapter{
+			Start: seconds(ch.StartTime),
+			End:   seconds(ch.EndTime),
+			Title: tag(ch.Tags, "title"),
+		})
+	}
+	return info, nil
+}
+
+// ffprobeFormat names a container the way the native reader does. ffprobe
+// names formats by the demuxer that read them, which may list several, such as
+// "mov,mp4,m4a,3gp,3g2,mj2"; the brand tells QuickTime files from MP4.
+func ffprobeFormat(name, brand string) string {
+	name, _, _ = strings.Cut(name, ",")
+	switch name {
+	case "matroska":
+		return FormatMatroska
+	case "mov":
+		if strings.TrimSpace(brand) == "qt" {
+			return FormatQuickTime
+		}
+		return FormatMP4
+	}
+	return name
+}
+
+// tag returns a tag, whose case varies between containers
+func tag(tags map[string]string, name string) string {
+	if v, ok := tags[name]; ok {
+		return v
+	}
+	for k, v := range tags {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// seconds parses a time in seconds as ffprobe prints it, such as "5.025000"
+func seconds(s string) time.Duration {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v <= 0 {
+		return 0
+	}
+	return time.Duration(v * float64(time.Second))
+}
+
+// rational parses a rate such as "24000/1001", returning 0 for "0/0"
+func rational(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		v, _ := strconv.ParseFloat(s, 64)
+		return v
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || d == 0 {
+		return 0
+	}
+	return n / d
+}
@@ -0,0 +1,128 @@
+package mediainfo
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"transogov2/app/mediainfo/ffprobetest"
+)
+
+// fakeFFprobe writes a fake ffprobe that prints the canned output in
+// testdata/ffprobe/<name>, or prints stderr and fails if name is empty
+func fakeFFprobe(t *testing.T, name, stderr string) (path, argsFile string) {
+	t.Helper()
+	if name == "" {
+		return ffprobetest.Fake(t, "echo '"+stderr+"' >&2\nexit 1\n")
+	}
+	return ffprobetest.Fake(t, ffprobetest.Output(t, filepath.Join("testdata", "ffprobe", name)))
+}
+
+func TestFFprobe(t *testing.T) {
+	tests := []struct {
+		name string
+		want Info
+	}{
+		{"avi.json", Info{
+			Format:   FormatAVI,
+			Duration: 6987520 * time.Millisecond,
+			Streams: []Stream{
+				{Index: 0, Type: StreamVideo, Codec: "XviD", CodecID: "mpeg4", Width: 720, Height: 304, FrameRate: 25},
+				{Index: 1, Type: StreamAudio, Codec: "MP3", CodecID: "mp3", Channels: 2, SampleRate: 48000},
+			},
+		}},
+		{"mkv.json", Info{
+			Format:   FormatMatroska,
+			Title:    "Heat",
+			Duration: 7200500 * time.Millisecond,
+			Streams: []Stream{
+				{Index: 0, Type: StreamVideo, Codec: "H.265", CodecID: "hevc", Language: "eng", Default: true, Width: 3840, Height: 2160, FrameRate: 23.976},
+				{Index: 1, Type: StreamAudio, Codec: "DTS-HD MA", CodecID: "dts", Language: "eng", Title: "Surround 7.1", Default: true, Channels: 8, SampleRate: 48000},
+				{Index: 2, Type: StreamSubtitle, Codec: "PGS", CodecID: "hdmv_pgs_subtitle", Language: "ger", Forced: true},
+			},
+			Chapters: []Chapter{
+				{Start: 0, End: 5 * time.Minute, Title: "Opening"},
+				{Start: 5 * time.Minute, End: 7200500 * time.Millisecond, Title: "The Heist"},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, argsFile := fakeFFprobe(t, tt.name, "")
+			got, err := (&FFprobe{Path: path}).Probe(context.Background(), "/media/movie file.avi")
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Probe =\n%+v\nwant\n%+v", got, tt.want)
+			}
+
+			args, err := os.ReadFile(argsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Join(append(ffprobeArgs, "/media/movie file.avi"), "\n") + "\n"
+			if string(args) != want {
+				t.Errorf("ffprobe arguments = %q, want %q", args, want)
+			}
+		})
+	}
+}
+
+func TestFFprobeErrors(t *testing.T) {
+	path, _ := fakeFFprobe(t, "", "movie.avi: Invalid data found when processing input")
+	_, err := (&FFprobe{Path: path}).Probe(context.Background(), "movie.avi")
+	if err == nil || err.Error() != "ffprobe: movie.avi: Invalid data found when processing input" {
+		t.Errorf("Probe error = %v, want ffprobe's message", err)
+	}
+
+	_, err = (&FFprobe{Path: filepath.Join(t.TempDir(), "missing")}).Probe(context.Background(), "movie.avi")
+	if err == nil || !strings.HasPrefix(err.Error(), "running ffprobe") {
+		t.Errorf("Probe with a missing executable error = %v", err)
+	}
+}
+
+func TestFFprobeTimeout(t *testing.T) {
+	path, _ := ffprobetest.Fake(t, "sleep 10\n")
+	start := time.Now()
+	_, err := (&FFprobe{Path: path, Timeout: 100 * time.Millisecond}).Probe(context.Background(), "movie.avi")
+	if err == nil || err.Error() != "ffprobe timed out after 100ms" {
+		t.Errorf("Probe error = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Probe took %v with a 100ms timeout", elapsed)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	path, argsFile := fakeFFprobe(t, "avi.json", "")
+	prober := Fallback{Native{}, &FFprobe{Path: path}}
+	ctx := context.Background()
+
+	// Native formats never reach ffprobe
+	info, err := prober.Probe(ctx, filepath.Join("testdata", "sample.mkv"))
+	if err != nil || info.Format != FormatMatroska {
+		t.Fatalf("Probe(sample.mkv) = %q, %v", info.Format, err)
+	}
+	if _, err := os.Stat(argsFile); !errors.Is(err, os.ErrNotExist) {
+		t.Error("ffprobe ran for a Matroska file")
+	}
+	// Nor do broken ones
+	if _, err := prober.Probe(ctx, filepath.Join("testdata", "truncated.mkv")); err == nil {
+		t.Error("Probe(truncated.mkv) returned no error")
+	}
+
+	info, err = prober.Probe(ctx, filepath.Join("testdata", "unknown.avi"))
+	if err != nil || info.Format != FormatAVI {
+		t.Errorf("Probe(unknown.avi) = %q, %v, want ffprobe's result", info.Format, err)
+	}
+
+	if _, err := (Fallback{Native{}}).Probe(ctx, filepath.Join("testdata", "unknown.avi")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("native Probe(unknown.avi) error = %v, want ErrUnknownFormat", err)
+	}
+}
@@ -0,0 +1,37 @@
+// Package ffprobetest provides a fake ffprobe for tests
+package ffprobetest
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Fake writes a shell script standing in for ffprobe and returns its path. The
+// script records its arguments in argsFile, one per line, then runs body. Tests
+// are skipped on Windows, which cannot run it.
+func Fake(t testing.TB, body string) (path, argsFile string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake ffprobe is a shell script")
+	}
+	dir := t.TempDir()
+	path = filepath.Join(dir, "ffprobe")
+	argsFile = filepath.Join(dir, "args")
+	script := "#!/bin/sh\nprintf '%s\\n' \"$@\" > '" + argsFile + "'\n" + body
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path, argsFile
+}
+
+// Output returns a script body printing the canned ffprobe output in file
+func Output(t testing.TB, file string) string {
+	t.Helper()
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "cat '" + abs + "'\n"
+}
@@ -0,0 +1,494 @@
+package mediainfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// maxMovieBoxSize caps the size of the movie box read into memory; the sample
+// tables of a feature film take a few megabytes at most
+const maxMovieBoxSize = 64 << 20
+
+// probeISOBMFF reads the movie box of an MP4 or QuickTime file, which holds the
+// duration and tracks. It may come after the media data.
+func probeISOBMFF(r io.ReaderAt, size int64) (Info, error) {
+	info := Info{Format: FormatMP4}
+	var moov []byte
+	for pos := int64(0); pos < size && moov == nil; {
+		typ, dataStart, n, err := readBoxHeader(r, pos, size)
+		if err != nil {
+			return info, err
+		}
+		switch typ {
+		case "ftyp":
+			brand := make([]byte, 4)
+			if _, err := r.ReadAt(brand, dataStart); err == nil && string(brand) == "qt  " {
+				info.Format = FormatQuickTime
+			}
+		case "moov":
+			if n > maxMovieBoxSize {
+				return info, fmt.Errorf("movie box of %d bytes is too large", n)
+			}
+			moov = make([]byte, n)
+			if _, err := r.ReadAt(moov, dataStart); err != nil {
+				return info, errTruncated
+			}
+		}
+		pos = dataStart + n
+	}
+	if moov == nil {
+		return info, errors.New("no movie box")
+	}
+
+	var tracks []mp4Track
+	err := boxChildren(moov, func(typ string, data []byte) error {
+		switch typ {
+		case "mvhd":
+			timescale, duration, err := readMediaHeader(data)
+			if err != nil {
+				return err
+			}
+			if timescale > 0 {
+				info.Duration = time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+			}
+		case "trak":
+			t, err := readTrack(data)
+			if err != nil {
+				return err
+			}
+			tracks = append(tracks, t)
+		}
+		return nil
+	})
+	if err != nil {
+		return info, err
+	}
+
+	// QuickTime chapters are text tracks referred to by the other tracks
+	chapters := make(map[uint32]bool)
+	for _, t := range tracks {
+		for _, id := range t.chapters {
+			chapters[id] = true
+		}
+	}
+	for _, t := range tracks {
+		if !chapters[t.id] {
+			continue
+		}
+		if info.Chapters == nil {
+			if info.Chapters, err = readChapterTrack(r, t); err != nil {
+				return info, err
+			}
+		}
+	}
+	for _, t := range tracks {
+		if t.stream.Type == "" || chapters[t.id] {
+			continue
+		}
+		t.stream.Index = len(info.Streams)
+		info.Streams = append(info.Streams, t.stream)
+	}
+	return info, nil
+}
+
+// maxChapters caps the number of chapters read from a chapter track
+const maxChapters = 1000
+
+// readChapterTrack reads the chapter titles held in the samples of a QuickTime
+// chapter track. Each sample is a 16-bit length followed by the title, and
+// lasts as long as its chapter.
+func readChapterTrack(r io.ReaderAt, t mp4Track) ([]Chapter, error) {
+	if t.timescale == 0 {
+		return nil, nil
+	}
+	var chapters []Chapter
+	var start uint64
+	offsets, sizes := t.sampleOffsets()
+	durations := t.sampleDurations()
+	for i := 0; i < len(offsets) && i < len(durations) && i < maxChapters; i++ {
+		buf := make([]byte, min(sizes[i], 1024))
+		if _, err := r.ReadAt(buf, offsets[i]); err != nil {
+			return nil, errTruncated
+		}
+		c := Chapter{
+			Start: time.Duration(float64(start) / float64(t.timescale) * float64(time.Second)),
+			End:   time.Duration(float64(start+durations[i]) / float64(t.timescale) * float64(time.Second)),
+		}
+		if len(buf) >= 2 {
+			n := int(binary.BigEndian.Uint16(buf))
+			c.Title = chapterText(buf[2:min(2+n, len(buf))])
+		}
+		chapters = append(chapters, c)
+		start += durations[i]
+	}
+	return chapters, nil
+}
+
+// chapterText decodes the text of a chapter sample, which is UTF-8 unless it
+// starts with a UTF-16 byte order mark
+func chapterText(b []byte) string {
+	if len(b) >= 2 && (b[0] == 0xFE && b[1] == 0xFF || b[0] == 0xFF && b[1] == 0xFE) {
+		order := binary.ByteOrder(binary.BigEndian)
+		if b[0] == 0xFF {
+			order = binary.LittleEndian
+		}
+		units := make([]uint16, 0, len(b)/2)
+		for b = b[2:]; len(b) >= 2; b = b[2:] {
+			units = append(units, order.Uint16(b))
+		}
+		return string(utf16.Decode(units))
+	}
+	return strings.TrimPrefix(string(b), "\uFEFF")
+}
+
+// mp4Track is a track box as read by readTrack
+type mp4Track struct {
+	id        uint32
+	stream    Stream   // with no type for tracks that are not streams
+	chapters  []uint32 // IDs of the tracks holding this track's chapters
+	timescale uint32
+	// The sample tables locating the track's samples in the file
+	stts, stsz, stsc, stco []byte
+	co64                   bool
+}
+
+// sampleOffsets returns the file offset and size of each sample, from the
+// chunk offsets, the samples in each chunk and the sample sizes
+func (t mp4Track) sampleOffsets() (offsets, sizes []int64) {
+	if len(t.stsz) < 12 || len(t.stsc) < 8 || len(t.stco) < 8 {
+		return nil, nil
+	}
+	count := min(int(binary.BigEndian.Uint32(t.stsz[8:])), maxChapters)
+	fixed := int64(binary.BigEndian.Uint32(t.stsz[4:]))
+	for i := 0; i < count; i++ {
+		size := fixed
+		if size == 0 {
+			if len(t.stsz) < 12+4*(i+1) {
+				break
+			}
+			size = int64(binary.BigEndian.Uint32(t.stsz[12+4*i:]))
+		}
+		sizes = append(sizes, size)
+	}
+
+	// Entry counts are capped by the data there is, so a corrupt count cannot
+	// run the loops on for billions of entries
+	width := 4
+	if t.co64 {
+		width = 8
+	}
+	data := t.stco[8:]
+	entries := min(int(binary.BigEndian.Uint32(t.stco[4:])), len(data)/width)
+	chunks := make([]int64, 0, entries)
+	for ; len(chunks) < entries; data = data[width:] {
+		if t.co64 {
+			chunks = append(chunks, int64(binary.BigEndian.Uint64(data)))
+		} else {
+			chunks = append(chunks, int64(binary.BigEndian.Uint32(data)))
+		}
+	}
+
+	// Sample-to-chunk entries give the samples per chunk from a first chunk on
+	runs := min(int(binary.BigEndian.Uint32(t.stsc[4:])), (len(t.stsc)-8)/12)
+	sample := 0
+	for run := 0; run < runs && sample < len(sizes); run++ {
+		entry := t.stsc[8+12*run:]
+		first := int(binary.BigEndian.Uint32(entry)) - 1
+		perChunk := int(binary.BigEndian.Uint32(entry[4:]))
+		last := len(chunks)
+		if run+1 < runs {
+			last = int(binary.BigEndian.Uint32(t.stsc[8+12*(run+1):])) - 1
+		}
+		for chunk := max(first, 0); chunk < min(last, len(chunks)) && sample < len(sizes); chunk++ {
+			offset := chunks[chunk]
+			for i := 0; i < perChunk && sample < len(sizes); i++ {
+				offsets = append(offsets, offset)
+				offset += sizes[sample]
+				sample++
+			}
+		}
+	}
+	return offsets, sizes[:len(offsets)]
+}
+
+// sampleDurations returns the duration of each sample in the media timescale
+func (t mp4Track) sampleDurations() []uint64 {
+	if len(t.stts) < 8 {
+		return nil
+	}
+	var durations []uint64
+	entries := binary.BigEndian.Uint32(t.stts[4:])
+	data := t.stts[8:]
+	for i := uint32(0); i < entries && len(data) >= 8 && len(durations) < maxChapters; i++ {
+		count := binary.BigEndian.Uint32(data)
+		delta := uint64(binary.BigEndian.Uint32(data[4:]))
+		for j := uint32(0); j < count && len(durations) < maxChapters; j++ {
+			durations = append(durations, delta)
+		}
+		data = data[8:]
+	}
+	return durations
+}
+
+// readTrack reads a track box. Tracks that are not video, audio or subtitles,
+// such as timecode tracks, are given no stream type.
+func readTrack(trak []byte) (mp4Track, error) {
+	var t mp4Track
+	var s Stream
+	var handler string
+	var timescale uint32
+	var samples, sampleTime uint64
+	var width, height int
+	err := boxChildren(trak, func(typ string, data []byte) error {
+		switch typ {
+		case "tkhd":
+			// Version and flags, then times and IDs whose size depends on
+			// the version, then 52 bytes before the 16.16 width and height
+			if len(data) < 4 {
+				return errTruncated
+			}
+			s.Default = data[3]&1 != 0
+			idOff, off := 12, 4+20+52
+			if data[0] == 1 {
+				idOff, off = 20, 4+32+52
+			}
+			if len(data) < off+8 {
+				return errTruncated
+			}
+			t.id = binary.BigEndian.Uint32(data[idOff:])
+			width = int(binary.BigEndian.Uint32(data[off:]) >> 16)
+			height = int(binary.BigEndian.Uint32(data[off+4:]) >> 16)
+		case "mdia":
+			return boxChildren(data, func(typ string, data []byte) error {
+				switch typ {
+				case "mdhd":
+					var err error
+					timescale, _, err = readMediaHeader(data)
+					if err != nil {
+						return err
+					}
+					s.Language = mediaLanguage(data)
+				case "hdlr":
+					if len(data) < 12 {
+						return errTruncated
+					}
+					handler = string(data[8:12])
+				case "minf":
+					return boxChildren(data, func(typ string, data []byte) error {
+						if typ != "stbl" {
+							return nil
+						}
+						return boxChildren(data, func(typ string, data []byte) error {
+							switch typ {
+							case "stsd":
+								return readSampleDescription(data, &s)
+							case "stts":
+								t.stts = data
+								samples, sampleTime = readTimeToSample(data)
+							case "stsz":
+								t.stsz = data
+							case "stsc":
+								t.stsc = data
+							case "stco", "co64":
+								t.stco, t.co64 = data, typ == "co64"
+							}
+							return nil
+						})
+					})
+				}
+				return nil
+			})
+		case "tref":
+			return boxChildren(data, func(typ string, data []byte) error {
+				if typ == "chap" {
+					for ; len(data) >= 4; data = data[4:] {
+						t.chapters = append(t.chapters, binary.BigEndian.Uint32(data))
+					}
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return t, err
+	}
+	t.timescale = timescale
+
+	switch handler {
+	case "vide":
+		s.Type = StreamVideo
+		// The sample description gives the coded size, the track header the
+		// displayed one
+		if width > 0 && height > 0 {
+			s.Width, s.Height = width, height
+		}
+		if sampleTime > 0 && timescale > 0 {
+			s.FrameRate = frameRate(float64(samples) * float64(timescale) / float64(sampleTime))
+		}
+		s.Channels, s.SampleRate = 0, 0
+	case "soun":
+		s.Type = StreamAudio
+		s.Width, s.Height = 0, 0
+	case "sbtl", "subt", "text", "clcp":
+		s.Type = StreamSubtitle
+		s.Width, s.Height, s.Channels, s.SampleRate = 0, 0, 0, 0
+	default:
+		return t, nil
+	}
+	s.Codec = mp4Codec(s.CodecID)
+	t.stream = s
+	return t, nil
+}
+
+// readSampleDescription reads the codec of the first sample entry, and the
+// picture size or the audio format
+func readSampleDescription(stsd []byte, s *Stream) error {
+	// Version and flags, entry count, then the entries as boxes
+	if len(stsd) < 8 {
+		return errTruncated
+	}
+	first := true
+	return boxChildren(stsd[8:], func(typ string, data []byte) error {
+		if !first {
+			return nil
+		}
+		first = false
+		s.CodecID = typ
+		// Visual entries: 6 reserved bytes, the data reference index and 16
+		// bytes of version and vendor fields before width and height. Audio
+		// entries: the same 8 bytes, 8 reserved bytes, then channel count,
+		// sample size, 4 more bytes and the 16.16 sample rate.
+		if len(data) >= 28 {
+			s.Width = int(binary.BigEndian.Uint16(data[24:]))
+			s.Height = int(binary.BigEndian.Uint16(data[26:]))
+			s.Channels = int(binary.BigEndian.Uint16(data[16:]))
+			s.SampleRate = int(binary.BigEndian.Uint32(data[24:]) >> 16)
+		}
+		return nil
+	})
+}
+
+// readTimeToSample returns the number of samples and their total duration in
+// the media timescale
+func readTimeToSample(stts []byte) (samples, duration uint64) {
+	if len(stts) < 8 {
+		return 0, 0
+	}
+	entries := binary.BigEndian.Uint32(stts[4:])
+	data := stts[8:]
+	for i := uint32(0); i < entries && len(data) >= 8; i++ {
+		count := uint64(binary.BigEndian.Uint32(data))
+		delta := uint64(binary.BigEndian.Uint32(data[4:]))
+		samples += count
+		duration += count * delta
+		data = data[8:]
+	}
+	return samples, duration
+}
+
+// readMediaHeader reads the timescale and duration of a movie or media header
+func readMediaHeader(data []byte) (timescale uint32, duration uint64, err error) {
+	if len(data) < 4 {
+		return 0, 0, errTruncated
+	}
+	if data[0] == 1 {
+		if len(data) < 4+28 {
+			return 0, 0, errTruncated
+		}
+		return binary.BigEndian.Uint32(data[20:]), binary.BigEndian.Uint64(data[24:]), nil
+	}
+	if len(data) < 4+16 {
+		return 0, 0, errTruncated
+	}
+	return binary.BigEndian.Uint32(data[12:]), uint64(binary.BigEndian.Uint32(data[16:])), nil
+}
+
+// mediaLanguage decodes the packed ISO 639-2 language of a media header
+func mediaLanguage(mdhd []byte) string {
+	off := 4 + 16
+	if mdhd[0] == 1 {
+		off = 4 + 28
+	}
+	if len(mdhd) < off+2 {
+		return ""
+	}
+	packed := binary.BigEndian.Uint16(mdhd[off:])
+	lang := []byte{
+		byte(packed>>10&0x1F) + 0x60,
+		byte(packed>>5&0x1F) + 0x60,
+		byte(packed&0x1F) + 0x60,
+	}
+	for _, c := range lang {
+		if c < 'a' || c > 'z' {
+			// QuickTime's older Macintosh language codes
+			return ""
+		}
+	}
+	if string(lang) == "und" {
+		return ""
+	}
+	return string(lang)
+}
+
+// readBoxHeader reads the type and data size of the box at pos
+func readBoxHeader(r io.ReaderAt, pos, end int64) (typ string, dataStart, size int64, err error) {
+	buf := make([]byte, 16)
+	n, err := r.ReadAt(buf, pos)
+	if n < 8 {
+		if err == nil || err == io.EOF {
+			err = errTruncated
+		}
+		return "", 0, 0, err
+	}
+	typ = string(buf[4:8])
+	boxSize := int64(binary.BigEndian.Uint32(buf))
+	dataStart = pos + 8
+	switch boxSize {
+	case 0:
+		// The box runs to the end of the file
+		return typ, dataStart, end - dataStart, nil
+	case 1:
+		if n < 16 {
+			return "", 0, 0, errTruncated
+		}
+		boxSize = int64(binary.BigEndian.Uint64(buf[8:]))
+		dataStart += 8
+	}
+	if boxSize < dataStart-pos || pos+boxSize > end {
+		return "", 0, 0, errTruncated
+	}
+	return typ, dataStart, boxSize - (dataStart - pos), nil
+}
+
+// boxChildren calls fn for each box in data
+func boxChildren(data []byte, fn func(typ string, data []byte) error) error {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		start := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return errTruncated
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			start = 16
+		}
+		if size < start || size > uint64(len(data)) {
+			return errTruncated
+		}
+		if err := fn(typ, data[start:size]); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+	return nil
+}
@@ -0,0 +1,502 @@
+package mediainfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Matroska element IDs, with their length marker
+const (
+	idEBML            = 0x1A45DFA3
+	idDocType         = 0x4282
+	idSegment         = 0x18538067
+	idSeekHead        = 0x114D9B74
+	idSeek            = 0x4DBB
+	idSeekID          = 0x53AB
+	idSeekPosition    = 0x53AC
+	idInfo            = 0x1549A966
+	idTimestampScale  = 0x2AD7B1
+	idDuration        = 0x4489
+	idTitle           = 0x7BA9
+	idTracks          = 0x1654AE6B
+	idTrackEntry      = 0xAE
+	idTrackNumber     = 0xD7
+	idTrackType       = 0x83
+	idFlagDefault     = 0x88
+	idFlagForced      = 0x55AA
+	idDefaultDuration = 0x23E383
+	idName            = 0x536E
+	idLanguage        = 0x22B59C
+	idCodecID         = 0x86
+	idVideo           = 0xE0
+	idPixelWidth      = 0xB0
+	idPixelHeight     = 0xBA
+	idAudio           = 0xE1
+	idSamplingFreq    = 0xB5
+	idChannels        = 0x9F
+	idCluster         = 0x1F43B675
+	idChapters        = 0x1043A770
+	idEditionEntry    = 0x45B9
+	idEditionHidden   = 0x45BD
+	idEditionDefault  = 0x45DB
+	idChapterAtom     = 0xB6
+	idChapterStart    = 0x91
+	idChapterEnd      = 0x92
+	idChapterHidden   = 0x98
+	idChapterEnabled  = 0x4598
+	idChapterDisplay  = 0x80
+	idChapString      = 0x85
+)
+
+// Matroska track types
+const (
+	trackTypeVideo    = 1
+	trackTypeAudio    = 2
+	trackTypeSubtitle = 0x11
+)
+
+// maxElementSize caps the size of the header elements read into memory
+const maxElementSize = 16 << 20
+
+// errTruncated is returned for elements that run past their parent or the file
+var errTruncated = errors.New("truncated element")
+
+// errStop ends a walk over child elements early
+var errStop = errors.New("stop")
+
+// probeMatroska reads the segment information, tracks and chapters of a
+// Matroska or WebM file. They usually come before the first cluster; when they
+// do not, the seek head says where they are.
+func probeMatroska(r io.ReaderAt, size int64) (Info, error) {
+	info := Info{Format: FormatMatroska}
+	id, start, n, err := readElementHeader(r, 0, size)
+	if err != nil || id != idEBML || n < 0 {
+		return info, ErrUnknownFormat
+	}
+	header, err := readElement(r, start, n)
+	if err != nil {
+		return info, err
+	}
+	err = ebmlChildren(header, func(id uint64, data []byte) error {
+		if id == idDocType && ebmlString(data) == FormatWebM {
+			info.Format = FormatWebM
+		}
+		return nil
+	})
+	if err != nil {
+		return info, err
+	}
+
+	id, segStart, segSize, err := readElementHeader(r, start+n, size)
+	if err != nil {
+		return info, err
+	}
+	if id != idSegment {
+		return info, fmt.Errorf("expected a segment, found element %X", id)
+	}
+	segEnd := size
+	if segSize >= 0 && segStart+segSize < size {
+		segEnd = segStart + segSize
+	}
+
+	var segInfo, tracks, chapters []byte
+	seeks := make(map[uint64]int64)
+	for pos := segStart; pos < segEnd && (segInfo == nil || tracks == nil || chapters == nil); {
+		id, dataStart, n, err := readElementHeader(r, pos, segEnd)
+		if err != nil {
+			break
+		}
+		if id == idCluster || n < 0 {
+			break
+		}
+		switch id {
+		case idSeekHead:
+			data, err := readElement(r, dataStart, n)
+			if err != nil {
+				return info, err
+			}
+			if err := readSeekHead(data, segStart, seeks); err != nil {
+				return info, err
+			}
+		case idInfo:
+			if segInfo, err = readElement(r, dataStart, n); err != nil {
+				return info, err
+			}
+		case idTracks:
+			if tracks, err = readElement(r, dataStart, n); err != nil {
+				return info, err
+			}
+		case idChapters:
+			if chapters, err = readElement(r, dataStart, n); err != nil {
+				return info, err
+			}
+		}
+		pos = dataStart + n
+	}
+	if segInfo == nil {
+		if segInfo, err = readSeekTarget(r, seeks, idInfo, segEnd); err != nil {
+			return info, err
+		}
+	}
+	if tracks == nil {
+		if tracks, err = readSeekTarget(r, seeks, idTracks, segEnd); err != nil {
+			return info, err
+		}
+	}
+	if segInfo == nil && tracks == nil {
+		return info, errors.New("no segment information or tracks")
+	}
+	if chapters == nil {
+		if chapters, err = readSeekTarget(r, seeks, idChapters, segEnd); err != nil {
+			return info, err
+		}
+	}
+
+	if err := readSegmentInfo(segInfo, &info); err != nil {
+		return info, err
+	}
+	if err := readTracks(tracks, &info); err != nil {
+		return info, err
+	}
+	if err := readChapters(chapters, &info); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+// readSeekHead records the positions of the top-level elements a seek head
+// lists, as offsets into the file
+func readSeekHead(data []byte, segStart int64, seeks map[uint64]int64) error {
+	return ebmlChildren(data, func(id uint64, data []byte) error {
+		if id != idSeek {
+			return nil
+		}
+		var target uint64
+		pos := int64(-1)
+		err := ebmlChildren(data, func(id uint64, data []byte) error {
+			switch id {
+			case idSeekID:
+				target = ebmlUint(data)
+			case idSeekPosition:
+				pos = int64(ebmlUint(data))
+			}
+			return nil
+		})
+		if err == nil && target != 0 && pos >= 0 {
+			if _, ok := seeks[target]; !ok {
+				seeks[target] = segStart + pos
+			}
+		}
+		return err
+	})
+}
+
+// readSeekTarget reads the element with the given ID where the seek head says
+// it is, or returns nil if it does not say
+func readSeekTarget(r io.ReaderAt, seeks map[uint64]int64, want uint64, end int64) ([]byte, error) {
+	pos, ok := seeks[want]
+	if !ok {
+		return nil, nil
+	}
+	id, dataStart, n, err := readElementHeader(r, pos, end)
+	if err != nil {
+		return nil, err
+	}
+	if id != want || n < 0 {
+		return nil, fmt.Errorf("seek head points at element %X, want %X", id, want)
+	}
+	return readElement(r, dataStart, n)
+}
+
+// readSegmentInfo reads the title and duration from the segment information
+func readSegmentInfo(data []byte, info *Info) error {
+	scale := uint64(1000000)
+	var duration float64
+	err := ebmlChildren(data, func(id uint64, data []byte) error {
+		switch id {
+		case idTimestampScale:
+			if v := ebmlUint(data); v > 0 {
+				scale = v
+			}
+		case idDuration:
+			duration = ebmlFloat(data)
+		case idTitle:
+			info.Title = ebmlString(data)
+		}
+		return nil
+	})
+	if duration > 0 && !math.IsInf(duration, 0) {
+		info.Duration = time.Duration(duration * float64(scale))
+	}
+	return err
+}
+
+// readTracks reads the track entries
+func readTracks(data []byte, info *Info) error {
+	return ebmlChildren(data, func(id uint64, data []byte) error {
+		if id != idTrackEntry {
+			return nil
+		}
+		// Defaults from the Matroska specification
+		s := Stream{Default: true, Language: "eng"}
+		var trackType uint64
+		var frameDuration uint64
+		err := ebmlChildren(data, func(id uint64, data []byte) error {
+			switch id {
+			case idTrackType:
+				trackType = ebmlUint(data)
+			case idCodecID:
+				s.CodecID = ebmlString(data)
+			case idName:
+				s.Title = ebmlString(data)
+			case idLanguage:
+				s.Language = ebmlString(data)
+			case idFlagDefault:
+				s.Default = ebmlUint(data) != 0
+			case idFlagForced:
+				s.Forced = ebmlUint(data) != 0
+			case idDefaultDuration:
+				frameDuration = ebmlUint(data)
+			case idVideo:
+				return ebmlChildren(data, func(id uint64, data []byte) error {
+					switch id {
+					case idPixelWidth:
+						s.Width = int(ebmlUint(data))
+					case idPixelHeight:
+						s.Height = int(ebmlUint(data))
+					}
+					return nil
+				})
+			case idAudio:
+				s.Channels = 1
+				return ebmlChildren(data, func(id uint64, data []byte) error {
+					switch id {
+					case idSamplingFreq:
+						s.SampleRate = int(ebmlFloat(data))
+					case idChannels:
+						s.Channels = int(ebmlUint(data))
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		switch trackType {
+		case trackTypeVideo:
+			s.Type = StreamVideo
+			if frameDuration > 0 {
+				s.FrameRate = frameRate(1e9 / float64(frameDuration))
+			}
+		case trackTypeAudio:
+			s.Type = StreamAudio
+		case trackTypeSubtitle:
+			s.Type = StreamSubtitle
+		default:
+			return nil
+		}
+		if s.Language == "und" {
+			s.Language = ""
+		}
+		s.Codec = matroskaCodec(s.CodecID)
+		s.Index = len(info.Streams)
+		info.Streams = append(info.Streams, s)
+		return nil
+	})
+}
+
+// readChapters reads the visible chapters of the default edition, or of the
+// first edition that is not hidden if none is the default. Nested chapters are
+// left out.
+func readChapters(data []byte, info *Info) error {
+	var edition []byte
+	err := ebmlChildren(data, func(id uint64, data []byte) error {
+		if id != idEditionEntry {
+			return nil
+		}
+		var hidden, isDefault bool
+		err := ebmlChildren(data, func(id uint64, data []byte) error {
+			switch id {
+			case idEditionHidden:
+				hidden = ebmlUint(data) != 0
+			case idEditionDefault:
+				isDefault = ebmlUint(data) != 0
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if isDefault || (edition == nil && !hidden) {
+			edition = data
+		}
+		if isDefault {
+			return errStop
+		}
+		return nil
+	})
+	if err != nil && err != errStop {
+		return err
+	}
+
+	return ebmlChildren(edition, func(id uint64, data []byte) error {
+		if id != idChapterAtom {
+			return nil
+		}
+		var c Chapter
+		visible := true
+		err := ebmlChildren(data, func(id uint64, data []byte) error {
+			switch id {
+			case idChapterStart:
+				c.Start = time.Duration(ebmlUint(data))
+			case idChapterEnd:
+				c.End = time.Duration(ebmlUint(data))
+			case idChapterHidden:
+				visible = visible && ebmlUint(data) == 0
+			case idChapterEnabled:
+				visible = visible && ebmlUint(data) != 0
+			case idChapterDisplay:
+				if c.Title != "" {
+					return nil
+				}
+				return ebmlChildren(data, func(id uint64, data []byte) error {
+					if id == idChapString {
+						c.Title = ebmlString(data)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if err == nil && visible {
+			info.Chapters = append(info.Chapters, c)
+		}
+		return err
+	})
+}
+
+// readElementHeader reads the ID and data size of the element at pos. The
+// size is -1 for elements of unknown size, which only clusters and segments
+// being written may have.
+func readElementHeader(r io.ReaderAt, pos, end int64) (id uint64, dataStart, size int64, err error) {
+	buf := make([]byte, 12)
+	n, err := r.ReadAt(buf, pos)
+	if n == 0 {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, 0, 0, err
+	}
+	buf = buf[:n]
+	id, idLen, ok := readVint(buf, true)
+	if !ok || idLen > 4 {
+		return 0, 0, 0, errTruncated
+	}
+	v, sizeLen, ok := readVint(buf[idLen:], false)
+	if !ok {
+		return 0, 0, 0, errTruncated
+	}
+	dataStart = pos + int64(idLen+sizeLen)
+	if v == 1<<(7*sizeLen)-1 {
+		return id, dataStart, -1, nil
+	}
+	if v > uint64(end-dataStart) {
+		return id, dataStart, 0, errTruncated
+	}
+	return id, dataStart, int64(v), nil
+}
+
+// readElement reads the data of an element
+func readElement(r io.ReaderAt, pos, size int64) ([]byte, error) {
+	if size > maxElementSize {
+		return nil, fmt.Errorf("header element of %d bytes is too large", size)
+	}
+	data := make([]byte, size)
+	if _, err := r.ReadAt(data, pos); err != nil {
+		if err == io.EOF {
+			return nil, errTruncated
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// ebmlChildren calls fn for each child element in the data of a master element
+func ebmlChildren(data []byte, fn func(id uint64, data []byte) error) error {
+	for len(data) > 0 {
+		id, idLen, ok := readVint(data, true)
+		if !ok {
+			return errTruncated
+		}
+		size, sizeLen, ok := readVint(data[idLen:], false)
+		if !ok {
+			return errTruncated
+		}
+		start := idLen + sizeLen
+		if size > uint64(len(data)-start) {
+			return errTruncated
+		}
+		end := start + int(size)
+		if err := fn(id, data[start:end]); err != nil {
+			return err
+		}
+		data = data[end:]
+	}
+	return nil
+}
+
+// readVint reads an EBML variable-length integer. IDs keep their length marker;
+// sizes do not.
+func readVint(b []byte, keepMarker bool) (uint64, int, bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	n := 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		n++
+	}
+	if len(b) < n {
+		return 0, 0, false
+	}
+	v := uint64(b[0])
+	if !keepMarker {
+		v &= uint64(0xFF >> n)
+	}
+	for _, c := range b[1:n] {
+		v = v<<8 | uint64(c)
+	}
+	return v, n, true
+}
+
+// ebmlUint decodes an unsigned integer element
+func ebmlUint(data []byte) uint64 {
+	var v uint64
+	for _, c := range data {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+// ebmlFloat decodes a float element, which is 4 or 8 bytes long
+func ebmlFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
+
+// ebmlString decodes a string element, which may be padded with zero bytes
+func ebmlString(data []byte) string {
+	return strings.TrimRight(string(data), "\x00")
+}
@@ -0,0 +1,160 @@
+// Package mediainfo reads the duration and the video, audio and subtitle tracks
+// of media files. Matroska, WebM, MP4 and QuickTime headers are read in pure Go,
+// without decoding anything; other formats can be probed with ffprobe.
+package mediainfo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ErrUnknownFormat is returned for files in a container format not understood
+var ErrUnknownFormat = errors.New("unknown container format")
+
+// Container formats. Probing with ffprobe may give others, named as ffprobe
+// names them.
+const (
+	FormatMatroska  = "matroska"
+	FormatWebM      = "webm"
+	FormatMP4       = "mp4"
+	FormatQuickTime = "mov"
+	FormatAVI       = "avi"
+	FormatASF       = "asf"
+	FormatFLV       = "flv"
+	FormatMPEGTS    = "mpegts"
+)
+
+// Stream types
+const (
+	StreamVideo    = "video"
+	StreamAudio    = "audio"
+	StreamSubtitle = "subtitle"
+)
+
+// Info describes a media file
+type Info struct {
+	Format   string // one of the Format constants
+	Title    string
+	Duration time.Duration
+	Streams  []Stream
+	Chapters []Chapter
+}
+
+// Chapter is a named point in a file's timeline
+type Chapter struct {
+	Start time.Duration
+	End   time.Duration // zero if unknown
+	Title string
+}
+
+// Stream is a video, audio or subtitle track
+type Stream struct {
+	Index int    // position among the file's tracks, from 0
+	Type  string // one of the Stream constants
+	// Codec is a display name such as "H.264" or "AAC", and CodecID the
+	// container's own codec identifier, such as "V_MPEG4/ISO/AVC" or "avc1"
+	Codec    string
+	CodecID  string
+	Language string // ISO 639-2 code such as "eng", or "" if undetermined
+	Title    string
+	Default  bool
+	Forced   bool
+
+	// Video streams
+	Width     int
+	Height    int
+	FrameRate float64
+
+	// Audio streams
+	Channels   int
+	SampleRate int
+}
+
+// Video returns the first video stream, or false if there is none
+func (i Info) Video() (Stream, bool) {
+	for _, s := range i.Streams {
+		if s.Type == StreamVideo {
+			return s, true
+		}
+	}
+	return Stream{}, false
+}
+
+// Audio returns the default audio stream, or the first if none is marked
+// default, or false if there is none
+func (i Info) Audio() (Stream, bool) {
+	var first *Stream
+	for n, s := range i.Streams {
+		if s.Type != StreamAudio {
+			continue
+		}
+		if s.Default {
+			return s, true
+		}
+		if first == nil {
+			first = &i.Streams[n]
+		}
+	}
+	if first == nil {
+		return Stream{}, false
+	}
+	return *first, true
+}
+
+// Probe reads the media information of a file
+func Probe(path string) (Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return Info{}, err
+	}
+	return ProbeReader(f, stat.Size())
+}
+
+// ProbeReader reads the media information of a file of the given size
+func ProbeReader(r io.ReaderAt, size int64) (Info, error) {
+	head := make([]byte, 12)
+	n, err := r.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return Info{}, err
+	}
+	head = head[:n]
+
+	var info Info
+	switch {
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		info, err = probeMatroska(r, size)
+	case len(head) >= 8 && isBoxType(head[4:8]):
+		info, err = probeISOBMFF(r, size)
+	default:
+		return Info{}, ErrUnknownFormat
+	}
+	if err != nil && !errors.Is(err, ErrUnknownFormat) {
+		return Info{}, fmt.Errorf("reading %s headers: %w", info.Format, err)
+	}
+	return info, err
+}
+
+// isBoxType reports whether b is the type of a box that may start an MP4 or
+// QuickTime file
+func isBoxType(b []byte) bool {
+	switch string(b) {
+	case "ftyp", "moov", "mdat", "free", "skip", "wide", "pnot":
+		return true
+	}
+	return false
+}
+
+// frameRate rounds a frame rate to three decimals, which keeps 23.976 and
+// 29.97 recognisable
+func frameRate(fps float64) float64 {
+	return float64(int64(fps*1000+0.5)) / 1000
+}
@@ -0,0 +1,155 @@
+package mediainfo
+
+import (
+	"encoding/binary"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The files in testdata are written by testdata/gen.go
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		file string
+		want Info
+	}{
+		{"sample.mkv", Info{
+			Format:   FormatMatroska,
+			Title:    "Sample Movie",
+			Duration: 5025 * time.Millisecond,
+			Streams: []Stream{
+				{Index: 0, Type: StreamVideo, Codec: "H.264", CodecID: "V_MPEG4/ISO/AVC", Default: true, Width: 1920, Height: 1080, FrameRate: 23.976},
+				{Index: 1, Type: StreamAudio, Codec: "AC3", CodecID: "A_AC3", Language: "eng", Title: "Surround 5.1", Default: true, Channels: 6, SampleRate: 48000},
+				{Index: 2, Type: StreamAudio, Codec: "AAC", CodecID: "A_AAC/MPEG4/LC", Language: "fre", Channels: 2, SampleRate: 44100},
+				{Index: 3, Type: StreamSubtitle, Codec: "SubRip", CodecID: "S_TEXT/UTF8", Language: "eng", Title: "Forced", Forced: true},
+			},
+			// From the default edition, without its hidden chapter
+			Chapters: []Chapter{
+				{Start: 0, End: 2 * time.Second, Title: "Opening"},
+				{Start: 3 * time.Second, Title: "The Heist"},
+			},
+		}},
+		{"sample.webm", Info{
+			Format:   FormatWebM,
+			Duration: 90500 * time.Millisecond,
+			Streams: []Stream{
+				{Index: 0, Type: StreamVideo, Codec: "VP9", CodecID: "V_VP9", Language: "eng", Default: true, Width: 640, Height: 360},
+				{Index: 1, Type: StreamAudio, Codec: "Opus", CodecID: "A_OPUS", Default: true, Channels: 2, SampleRate: 48000},
+			},
+		}},
+		{"sample.mp4", Info{
+			Format:   FormatMP4,
+			Duration: 10 * time.Second,
+			Streams: []Stream{
+				{Index: 0, Type: StreamVideo, Codec: "H.264", CodecID: "avc1", Default: true, Width: 1280, Height: 720, FrameRate: 23.976},
+				{Index: 1, Type: StreamAudio, Codec: "AAC", CodecID: "mp4a", Language: "eng", Default: true, Channels: 2, SampleRate: 44100},
+				{Index: 2, Type: StreamSubtitle, Codec: "Timed Text", CodecID: "tx3g", Language: "spa"},
+			},
+		}},
+		{"sample.mov", Info{
+			Format:   FormatQuickTime,
+			Duration: 2 * time.Hour,
+			Streams: []Stream{
+				{Index: 0, Type: StreamVideo, Codec: "H.265", CodecID: "hvc1", Language: "eng", Default: true, Width: 3840, Height: 2160, FrameRate: 25},
+				{Index: 1, Type: StreamAudio, Codec: "E-AC3", CodecID: "ec-3", Language: "deu", Default: true, Channels: 6, SampleRate: 48000},
+			},
+			// From the chapter track, which is not a stream
+			Chapters: []Chapter{
+				{Start: 0, End: 10 * time.Minute, Title: "Opening"},
+				{Start: 10 * time.Minute, End: 65 * time.Minute, Title: "Café"},
+				{Start: 65 * time.Minute, End: 2 * time.Hour, Title: "Finale"},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := Probe(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Probe =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProbeErrors(t *testing.T) {
+	if _, err := Probe(filepath.Join("testdata", "unknown.avi")); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Probe(unknown.avi) error = %v, want ErrUnknownFormat", err)
+	}
+	_, err := Probe(filepath.Join("testdata", "truncated.mkv"))
+	if err == nil || !strings.HasPrefix(err.Error(), "reading matroska headers") {
+		t.Errorf("Probe(truncated.mkv) error = %v, want a matroska header error", err)
+	}
+	if _, err := Probe(filepath.Join("testdata", "missing.mkv")); err == nil {
+		t.Error("Probe(missing.mkv) returned no error")
+	}
+}
+
+// be32 encodes big-endian 32-bit values
+func be32(values ...uint32) []byte {
+	b := make([]byte, 0, 4*len(values))
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+func TestSampleOffsets(t *testing.T) {
+	// Two samples of 10 and 20 bytes in one chunk at 100
+	stsz := be32(0, 0, 2, 10, 20)
+	stsc := be32(0, 1, 1, 2, 1)
+	stco := be32(0, 1, 100)
+	tests := []struct {
+		name    string
+		track   mp4Track
+		offsets []int64
+		sizes   []int64
+	}{
+		{"complete", mp4Track{stsz: stsz, stsc: stsc, stco: stco}, []int64{100, 110}, []int64{10, 20}},
+		{"64-bit chunk offsets", mp4Track{stsz: stsz, stsc: stsc, stco: append(be32(0, 1), 0, 0, 0, 2, 0, 0, 0, 0), co64: true},
+			[]int64{1 << 33, 1<<33 + 10}, []int64{10, 20}},
+		// Counts far beyond the data stop where the data does
+		{"oversized chunk offsets", mp4Track{stsz: stsz, stsc: stsc, stco: be32(0, 0xFFFFFFFF, 100)}, []int64{100, 110}, []int64{10, 20}},
+		{"oversized 64-bit chunk offsets", mp4Track{stsz: stsz, stsc: stsc, stco: append(be32(0, 0xFFFFFFFF, 0, 100), 0, 0), co64: true},
+			[]int64{100, 110}, []int64{10, 20}},
+		{"oversized sample-to-chunk table", mp4Track{stsz: stsz, stsc: be32(0, 0xFFFFFFFF, 1, 2, 1), stco: stco}, []int64{100, 110}, []int64{10, 20}},
+		{"truncated sample sizes", mp4Track{stsz: be32(0, 0, 0xFFFFFFFF, 10), stsc: stsc, stco: stco}, []int64{100}, []int64{10}},
+		{"truncated chunk offsets", mp4Track{stsz: stsz, stsc: stsc, stco: be32(0, 2, 100)[:10]}, nil, []int64{}},
+		{"empty", mp4Track{}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			offsets, sizes := tt.track.sampleOffsets()
+			if !reflect.DeepEqual(offsets, tt.offsets) || !reflect.DeepEqual(sizes, tt.sizes) {
+				t.Errorf("sampleOffsets = %v, %v, want %v, %v", offsets, sizes, tt.offsets, tt.sizes)
+			}
+		})
+	}
+}
+
+func TestInfoStreams(t *testing.T) {
+	info, err := Probe(filepath.Join("testdata", "sample.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := info.Video(); !ok || v.Height != 1080 {
+		t.Errorf("Video = %+v, %v", v, ok)
+	}
+	if a, ok := info.Audio(); !ok || a.Codec != "AC3" {
+		t.Errorf("Audio = %+v, %v", a, ok)
+	}
+
+	info.Streams[1].Default = false
+	if a, ok := info.Audio(); !ok || a.Codec != "AC3" {
+		t.Errorf("Audio with no default = %+v, %v, want the first audio stream", a, ok)
+	}
+	if _, ok := (Info{}).Audio(); ok {
+		t.Error("Audio of an empty Info returned a stream")
+	}
+}
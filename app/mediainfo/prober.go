@@ -0,0 +1,39 @@
+package mediainfo
+
+import (
+	"context"
+	"errors"
+)
+
+// Prober reads the media information of a file
+type Prober interface {
+	Probe(ctx context.Context, path string) (Info, error)
+}
+
+// Native is the Prober reading Matroska, WebM, MP4 and QuickTime headers in
+// pure Go. It returns ErrUnknownFormat for other files.
+type Native struct{}
+
+// Probe reads the media information of a file
+func (Native) Probe(ctx context.Context, path string) (Info, error) {
+	if err := ctx.Err(); err != nil {
+		return Info{}, err
+	}
+	return Probe(path)
+}
+
+// Fallback is a Prober trying each of its probers in turn until one knows the
+// file's format
+type Fallback []Prober
+
+// Probe reads the media information of a file with the first prober that does
+// not return ErrUnknownFormat
+func (f Fallback) Probe(ctx context.Context, path string) (Info, error) {
+	for _, p := range f {
+		info, err := p.Probe(ctx, path)
+		if !errors.Is(err, ErrUnknownFormat) {
+			return info, err
+		}
+	}
+	return Info{}, ErrUnknownFormat
+}
@@ -0,0 +1,271 @@
+//go:build ignore
+
+// gen writes the tiny synthetic container files the mediainfo tests read. They
+// hold headers only, with a few bytes standing in for the media data.
+//
+//	go run gen.go
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"math"
+	"os"
+)
+
+func main() {
+	mkv := matroska()
+	write("sample.mkv", mkv)
+	write("truncated.mkv", mkv[:len(mkv)/2])
+	write("sample.webm", webm())
+	write("sample.mp4", mp4())
+	write("sample.mov", mov())
+	write("unknown.avi", []byte("RIFF\x10\x00\x00\x00AVI LIST"))
+}
+
+func write(name string, data []byte) {
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// EBML
+
+// el encodes an element with a 1 to 4 byte ID and an 8-byte size
+func el(id uint32, children ...[]byte) []byte {
+	var b bytes.Buffer
+	switch {
+	case id > 0xFFFFFF:
+		binary.Write(&b, binary.BigEndian, id)
+	case id > 0xFFFF:
+		b.Write([]byte{byte(id >> 16), byte(id >> 8), byte(id)})
+	case id > 0xFF:
+		binary.Write(&b, binary.BigEndian, uint16(id))
+	default:
+		b.WriteByte(byte(id))
+	}
+	data := bytes.Join(children, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01
+	b.Write(size)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func uintEl(id uint32, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	i := 0
+	for i < 7 && b[i] == 0 {
+		i++
+	}
+	return el(id, b[i:])
+}
+
+func floatEl(id uint32, v float64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], math.Float64bits(v))
+	return el(id, b[:])
+}
+
+func float32El(id uint32, v float32) []byte {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], math.Float32bits(v))
+	return el(id, b[:])
+}
+
+func strEl(id uint32, s string) []byte { return el(id, []byte(s)) }
+
+func ebmlHeader(docType string) []byte {
+	return el(0x1A45DFA3, uintEl(0x4286, 1), uintEl(0x42F7, 1), uintEl(0x42F2, 4), uintEl(0x42F3, 8),
+		strEl(0x4282, docType), uintEl(0x4287, 4), uintEl(0x4285, 2))
+}
+
+func cluster() []byte {
+	return el(0x1F43B675, uintEl(0xE7, 0), el(0xA3, []byte{0x81, 0, 0, 0x80, 0xDE, 0xAD, 0xBE, 0xEF}))
+}
+
+// matroska has a seek head, the segment information and tracks, then a cluster
+func matroska() []byte {
+	info := el(0x1549A966, uintEl(0x2AD7B1, 1000000), floatEl(0x4489, 5025), strEl(0x7BA9, "Sample Movie"),
+		strEl(0x4D80, "gen.go"), strEl(0x5741, "gen.go"))
+	tracks := el(0x1654AE6B,
+		el(0xAE, uintEl(0xD7, 1), uintEl(0x73C5, 1), uintEl(0x83, 1), strEl(0x86, "V_MPEG4/ISO/AVC"),
+			uintEl(0x23E383, 41708333), strEl(0x22B59C, "und"),
+			el(0xE0, uintEl(0xB0, 1920), uintEl(0xBA, 1080))),
+		el(0xAE, uintEl(0xD7, 2), uintEl(0x73C5, 2), uintEl(0x83, 2), strEl(0x86, "A_AC3"),
+			strEl(0x536E, "Surround 5.1"),
+			el(0xE1, floatEl(0xB5, 48000), uintEl(0x9F, 6))),
+		el(0xAE, uintEl(0xD7, 3), uintEl(0x73C5, 3), uintEl(0x83, 2), strEl(0x86, "A_AAC/MPEG4/LC"),
+			strEl(0x22B59C, "fre"), uintEl(0x88, 0),
+			el(0xE1, float32El(0xB5, 44100), uintEl(0x9F, 2))),
+		el(0xAE, uintEl(0xD7, 4), uintEl(0x73C5, 4), uintEl(0x83, 0x11), strEl(0x86, "S_TEXT/UTF8"),
+			strEl(0x536E, "Forced"), uintEl(0x88, 0), uintEl(0x55AA, 1)),
+	)
+	// The seek head comes first; positions are relative to the segment data
+	seekHead := func(infoPos, tracksPos uint64) []byte {
+		return el(0x114D9B74,
+			el(0x4DBB, el(0x53AB, []byte{0x15, 0x49, 0xA9, 0x66}), uintEl(0x53AC, infoPos)),
+			el(0x4DBB, el(0x53AB, []byte{0x16, 0x54, 0xAE, 0x6B}), uintEl(0x53AC, tracksPos)))
+	}
+	sh := seekHead(0, 0)
+	for n := 0; n != len(sh); {
+		n = len(sh)
+		sh = seekHead(uint64(n), uint64(n+len(info)))
+	}
+	// An ordinary edition, then the default one with a hidden chapter and
+	// titles in two languages
+	chapter := func(start, end uint64, title string, more ...[]byte) []byte {
+		children := [][]byte{uintEl(0x73C4, start+1), uintEl(0x91, start)}
+		if end > 0 {
+			children = append(children, uintEl(0x92, end))
+		}
+		children = append(children, el(0x80, strEl(0x85, title), strEl(0x437C, "eng")))
+		return el(0xB6, append(children, more...)...)
+	}
+	chapters := el(0x1043A770,
+		el(0x45B9, uintEl(0x45BC, 1), chapter(0, 0, "Alternate")),
+		el(0x45B9, uintEl(0x45BC, 2), uintEl(0x45DB, 1),
+			chapter(0, 2_000_000_000, "Opening", el(0x80, strEl(0x85, "Ouverture"), strEl(0x437C, "fre"))),
+			chapter(2_000_000_000, 3_000_000_000, "Hidden", uintEl(0x98, 1)),
+			chapter(3_000_000_000, 0, "The Heist")),
+	)
+	return append(ebmlHeader("matroska"), el(0x18538067, sh, info, tracks, chapters, cluster())...)
+}
+
+// webm keeps its tracks after the first cluster, where only the seek head
+// finds them
+func webm() []byte {
+	info := el(0x1549A966, uintEl(0x2AD7B1, 1000000), float32El(0x4489, 90500))
+	c := cluster()
+	tracks := el(0x1654AE6B,
+		el(0xAE, uintEl(0xD7, 1), uintEl(0x83, 1), strEl(0x86, "V_VP9"),
+			el(0xE0, uintEl(0xB0, 640), uintEl(0xBA, 360))),
+		el(0xAE, uintEl(0xD7, 2), uintEl(0x83, 2), strEl(0x86, "A_OPUS"), strEl(0x22B59C, "und"),
+			el(0xE1, floatEl(0xB5, 48000), uintEl(0x9F, 2))),
+	)
+	seekHead := func(tracksPos uint64) []byte {
+		return el(0x114D9B74, el(0x4DBB, el(0x53AB, []byte{0x16, 0x54, 0xAE, 0x6B}), uintEl(0x53AC, tracksPos)))
+	}
+	sh := seekHead(0)
+	for n := 0; n != len(sh); {
+		n = len(sh)
+		sh = seekHead(uint64(n + len(info) + len(c)))
+	}
+	return append(ebmlHeader("webm"), el(0x18538067, sh, info, c, tracks)...)
+}
+
+// ISO-BMFF
+
+func box(typ string, children ...[]byte) []byte {
+	data := bytes.Join(children, nil)
+	b := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(b, uint32(8+len(data)))
+	copy(b[4:], typ)
+	return append(b, data...)
+}
+
+func be(vs ...any) []byte {
+	var b bytes.Buffer
+	for _, v := range vs {
+		binary.Write(&b, binary.BigEndian, v)
+	}
+	return b.Bytes()
+}
+
+func lang(code string) uint16 {
+	return uint16(code[0]-0x60)<<10 | uint16(code[1]-0x60)<<5 | uint16(code[2]-0x60)
+}
+
+var matrix = be(uint32(0x10000), uint32(0), uint32(0), uint32(0), uint32(0x10000), uint32(0), uint32(0), uint32(0), uint32(0x40000000))
+
+func mvhd(version byte, timescale uint32, duration uint64) []byte {
+	head := be(version, [3]byte{})
+	if version == 1 {
+		head = append(head, be(uint64(0), uint64(0), timescale, duration)...)
+	} else {
+		head = append(head, be(uint32(0), uint32(0), timescale, uint32(duration))...)
+	}
+	return box("mvhd", head, be(uint32(0x10000), uint16(0x100), [10]byte{}), matrix, make([]byte, 24), be(uint32(10)))
+}
+
+func tkhd(enabled bool, id uint32, width, height uint16) []byte {
+	flags := [3]byte{0, 0, 2}
+	if enabled {
+		flags[2] = 3
+	}
+	return box("tkhd", be(byte(0), flags, uint32(0), uint32(0), id, uint32(0), uint32(0), [8]byte{}, uint16(0), uint16(0), uint16(0), uint16(0)),
+		matrix, be(uint32(width)<<16, uint32(height)<<16))
+}
+
+func mdhd(timescale uint32, duration uint32, language string) []byte {
+	return box("mdhd", be(uint32(0), uint32(0), uint32(0), timescale, duration, lang(language), uint16(0)))
+}
+
+func hdlr(handler string) []byte {
+	return box("hdlr", be(uint32(0), uint32(0)), []byte(handler), make([]byte, 12), []byte("\x00"))
+}
+
+func stbl(entry []byte, samples, delta uint32) []byte {
+	return box("minf", box("stbl",
+		box("stsd", be(uint32(0), uint32(1)), entry),
+		box("stts", be(uint32(0), uint32(1), samples, delta)),
+	))
+}
+
+func visualEntry(typ string, width, height uint16) []byte {
+	return box(typ, make([]byte, 6), be(uint16(1)), make([]byte, 16), be(width, height, uint32(0x480000), uint32(0x480000), uint32(0), uint16(1)),
+		make([]byte, 32), be(uint16(0x18), int16(-1)))
+}
+
+func audioEntry(typ string, channels uint16, rate uint32) []byte {
+	return box(typ, make([]byte, 6), be(uint16(1)), make([]byte, 8), be(channels, uint16(16), uint16(0), uint16(0), rate<<16))
+}
+
+func textEntry(typ string) []byte {
+	return box(typ, make([]byte, 6), be(uint16(1)), make([]byte, 30))
+}
+
+// mp4 has its movie box before the media data
+func mp4() []byte {
+	moov := box("moov",
+		mvhd(0, 1000, 10000),
+		box("trak", tkhd(true, 1, 1280, 720), box("mdia", mdhd(24000, 240240, "und"), hdlr("vide"), stbl(visualEntry("avc1", 1280, 720), 240, 1001))),
+		box("trak", tkhd(true, 2, 0, 0), box("mdia", mdhd(44100, 441000, "eng"), hdlr("soun"), stbl(audioEntry("mp4a", 2, 44100), 431, 1024))),
+		box("trak", tkhd(false, 3, 0, 0), box("mdia", mdhd(1000, 10000, "spa"), hdlr("sbtl"), stbl(textEntry("tx3g"), 2, 5000))),
+	)
+	return bytes.Join([][]byte{box("ftyp", []byte("isom"), be(uint32(0x200)), []byte("isomiso2avc1mp41")), moov, box("mdat", []byte("media"))}, nil)
+}
+
+// mov is a QuickTime file with its movie box after the media data, a 64-bit
+// movie header and a chapter track. Its three chapter titles are in the media
+// data, in two chunks, the last in UTF-16.
+func mov() []byte {
+	ftyp := box("ftyp", []byte("qt  "), be(uint32(0x200)), []byte("qt  "))
+	wide := box("wide")
+	var samples [][]byte
+	for _, title := range [][]byte{[]byte("Opening"), []byte("Café"), be([]uint16{0xFEFF, 'F', 'i', 'n', 'a', 'l', 'e'})} {
+		samples = append(samples, append(be(uint16(len(title))), title...))
+	}
+	mdat := box("mdat", []byte("media"), bytes.Join(samples, nil))
+	first := uint32(len(ftyp) + len(wide) + 8 + len("media"))
+	third := first + uint32(len(samples[0])+len(samples[1]))
+	chapterTable := box("minf", box("stbl",
+		box("stsd", be(uint32(0), uint32(1)), textEntry("text")),
+		box("stts", be(uint32(0), uint32(2), uint32(1), uint32(600*600), uint32(2), uint32(600*3300))),
+		box("stsz", be(uint32(0), uint32(0), uint32(3), uint32(len(samples[0])), uint32(len(samples[1])), uint32(len(samples[2])))),
+		box("stsc", be(uint32(0), uint32(2), uint32(1), uint32(2), uint32(1), uint32(2), uint32(1), uint32(1))),
+		box("stco", be(uint32(0), uint32(2), first, third)),
+	))
+
+	moov := box("moov",
+		mvhd(1, 600, 600*7200),
+		box("trak", tkhd(true, 1, 3840, 2160), box("tref", box("chap", be(uint32(3)))),
+			box("mdia", mdhd(25, 180000, "eng"), hdlr("vide"), stbl(visualEntry("hvc1", 3840, 2160), 180000, 1))),
+		box("trak", tkhd(true, 2, 0, 0), box("mdia", mdhd(48000, 345600000, "deu"), hdlr("soun"), stbl(audioEntry("ec-3", 6, 48000), 337500, 1024))),
+		box("trak", tkhd(false, 3, 0, 0), box("mdia", mdhd(600, 600*7200, "eng"), hdlr("text"), chapterTable)),
+	)
+	return bytes.Join([][]byte{ftyp, wide, mdat, moov}, nil)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"transogov2/app/models"
+)
+
+// ErrMetadataNotFound is returned by a MetadataProvider for IDs it does not know
+var ErrMetadataNotFound = errors.New("metadata not found")
+
+// MetadataProvider looks up movies and TV shows in an online metadata database.
+// IDs are the provider's own.
+type MetadataProvider interface {
+	SearchMovies(ctx context.Context, title string, year int) ([]MetadataMatch, error)
+	SearchTVShows(ctx context.Context, title string, year int) ([]MetadataMatch, error)
+	Movie(ctx context.Context, id string) (ProviderMetadata, error)
+	TVShow(ctx context.Context, id string) (ProviderMetadata, error)
+	// Artwork downloads an image named by ProviderMetadata.Poster or Fanart
+	Artwork(ctx context.Context, ref string) ([]byte, error)
+}
+
+// MetadataMatch is a search result
+type MetadataMatch struct {
+	ID            string
+	Title         string
+	OriginalTitle string
+	Year          int
+}
+
+// ProviderMetadata is what a provider knows about a movie or TV show.
+// ExternalIDs hold the provider's own ID. Poster and Fanart name artwork to
+// fetch with Artwork, and are empty if there is none.
+type ProviderMetadata struct {
+	models.Metadata
+	Poster string
+	Fanart string
+}
+
+// metadataRetry is how long a movie or TV show that the provider had nothing
+// for waits before it is looked up again. The wait doubles with each miss in a
+// row, up to maxMetadataRetry.
+const (
+	metadataRetry    = 24 * time.Hour
+	maxMetadataRetry = 30 * 24 * time.Hour
+)
+
+// matchMetadata looks up the movies and TV shows added or rescanned by the scan
+// that lack a description or a TMDb ID with the configured provider, filling in
+// what the files and NFO files did not give. Local metadata and artwork always
+// win. Those the provider had nothing for are not looked up again until their
+// retry is due. The first provider error other than an unknown ID ends the
+// lookup for this scan.
+func matchMetadata(ctx context.Context, repo MediaRepository, cfg *ScanConfig, s *scanSession) {
+	s.mu.Lock()
+	keys := slices.SortedFunc(maps.Keys(s.lookups), func(a, b lookupKey) int {
+		if a.tvShow != b.tvShow {
+			if b.tvShow {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.id, b.id)
+	})
+	s.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range keys {
+		if ctx.Err() != nil {
+			return
+		}
+		if key.tvShow {
+			tvShow, err := repo.GetTVShowByID(ctx, key.id)
+			if err != nil {
+				log.Printf("Error retrieving TV show %d for metadata lookup: %v", key.id, err)
+				s.fail()
+				continue
+			}
+			if tvShow.Description.Valid && tvShow.TMDbID.Valid || !lookupDue(tvShow.MetadataLookup, now) {
+				continue
+			}
+			found, err := matchTVShow(ctx, repo, cfg, tvShow)
+			if err != nil {
+				s.warn("Stopping metadata lookup at %s: %v", tvShow.Path, err)
+				return
+			}
+			if err := repo.SetTVShowMetadataLookup(ctx, tvShow.ID, nextLookup(tvShow.MetadataLookup, found, now)); err != nil {
+				log.Printf("Error saving metadata lookup of %s: %v", tvShow.Path, err)
+				s.fail()
+			}
+			continue
+		}
+
+		movie, err := repo.GetMediaByID(ctx, key.id)
+		if err != nil {
+			log.Printf("Error retrieving movie %d for metadata lookup: %v", key.id, err)
+			s.fail()
+			continue
+		}
+		if movie.MissingSince.Valid || movie.ParentID.Valid || movie.VersionOf.Valid ||
+			movie.Description.Valid && movie.TMDbID.Valid || !lookupDue(movie.MetadataLookup, now) {
+			continue
+		}
+		found, err := matchMovie(ctx, repo, cfg, movie)
+		if err != nil {
+			s.warn("Stopping metadata lookup at %s: %v", movie.Path, err)
+			return
+		}
+		if err := repo.SetMediaMetadataLookup(ctx, movie.ID, nextLookup(movie.MetadataLookup, found, now)); err != nil {
+			log.Printf("Error saving metadata lookup of %s: %v", movie.Path, err)
+			s.fail()
+		}
+	}
+}
+
+// lookupDue reports whether a movie or TV show last looked up as recorded in
+// lookup may be looked up again at now
+func lookupDue(lookup models.MetadataLookup, now time.Time) bool {
+	if !lookup.CheckedAt.Valid || lookup.Misses == 0 {
+		return true
+	}
+	wait := metadataRetry
+	for i := 1; i < lookup.Misses && wait < maxMetadataRetry; i++ {
+		wait *= 2
+	}
+	return now.Sub(lookup.CheckedAt.Time) >= min(wait, maxMetadataRetry)
+}
+
+// nextLookup records a lookup at now that found metadata or did not
+func nextLookup(lookup models.MetadataLookup, found bool, now time.Time) models.MetadataLookup {
+	lookup.CheckedAt = sql.NullTime{Time: now, Valid: true}
+	if found {
+		lookup.Misses = 0
+	} else {
+		lookup.Misses++
+	}
+	return lookup
+}
+
+// matchMovie looks up a movie by its TMDb ID, or searches for it by title and
+// year, and stores what was found. It reports whether the provider knew it.
+func matchMovie(ctx context.Context, repo MediaRepository, cfg *ScanConfig, movie models.Media) (bool, error) {
+	id := movie.TMDbID.String
+	if id == "" {
+		var err error
+		id, err = searchMetadata(ctx, cfg.Metadata.SearchMovies, movie.Title, int(movie.Year.Int64))
+		if err != nil || id == "" {
+			return false, err
+		}
+	}
+	found, err := cfg.Metadata.Movie(ctx, id)
+	if errors.Is(err, ErrMetadataNotFound) {
+		log.Printf("No metadata for %s (TMDb ID %s)", movie.Path, id)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	meta := missingMetadata(found.Metadata, models.Metadata{Year: movie.Year, Description: movie.Description, Rating: movie.Rating, ExternalIDs: movie.ExternalIDs})
+	if err := repo.UpdateMediaMetadata(ctx, movie.ID, meta); err != nil {
+		return false, fmt.Errorf("saving metadata: %w", err)
+	}
+	poster := downloadArtwork(ctx, cfg, found.Poster, movie.PosterPath)
+	fanart := downloadArtwork(ctx, cfg, found.Fanart, movie.FanartPath)
+	if poster != movie.PosterPath || fanart != movie.FanartPath {
+		if err := repo.SetMediaArtwork(ctx, movie.ID, poster, fanart); err != nil {
+			return false, fmt.Errorf("saving artwork: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// matchTVShow looks up a TV show by its TMDb ID, or searches for it by title,
+// and stores what was found. It reports whether the provider knew it.
+func matchTVShow(ctx context.Context, repo MediaRepository, cfg *ScanConfig, tvShow models.TVShow) (bool, error) {
+	id := tvShow.TMDbID.String
+	if id == "" {
+		var err error
+		id, err = searchMetadata(ctx, cfg.Metadata.SearchTVShows, tvShow.Title, int(tvShow.Year.Int64))
+		if err != nil || id == "" {
+			return false, err
+		}
+	}
+	found, err := cfg.Metadata.TVShow(ctx, id)
+	if errors.Is(err, ErrMetadataNotFound) {
+		log.Printf("No metadata for %s (TMDb ID %s)", tvShow.Path, id)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	meta := missingMetadata(found.Metadata, models.Metadata{Year: tvShow.Year, Description: tvShow.Description, Rating: tvShow.Rating, ExternalIDs: tvShow.ExternalIDs})
+	if err := repo.UpdateTVShowMetadata(ctx, tvShow.ID, meta); err != nil {
+		return false, fmt.Errorf("saving metadata: %w", err)
+	}
+	poster := downloadArtwork(ctx, cfg, found.Poster, tvShow.PosterPath)
+	fanart := downloadArtwork(ctx, cfg, found.Fanart, tvShow.FanartPath)
+	if poster != tvShow.PosterPath || fanart != tvShow.FanartPath {
+		if err := repo.SetTVShowArtwork(ctx, tvShow.ID, poster, fanart); err != nil {
+			return false, fmt.Errorf("saving artwork: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// searchMetadata searches for a title and returns the ID of the best match, or
+// "" if nothing matches well enough. A search by title and year that finds
+// nothing is retried without the year, as release years often differ by one.
+func searchMetadata(ctx context.Context, search func(context.Context, string, int) ([]MetadataMatch, error), title string, year int) (string, error) {
+	matches, err := search(ctx, title, year)
+	if err != nil {
+		return "", err
+	}
+	if id := bestMatch(matches, title, year); id != "" || year == 0 {
+		return id, nil
+	}
+	if matches, err = search(ctx, title, 0); err != nil {
+		return "", err
+	}
+	return bestMatch(matches, title, year), nil
+}
+
+// bestMatch picks the search result for a title and year: the first with the
+// same title and a year at most one off, or without a year to go by, the first
+// with the same title. Titles are compared ignoring case and punctuation.
+func bestMatch(matches []MetadataMatch, title string, year int) string {
+	want := titleKey(title)
+	for _, m := range matches {
+		if titleKey(m.Title) != want && titleKey(m.OriginalTitle) != want {
+			continue
+		}
+		if year == 0 || m.Year == 0 || m.Year >= year-1 && m.Year <= year+1 {
+			return m.ID
+		}
+	}
+	return ""
+}
+
+// titleKey reduces a title to its lower-case letters and digits
+func titleKey(title string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, title)
+}
+
+// missingMetadata returns the fields of found that are missing from have.
+// Titles are left as they were scanned.
+func missingMetadata(found, have models.Metadata) models.Metadata {
+	var meta models.Metadata
+	if !have.Year.Valid {
+		meta.Year = found.Year
+	}
+	if !have.Description.Valid {
+		meta.Description = found.Description
+	}
+	if !have.Rating.Valid {
+		meta.Rating = found.Rating
+	}
+	if !have.IMDbID.Valid {
+		meta.IMDbID = found.IMDbID
+	}
+	if !have.TMDbID.Valid {
+		meta.TMDbID = found.TMDbID
+	}
+	if !have.TVDbID.Valid {
+		meta.TVDbID = found.TVDbID
+	}
+	return meta
+}
+
+// downloadArtwork saves provider artwork in the artwork directory and returns
+// its path, unless there is artwork already. Failed downloads are logged and
+// leave the current value.
+func downloadArtwork(ctx context.Context, cfg *ScanConfig, ref string, current sql.NullString) sql.NullString {
+	if current.Valid || ref == "" || cfg.ArtworkDir == "" {
+		return current
+	}
+	name := path.Base(ref)
+	if !slices.Contains(artworkExtensions, strings.ToLower(filepath.Ext(name))) {
+		return current
+	}
+	file := filepath.Join(cfg.ArtworkDir, name)
+	if _, err := os.Stat(file); err == nil {
+		return nullString(file)
+	}
+
+	data, err := cfg.Metadata.Artwork(ctx, ref)
+	if err != nil {
+		log.Printf("Error downloading artwork %s: %v", ref, err)
+		return current
+	}
+	if err := writeFileAtomic(file, data); err != nil {
+		log.Printf("Error saving artwork %s: %v", file, err)
+		return current
+	}
+	return nullString(file)
+}
+
+// writeFileAtomic writes a file through a temporary file so readers never see it
+// half written
+func writeFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
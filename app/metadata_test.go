@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"transogov2/app/models"
+)
+
+func TestBestMatch(t *testing.T) {
+	matches := []MetadataMatch{
+		{ID: "1", Title: "Heat Wave", Year: 1995},
+		{ID: "2", Title: "Heat", Year: 1986},
+		{ID: "3", Title: "Heat", Year: 1995},
+		{ID: "4", Title: "Léon", OriginalTitle: "Léon: The Professional", Year: 1994},
+	}
+	tests := []struct {
+		title string
+		year  int
+		want  string
+	}{
+		{"Heat", 1995, "3"},
+		{"heat", 1996, "3"},
+		{"Heat", 0, "2"},
+		{"Heat", 2010, ""},
+		{"Leon The Professional", 1994, ""},
+		{"Léon: The Professional", 1994, "4"},
+		{"Ronin", 1998, ""},
+	}
+	for _, tt := range tests {
+		if got := bestMatch(matches, tt.title, tt.year); got != tt.want {
+			t.Errorf("bestMatch(%q, %d) = %q, want %q", tt.title, tt.year, got, tt.want)
+		}
+	}
+}
+
+func TestScanLooksUpMetadata(t *testing.T) {
+	metadataCfg, requests := newTMDBServer(t)
+	cfg := newTestLibrary(t)
+	cfg.Metadata = NewTMDBProvider(metadataCfg)
+	cfg.ArtworkDir = metadataCfg.ArtworkDir()
+
+	heatPath := filepath.Join(cfg.MoviesDir, "Heat (1995)", "heat.1080p.mkv")
+	writeFile(t, heatPath, "heat")
+	// NFO metadata wins over what the provider says
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Heat (1995)", "movie.nfo"), "<movie><title>Heat</title><rating>9.5</rating></movie>")
+	unknownPath := filepath.Join(cfg.MoviesDir, "Unknown.Film.2001.mkv")
+	writeFile(t, unknownPath, "unknown")
+	show := filepath.Join(cfg.TVDir, "The Wire")
+	writeFile(t, filepath.Join(show, "Season 1", "The.Wire.S01E01.mkv"), "episode")
+	writeFile(t, filepath.Join(show, "poster.jpg"), "local poster")
+
+	repo := newFakeRepo()
+	ctx := context.Background()
+	summary, err := ScanMedia(ctx, repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Warnings) != 0 {
+		t.Errorf("warnings = %q, want none", summary.Warnings)
+	}
+
+	heat, _ := repo.GetMediaByPath(ctx, heatPath)
+	if heat.TMDbID.String != "949" || heat.IMDbID.String != "tt0113277" || heat.Year.Int64 != 1995 || !heat.Description.Valid || heat.Rating.String != "9.5" {
+		t.Errorf("Heat = %+v, want the TMDB metadata except the rating", heat)
+	}
+	if heat.PosterPath.String != filepath.Join(cfg.ArtworkDir, "heat-poster.jpg") || heat.FanartPath.String != filepath.Join(cfg.ArtworkDir, "heat-backdrop.jpg") {
+		t.Errorf("Heat artwork = %q, %q, want the downloaded images", heat.PosterPath.String, heat.FanartPath.String)
+	}
+	if data, err := os.ReadFile(heat.PosterPath.String); err != nil || string(data) != "heat poster" {
+		t.Errorf("downloaded poster = %q, %v", data, err)
+	}
+	if unknown, _ := repo.GetMediaByPath(ctx, unknownPath); unknown.TMDbID.Valid || unknown.Description.Valid {
+		t.Errorf("Unknown Film = %+v, want no match", unknown)
+	}
+
+	tvshow, _ := repo.GetTVShowByPath(ctx, show)
+	if tvshow.TMDbID.String != "1438" || tvshow.TVDbID.String != "79126" || tvshow.Rating.String != "8.6" || !tvshow.Description.Valid {
+		t.Errorf("show = %+v, want the TMDB metadata", tvshow)
+	}
+	if tvshow.PosterPath.String != filepath.Join(show, "poster.jpg") {
+		t.Errorf("show poster = %q, want the local one", tvshow.PosterPath.String)
+	}
+
+	// Matched items are not looked up again, and downloaded artwork survives
+	// the artwork discovery of a full rescan
+	before := requests.Load()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if heat, _ := repo.GetMediaByPath(ctx, heatPath); heat.PosterPath.String != filepath.Join(cfg.ArtworkDir, "heat-poster.jpg") {
+		t.Errorf("Heat poster = %q after a rescan, want the downloaded one", heat.PosterPath.String)
+	}
+	// The unmatched movie waits for its retry
+	if n := requests.Load(); n != before {
+		t.Errorf("%d requests on the rescan, want none", n-before)
+	}
+}
+
+func TestScanBacksOffUnmatchedMetadata(t *testing.T) {
+	metadataCfg, requests := newTMDBServer(t)
+	metadataCfg.CacheDir = ""
+	cfg := newTestLibrary(t)
+	cfg.Metadata = NewTMDBProvider(metadataCfg)
+	unknownPath := filepath.Join(cfg.MoviesDir, "Unknown.Film.2001.mkv")
+	writeFile(t, unknownPath, "unknown")
+
+	repo := newFakeRepo()
+	ctx := context.Background()
+	scan := func(full bool) (int32, models.MetadataLookup) {
+		t.Helper()
+		before := requests.Load()
+		if _, err := ScanMedia(ctx, repo, cfg, nil, full); err != nil {
+			t.Fatal(err)
+		}
+		unknown, _ := repo.GetMediaByPath(ctx, unknownPath)
+		return requests.Load() - before, unknown.MetadataLookup
+	}
+
+	if n, lookup := scan(false); n == 0 || lookup.Misses != 1 || !lookup.CheckedAt.Valid {
+		t.Fatalf("first scan: %d requests, lookup %+v, want a search and one miss", n, lookup)
+	}
+	if n, _ := scan(true); n != 0 {
+		t.Errorf("%d requests on a rescan right after a miss, want none", n)
+	}
+
+	// Once the retry is due, only a scan that touches the movie looks it up
+	unknown, _ := repo.GetMediaByPath(ctx, unknownPath)
+	checked := models.MetadataLookup{CheckedAt: sql.NullTime{Time: time.Now().Add(-2 * metadataRetry), Valid: true}, Misses: 1}
+	repo.SetMediaMetadataLookup(ctx, unknown.ID, checked)
+	if n, _ := scan(false); n != 0 {
+		t.Errorf("%d requests on an incremental scan that skipped the movie, want none", n)
+	}
+	if n, lookup := scan(true); n == 0 || lookup.Misses != 2 {
+		t.Errorf("full rescan: %d requests, lookup %+v, want a search and two misses", n, lookup)
+	}
+	// The wait doubles with each miss
+	checked.CheckedAt.Time = time.Now().Add(-metadataRetry * 3 / 2)
+	repo.SetMediaMetadataLookup(ctx, unknown.ID, models.MetadataLookup{CheckedAt: checked.CheckedAt, Misses: 2})
+	if n, _ := scan(true); n != 0 {
+		t.Errorf("%d requests before the second retry is due, want none", n)
+	}
+}
+
+func TestScanStopsMetadataLookupOnError(t *testing.T) {
+	metadataCfg, _ := newTMDBServer(t)
+	metadataCfg.TMDBAPIKey = "wrong"
+	cfg := newTestLibrary(t)
+	cfg.Metadata = NewTMDBProvider(metadataCfg)
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Heat.1995.mkv"), "heat")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Ronin.1998.mkv"), "ronin")
+
+	summary, err := ScanMedia(context.Background(), newFakeRepo(), cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Warnings) != 1 || summary.Added != 2 {
+		t.Errorf("added %d with warnings %q, want 2 files and one warning", summary.Added, summary.Warnings)
+	}
+}
@@ -4,6 +4,31 @@ import (
 	"database/sql"
 )
 
+// ExternalIDs are the IDs of a movie, show or episode on metadata sites
+type ExternalIDs struct {
+	IMDbID sql.NullString `db:"imdb_id"`
+	TMDbID sql.NullString `db:"tmdb_id"`
+	TVDbID sql.NullString `db:"tvdb_id"`
+}
+
+// MetadataLookup records when a movie or TV show was last looked up with the
+// metadata provider, and how many lookups in a row found nothing
+type MetadataLookup struct {
+	CheckedAt sql.NullTime `db:"metadata_checked_at"`
+	Misses    int          `db:"metadata_misses"`
+}
+
+// Metadata describes a movie, show or episode, as read from an NFO file.
+// Fields that are not valid are unknown and leave stored values alone.
+type Metadata struct {
+	Title       sql.NullString
+	Year        sql.NullInt64
+	Description sql.NullString
+	Rating      sql.NullString
+	AirDate     sql.NullTime // episodes only
+	ExternalIDs
+}
+
 // Media represents a media file
 type Media struct {
 	ID            int64          `db:"id"`
@@ -13,9 +38,38 @@ type Media struct {
 	FileSize      int64          `db:"file_size"`
 	FileExtension string         `db:"file_extension"`
 	PosterPath    sql.NullString `db:"poster_path"`
+	FanartPath    sql.NullString `db:"fanart_path"`
 	Rating        sql.NullString `db:"rating"`
 	Year          sql.NullInt64  `db:"year"`
 	Description   sql.NullString `db:"description"`
+	MissingSince  sql.NullTime   `db:"missing_since"`
+	Fingerprint   sql.NullString `db:"fingerprint"`
+	// DurationMS is the running time read from the file's headers
+	DurationMS sql.NullInt64 `db:"duration_ms"`
+	// Release details parsed from the file name, or read from its headers
+	Resolution   sql.NullString `db:"resolution"`
+	Source       sql.NullString `db:"source"`
+	VideoCodec   sql.NullString `db:"video_codec"`
+	AudioCodec   sql.NullString `db:"audio_codec"`
+	HDR          bool           `db:"hdr"`
+	ReleaseGroup sql.NullString `db:"release_group"`
+	Edition      sql.NullString `db:"edition"`
+	// ReleaseParsed is false for rows saved before release details were parsed
+	// from file names; scans fill them in
+	ReleaseParsed bool `db:"release_parsed"`
+	// ParentID is the movie a later part of a multi-part movie or an extra
+	// belongs to; movies shown in the library have none
+	ParentID sql.NullInt64 `db:"parent_id"`
+	// Part is the part number of a movie split into several files, such as
+	// "Movie.cd2.avi"
+	Part sql.NullInt64 `db:"part"`
+	// ExtraType is one of the ExtraType constants for trailers and other extras
+	ExtraType sql.NullString `db:"extra_type"`
+	// VersionOf is the main version of a movie kept in several versions, such
+	// as a 4K copy or a director's cut; it is not set on the main version
+	VersionOf sql.NullInt64 `db:"version_of"`
+	MetadataLookup
+	ExternalIDs
 }
 
 // Media type constants
@@ -24,33 +78,168 @@ const (
 	MediaTypeTVShow = "tvshow"
 )
 
+// Extra types for Media.ExtraType
+const (
+	ExtraTypeTrailer         = "trailer"
+	ExtraTypeFeaturette      = "featurette"
+	ExtraTypeBehindTheScenes = "behindthescenes"
+	ExtraTypeDeleted         = "deleted"
+	ExtraTypeInterview       = "interview"
+	ExtraTypeScene           = "scene"
+	ExtraTypeShort           = "short"
+	ExtraTypeOther           = "other"
+)
+
+// ExtraTypeNames are the display names of the extra types; other extras are
+// shown as "Extra"
+var ExtraTypeNames = map[string]string{
+	ExtraTypeTrailer:         "Trailer",
+	ExtraTypeFeaturette:      "Featurette",
+	ExtraTypeBehindTheScenes: "Behind the Scenes",
+	ExtraTypeDeleted:         "Deleted Scene",
+	ExtraTypeInterview:       "Interview",
+	ExtraTypeScene:           "Scene",
+	ExtraTypeShort:           "Short",
+}
+
 // TVShow represents a TV show
 type TVShow struct {
 	ID          int64          `db:"id"`
 	Title       string         `db:"title"`
 	Path        string         `db:"path"`
 	PosterPath  sql.NullString `db:"poster_path"`
+	FanartPath  sql.NullString `db:"fanart_path"`
 	Rating      sql.NullString `db:"rating"`
 	Year        sql.NullInt64  `db:"year"`
 	Description sql.NullString `db:"description"`
+	// EpisodeOrder is how season pages order episodes: one of the EpisodeOrder
+	// constants, with an empty value meaning EpisodeOrderAired
+	EpisodeOrder string `db:"episode_order"`
+	MetadataLookup
+	ExternalIDs
 }
 
+// Episode orderings for TVShow.EpisodeOrder
+const (
+	EpisodeOrderAired    = "aired"    // by season and episode number
+	EpisodeOrderAbsolute = "absolute" // by absolute episode number, for anime
+	EpisodeOrderDate     = "date"     // by air date, for daily shows
+)
+
 // Season represents a TV show season
 type Season struct {
-	ID       int64  `db:"id"`
-	TVShowID int64  `db:"tvshow_id"`
-	Number   int    `db:"number"`
-	Title    string `db:"title"`
-	Path     string `db:"path"`
+	ID         int64          `db:"id"`
+	TVShowID   int64          `db:"tvshow_id"`
+	Number     int            `db:"number"`
+	Title      string         `db:"title"`
+	Path       string         `db:"path"`
+	PosterPath sql.NullString `db:"poster_path"`
 }
 
 // Episode represents a TV show episode
 type Episode struct {
-	ID       int64          `db:"id"`
-	SeasonID int64          `db:"season_id"`
-	Number   int            `db:"number"`
-	Title    string         `db:"title"`
-	Path     string         `db:"path"`
-	FileSize int64          `db:"file_size"`
-	Rating   sql.NullString `db:"rating"`
+	ID           int64          `db:"id"`
+	SeasonID     int64          `db:"season_id"`
+	Number       int            `db:"number"`
+	Title        string         `db:"title"`
+	Path         string         `db:"path"`
+	FileSize     int64          `db:"file_size"`
+	Rating       sql.NullString `db:"rating"`
+	MissingSince sql.NullTime   `db:"missing_since"`
+	Fingerprint  sql.NullString `db:"fingerprint"`
+	DurationMS   sql.NullInt64  `db:"duration_ms"`
+	// LastNumber is the last episode in a file holding several episodes, such
+	// as "S01E01E02"; Number is the first
+	LastNumber     sql.NullInt64 `db:"last_number"`
+	AirDate        sql.NullTime  `db:"air_date"`
+	AbsoluteNumber sql.NullInt64 `db:"absolute_number"`
+	// NamedSeason is the season given by the file's name, which may differ
+	// from the season folder it is in
+	NamedSeason sql.NullInt64  `db:"named_season"`
+	Description sql.NullString `db:"description"`
+	ExternalIDs
+}
+
+// MediaStream is a video, audio or subtitle track of a movie or episode file,
+// as read from the file's headers
+type MediaStream struct {
+	ID        int64         `db:"id"`
+	MediaID   sql.NullInt64 `db:"media_id"`
+	EpisodeID sql.NullInt64 `db:"episode_id"`
+	// Index is the position of the track in the file, from 0
+	Index int    `db:"stream_index"`
+	Type  string `db:"stream_type"`
+	// Codec is a display name such as "H.264", and CodecID the container's own
+	// identifier, such as "V_MPEG4/ISO/AVC"
+	Codec    string         `db:"codec"`
+	CodecID  string         `db:"codec_id"`
+	Language sql.NullString `db:"language"`
+	Title    sql.NullString `db:"title"`
+	Default  bool           `db:"is_default"`
+	Forced   bool           `db:"forced"`
+	// Video streams only
+	Width     sql.NullInt64   `db:"width"`
+	Height    sql.NullInt64   `db:"height"`
+	FrameRate sql.NullFloat64 `db:"frame_rate"`
+	// Audio streams only
+	Channels   sql.NullInt64 `db:"channels"`
+	SampleRate sql.NullInt64 `db:"sample_rate"`
+}
+
+// Stream types for MediaStream.Type
+const (
+	StreamTypeVideo    = "video"
+	StreamTypeAudio    = "audio"
+	StreamTypeSubtitle = "subtitle"
+)
+
+// Chapter is a named point in the timeline of a movie or episode file
+type Chapter struct {
+	ID        int64         `db:"id"`
+	MediaID   sql.NullInt64 `db:"media_id"`
+	EpisodeID sql.NullInt64 `db:"episode_id"`
+	// Index is the position of the chapter in the file, from 0
+	Index   int            `db:"chapter_index"`
+	StartMS int64          `db:"start_ms"`
+	EndMS   sql.NullInt64  `db:"end_ms"`
+	Title   sql.NullString `db:"title"`
+}
+
+// Subtitle is a subtitle file stored next to a movie or episode file, such as
+// "Heat.en.forced.srt", rather than a track inside it
+type Subtitle struct {
+	ID        int64         `db:"id"`
+	MediaID   sql.NullInt64 `db:"media_id"`
+	EpisodeID sql.NullInt64 `db:"episode_id"`
+	Path      string        `db:"path"`
+	// Format is the file's extension without the dot, such as "srt" or "ass"
+	Format string `db:"format"`
+	// Language is an ISO 639-2 code such as "eng", parsed from the file name
+	Language sql.NullString `db:"language"`
+	Forced   bool           `db:"forced"`
+	// SDH subtitles also describe sounds, for the deaf and hard of hearing
+	SDH bool `db:"sdh"`
+}
+
+// Release is what was parsed from the release name of a movie file. Fields that
+// are not valid were not in the name.
+type Release struct {
+	Resolution   sql.NullString
+	Source       sql.NullString
+	VideoCodec   sql.NullString
+	AudioCodec   sql.NullString
+	HDR          bool
+	ReleaseGroup sql.NullString
+	Edition      sql.NullString
+}
+
+// MediaInfo is what was read from the headers of a movie or episode file.
+// Fields that are not valid are unknown and leave stored values alone.
+type MediaInfo struct {
+	DurationMS sql.NullInt64
+	Resolution sql.NullString
+	VideoCodec sql.NullString
+	AudioCodec sql.NullString
+	Streams    []MediaStream
+	Chapters   []Chapter
 }
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ScanRun records a single run of the media scanner
+type ScanRun struct {
+	ID         int64          `db:"id"`
+	StartedAt  time.Time      `db:"started_at"`
+	FinishedAt sql.NullTime   `db:"finished_at"`
+	Status     string         `db:"status"`
+	Added      int            `db:"added"`
+	Updated    int            `db:"updated"`
+	Removed    int            `db:"removed"`
+	Errors     int            `db:"errors"`
+	Warnings   int            `db:"warnings"`
+	Error      sql.NullString `db:"error"`
+}
+
+// Scan run status constants
+const (
+	ScanStatusRunning   = "running"
+	ScanStatusCompleted = "completed"
+	ScanStatusFailed    = "failed"
+	ScanStatusCancelled = "cancelled"
+)
+
+// ScanState records a library directory or video file as it was when last scanned.
+// Directories that have not been modified since are skipped by incremental scans.
+type ScanState struct {
+	Path    string `db:"path"`
+	IsDir   bool   `db:"is_dir"`
+	Size    int64  `db:"size"`
+	ModTime int64  `db:"mod_time"` // nanoseconds since the Unix epoch
+	Rules   int64  `db:"rules"`    // hash of the ignore rules that applied to a directory
+	// Sidecars hashes the NFO and other files read with a video file
+	Sidecars int64 `db:"sidecars"`
+}
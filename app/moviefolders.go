@@ -0,0 +1,406 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"transogov2/app/models"
+)
+
+// extraDirs maps the names of the extras folders found inside movie folders
+// (lowercased) to the extra type of the videos in them
+var extraDirs = map[string]string{
+	"trailers":          models.ExtraTypeTrailer,
+	"featurettes":       models.ExtraTypeFeaturette,
+	"behind the scenes": models.ExtraTypeBehindTheScenes,
+	"behindthescenes":   models.ExtraTypeBehindTheScenes,
+	"deleted scenes":    models.ExtraTypeDeleted,
+	"interviews":        models.ExtraTypeInterview,
+	"scenes":            models.ExtraTypeScene,
+	"shorts":            models.ExtraTypeShort,
+	"extras":            models.ExtraTypeOther,
+	"other":             models.ExtraTypeOther,
+}
+
+// extraSuffixRe matches the extra suffix of names like "Heat (1995)-trailer.mkv"
+// or "Heat-behindthescenes.mkv". Group 1 is the name of the video the extra
+// belongs to and group 2 the extra type.
+var extraSuffixRe = regexp.MustCompile(`(?i)^(.*?)[ ._]?-[ ._]?(trailer|featurette|behindthescenes|deleted|interview|scene|short|other)$`)
+
+// movieExtra returns the extra type of a video in the movie library at root, or
+// "" if it is a feature. Extras are the videos in an extras folder such as
+// "Trailers" inside a movie folder and those named with an extra suffix. For
+// suffixed extras, owner is the name of the movie they belong to; it is empty
+// for extras in an extras folder. A folder such as "Shorts" directly in the
+// library holds movies rather than extras.
+func movieExtra(root, path string) (extraType, owner string) {
+	if t, ok := extrasFolder(root, filepath.Dir(path)); ok {
+		return t, ""
+	}
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if strings.EqualFold(stem, "trailer") {
+		return models.ExtraTypeTrailer, ""
+	}
+	if m := extraSuffixRe.FindStringSubmatch(stem); m != nil {
+		return strings.ToLower(m[2]), m[1]
+	}
+	return "", ""
+}
+
+// extrasFolder returns the extra type of the videos in dir if it is an extras
+// folder: one named like "Trailers" inside a movie folder of the library at root
+func extrasFolder(root, dir string) (string, bool) {
+	if filepath.Dir(dir) == root || dir == root {
+		return "", false
+	}
+	t, ok := extraDirs[strings.ToLower(filepath.Base(dir))]
+	return t, ok
+}
+
+// isExtra reports whether a video is a movie extra
+func isExtra(root, path string) bool {
+	extraType, _ := movieExtra(root, path)
+	return extraType != ""
+}
+
+// movieFolder returns the folder of the movie a video belongs to: the folder
+// holding it, or for videos in an extras folder the folder above
+func movieFolder(root, path string) string {
+	dir := filepath.Dir(path)
+	if _, ok := extrasFolder(root, dir); ok {
+		return filepath.Dir(dir)
+	}
+	return dir
+}
+
+// stackRe matches the part marker of a movie split into several files, such as
+// "Movie.cd1.avi", "Movie - Part 2.mkv" or "Movie [Disc 1].mkv". Group 1 is the
+// text before the marker, group 2 the part number and group 3 the rest.
+var stackRe = regexp.MustCompile(`(?i)^(.*?)(?:^|[ ._-]+|[ ._-]*[\[(])(?:cd|dvd|part|pt|disc|disk)[ ._-]*(\d{1,2})[\])]?([ ._-].*|)$`)
+
+// stackKey returns the name shared by the parts of a stacked movie and the part
+// number of a file, or false if the name has no part marker
+func stackKey(name string) (string, int, bool) {
+	m := stackRe.FindStringSubmatch(name)
+	if m == nil {
+		return "", 0, false
+	}
+	part, _ := strconv.Atoi(m[2])
+	return strings.ToLower(m[1] + "\x00" + m[3]), part, true
+}
+
+// moviePart returns the part number of a video that is one of several parts of
+// a movie, or 0. A part marker alone is not enough, as titles like "Harry Potter
+// and the Deathly Hallows Part 2" show: another part with the same name must be
+// next to it.
+func moviePart(filter *scanFilter, dirs *dirListings, path string) int {
+	key, part, ok := stackKey(filepath.Base(path))
+	if !ok {
+		return 0
+	}
+	entries, err := dirs.read(filepath.Dir(path))
+	if err != nil {
+		log.Printf("Error reading directory %s: %v", filepath.Dir(path), err)
+		return 0
+	}
+	for _, entry := range entries {
+		sibling := filepath.Join(filepath.Dir(path), entry.Name())
+		if entry.IsDir() || sibling == path || filter.ignored(sibling, false) || !filter.isVideo(sibling) {
+			continue
+		}
+		if k, p, ok := stackKey(entry.Name()); ok && k == key && p != part {
+			return part
+		}
+	}
+	return 0
+}
+
+// movieTitle works out the title and year of a movie file. Inside a movie
+// folder such as "Heat (1995)" the folder name wins, as it is usually tidier
+// than the file name; folders without a year, which may hold a collection, only
+// stand in for what the file name lacks. Part markers are left out of titles.
+func movieTitle(root, path string, part int) (string, int) {
+	name := filepath.Base(path)
+	if part > 0 {
+		m := stackRe.FindStringSubmatch(name)
+		name = m[1] + m[3]
+	}
+	release := ParseReleaseName(name)
+	title, year := release.Title, release.Year
+
+	if dir := filepath.Dir(path); dir != root {
+		folder := ParseReleaseName(filepath.Base(dir))
+		if folder.Title != "" && (folder.Year != 0 || title == "") {
+			title = folder.Title
+		}
+		if folder.Year != 0 {
+			year = folder.Year
+		}
+	}
+	if title == "" {
+		title = cleanTitle(filepath.Base(path))
+	}
+	return title, year
+}
+
+// extraTitle is the display title of an extra: its cleaned file name, or the
+// extra type for names like "Heat-trailer.mkv" that only say what it is
+func extraTitle(path, extraType string) string {
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if strings.EqualFold(stem, "trailer") || extraSuffixRe.MatchString(stem) {
+		return extraTypeTitle(extraType)
+	}
+	return cleanTitle(filepath.Base(path))
+}
+
+// extraTypeTitle returns the display name of an extra type
+func extraTypeTitle(extraType string) string {
+	if name, ok := models.ExtraTypeNames[extraType]; ok {
+		return name
+	}
+	return "Extra"
+}
+
+// linkMovies attaches the later parts of stacked movies to their first part and
+// extras to the movie they belong to, numbers the parts and groups the versions
+// of each movie. It looks at the movies of the movie folders in dirs, or every
+// movie if dirs is nil, present on disk, so files that were skipped as unchanged
+// still find their parent, and a part or extra whose movie vanished is detached.
+func linkMovies(ctx context.Context, repo MediaRepository, filter *scanFilter, dirs []string) error {
+	all, err := linkedMedia(ctx, repo, filter, dirs)
+	if err != nil {
+		return err
+	}
+	var movies []models.Media
+	for _, m := range all {
+		if m.MediaType == models.MediaTypeMovie && !m.MissingSince.Valid {
+			movies = append(movies, m)
+		}
+	}
+	sort.Slice(movies, func(i, j int) bool { return movies[i].Path < movies[j].Path })
+
+	// Group the features with part markers by directory and stack name; groups
+	// of more than one part are stacks
+	stacks := make(map[string][]models.Media)
+	parts := make(map[int64]int)
+	for _, m := range movies {
+		if m.ExtraType.Valid {
+			continue
+		}
+		if key, part, ok := stackKey(filepath.Base(m.Path)); ok {
+			key = filepath.Dir(m.Path) + "\x00" + key
+			stacks[key] = append(stacks[key], m)
+			parts[m.ID] = part
+		}
+	}
+	heads := make(map[int64]int64) // part -> first part of its stack
+	for _, stack := range stacks {
+		if len(stack) < 2 {
+			continue
+		}
+		head := stack[0]
+		for _, m := range stack {
+			if parts[m.ID] < parts[head.ID] {
+				head = m
+			}
+		}
+		for _, m := range stack {
+			heads[m.ID] = head.ID
+		}
+	}
+
+	// Features with the same title and year are versions of one movie. The
+	// first by path is the main version, except that a movie which already
+	// has versions stays the main one, so adding a copy never moves the movie
+	// to another page.
+	var features []models.Media
+	hasVersions := make(map[int64]bool)
+	for _, m := range movies {
+		if m.VersionOf.Valid {
+			hasVersions[m.VersionOf.Int64] = true
+		}
+	}
+	mainVersions := make(map[string]int64)
+	for _, m := range movies {
+		if head, ok := heads[m.ID]; m.ExtraType.Valid || (ok && head != m.ID) {
+			continue
+		}
+		features = append(features, m)
+		key := versionKey(filter, m)
+		if main, ok := mainVersions[key]; !ok || hasVersions[m.ID] && !hasVersions[main] {
+			mainVersions[key] = m.ID
+		}
+	}
+	versionOf := make(map[int64]int64)
+	for _, m := range features {
+		if main := mainVersions[versionKey(filter, m)]; main != m.ID {
+			versionOf[m.ID] = main
+		}
+	}
+	mainVersion := func(id int64) int64 {
+		if main, ok := versionOf[id]; ok {
+			return main
+		}
+		return id
+	}
+
+	// The main movie of each movie folder, and every feature by name for
+	// suffixed extras. Extras belong to the main version.
+	mains := make(map[string]int64)
+	byName := make(map[string]int64)
+	for _, m := range features {
+		dir := filepath.Dir(m.Path)
+		if root, _ := filter.root(m.Path); dir != root {
+			if _, ok := mains[dir]; !ok {
+				mains[dir] = mainVersion(m.ID)
+			}
+		}
+		name := filepath.Base(m.Path)
+		byName[filepath.Join(dir, strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name))))] = mainVersion(m.ID)
+	}
+
+	for _, m := range movies {
+		var parent, part int64
+		if m.ExtraType.Valid {
+			root, _ := filter.root(m.Path)
+			if _, owner := movieExtra(root, m.Path); owner != "" {
+				parent = byName[filepath.Join(filepath.Dir(m.Path), strings.ToLower(owner))]
+			}
+			if parent == 0 {
+				parent = mains[movieFolder(root, m.Path)]
+			}
+		} else if head, ok := heads[m.ID]; ok {
+			part = int64(parts[m.ID])
+			if head != m.ID {
+				parent = head
+			}
+		}
+		wantParent := sql.NullInt64{Int64: parent, Valid: parent != 0}
+		wantPart := sql.NullInt64{Int64: part, Valid: part != 0}
+		if m.ParentID != wantParent || m.Part != wantPart {
+			if err := repo.LinkMedia(ctx, m.ID, wantParent, wantPart); err != nil {
+				return err
+			}
+		}
+		main, ok := versionOf[m.ID]
+		if wantVersionOf := (sql.NullInt64{Int64: main, Valid: ok}); m.VersionOf != wantVersionOf {
+			if err := repo.SetMediaVersionOf(ctx, m.ID, wantVersionOf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// linkedMedia loads the media linkMovies looks at: all of it if dirs is nil,
+// otherwise that of the movie folders in dirs and of every folder holding
+// another version of one of their movies, and so on, so that each folder and
+// group of versions is linked whole
+func linkedMedia(ctx context.Context, repo MediaRepository, filter *scanFilter, dirs []string) ([]models.Media, error) {
+	if dirs == nil {
+		return repo.GetAllMedia(ctx)
+	}
+	var media []models.Media
+	loaded := make(map[string]bool)
+	titles := make(map[string]bool)
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		if loaded[dir] {
+			continue
+		}
+		loaded[dir] = true
+		rows, err := folderMedia(ctx, repo, filter, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range rows {
+			media = append(media, m)
+			if m.ExtraType.Valid {
+				continue
+			}
+			versions, err := otherVersions(ctx, repo, m, titles)
+			if err != nil {
+				return nil, err
+			}
+			for _, v := range versions {
+				root, _ := filter.root(v.Path)
+				dirs = append(dirs, movieFolder(root, v.Path))
+			}
+		}
+	}
+	return media, nil
+}
+
+// folderMedia loads the media of a movie folder, including its extras folders.
+// A library root is the folder of the loose movies directly in it.
+func folderMedia(ctx context.Context, repo MediaRepository, filter *scanFilter, dir string) ([]models.Media, error) {
+	if root, _ := filter.root(dir); root == dir {
+		return repo.GetMediaIn(ctx, dir)
+	}
+	rows, err := repo.GetMediaUnder(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	var media []models.Media
+	for _, m := range rows {
+		// Movie folders inside a collection folder are folders of their own
+		if root, _ := filter.root(m.Path); movieFolder(root, m.Path) == dir {
+			media = append(media, m)
+		}
+	}
+	return media, nil
+}
+
+// otherVersions loads the movies that may be versions of m, now or until this
+// scan: those with its title, those grouped under it and the one it is grouped
+// under. Titles already in titles are not looked up again.
+func otherVersions(ctx context.Context, repo MediaRepository, m models.Media, titles map[string]bool) ([]models.Media, error) {
+	var versions []models.Media
+	if title := strings.ToLower(m.Title); !titles[title] {
+		titles[title] = true
+		rows, err := repo.GetMoviesByTitle(ctx, m.Title)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, rows...)
+	}
+	rows, err := repo.GetMediaVersions(ctx, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	versions = append(versions, rows...)
+	if m.VersionOf.Valid {
+		main, err := repo.GetMediaByID(ctx, m.VersionOf.Int64)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			versions = append(versions, main)
+		}
+	}
+	return versions, nil
+}
+
+// versionKey returns the name shared by the versions of a movie: its title and
+// year. A title without a year is not enough to tell films apart, so movies
+// without one are only versions of those in the same movie folder, and loose
+// movies at the library root are never grouped.
+func versionKey(filter *scanFilter, m models.Media) string {
+	key := strings.ToLower(m.Title) + "\x00"
+	if m.Year.Valid {
+		return key + strconv.FormatInt(m.Year.Int64, 10)
+	}
+	root, _ := filter.root(m.Path)
+	if dir := filepath.Dir(m.Path); dir != root {
+		return key + "\x00" + movieFolder(root, m.Path)
+	}
+	return key + "\x00" + m.Path
+}
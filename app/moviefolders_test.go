@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"transogov2/app/models"
+)
+
+func TestMovieExtra(t *testing.T) {
+	tests := []struct {
+		path      string
+		extraType string
+		owner     string
+	}{
+		{"/movies/Heat (1995)/Heat.1995.mkv", "", ""},
+		{"/movies/Heat (1995)/Trailers/Teaser.mkv", models.ExtraTypeTrailer, ""},
+		{"/movies/Heat (1995)/Featurettes/Shooting LA.mkv", models.ExtraTypeFeaturette, ""},
+		{"/movies/Heat (1995)/Behind The Scenes/Making Of.mkv", models.ExtraTypeBehindTheScenes, ""},
+		{"/movies/Heat (1995)/Deleted Scenes/Diner.mkv", models.ExtraTypeDeleted, ""},
+		{"/movies/Heat (1995)/Extras/Commentary.mkv", models.ExtraTypeOther, ""},
+		{"/movies/Heat (1995)/trailer.mp4", models.ExtraTypeTrailer, ""},
+		{"/movies/Heat (1995)/Heat (1995)-trailer.mkv", models.ExtraTypeTrailer, "Heat (1995)"},
+		{"/movies/Heat (1995)/Heat-Featurette.mkv", models.ExtraTypeFeaturette, "Heat"},
+		{"/movies/Heat (1995)/Heat - behindthescenes.mkv", models.ExtraTypeBehindTheScenes, "Heat"},
+		{"/movies/Trailer Park Boys (2006)/Trailer.Park.Boys.2006.mkv", "", ""},
+		{"/movies/The Other Guys (2010)/The.Other.Guys.2010.mkv", "", ""},
+		{"/movies/Shorts/Paperman (2012).mkv", "", ""},
+		{"/movies/Trailers/Heat (1995)/Heat.1995.mkv", "", ""},
+	}
+	for _, tt := range tests {
+		extraType, owner := movieExtra("/movies", tt.path)
+		if extraType != tt.extraType || owner != tt.owner {
+			t.Errorf("movieExtra(%q) = %q, %q, want %q, %q", tt.path, extraType, owner, tt.extraType, tt.owner)
+		}
+	}
+}
+
+func TestStackKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		stacked bool
+		part    int
+	}{
+		{"Movie.cd1.avi", true, 1},
+		{"Movie.CD2.avi", true, 2},
+		{"Movie - Part 2.mkv", true, 2},
+		{"Movie.pt3.mkv", true, 3},
+		{"Movie [Disc 1].mkv", true, 1},
+		{"Movie (DVD2).mkv", true, 2},
+		{"cd1.avi", true, 1},
+		{"Movie.2010.1080p.mkv", false, 0},
+		{"Apartment.1960.mkv", false, 0},
+		{"The.Departed.2006.mkv", false, 0},
+		{"Movie.cd12abc.avi", false, 0},
+	}
+	for _, tt := range tests {
+		_, part, ok := stackKey(tt.name)
+		if ok != tt.stacked || part != tt.part {
+			t.Errorf("stackKey(%q) = part %d, %v, want part %d, %v", tt.name, part, ok, tt.part, tt.stacked)
+		}
+	}
+
+	a, _, _ := stackKey("Movie.cd1.avi")
+	b, _, _ := stackKey("movie.CD2.avi")
+	c, _, _ := stackKey("Movie.cd1.mkv")
+	if a != b || a == c {
+		t.Errorf("stack keys %q, %q, %q: want the first two equal and the last different", a, b, c)
+	}
+}
+
+// writeMovieFixtures writes a movie library in the usual layouts: movies in
+// their own folders with extras, a stacked movie, a collection folder and loose
+// files at the root
+func writeMovieFixtures(t *testing.T, root string) {
+	t.Helper()
+	for name, contents := range map[string]string{
+		"Heat (1995)/heat.1995.1080p.bluray.x264-grp.mkv":         "heat",
+		"Heat (1995)/Trailers/Teaser.mkv":                         "teaser",
+		"Heat (1995)/Heat-featurette.mkv":                         "featurette",
+		"Heat (1995)/Behind The Scenes/Making Of.mkv":             "making of",
+		"The Abyss (1989)/The.Abyss.cd1.avi":                      "abyss 1",
+		"The Abyss (1989)/The.Abyss.cd2.avi":                      "abyss 2",
+		"The Abyss (1989)/The.Abyss-trailer.avi":                  "abyss trailer",
+		"Sci-Fi/Alien.1979.mkv":                                   "alien",
+		"Sci-Fi/Aliens.1986.mkv":                                  "aliens",
+		"HP/Harry.Potter.and.the.Deathly.Hallows.Part.1.2010.mkv": "hp 7",
+		"HP/Harry.Potter.and.the.Deathly.Hallows.Part.2.2011.mkv": "hp 8",
+		"Loose.Movie.2001.mkv":                                    "loose",
+		"Loose.Movie.2001-trailer.mkv":                            "loose trailer",
+		"Stacked.Movie.2003.cd1.avi":                              "stacked 1",
+		"Stacked.Movie.2003.cd2.avi":                              "stacked 2",
+	} {
+		writeFile(t, filepath.Join(root, filepath.FromSlash(name)), contents)
+	}
+}
+
+func TestScanMoviesUnderstandsMovieFolders(t *testing.T) {
+	cfg := newTestLibrary(t)
+	writeMovieFixtures(t, cfg.MoviesDir)
+	repo := newFakeRepo()
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	movies, _ := repo.GetMediaByType(ctx, models.MediaTypeMovie)
+	var titles []string
+	for _, m := range movies {
+		titles = append(titles, fmt.Sprintf("%s %d", m.Title, m.Year.Int64))
+	}
+	sort.Strings(titles)
+	want := []string{
+		"Alien 1979", "Aliens 1986",
+		"Harry Potter and the Deathly Hallows Part 1 2010", "Harry Potter and the Deathly Hallows Part 2 2011",
+		"Heat 1995", "Loose Movie 2001", "Stacked Movie 2003", "The Abyss 1989",
+	}
+	if !reflect.DeepEqual(titles, want) {
+		t.Errorf("movies = %q, want %q", titles, want)
+	}
+
+	children := func(path string) []string {
+		t.Helper()
+		movie, err := repo.GetMediaByPath(ctx, filepath.Join(cfg.MoviesDir, filepath.FromSlash(path)))
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		media, _ := repo.GetMediaChildren(ctx, movie.ID)
+		var got []string
+		for _, m := range media {
+			rel, _ := filepath.Rel(cfg.MoviesDir, m.Path)
+			got = append(got, filepath.ToSlash(rel)+" "+m.Title+" "+m.ExtraType.String)
+		}
+		return got
+	}
+	for movie, want := range map[string][]string{
+		"Heat (1995)/heat.1995.1080p.bluray.x264-grp.mkv": {
+			"Heat (1995)/Behind The Scenes/Making Of.mkv Making Of behindthescenes",
+			"Heat (1995)/Heat-featurette.mkv Featurette featurette",
+			"Heat (1995)/Trailers/Teaser.mkv Teaser trailer",
+		},
+		"The Abyss (1989)/The.Abyss.cd1.avi": {
+			"The Abyss (1989)/The.Abyss.cd2.avi The Abyss ",
+			"The Abyss (1989)/The.Abyss-trailer.avi Trailer trailer",
+		},
+		"Loose.Movie.2001.mkv":       {"Loose.Movie.2001-trailer.mkv Trailer trailer"},
+		"Stacked.Movie.2003.cd1.avi": {"Stacked.Movie.2003.cd2.avi Stacked Movie "},
+		"Sci-Fi/Alien.1979.mkv":      nil,
+	} {
+		if got := children(movie); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: children = %q, want %q", movie, got, want)
+		}
+	}
+}
+
+func TestScanMoviesLinksPartsAddedLater(t *testing.T) {
+	cfg := newTestLibrary(t)
+	dir := filepath.Join(cfg.MoviesDir, "The Abyss (1989)")
+	writeFile(t, filepath.Join(dir, "The.Abyss.cd1.avi"), "abyss 1")
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := repo.GetMediaByPath(ctx, filepath.Join(dir, "The.Abyss.cd1.avi"))
+	if first.Part.Valid || first.Title != "The Abyss" {
+		t.Errorf("a lone cd1 file is %q part %v, want \"The Abyss\" and no part", first.Title, first.Part)
+	}
+
+	// An incremental scan only sees the new files, but links them to the
+	// movie that is already known
+	writeFile(t, filepath.Join(dir, "The.Abyss.cd2.avi"), "abyss 2")
+	writeFile(t, filepath.Join(dir, "Trailers", "Teaser.avi"), "teaser")
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	first, _ = repo.GetMediaByPath(ctx, filepath.Join(dir, "The.Abyss.cd1.avi"))
+	second, _ := repo.GetMediaByPath(ctx, filepath.Join(dir, "The.Abyss.cd2.avi"))
+	teaser, _ := repo.GetMediaByPath(ctx, filepath.Join(dir, "Trailers", "Teaser.avi"))
+	if second.ParentID.Int64 != first.ID || second.Part.Int64 != 2 || teaser.ParentID.Int64 != first.ID {
+		t.Errorf("cd2 has parent %v and part %v, teaser parent %v; want both under %d", second.ParentID, second.Part, teaser.ParentID, first.ID)
+	}
+	if first.Part.Int64 != 1 {
+		t.Errorf("cd1 is part %v, want 1", first.Part)
+	}
+	if movies, _ := repo.GetMediaByType(ctx, models.MediaTypeMovie); len(movies) != 1 {
+		t.Errorf("%d movies in the library, want 1", len(movies))
+	}
+}
+
+func TestScanMoviesGroupsVersions(t *testing.T) {
+	cfg := newTestLibrary(t)
+	cfg.Workers = 4
+	for name, contents := range map[string]string{
+		"Heat (1995)/Heat.1995.1080p.BluRay.x264-GRP.mkv":           "1080p",
+		"Heat (1995)/Heat.1995.2160p.UHD.BluRay.HDR.x265-GRP.mkv":   "2160p",
+		"Heat (1995)/Heat.1995.Directors.Cut.1080p.BluRay.x264.mkv": "directors cut",
+		"Heat (1995)/Trailers/Teaser.mkv":                           "teaser",
+		"Unsorted/Heat.1995.720p.mkv":                               "720p",
+		"Heat.1986.mkv":                                             "another film",
+	} {
+		writeFile(t, filepath.Join(cfg.MoviesDir, filepath.FromSlash(name)), contents)
+	}
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	movies, _ := repo.GetMediaByType(ctx, models.MediaTypeMovie)
+	if len(movies) != 2 {
+		t.Fatalf("%d movies in the library, want Heat (1995) and Heat (1986)", len(movies))
+	}
+	main, _ := repo.GetMediaByPath(ctx, filepath.Join(cfg.MoviesDir, "Heat (1995)", "Heat.1995.1080p.BluRay.x264-GRP.mkv"))
+	versions, _ := repo.GetMediaVersions(ctx, main.ID)
+	var got []string
+	for _, v := range versions {
+		got = append(got, fmt.Sprintf("%s %s %s", v.Resolution.String, v.VideoCodec.String, v.Edition.String))
+	}
+	sort.Strings(got)
+	if want := []string{"1080p H.264 Director's Cut", "2160p H.265 ", "720p  "}; !reflect.DeepEqual(got, want) {
+		t.Errorf("versions = %q, want %q", got, want)
+	}
+	if children, _ := repo.GetMediaChildren(ctx, main.ID); len(children) != 1 || children[0].Title != "Teaser" {
+		t.Errorf("main version has children %v, want the teaser", children)
+	}
+
+	// A copy that sorts first does not take over as the main version
+	writeFile(t, filepath.Join(cfg.MoviesDir, "A Heat Copy", "Heat.1995.480p.mkv"), "480p")
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	later, _ := repo.GetMediaByPath(ctx, filepath.Join(cfg.MoviesDir, "A Heat Copy", "Heat.1995.480p.mkv"))
+	if later.VersionOf.Int64 != main.ID {
+		t.Errorf("new copy is a version of %v, want %d", later.VersionOf, main.ID)
+	}
+}
+
+func TestScanMoviesGroupsVersionsWithoutAYearByFolder(t *testing.T) {
+	cfg := newTestLibrary(t)
+	for name, contents := range map[string]string{
+		"Solaris/Solaris.720p.mkv":  "720p",
+		"Solaris/Solaris.1080p.mkv": "1080p",
+		"Unsorted/Solaris.mkv":      "another film",
+		"Crash.mkv":                 "crash",
+		"Crash.avi":                 "another crash",
+	} {
+		writeFile(t, filepath.Join(cfg.MoviesDir, filepath.FromSlash(name)), contents)
+	}
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	movies, _ := repo.GetMediaByType(ctx, models.MediaTypeMovie)
+	var paths []string
+	for _, m := range movies {
+		rel, _ := filepath.Rel(cfg.MoviesDir, m.Path)
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	sort.Strings(paths)
+	want := []string{"Crash.avi", "Crash.mkv", "Solaris/Solaris.1080p.mkv", "Unsorted/Solaris.mkv"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("movies = %q, want %q", paths, want)
+	}
+}
+
+func TestScanMoviesShowsExtrasWithoutAMovie(t *testing.T) {
+	cfg := newTestLibrary(t)
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Shorts", "Paperman (2012).mkv"), "paperman")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Movie - Short.mkv"), "short")
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	movies, _ := repo.GetMediaByType(ctx, models.MediaTypeMovie)
+	var paths []string
+	for _, m := range movies {
+		rel, _ := filepath.Rel(cfg.MoviesDir, m.Path)
+		paths = append(paths, filepath.ToSlash(rel)+" "+m.ExtraType.String)
+	}
+	sort.Strings(paths)
+	// A "Shorts" folder in the library holds movies; a suffixed extra with no
+	// movie of its name is still listed
+	if want := []string{"Movie - Short.mkv short", "Shorts/Paperman (2012).mkv "}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("movies = %q, want %q", paths, want)
+	}
+}
+
+func TestLinkedMediaLoadsFoldersAndVersions(t *testing.T) {
+	cfg := newTestLibrary(t)
+	for name, contents := range map[string]string{
+		"Heat (1995)/Heat.1995.1080p.mkv":  "1080p",
+		"Heat (1995)/Trailers/Teaser.mkv":  "teaser",
+		"Heat 4K/Heat.1995.2160p.mkv":      "2160p",
+		"Heat 4K/Heat.1995-featurette.mkv": "featurette",
+		"Alien (1979)/Alien.1979.mkv":      "alien",
+		"Loose.Movie.2001.mkv":             "loose",
+	} {
+		writeFile(t, filepath.Join(cfg.MoviesDir, filepath.FromSlash(name)), contents)
+	}
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	media, err := linkedMedia(ctx, repo, cfg.scanFilter(), []string{filepath.Join(cfg.MoviesDir, "Heat (1995)")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, m := range media {
+		rel, _ := filepath.Rel(cfg.MoviesDir, m.Path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	// The folder of the other version comes along; unrelated folders do not
+	want := []string{"Heat (1995)/Heat.1995.1080p.mkv", "Heat (1995)/Trailers/Teaser.mkv", "Heat 4K/Heat.1995-featurette.mkv", "Heat 4K/Heat.1995.2160p.mkv"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("linked media = %q, want %q", got, want)
+	}
+
+	media, _ = linkedMedia(ctx, repo, cfg.scanFilter(), []string{cfg.MoviesDir})
+	if len(media) != 1 || filepath.Base(media[0].Path) != "Loose.Movie.2001.mkv" {
+		t.Errorf("linked media of the library root = %v, want the loose movie only", media)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"transogov2/app/models"
+)
+
+// NFO root elements
+const (
+	nfoMovie   = "movie"
+	nfoTVShow  = "tvshow"
+	nfoEpisode = "episodedetails"
+)
+
+// nfo is the part of a Kodi NFO file the scanner imports. Movies, shows and
+// episodes share most elements.
+type nfo struct {
+	XMLName   xml.Name
+	Title     string `xml:"title"`
+	Year      string `xml:"year"`
+	Plot      string `xml:"plot"`
+	Outline   string `xml:"outline"`
+	Premiered string `xml:"premiered"`
+	Aired     string `xml:"aired"`
+	// Rating is the single rating of files written before Kodi 17
+	Rating  string `xml:"rating"`
+	Ratings []struct {
+		Name    string `xml:"name,attr"`
+		Default bool   `xml:"default,attr"`
+		Value   string `xml:"value"`
+	} `xml:"ratings>rating"`
+	UniqueIDs []struct {
+		Type  string `xml:"type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"uniqueid"`
+	// Older ID elements
+	ID     string `xml:"id"`
+	IMDbID string `xml:"imdbid"`
+	TMDbID string `xml:"tmdbid"`
+	TVDbID string `xml:"tvdbid"`
+}
+
+// readNFO reads the metadata from an NFO file whose root element is kind. It
+// returns false without an error if there is no such file, or if the file only
+// holds the scraper URL that Kodi also accepts.
+func readNFO(path, kind string) (models.Metadata, bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return models.Metadata{}, false, nil
+	}
+	if err != nil {
+		return models.Metadata{}, false, err
+	}
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(data, []byte("<")) {
+		return models.Metadata{}, false, nil
+	}
+
+	// Multi-episode files hold one element per episode; the first describes
+	// the file. Anything after it, such as a scraper URL, is ignored.
+	var doc nfo
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = nfoCharsetReader
+	if err := dec.Decode(&doc); err != nil {
+		return models.Metadata{}, false, err
+	}
+	if doc.XMLName.Local != kind {
+		return models.Metadata{}, false, fmt.Errorf("root element is <%s>, want <%s>", doc.XMLName.Local, kind)
+	}
+	return doc.metadata(kind), true, nil
+}
+
+// metadata converts an NFO document to metadata
+func (n nfo) metadata(kind string) models.Metadata {
+	meta := models.Metadata{
+		Title:       nullString(strings.TrimSpace(n.Title)),
+		Description: nullString(strings.TrimSpace(n.Plot)),
+	}
+	if !meta.Description.Valid {
+		meta.Description = nullString(strings.TrimSpace(n.Outline))
+	}
+
+	premiered := nfoDate(n.Premiered)
+	if kind == nfoEpisode {
+		meta.AirDate = nfoDate(n.Aired)
+		if !meta.AirDate.Valid {
+			meta.AirDate = premiered
+		}
+	} else if year, err := strconv.Atoi(strings.TrimSpace(n.Year)); err == nil && year > 0 {
+		meta.Year = sql.NullInt64{Int64: int64(year), Valid: true}
+	} else if premiered.Valid {
+		meta.Year = sql.NullInt64{Int64: int64(premiered.Time.Year()), Valid: true}
+	}
+
+	// The default rating, or the first one, or the old single rating
+	rating := strings.TrimSpace(n.Rating)
+	for i, r := range n.Ratings {
+		if r.Default || i == 0 {
+			rating = strings.TrimSpace(r.Value)
+		}
+		if r.Default {
+			break
+		}
+	}
+	if v, err := strconv.ParseFloat(rating, 64); err == nil && v > 0 {
+		meta.Rating = nullString(strconv.FormatFloat(v, 'f', 1, 64))
+	}
+
+	for _, id := range n.UniqueIDs {
+		setExternalID(&meta.ExternalIDs, strings.ToLower(id.Type), strings.TrimSpace(id.Value))
+	}
+	setExternalID(&meta.ExternalIDs, "imdb", strings.TrimSpace(n.IMDbID))
+	setExternalID(&meta.ExternalIDs, "tmdb", strings.TrimSpace(n.TMDbID))
+	setExternalID(&meta.ExternalIDs, "tvdb", strings.TrimSpace(n.TVDbID))
+	// The old <id> is an IMDb ID for movies and a TVDb ID for shows and episodes
+	if id := strings.TrimSpace(n.ID); strings.HasPrefix(id, "tt") {
+		setExternalID(&meta.ExternalIDs, "imdb", id)
+	} else if kind == nfoMovie {
+		setExternalID(&meta.ExternalIDs, "tmdb", id)
+	} else {
+		setExternalID(&meta.ExternalIDs, "tvdb", id)
+	}
+	return meta
+}
+
+// setExternalID sets the ID for a metadata site unless it is already set
+func setExternalID(ids *models.ExternalIDs, site, value string) {
+	if value == "" {
+		return
+	}
+	var id *sql.NullString
+	switch site {
+	case "imdb":
+		id = &ids.IMDbID
+	case "tmdb", "themoviedb":
+		id = &ids.TMDbID
+	case "tvdb", "thetvdb":
+		id = &ids.TVDbID
+	default:
+		return
+	}
+	if !id.Valid {
+		*id = nullString(value)
+	}
+}
+
+// nfoDate parses a date as written in NFO files
+func nfoDate(s string) sql.NullTime {
+	t, err := time.Parse("2006-01-02", strings.TrimSpace(s))
+	return sql.NullTime{Time: t, Valid: err == nil}
+}
+
+// nfoCharsetReader decodes the Latin-1 NFO files written by some older tools;
+// other encodings are read as UTF-8
+func nfoCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "iso-8859-1", "latin1", "windows-1252", "cp1252":
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 0, len(data))
+		for _, b := range data {
+			buf = utf8.AppendRune(buf, rune(b))
+		}
+		return bytes.NewReader(buf), nil
+	}
+	return input, nil
+}
+
+// movieNFO returns the NFO file of a movie: one named after the video, or
+// movie.nfo in its movie folder
+func movieNFO(root, path string) (models.Metadata, bool, error) {
+	stem := strings.TrimSuffix(path, filepath.Ext(path))
+	meta, ok, err := readNFO(stem+".nfo", nfoMovie)
+	if ok || err != nil || filepath.Dir(path) == root {
+		return meta, ok, err
+	}
+	return readNFO(filepath.Join(filepath.Dir(path), "movie.nfo"), nfoMovie)
+}
+
+// importMovieNFO stores the metadata from a movie's NFO file, if it has one
+func importMovieNFO(ctx context.Context, repo MediaRepository, id int64, path string, s *scanSession) {
+	root, _ := s.filter.root(path)
+	meta, ok, err := movieNFO(root, path)
+	if err != nil {
+		s.warn("Skipping NFO for %s: %v", path, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if err := repo.UpdateMediaMetadata(ctx, id, meta); err != nil {
+		log.Printf("Error saving NFO metadata for %s: %v", path, err)
+		s.fail()
+	}
+}
+
+// importTVShowNFO stores the metadata from a show's tvshow.nfo, if it has one
+func importTVShowNFO(ctx context.Context, repo MediaRepository, id int64, tvShowPath string, s *scanSession) {
+	meta, ok, err := readNFO(filepath.Join(tvShowPath, "tvshow.nfo"), nfoTVShow)
+	if err != nil {
+		s.warn("Skipping NFO for %s: %v", tvShowPath, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if err := repo.UpdateTVShowMetadata(ctx, id, meta); err != nil {
+		log.Printf("Error saving NFO metadata for %s: %v", tvShowPath, err)
+		s.fail()
+	}
+}
+
+// importEpisodeNFO stores the metadata from the NFO file named after an episode,
+// if it has one
+func importEpisodeNFO(ctx context.Context, repo MediaRepository, id int64, path string, s *scanSession) {
+	meta, ok, err := readNFO(strings.TrimSuffix(path, filepath.Ext(path))+".nfo", nfoEpisode)
+	if err != nil {
+		s.warn("Skipping NFO for %s: %v", path, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if err := repo.UpdateEpisodeMetadata(ctx, id, meta); err != nil {
+		log.Printf("Error saving NFO metadata for %s: %v", path, err)
+		s.fail()
+	}
+}
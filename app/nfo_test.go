@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"transogov2/app/models"
+)
+
+func TestReadNFO(t *testing.T) {
+	str := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	year := func(y int64) sql.NullInt64 { return sql.NullInt64{Int64: y, Valid: true} }
+	tests := []struct {
+		file string
+		kind string
+		want models.Metadata
+		ok   bool
+		err  bool
+	}{
+		{
+			file: "movie.nfo", kind: nfoMovie, ok: true,
+			want: models.Metadata{
+				Title:       str("Heat"),
+				Year:        year(1995),
+				Description: str("Obsessive master thief Neil McCauley leads a top-notch crew on various daring heists throughout Los Angeles while determined detective Vincent Hanna pursues him without rest."),
+				Rating:      str("8.3"),
+				ExternalIDs: models.ExternalIDs{IMDbID: str("tt0113277"), TMDbID: str("949")},
+			},
+		},
+		{
+			file: "legacy-movie.nfo", kind: nfoMovie, ok: true,
+			want: models.Metadata{
+				Title:       str("Amélie"),
+				Year:        year(2001),
+				Description: str("Amélie is an innocent and naive girl in Paris."),
+				Rating:      str("7.8"),
+				ExternalIDs: models.ExternalIDs{IMDbID: str("tt0211915")},
+			},
+		},
+		{
+			file: "tvshow.nfo", kind: nfoTVShow, ok: true,
+			want: models.Metadata{
+				Title:       str("The Wire"),
+				Year:        year(2002),
+				Description: str("Told from the points of view of both the Baltimore homicide and narcotics detectives and their targets."),
+				Rating:      str("9.3"),
+				ExternalIDs: models.ExternalIDs{IMDbID: str("tt0306414"), TMDbID: str("1438"), TVDbID: str("79126")},
+			},
+		},
+		{
+			file: "episode.nfo", kind: nfoEpisode, ok: true,
+			want: models.Metadata{
+				Title:       str("The Target"),
+				Description: str("Baltimore detective Jimmy McNulty goes after a drug kingpin."),
+				Rating:      str("8.1"),
+				AirDate:     sql.NullTime{Time: time.Date(2002, 6, 2, 0, 0, 0, 0, time.UTC), Valid: true},
+				ExternalIDs: models.ExternalIDs{IMDbID: str("tt0749451"), TVDbID: str("349232")},
+			},
+		},
+		{
+			file: "multi-episode.nfo", kind: nfoEpisode, ok: true,
+			want: models.Metadata{
+				Title:       str("The Detail"),
+				AirDate:     sql.NullTime{Time: time.Date(2002, 6, 9, 0, 0, 0, 0, time.UTC), Valid: true},
+				ExternalIDs: models.ExternalIDs{TVDbID: str("349233")},
+			},
+		},
+		{file: "url.nfo", kind: nfoMovie},
+		{file: "missing.nfo", kind: nfoMovie},
+		{file: "broken.nfo", kind: nfoMovie, err: true},
+		{file: "tvshow.nfo", kind: nfoMovie, err: true},
+	}
+	for _, tt := range tests {
+		meta, ok, err := readNFO(filepath.Join("testdata", "nfo", tt.file), tt.kind)
+		if (err != nil) != tt.err || ok != tt.ok {
+			t.Errorf("readNFO(%s, %s) = %v, %v, want ok %v and error %v", tt.file, tt.kind, ok, err, tt.ok, tt.err)
+			continue
+		}
+		if !reflect.DeepEqual(meta, tt.want) {
+			t.Errorf("readNFO(%s, %s) = %+v, want %+v", tt.file, tt.kind, meta, tt.want)
+		}
+	}
+}
+
+// copyFixture copies a file from testdata/nfo into a test library
+func copyFixture(t *testing.T, name, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "nfo", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dst, string(data))
+}
+
+func TestScanImportsNFO(t *testing.T) {
+	cfg := newTestLibrary(t)
+	movieDir := filepath.Join(cfg.MoviesDir, "Heat (1995)")
+	writeFile(t, filepath.Join(movieDir, "heat.1080p.mkv"), "heat")
+	copyFixture(t, "movie.nfo", filepath.Join(movieDir, "movie.nfo"))
+	writeFile(t, filepath.Join(cfg.MoviesDir, "amelie.mkv"), "amelie")
+	copyFixture(t, "legacy-movie.nfo", filepath.Join(cfg.MoviesDir, "amelie.nfo"))
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Broken.2000.mkv"), "broken")
+	copyFixture(t, "broken.nfo", filepath.Join(cfg.MoviesDir, "Broken.2000.nfo"))
+
+	show := filepath.Join(cfg.TVDir, "the wire")
+	copyFixture(t, "tvshow.nfo", filepath.Join(show, "tvshow.nfo"))
+	episode := filepath.Join(show, "Season 1", "The.Wire.S01E01.mkv")
+	writeFile(t, episode, "episode")
+	copyFixture(t, "episode.nfo", filepath.Join(show, "Season 1", "The.Wire.S01E01.nfo"))
+
+	repo := newFakeRepo()
+	ctx := context.Background()
+	summary, err := ScanMedia(ctx, repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	heat, _ := repo.GetMediaByPath(ctx, filepath.Join(movieDir, "heat.1080p.mkv"))
+	if heat.Title != "Heat" || heat.Year.Int64 != 1995 || heat.Rating.String != "8.3" || heat.IMDbID.String != "tt0113277" || !heat.Description.Valid {
+		t.Errorf("Heat = %+v, want the metadata from movie.nfo", heat)
+	}
+	// NFO values win over the file name
+	amelie, _ := repo.GetMediaByPath(ctx, filepath.Join(cfg.MoviesDir, "amelie.mkv"))
+	if amelie.Title != "Amélie" || amelie.Year.Int64 != 2001 || amelie.Rating.String != "7.8" {
+		t.Errorf("Amélie = %q (%d) rated %q, want the metadata from amelie.nfo", amelie.Title, amelie.Year.Int64, amelie.Rating.String)
+	}
+	broken, _ := repo.GetMediaByPath(ctx, filepath.Join(cfg.MoviesDir, "Broken.2000.mkv"))
+	if broken.Title != "Broken" || broken.Year.Int64 != 2000 {
+		t.Errorf("a broken NFO gave %q (%d), want the file name's title and year", broken.Title, broken.Year.Int64)
+	}
+	if len(summary.Warnings) != 1 || !strings.Contains(summary.Warnings[0], "Broken.2000.mkv") {
+		t.Errorf("warnings = %q, want one for the broken NFO", summary.Warnings)
+	}
+
+	tvshow, _ := repo.GetTVShowByPath(ctx, show)
+	if tvshow.Title != "The Wire" || tvshow.Year.Int64 != 2002 || tvshow.TVDbID.String != "79126" || tvshow.Rating.String != "9.3" {
+		t.Errorf("show = %+v, want the metadata from tvshow.nfo", tvshow)
+	}
+	ep, _ := repo.GetEpisodeByPath(ctx, episode)
+	if ep.Title != "The Target" || ep.Description.String == "" || ep.TVDbID.String != "349232" || ep.AirDate.Time.Format("2006-01-02") != "2002-06-02" {
+		t.Errorf("episode = %+v, want the metadata from its NFO", ep)
+	}
+
+	// Edited NFO files are picked up by a full scan
+	writeFile(t, filepath.Join(movieDir, "movie.nfo"), "<movie><title>Heat</title><rating>9</rating></movie>")
+	if _, err := ScanMedia(ctx, repo, cfg, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if heat, _ := repo.GetMediaByPath(ctx, filepath.Join(movieDir, "heat.1080p.mkv")); heat.Rating.String != "9.0" || heat.Year.Int64 != 1995 {
+		t.Errorf("after editing movie.nfo Heat is rated %q from %d, want 9.0 from 1995", heat.Rating.String, heat.Year.Int64)
+	}
+}
+
+func TestIncrementalScanReadsAddedNFO(t *testing.T) {
+	cfg := newTestLibrary(t)
+	movieDir := filepath.Join(cfg.MoviesDir, "Heat (1995)")
+	movie := filepath.Join(movieDir, "heat.1080p.mkv")
+	writeFile(t, movie, "heat")
+	writeFile(t, filepath.Join(movieDir, "Heat.Trailer.mkv"), "trailer")
+	season := filepath.Join(cfg.TVDir, "the wire", "Season 1")
+	episode := filepath.Join(season, "The.Wire.S01E01.mkv")
+	writeFile(t, episode, "episode")
+	writeFile(t, filepath.Join(season, "The.Wire.S01E02.mkv"), "next episode")
+
+	repo := &lookupCountingRepo{fakeRepo: newFakeRepo()}
+	ctx := context.Background()
+	scanCounting(t, repo, cfg, false)
+
+	// Neither video changes, but their directories do
+	copyFixture(t, "movie.nfo", filepath.Join(movieDir, "movie.nfo"))
+	copyFixture(t, "episode.nfo", filepath.Join(season, "The.Wire.S01E01.nfo"))
+	summary, lookups := scanCounting(t, repo, cfg, false)
+
+	if heat, _ := repo.GetMediaByPath(ctx, movie); heat.Rating.String != "8.3" || heat.IMDbID.String != "tt0113277" {
+		t.Errorf("Heat = %+v, want the metadata from the new movie.nfo", heat)
+	}
+	if ep, _ := repo.GetEpisodeByPath(ctx, episode); ep.Title != "The Target" {
+		t.Errorf("episode title = %q, want the one from its new NFO", ep.Title)
+	}
+	// movie.nfo goes with every video in the folder; the episode NFO only with
+	// its own episode
+	if summary.Unchanged != 1 || lookups != 5 {
+		t.Errorf("rescan left %d files unchanged with %d lookups, want 1 and 5", summary.Unchanged, lookups)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+
+	"transogov2/app/mediainfo"
+	"transogov2/app/models"
+)
+
+// probeMovie stores the duration, streams and chapters read from a movie file's
+// headers
+func probeMovie(ctx context.Context, repo MediaRepository, id int64, path string, s *scanSession) {
+	info, ok := probeFile(path, s)
+	if !ok {
+		return
+	}
+	if err := repo.SaveMediaInfo(ctx, id, info); err != nil {
+		log.Printf("Error saving media info for %s: %v", path, err)
+		s.fail()
+	}
+}
+
+// probeEpisode stores the duration, streams and chapters read from an episode
+// file's headers
+func probeEpisode(ctx context.Context, repo MediaRepository, id int64, path string, s *scanSession) {
+	info, ok := probeFile(path, s)
+	if !ok {
+		return
+	}
+	if err := repo.SaveEpisodeInfo(ctx, id, info); err != nil {
+		log.Printf("Error saving media info for %s: %v", path, err)
+		s.fail()
+	}
+}
+
+// probeFile reads the streams of a media file with the session's prober. Files
+// in formats it does not read, such as AVI without ffprobe, are skipped quietly;
+// broken ones are warned about.
+func probeFile(path string, s *scanSession) (models.MediaInfo, bool) {
+	info, err := s.prober.Probe(s.ctx, path)
+	if errors.Is(err, mediainfo.ErrUnknownFormat) {
+		return models.MediaInfo{}, false
+	}
+	if err != nil {
+		if s.ctx.Err() != nil {
+			return models.MediaInfo{}, false
+		}
+		s.warn("Skipping media info for %s: %v", path, err)
+		return models.MediaInfo{}, false
+	}
+	return mediaInfo(info), true
+}
+
+// mediaInfo converts what mediainfo read into what is stored
+func mediaInfo(info mediainfo.Info) models.MediaInfo {
+	mi := models.MediaInfo{
+		DurationMS: sql.NullInt64{Int64: info.Duration.Milliseconds(), Valid: info.Duration > 0},
+	}
+	if v, ok := info.Video(); ok {
+		mi.Resolution = nullString(pictureResolution(v.Width, v.Height))
+		mi.VideoCodec = nullString(v.Codec)
+	}
+	if a, ok := info.Audio(); ok {
+		mi.AudioCodec = nullString(a.Codec)
+	}
+	for _, st := range info.Streams {
+		mi.Streams = append(mi.Streams, models.MediaStream{
+			Index:      st.Index,
+			Type:       st.Type,
+			Codec:      st.Codec,
+			CodecID:    st.CodecID,
+			Language:   nullString(st.Language),
+			Title:      nullString(st.Title),
+			Default:    st.Default,
+			Forced:     st.Forced,
+			Width:      sql.NullInt64{Int64: int64(st.Width), Valid: st.Width > 0},
+			Height:     sql.NullInt64{Int64: int64(st.Height), Valid: st.Height > 0},
+			FrameRate:  sql.NullFloat64{Float64: st.FrameRate, Valid: st.FrameRate > 0},
+			Channels:   sql.NullInt64{Int64: int64(st.Channels), Valid: st.Channels > 0},
+			SampleRate: sql.NullInt64{Int64: int64(st.SampleRate), Valid: st.SampleRate > 0},
+		})
+	}
+	for i, c := range info.Chapters {
+		mi.Chapters = append(mi.Chapters, models.Chapter{
+			Index:   i,
+			StartMS: c.Start.Milliseconds(),
+			EndMS:   sql.NullInt64{Int64: c.End.Milliseconds(), Valid: c.End > c.Start},
+			Title:   nullString(c.Title),
+		})
+	}
+	return mi
+}
+
+// pictureResolution names the resolution of a picture the way release names do.
+// Widescreen films are cropped to less than their nominal height, so the width
+// counts too.
+func pictureResolution(width, height int) string {
+	switch {
+	case height >= 1600 || width >= 3200:
+		return "2160p"
+	case height >= 900 || width >= 1800:
+		return "1080p"
+	case height >= 650 || width >= 1200:
+		return "720p"
+	case height >= 560:
+		return "576p"
+	case height > 0:
+		return "480p"
+	}
+	return ""
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"transogov2/app/mediainfo/ffprobetest"
+	"transogov2/app/models"
+)
+
+// copySample copies one of the mediainfo package's synthetic container files
+func copySample(t *testing.T, name, dst string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("mediainfo", "testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, dst, string(data))
+}
+
+func TestScanProbesMediaInfo(t *testing.T) {
+	cfg := newTestLibrary(t)
+	// The name says 720p, the headers 1080p
+	moviePath := filepath.Join(cfg.MoviesDir, "Heat.1995.720p.x264.mkv")
+	copySample(t, "sample.mkv", moviePath)
+	brokenPath := filepath.Join(cfg.MoviesDir, "Broken.2000.mkv")
+	copySample(t, "truncated.mkv", brokenPath)
+	aviPath := filepath.Join(cfg.MoviesDir, "Alien.1979.avi")
+	copySample(t, "unknown.avi", aviPath)
+	episodePath := filepath.Join(cfg.TVDir, "The Wire", "Season 1", "The.Wire.S01E01.mp4")
+	copySample(t, "sample.mp4", episodePath)
+
+	repo := newFakeRepo()
+	ctx := context.Background()
+	summary, err := ScanMedia(ctx, repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 4 || summary.Errors != 0 {
+		t.Errorf("added %d with %d errors, want 4 files and no errors", summary.Added, summary.Errors)
+	}
+	if len(summary.Warnings) != 1 || !strings.Contains(summary.Warnings[0], "Broken.2000.mkv") {
+		t.Errorf("warnings = %q, want one for the truncated file", summary.Warnings)
+	}
+
+	heat, _ := repo.GetMediaByPath(ctx, moviePath)
+	if heat.DurationMS.Int64 != 5025 || heat.Resolution.String != "1080p" || heat.VideoCodec.String != "H.264" || heat.AudioCodec.String != "AC3" {
+		t.Errorf("Heat = %d ms, %q, %q, %q, want 5025 ms, 1080p, H.264 and AC3",
+			heat.DurationMS.Int64, heat.Resolution.String, heat.VideoCodec.String, heat.AudioCodec.String)
+	}
+	streams, _ := repo.GetMediaStreams(ctx, heat.ID)
+	var types []string
+	for _, st := range streams {
+		types = append(types, st.Type)
+	}
+	if strings.Join(types, ",") != "video,audio,audio,subtitle" {
+		t.Fatalf("Heat stream types = %q", types)
+	}
+	if audio := streams[2]; audio.Language.String != "fre" || audio.Channels.Int64 != 2 || audio.Default {
+		t.Errorf("second audio stream = %+v, want French stereo, not default", audio)
+	}
+	if sub := streams[3]; sub.Codec != "SubRip" || !sub.Forced {
+		t.Errorf("subtitle stream = %+v, want forced SubRip", sub)
+	}
+
+	chapters, _ := repo.GetMediaChapters(ctx, heat.ID)
+	if len(chapters) != 2 || chapters[0].Title.String != "Opening" || chapters[0].EndMS.Int64 != 2000 ||
+		chapters[1].StartMS != 3000 || chapters[1].EndMS.Valid {
+		t.Errorf("Heat chapters = %+v, want Opening to 2000 ms and an open-ended chapter at 3000 ms", chapters)
+	}
+
+	for _, path := range []string{brokenPath, aviPath} {
+		m, _ := repo.GetMediaByPath(ctx, path)
+		if streams, _ := repo.GetMediaStreams(ctx, m.ID); m.DurationMS.Valid || len(streams) != 0 {
+			t.Errorf("%s has %d ms and %d streams, want none", filepath.Base(path), m.DurationMS.Int64, len(streams))
+		}
+	}
+
+	episode, _ := repo.GetEpisodeByPath(ctx, episodePath)
+	streams, _ = repo.GetEpisodeStreams(ctx, episode.ID)
+	if episode.DurationMS.Int64 != 10000 || len(streams) != 3 || streams[0].Height.Int64 != 720 {
+		t.Errorf("episode = %d ms with streams %+v, want 10000 ms and 3 streams starting with 720p video", episode.DurationMS.Int64, streams)
+	}
+}
+
+func TestScanBackfillsMediaInfo(t *testing.T) {
+	cfg := newTestLibrary(t)
+	moviePath := filepath.Join(cfg.MoviesDir, "Heat.1995.mkv")
+	copySample(t, "sample.mkv", moviePath)
+
+	// A row saved before files were probed
+	repo := newFakeRepo()
+	ctx := context.Background()
+	id, _ := repo.SaveMedia(ctx, &models.Media{Title: "Heat", Path: moviePath, MediaType: models.MediaTypeMovie})
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	heat, _ := repo.GetMediaByID(ctx, id)
+	streams, _ := repo.GetMediaStreams(ctx, id)
+	if heat.DurationMS.Int64 != 5025 || len(streams) != 4 {
+		t.Errorf("Heat = %d ms with %d streams, want 5025 ms and 4 streams", heat.DurationMS.Int64, len(streams))
+	}
+}
+
+func TestPictureResolution(t *testing.T) {
+	tests := []struct {
+		width, height int
+		want          string
+	}{
+		{3840, 2160, "2160p"},
+		{3840, 1600, "2160p"},
+		{1920, 1080, "1080p"},
+		{1920, 800, "1080p"},
+		{1280, 720, "720p"},
+		{1280, 536, "720p"},
+		{720, 576, "576p"},
+		{720, 480, "480p"},
+		{0, 0, ""},
+	}
+	for _, tt := range tests {
+		if got := pictureResolution(tt.width, tt.height); got != tt.want {
+			t.Errorf("pictureResolution(%d, %d) = %q, want %q", tt.width, tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestScanSkipsFilesFFprobeHangsOn(t *testing.T) {
+	cfg := newTestLibrary(t)
+	cfg.FFprobePath, _ = ffprobetest.Fake(t, "sleep 10\n")
+	cfg.FFprobeTimeout = 100 * time.Millisecond
+	aviPath := filepath.Join(cfg.MoviesDir, "Alien.1979.DVDRip.avi")
+	copySample(t, "unknown.avi", aviPath)
+
+	repo := newFakeRepo()
+	ctx := context.Background()
+	start := time.Now()
+	summary, err := ScanMedia(ctx, repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("scan took %v with a 100ms ffprobe timeout", elapsed)
+	}
+	if summary.Added != 1 || len(summary.Warnings) != 1 || !strings.Contains(summary.Warnings[0], "timed out") {
+		t.Errorf("added %d with warnings %q, want the file and a timeout warning", summary.Added, summary.Warnings)
+	}
+	if alien, _ := repo.GetMediaByPath(ctx, aviPath); alien.DurationMS.Valid {
+		t.Errorf("Alien = %d ms, want no media info", alien.DurationMS.Int64)
+	}
+}
+
+func TestScanProbesWithFFprobe(t *testing.T) {
+	cfg := newTestLibrary(t)
+	cfg.FFprobePath, _ = ffprobetest.Fake(t, ffprobetest.Output(t, filepath.Join("mediainfo", "testdata", "ffprobe", "avi.json")))
+	aviPath := filepath.Join(cfg.MoviesDir, "Alien.1979.DVDRip.avi")
+	copySample(t, "unknown.avi", aviPath)
+	mkvPath := filepath.Join(cfg.MoviesDir, "Heat.1995.mkv")
+	copySample(t, "sample.mkv", mkvPath)
+
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	alien, _ := repo.GetMediaByPath(ctx, aviPath)
+	streams, _ := repo.GetMediaStreams(ctx, alien.ID)
+	if alien.DurationMS.Int64 != 6987520 || alien.VideoCodec.String != "XviD" || alien.Resolution.String != "480p" || len(streams) != 2 {
+		t.Errorf("Alien = %d ms, %q, %q with %d streams, want ffprobe's 6987520 ms, XviD, 480p and 2 streams",
+			alien.DurationMS.Int64, alien.VideoCodec.String, alien.Resolution.String, len(streams))
+	}
+	// Natively read formats never reach ffprobe
+	if heat, _ := repo.GetMediaByPath(ctx, mkvPath); heat.DurationMS.Int64 != 5025 {
+		t.Errorf("Heat = %d ms, want 5025 ms from its own headers", heat.DurationMS.Int64)
+	}
+}
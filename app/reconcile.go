@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"transogov2/app/models"
+)
+
+// ReconcileResult counts the changes made by a reconciliation pass
+type ReconcileResult struct {
+	Missing  int // rows newly marked as missing
+	Restored int // rows whose file reappeared
+	Purged   int // rows deleted after the grace period
+	Seasons  int // seasons deleted because they became empty
+	TVShows  int // TV shows deleted because they became empty
+}
+
+// markMissing marks rows whose files have vanished and clears the mark on rows whose
+// files have reappeared. It runs before a scan so that moved files can be matched
+// against the rows they left behind. When paths are given only rows at or below
+// one of them are loaded. Files are checked through their directories, using the
+// scan cache to skip the unchanged ones. Files excluded by filter count as
+// vanished, so their rows leave the library once they are ignored. filter and
+// cache may be nil. The paths of the media rows it changed are returned.
+func markMissing(ctx context.Context, repo MediaRepository, filter *scanFilter, cache *scanCache, now time.Time, paths ...string) (ReconcileResult, []string, error) {
+	var result ReconcileResult
+	var changed []string
+	check := missingCheck{filter: filter, cache: cache, dirs: make(map[string]dirPresence)}
+
+	media, err := mediaUnder(ctx, repo, paths)
+	if err != nil {
+		return result, changed, err
+	}
+	for _, m := range media {
+		switch check.action(m.Path, m.MissingSince) {
+		case reconcileMark:
+			err = repo.SetMediaMissingSince(ctx, m.ID, sql.NullTime{Time: now, Valid: true})
+			result.Missing++
+			changed = append(changed, m.Path)
+		case reconcileRestore:
+			err = repo.SetMediaMissingSince(ctx, m.ID, sql.NullTime{})
+			result.Restored++
+			changed = append(changed, m.Path)
+		}
+		if err != nil {
+			return result, changed, err
+		}
+	}
+
+	episodes, err := episodesUnder(ctx, repo, paths)
+	if err != nil {
+		return result, changed, err
+	}
+	for _, e := range episodes {
+		switch check.action(e.Path, e.MissingSince) {
+		case reconcileMark:
+			err = repo.SetEpisodeMissingSince(ctx, e.ID, sql.NullTime{Time: now, Valid: true})
+			result.Missing++
+		case reconcileRestore:
+			err = repo.SetEpisodeMissingSince(ctx, e.ID, sql.NullTime{})
+			result.Restored++
+		}
+		if err != nil {
+			return result, changed, err
+		}
+	}
+
+	return result, changed, nil
+}
+
+// mediaUnder loads the media at or below one of paths, or all media if there
+// are none
+func mediaUnder(ctx context.Context, repo MediaRepository, paths []string) ([]models.Media, error) {
+	if len(paths) == 0 {
+		return repo.GetAllMedia(ctx)
+	}
+	var media []models.Media
+	seen := make(map[int64]bool)
+	for _, path := range paths {
+		rows, err := repo.GetMediaUnder(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range rows {
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				media = append(media, m)
+			}
+		}
+	}
+	return media, nil
+}
+
+// episodesUnder loads the episodes at or below one of paths, or all episodes if
+// there are none
+func episodesUnder(ctx context.Context, repo MediaRepository, paths []string) ([]models.Episode, error) {
+	if len(paths) == 0 {
+		return repo.GetAllEpisodes(ctx)
+	}
+	var episodes []models.Episode
+	seen := make(map[int64]bool)
+	for _, path := range paths {
+		rows, err := repo.GetEpisodesUnder(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range rows {
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				episodes = append(episodes, e)
+			}
+		}
+	}
+	return episodes, nil
+}
+
+// dirPresence is what looking at a directory says about the files of the rows in it
+type dirPresence int
+
+const (
+	dirChanged   dirPresence = iota // each file has to be checked
+	dirUnchanged                    // the files are as the last scan left them
+	dirGone                         // none of the files exist
+)
+
+// missingCheck decides whether the files of rows are still there, looking at each
+// directory once. Adding or removing a file changes the modification time of its
+// directory, so the files of a directory the scan cache has unchanged are not
+// checked one by one, and neither are those of a directory that is gone. The
+// cache keeps the ignore rules with each directory, so the files of a directory
+// whose rules changed are checked.
+type missingCheck struct {
+	filter *scanFilter
+	cache  *scanCache
+	dirs   map[string]dirPresence
+}
+
+// action decides what to do with a row
+func (c *missingCheck) action(path string, missingSince sql.NullTime) reconcileAction {
+	dir := filepath.Dir(path)
+	presence, ok := c.dirs[dir]
+	if !ok {
+		presence = c.presence(dir)
+		c.dirs[dir] = presence
+	}
+	switch presence {
+	case dirUnchanged:
+		return reconcileNone
+	case dirGone:
+		if missingSince.Valid {
+			return reconcileNone
+		}
+		return reconcileMark
+	}
+	if c.filter.excluded(path, false) {
+		if missingSince.Valid {
+			return reconcileNone
+		}
+		return reconcileMark
+	}
+	return reconcileRow(path, missingSince)
+}
+
+// presence looks at a directory
+func (c *missingCheck) presence(dir string) dirPresence {
+	info, err := os.Stat(dir)
+	switch {
+	case err != nil && errors.Is(err, fs.ErrNotExist):
+		return dirGone
+	case err == nil && c.cache.dirUnchanged(dir, info):
+		return dirUnchanged
+	}
+	return dirChanged
+}
+
+// underAny reports whether path is one of dirs or inside one of them. An empty
+// dirs matches every path.
+func underAny(path string, dirs []string) bool {
+	if len(dirs) == 0 {
+		return true
+	}
+	for _, dir := range dirs {
+		if path == dir || isWithin(dir, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// purgeMissing deletes rows that have been missing for at least grace, then removes
+// seasons and TV shows that were left empty
+func purgeMissing(ctx context.Context, repo MediaRepository, grace time.Duration, now time.Time, result *ReconcileResult) error {
+	media, err := repo.GetAllMedia(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range media {
+		if !expired(m.MissingSince, grace, now) {
+			continue
+		}
+		if err := repo.DeleteMedia(ctx, m.ID); err != nil {
+			return err
+		}
+		result.Purged++
+	}
+
+	episodes, err := repo.GetAllEpisodes(ctx)
+	if err != nil {
+		return err
+	}
+	var emptied []int64
+	for _, e := range episodes {
+		if !expired(e.MissingSince, grace, now) {
+			continue
+		}
+		if err := repo.DeleteEpisode(ctx, e.ID); err != nil {
+			return err
+		}
+		emptied = append(emptied, e.SeasonID)
+		result.Purged++
+	}
+
+	seasons, shows, err := pruneEmptySeasons(ctx, repo, emptied)
+	result.Seasons += seasons
+	result.TVShows += shows
+	return err
+}
+
+// pruneEmptySeasons deletes the given seasons if they no longer have episodes,
+// cascading to TV shows that are left without seasons
+func pruneEmptySeasons(ctx context.Context, repo MediaRepository, seasonIDs []int64) (seasons, shows int, err error) {
+	tvshowIDs := make(map[int64]bool)
+	for _, seasonID := range seasonIDs {
+		tvshowID, err := repo.DeleteSeasonIfEmpty(ctx, seasonID)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return seasons, shows, err
+		}
+		tvshowIDs[tvshowID] = true
+		seasons++
+	}
+	for tvshowID := range tvshowIDs {
+		deleted, err := repo.DeleteTVShowIfEmpty(ctx, tvshowID)
+		if err != nil {
+			return seasons, shows, err
+		}
+		if deleted {
+			shows++
+		}
+	}
+	return seasons, shows, nil
+}
+
+type reconcileAction int
+
+const (
+	reconcileNone reconcileAction = iota
+	reconcileMark
+	reconcileRestore
+)
+
+// reconcileRow decides what to do with a row given whether its file is still on disk
+func reconcileRow(path string, missingSince sql.NullTime) reconcileAction {
+	exists := fileExists(path)
+	switch {
+	case exists && missingSince.Valid:
+		return reconcileRestore
+	case !exists && !missingSince.Valid:
+		return reconcileMark
+	}
+	return reconcileNone
+}
+
+// expired reports whether a row has been missing for at least the grace period
+func expired(missingSince sql.NullTime, grace time.Duration, now time.Time) bool {
+	return missingSince.Valid && now.Sub(missingSince.Time) >= grace
+}
+
+// fileExists reports whether a path exists. Errors other than "not exist"
+// (permissions, a flaky network mount) count as existing so that rows are never
+// purged because of a transient failure.
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	if err != nil && errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Error checking %s: %v", path, err)
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"transogov2/app/models"
+)
+
+// writeFile creates a file (and its parent directories) with the given contents
+func writeFile(t testing.TB, path, contents string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// reconcileMissing runs the reconciliation a full scan does around it: marking
+// rows whose files vanished, then purging those missing for longer than grace
+func reconcileMissing(ctx context.Context, repo MediaRepository, grace time.Duration, now time.Time) (ReconcileResult, error) {
+	result, _, err := markMissing(ctx, repo, nil, nil, now)
+	if err != nil {
+		return result, err
+	}
+	err = purgeMissing(ctx, repo, grace, now, &result)
+	return result, err
+}
+
+func TestReconcileMissingMarksAndPurges(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := newFakeRepo()
+
+	kept := filepath.Join(dir, "Kept.mkv")
+	gone := filepath.Join(dir, "Gone.mkv")
+	writeFile(t, kept, "video")
+	keptID, _ := repo.SaveMedia(ctx, &models.Media{Title: "Kept", Path: kept, MediaType: models.MediaTypeMovie})
+	goneID, _ := repo.SaveMedia(ctx, &models.Media{Title: "Gone", Path: gone, MediaType: models.MediaTypeMovie})
+
+	grace := 24 * time.Hour
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	result, err := reconcileMissing(ctx, repo, grace, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Missing != 1 || result.Purged != 0 {
+		t.Fatalf("first pass = %+v, want 1 missing, 0 purged", result)
+	}
+	if !repo.media[goneID].MissingSince.Valid {
+		t.Errorf("missing media was not marked")
+	}
+	if repo.media[keptID].MissingSince.Valid {
+		t.Errorf("existing media was marked missing")
+	}
+
+	// Still inside the grace period: nothing changes
+	result, err = reconcileMissing(ctx, repo, grace, now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (ReconcileResult{}) {
+		t.Fatalf("second pass = %+v, want no changes", result)
+	}
+
+	result, err = reconcileMissing(ctx, repo, grace, now.Add(grace))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Purged != 1 {
+		t.Fatalf("third pass = %+v, want 1 purged", result)
+	}
+	if _, ok := repo.media[goneID]; ok {
+		t.Errorf("media was not purged after the grace period")
+	}
+	if _, ok := repo.media[keptID]; !ok {
+		t.Errorf("existing media was purged")
+	}
+}
+
+func TestReconcileMissingRestoresReappearedFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := newFakeRepo()
+
+	path := filepath.Join(dir, "Back.mkv")
+	writeFile(t, path, "video")
+	id, _ := repo.SaveMedia(ctx, &models.Media{Title: "Back", Path: path, MediaType: models.MediaTypeMovie})
+	repo.SetMediaMissingSince(ctx, id, sql.NullTime{Time: time.Now().Add(-time.Hour), Valid: true})
+
+	result, err := reconcileMissing(ctx, repo, 24*time.Hour, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Restored != 1 {
+		t.Fatalf("result = %+v, want 1 restored", result)
+	}
+	if repo.media[id].MissingSince.Valid {
+		t.Errorf("restored media is still marked missing")
+	}
+}
+
+func TestReconcileMissingCascadesEmptySeasonsAndShows(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	repo := newFakeRepo()
+
+	// Show A loses its only episode; show B keeps one of two seasons
+	showA, _ := repo.SaveTVShow(ctx, &models.TVShow{Title: "A", Path: filepath.Join(dir, "A")})
+	seasonA, _ := repo.SaveSeason(ctx, &models.Season{TVShowID: showA, Number: 1, Path: filepath.Join(dir, "A", "Season 1")})
+	repo.SaveEpisode(ctx, &models.Episode{SeasonID: seasonA, Number: 1, Path: filepath.Join(dir, "A", "Season 1", "A.S01E01.mkv")})
+
+	showB, _ := repo.SaveTVShow(ctx, &models.TVShow{Title: "B", Path: filepath.Join(dir, "B")})
+	seasonB1, _ := repo.SaveSeason(ctx, &models.Season{TVShowID: showB, Number: 1, Path: filepath.Join(dir, "B", "Season 1")})
+	seasonB2, _ := repo.SaveSeason(ctx, &models.Season{TVShowID: showB, Number: 2, Path: filepath.Join(dir, "B", "Season 2")})
+	keptEpisode := filepath.Join(dir, "B", "Season 1", "B.S01E01.mkv")
+	writeFile(t, keptEpisode, "video")
+	repo.SaveEpisode(ctx, &models.Episode{SeasonID: seasonB1, Number: 1, Path: keptEpisode})
+	repo.SaveEpisode(ctx, &models.Episode{SeasonID: seasonB2, Number: 1, Path: filepath.Join(dir, "B", "Season 2", "B.S02E01.mkv")})
+
+	// A zero grace period purges immediately
+	result, err := reconcileMissing(ctx, repo, 0, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Purged != 2 || result.Seasons != 2 || result.TVShows != 1 {
+		t.Fatalf("result = %+v, want 2 purged, 2 seasons, 1 TV show", result)
+	}
+	if _, ok := repo.tvshows[showA]; ok {
+		t.Errorf("empty TV show was not removed")
+	}
+	if _, ok := repo.tvshows[showB]; !ok {
+		t.Errorf("TV show with remaining episodes was removed")
+	}
+	if _, ok := repo.seasons[seasonB1]; !ok {
+		t.Errorf("season with remaining episodes was removed")
+	}
+	if _, ok := repo.seasons[seasonB2]; ok {
+		t.Errorf("empty season was not removed")
+	}
+}
+
+func TestMarkMissingSkipsUnchangedDirectories(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestLibrary(t)
+	repo := newFakeRepo()
+	heat := filepath.Join(cfg.MoviesDir, "Heat (1995)", "Heat (1995).mkv")
+	alien := filepath.Join(cfg.MoviesDir, "Alien (1979)", "Alien (1979).mkv")
+	writeFile(t, heat, "heat")
+	writeFile(t, alien, "alien")
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// A row without a file in a directory unchanged since the scan is not
+	// looked at, while the removed file of a changed directory is
+	ghost := filepath.Join(filepath.Dir(heat), "Ghost.mkv")
+	ghostID, _ := repo.SaveMedia(ctx, &models.Media{Title: "Ghost", Path: ghost, MediaType: models.MediaTypeMovie})
+	if err := os.Remove(alien); err != nil {
+		t.Fatal(err)
+	}
+	result, _, err := markMissing(ctx, repo, cfg.scanFilter(), loadScanCache(ctx, repo, cfg.scanFilter(), false), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Missing != 1 || repo.media[ghostID].MissingSince.Valid {
+		t.Fatalf("result = %+v, ghost marked = %v; want only the removed file marked", result, repo.media[ghostID].MissingSince.Valid)
+	}
+	if m, _ := repo.GetMediaByPath(ctx, alien); !m.MissingSince.Valid {
+		t.Errorf("removed file was not marked missing")
+	}
+
+	// Without the cache every file is checked
+	result, _, err = markMissing(ctx, repo, nil, nil, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Missing != 1 || !repo.media[ghostID].MissingSince.Valid {
+		t.Errorf("result = %+v, want the ghost row marked", result)
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ReleaseInfo is the information encoded in a release-style file name such as
+// "Blade.Runner.2049.2017.2160p.UHD.BluRay.x265.HDR.TrueHD.7.1.Atmos-GROUP.mkv".
+// Values are normalised, so "x265", "h265" and "HEVC" all give VideoCodec "H.265".
+type ReleaseInfo struct {
+	Title      string
+	Year       int    // 0 if unknown
+	Resolution string // "2160p", "1080p", "1080i", "720p", "576p" or "480p"
+	Source     string // e.g. "BluRay", "Remux", "WEB-DL", "WEBRip", "HDTV", "DVDRip"
+	VideoCodec string // e.g. "H.264", "H.265", "AV1", "XviD"
+	AudioCodec string // e.g. "AAC", "AC3", "E-AC3", "DTS-HD MA", "TrueHD"
+	HDR        bool
+	Group      string
+	Edition    string // e.g. "Director's Cut", "Extended"; several are joined with ", "
+}
+
+// releaseField identifies the ReleaseInfo field a token sets
+type releaseField int
+
+const (
+	fieldNone releaseField = iota // ends the title but sets nothing, e.g. "PROPER"
+	fieldResolution
+	fieldSource
+	fieldVideoCodec
+	fieldAudioCodec
+	fieldHDR
+	fieldEdition
+)
+
+// releaseToken is a recognised word or phrase in a release name
+type releaseToken struct {
+	re    *regexp.Regexp
+	field releaseField
+	value string
+	// weak tokens are common words ("Web", "Cam", "Final Cut") that only count
+	// once the title has ended
+	weak bool
+	// suffix editions are also recognised at the end of the title, for names like
+	// "Movie.Directors.Cut.2001"
+	suffix bool
+}
+
+// tokenRe compiles a case-insensitive pattern that must be delimited by
+// separators or the ends of the name; group 1 is the token itself
+func tokenRe(pattern string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|[^a-z0-9])(` + pattern + `)(?:[^a-z0-9]|$)`)
+}
+
+func strong(field releaseField, value, pattern string) releaseToken {
+	return releaseToken{re: tokenRe(pattern), field: field, value: value}
+}
+
+func weak(field releaseField, value, pattern string) releaseToken {
+	return releaseToken{re: tokenRe(pattern), field: field, value: value, weak: true}
+}
+
+func edition(value, pattern string, suffix bool) releaseToken {
+	return releaseToken{re: tokenRe(pattern), field: fieldEdition, value: value, weak: true, suffix: suffix}
+}
+
+// sep matches the separators used between words in release names
+const sep = `[ ._-]?`
+
+// releaseTokens lists every recognised token. Within a field, earlier tokens take
+// precedence, so more specific patterns come first.
+var releaseTokens = []releaseToken{
+	strong(fieldResolution, "2160p", `2160[pi]|4k|uhd|3840x2160`),
+	strong(fieldResolution, "1080p", `1080p|1920x1080|fhd`),
+	strong(fieldResolution, "1080i", `1080i`),
+	strong(fieldResolution, "720p", `720p|1280x720`),
+	strong(fieldResolution, "576p", `576[pi]`),
+	strong(fieldResolution, "480p", `480[pi]`),
+	weak(fieldResolution, "480p", `sd`),
+
+	strong(fieldSource, "Remux", `(?:bd|blu`+sep+`ray)?`+sep+`remux`),
+	strong(fieldSource, "BDRip", `bdrip|bd`+sep+`rip`),
+	strong(fieldSource, "BRRip", `brrip|br`+sep+`rip`),
+	strong(fieldSource, "BluRay", `blu`+sep+`ray|bdmv|bd25|bd50|bd`),
+	strong(fieldSource, "WEB-DL", `web`+sep+`dl|webdl|amzn`+sep+`web`+sep+`dl`),
+	strong(fieldSource, "WEBRip", `web`+sep+`rip`),
+	strong(fieldSource, "HDTV", `hdtv|pdtv|dsr|dvb`),
+	strong(fieldSource, "DVDRip", `dvd`+sep+`rip`),
+	strong(fieldSource, "DVD", `dvd[59]?|dvd`+sep+`r`),
+	strong(fieldSource, "HDRip", `hd`+sep+`rip`),
+	strong(fieldSource, "CAM", `hdcam|camrip|cam`+sep+`rip`),
+	strong(fieldSource, "Telesync", `hdts|telesync|ts`+sep+`rip`),
+	strong(fieldSource, "Screener", `screener|dvdscr|bdscr`),
+	weak(fieldSource, "WEB-DL", `web`),
+	weak(fieldSource, "CAM", `cam`),
+	weak(fieldSource, "Telesync", `ts`),
+	weak(fieldSource, "Screener", `scr`),
+	weak(fieldSource, "DVD", `ntsc|pal`),
+
+	strong(fieldVideoCodec, "H.265", `[xh]\.?265|hevc`),
+	strong(fieldVideoCodec, "H.264", `[xh]\.?264|avc`),
+	strong(fieldVideoCodec, "AV1", `av1`),
+	strong(fieldVideoCodec, "VP9", `vp9`),
+	strong(fieldVideoCodec, "XviD", `xvid`),
+	strong(fieldVideoCodec, "DivX", `divx`),
+	strong(fieldVideoCodec, "VC-1", `vc`+sep+`1`),
+	strong(fieldVideoCodec, "MPEG-2", `mpeg`+sep+`2`),
+
+	strong(fieldAudioCodec, "TrueHD", `true`+sep+`hd`),
+	strong(fieldAudioCodec, "DTS-HD MA", `dts`+sep+`hd`+sep+`ma|dts`+sep+`ma`),
+	strong(fieldAudioCodec, "DTS:X", `dts`+sep+`x`),
+	strong(fieldAudioCodec, "DTS-HD", `dts`+sep+`hd(?:`+sep+`hra)?`),
+	strong(fieldAudioCodec, "DTS", `dts(?:`+sep+`es)?`),
+	strong(fieldAudioCodec, "E-AC3", `e`+sep+`ac`+sep+`3|ddp(?:\d\.?\d)?|dd\+(?:\d\.?\d)?|dolby`+sep+`digital`+sep+`plus`),
+	strong(fieldAudioCodec, "AC3", `ac`+sep+`3|dd(?:\d\.?\d)?|dolby`+sep+`digital`),
+	strong(fieldAudioCodec, "FLAC", `flac(?:\d\.?\d)?`),
+	strong(fieldAudioCodec, "AAC", `aac(?:\d\.?\d)?(?:`+sep+`lc)?|he`+sep+`aac`),
+	strong(fieldAudioCodec, "Opus", `opus`),
+	strong(fieldAudioCodec, "MP3", `mp3`),
+	strong(fieldAudioCodec, "PCM", `l?pcm`),
+
+	strong(fieldHDR, "HDR", `hdr(?:10)?(?:\+|plus)?|dolby`+sep+`vision|dovi|dv`+sep+`hdr`),
+
+	edition("Director's Cut", `director'?s`+sep+`cut|dc`, true),
+	edition("Extended", `extended(?:`+sep+`(?:cut|edition|version))?`, true),
+	edition("Unrated", `unrated(?:`+sep+`(?:cut|edition))?`, true),
+	edition("Uncut", `uncut`, false),
+	edition("Theatrical", `theatrical(?:`+sep+`(?:cut|edition|version))?`, true),
+	edition("Remastered", `(?:4k`+sep+`)?remastered`, true),
+	edition("IMAX", `imax(?:`+sep+`edition)?`, true),
+	edition("Criterion", `criterion(?:`+sep+`collection)?`, true),
+	edition("Special Edition", `special`+sep+`edition`, true),
+	edition("Collector's Edition", `collector'?s`+sep+`edition`, true),
+	edition("Ultimate Edition", `ultimate`+sep+`(?:cut|edition)`, true),
+	edition("Anniversary Edition", `\d+(?:th|st|nd|rd)`+sep+`anniversary(?:`+sep+`edition)?`, true),
+	edition("Final Cut", `final`+sep+`cut`, false),
+	edition("Open Matte", `open`+sep+`matte`, true),
+
+	strong(fieldNone, "", `proper|repack|rerip|internal|limited|readnfo|hybrid|multi|dual`+sep+`audio|subbed|dubbed|(?:8|10|12)`+sep+`bit|hi10p?|sdr|hsbs|atmos`),
+	weak(fieldNone, "", `real|dual|3d|hou|complete|[1-9]\.[0-2](?:ch)?|[25678]ch`),
+}
+
+// yearRe matches a plausible release year
+var yearRe = tokenRe(`(?:19|20)\d\d`)
+
+// editionTagRe matches Plex-style edition tags such as "{edition-Director's Cut}"
+var editionTagRe = regexp.MustCompile(`(?i)\s*\{edition-([^}]+)\}`)
+
+// leadingGroupRe and trailingGroupRe match release groups written in brackets
+// at the start ("[Group] Title - 01") or end ("Title (2019) [YTS.MX]") of a name
+var (
+	leadingGroupRe  = regexp.MustCompile(`^\s*\[([^\[\]]+)\]\s*`)
+	trailingGroupRe = regexp.MustCompile(`\s*\[([^\[\]]+)\]\s*$`)
+	dashGroupRe     = regexp.MustCompile(`-\s*([A-Za-z0-9][A-Za-z0-9@]*)(\.[A-Za-z]{2,3})?\s*$`)
+)
+
+// bracketRe matches bracketed or parenthesised text left in a title
+var bracketRe = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)|\{[^}]*\}`)
+
+// spacesRe matches runs of whitespace
+var spacesRe = regexp.MustCompile(`\s+`)
+
+// initialsRe matches runs of single letters separated by spaces, such as the
+// "S H I E L D" left over from "S.H.I.E.L.D." once dots became spaces
+var initialsRe = regexp.MustCompile(`\b(?:[A-Za-z] )+[A-Za-z]\b`)
+
+// ParseReleaseName extracts the title, year and release details from a file or
+// folder name. Unrecognised names give just a cleaned-up title.
+func ParseReleaseName(name string) ReleaseInfo {
+	return parseReleaseName(name, true)
+}
+
+// parseReleaseName parses a release name. When needTitle is set, a token at the
+// very start is taken as part of the title ("Uncut.Gems.2019"); otherwise the
+// title may be empty, as for the text after an episode number.
+func parseReleaseName(name string, needTitle bool) ReleaseInfo {
+	var info ReleaseInfo
+	name = stripReleaseExtension(name)
+
+	var editions []string
+	if m := editionTagRe.FindStringSubmatchIndex(name); m != nil {
+		editions = append(editions, strings.TrimSpace(name[m[2]:m[3]]))
+		name = name[:m[0]] + name[m[1]:]
+	}
+
+	// Bracketed groups at either end; a leading group is followed by bracketed
+	// tags rather than a trailing group, and a trailing one is only used if
+	// there is no "-GROUP" before it, as "[rarbg]" is often the site's tag
+	titleStart := 0
+	trailingGroup := ""
+	if m := leadingGroupRe.FindStringSubmatchIndex(name); m != nil && m[1] < len(name) {
+		if !isReleaseToken(name[m[2]:m[3]]) {
+			info.Group = name[m[2]:m[3]]
+		}
+		titleStart = m[1]
+	} else if m := trailingGroupRe.FindStringSubmatchIndex(name); m != nil && !isReleaseToken(name[m[2]:m[3]]) {
+		trailingGroup = name[m[2]:m[3]]
+		name = name[:m[0]]
+	}
+
+	// The title ends at the first strong token or at the year
+	titleEnd := len(name)
+	for _, tok := range releaseTokens {
+		if tok.weak {
+			continue
+		}
+		for _, m := range tokenMatches(tok.re, name) {
+			if m[2] > titleStart || (!needTitle && m[2] == titleStart) {
+				titleEnd = min(titleEnd, m[2])
+				break
+			}
+		}
+	}
+	if year, start := releaseYear(name, titleStart, titleEnd); year != 0 {
+		info.Year = year
+		titleEnd = min(titleEnd, start)
+	}
+
+	// A trailing "-GROUP" is only a group if it follows the release details;
+	// otherwise it is part of the title, as in "Spider-Man"
+	if titleEnd < len(name) {
+		if m := dashGroupRe.FindStringSubmatchIndex(name); m != nil && m[0] >= titleEnd && !isReleaseToken(name[m[2]:m[3]]) &&
+			(m[4] < 0 || !isReleaseToken(name[m[4]+1:m[5]])) {
+			if info.Group == "" {
+				info.Group = name[m[2]:m[1]]
+			}
+			name = name[:m[0]]
+		}
+	}
+	if info.Group == "" {
+		info.Group = trailingGroup
+	}
+
+	// Fields come from tokens after the title
+	type editionMatch struct {
+		start int
+		value string
+	}
+	var editionMatches []editionMatch
+	for _, tok := range releaseTokens {
+		start := -1
+		for _, m := range tokenMatches(tok.re, name) {
+			if m[2] >= titleEnd && (m[2] > titleStart || !needTitle) {
+				start = m[2]
+				break
+			}
+		}
+		if start < 0 {
+			continue
+		}
+		switch tok.field {
+		case fieldResolution:
+			setOnce(&info.Resolution, tok.value)
+		case fieldSource:
+			setOnce(&info.Source, tok.value)
+		case fieldVideoCodec:
+			setOnce(&info.VideoCodec, tok.value)
+		case fieldAudioCodec:
+			setOnce(&info.AudioCodec, tok.value)
+		case fieldHDR:
+			info.HDR = true
+		case fieldEdition:
+			editionMatches = append(editionMatches, editionMatch{start, tok.value})
+		}
+	}
+	if !info.HDR && caseSensitiveDVRe.MatchString(name[titleEnd:]) {
+		info.HDR = true
+	}
+
+	title := name[titleStart:titleEnd]
+
+	// Editions written before the year, as in "Movie.Directors.Cut.2001"
+	for _, tok := range releaseTokens {
+		if !tok.suffix {
+			continue
+		}
+		if m := tok.re.FindStringSubmatchIndex(title); m != nil && m[3] == len(strings.TrimRight(title, " ._-([")) && m[2] > 0 {
+			editionMatches = append(editionMatches, editionMatch{titleStart + m[2], tok.value})
+			title = title[:m[2]]
+		}
+	}
+
+	// Order editions as they appear in the name
+	for i := 1; i < len(editionMatches); i++ {
+		for j := i; j > 0 && editionMatches[j].start < editionMatches[j-1].start; j-- {
+			editionMatches[j], editionMatches[j-1] = editionMatches[j-1], editionMatches[j]
+		}
+	}
+	for _, m := range editionMatches {
+		editions = appendUnique(editions, m.value)
+	}
+	info.Edition = strings.Join(editions, ", ")
+
+	info.Title = cleanReleaseTitle(title, !strings.ContainsAny(name, " ._"))
+	if info.Title == "" && info.Year != 0 {
+		// Names like "1917.mkv" or "2012.2009.mkv": a lone number is the title
+		info.Title = strconv.Itoa(info.Year)
+		info.Year = 0
+	}
+	return info
+}
+
+// caseSensitiveDVRe matches the Dolby Vision abbreviation "DV", which is only
+// trusted in upper case
+var caseSensitiveDVRe = regexp.MustCompile(`(?:^|[^A-Za-z0-9])DV(?:[^A-Za-z0-9]|$)`)
+
+// tokenMatches returns the submatch indices of every match of a tokenRe pattern.
+// Unlike FindAllStringSubmatchIndex it finds adjacent tokens that share a
+// separator, such as both years in "2019.2020".
+func tokenMatches(re *regexp.Regexp, s string) [][]int {
+	var matches [][]int
+	for offset := 0; offset < len(s); {
+		m := re.FindStringSubmatchIndex(s[offset:])
+		if m == nil {
+			break
+		}
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += offset
+			}
+		}
+		matches = append(matches, m)
+		offset = m[3]
+	}
+	return matches
+}
+
+// releaseYear picks the release year: the last year-like number inside the title
+// region that is not at its start, or failing that the first one after it.
+// "2001.A.Space.Odyssey.1968" and "Blade.Runner.2049.2017" give 1968 and 2017.
+func releaseYear(name string, titleStart, titleEnd int) (year, start int) {
+	var before, after []int
+	for _, m := range tokenMatches(yearRe, name) {
+		if m[2] <= titleStart {
+			continue
+		}
+		if m[2] < titleEnd {
+			before = append(before, m[2])
+		} else {
+			after = append(after, m[2])
+		}
+	}
+	switch {
+	case len(before) > 0:
+		start = before[len(before)-1]
+	case len(after) > 0:
+		start = after[0]
+	default:
+		return 0, 0
+	}
+	year, _ = strconv.Atoi(name[start : start+4])
+	return year, start
+}
+
+// partialExtensions are suffixes download clients add to incomplete files
+var partialExtensions = map[string]bool{".part": true, ".partial": true, ".!qb": true, ".crdownload": true}
+
+// stripReleaseExtension removes a video file extension, and any partial download
+// suffix after it, but not a trailing part of the name that merely follows a
+// dot, like the year in "Movie.2001"
+func stripReleaseExtension(name string) string {
+	if ext := filepath.Ext(name); partialExtensions[strings.ToLower(ext)] {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if ext := filepath.Ext(name); isVideoFile(strings.ToLower(ext)) {
+		name = strings.TrimSuffix(name, ext)
+	}
+	return name
+}
+
+// isReleaseToken reports whether s is entirely one recognised token
+func isReleaseToken(s string) bool {
+	for _, tok := range releaseTokens {
+		if m := tok.re.FindStringSubmatchIndex(s); m != nil && m[2] == 0 && m[3] == len(s) {
+			return true
+		}
+	}
+	if m := yearRe.FindStringSubmatchIndex(s); m != nil && m[2] == 0 && m[3] == len(s) {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "dl", "rip", "hd", "ma", "lc", "x", "es", "1", "2", "3", "5":
+		return true
+	}
+	return false
+}
+
+// cleanReleaseTitle turns the title part of a release name into a readable title.
+// Dashes are only separators in names that use nothing else, like
+// "Forrest-Gump-1994-1080p"; otherwise they belong to titles like "Spider-Man".
+func cleanReleaseTitle(title string, dashSeparated bool) string {
+	title = bracketRe.ReplaceAllString(title, " ")
+	title = strings.ReplaceAll(title, "_", " ")
+	if dashSeparated {
+		title = strings.ReplaceAll(title, "-", " ")
+	}
+	// Dots separate words unless the name already uses spaces, as in "Mr. Nobody"
+	if !strings.Contains(strings.TrimSpace(title), " ") {
+		title = strings.ReplaceAll(title, ".", " ")
+		title = initialsRe.ReplaceAllStringFunc(title, func(s string) string {
+			return strings.ReplaceAll(s, " ", ".")
+		})
+	}
+	title = strings.NewReplacer("[", " ", "]", " ", "(", " ", ")", " ", "{", " ", "}", " ").Replace(title)
+	title = spacesRe.ReplaceAllString(title, " ")
+	return strings.Trim(title, " -.,:;")
+}
+
+// setOnce sets *field to value unless it is already set
+func setOnce(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// appendUnique appends value to list unless it is already present
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
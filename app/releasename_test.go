@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseReleaseName(t *testing.T) {
+	tests := []struct {
+		name string
+		want ReleaseInfo
+	}{
+		{"Blade.Runner.2049.2017.2160p.UHD.BluRay.x265.HDR.TrueHD.7.1.Atmos-GROUP.mkv", ReleaseInfo{Title: "Blade Runner 2049", Year: 2017, Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", AudioCodec: "TrueHD", HDR: true, Group: "GROUP"}},
+		{"2001.A.Space.Odyssey.1968.1080p.BluRay.x264-AMIABLE.mkv", ReleaseInfo{Title: "2001 A Space Odyssey", Year: 1968, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "AMIABLE"}},
+		{"The.Matrix.1999.1080p.BluRay.x264.DTS-HD.MA.5.1-FGT.mkv", ReleaseInfo{Title: "The Matrix", Year: 1999, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS-HD MA", Group: "FGT"}},
+		{"Inception (2010) [1080p] [BluRay] [5.1] [YTS.MX].mp4", ReleaseInfo{Title: "Inception", Year: 2010, Resolution: "1080p", Source: "BluRay", Group: "YTS.MX"}},
+		{"Heat.1995.mkv", ReleaseInfo{Title: "Heat", Year: 1995}},
+		{"Heat (1995).mkv", ReleaseInfo{Title: "Heat", Year: 1995}},
+		{"Heat.mkv", ReleaseInfo{Title: "Heat"}},
+		{"1917.2019.1080p.WEB-DL.DDP5.1.H264-CMRG.mkv", ReleaseInfo{Title: "1917", Year: 2019, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "CMRG"}},
+		{"1917 (2019).mkv", ReleaseInfo{Title: "1917", Year: 2019}},
+		{"2012.2009.720p.BluRay.x264.mkv", ReleaseInfo{Title: "2012", Year: 2009, Resolution: "720p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Spider-Man.Into.the.Spider-Verse.2018.1080p.WEBRip.x264-RARBG.mp4", ReleaseInfo{Title: "Spider-Man Into the Spider-Verse", Year: 2018, Resolution: "1080p", Source: "WEBRip", VideoCodec: "H.264", Group: "RARBG"}},
+		{"Spider-Man (2002).mkv", ReleaseInfo{Title: "Spider-Man", Year: 2002}},
+		{"Charlottes.Web.2006.1080p.WEB.h264-NOGRP.mkv", ReleaseInfo{Title: "Charlottes Web", Year: 2006, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", Group: "NOGRP"}},
+		{"Uncut.Gems.2019.1080p.NF.WEB-DL.DDP5.1.x264-NTG.mkv", ReleaseInfo{Title: "Uncut Gems", Year: 2019, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "NTG"}},
+		{"The.Final.Cut.2004.DVDRip.XviD-DoNE.avi", ReleaseInfo{Title: "The Final Cut", Year: 2004, Source: "DVDRip", VideoCodec: "XviD", Group: "DoNE"}},
+		{"Blade.Runner.1982.The.Final.Cut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Blade Runner", Year: 1982, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Final Cut"}},
+		{"Aliens.1986.Directors.Cut.1080p.BluRay.x264.DTS-WiKi.mkv", ReleaseInfo{Title: "Aliens", Year: 1986, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS", Group: "WiKi", Edition: "Director's Cut"}},
+		{"Aliens.Directors.Cut.1986.720p.BluRay.mkv", ReleaseInfo{Title: "Aliens", Year: 1986, Resolution: "720p", Source: "BluRay", Edition: "Director's Cut"}},
+		{"The.Lord.of.the.Rings.The.Fellowship.of.the.Ring.2001.EXTENDED.2160p.UHD.BluRay.x265.10bit.HDR.TrueHD.7.1.Atmos-DON.mkv", ReleaseInfo{Title: "The Lord of the Rings The Fellowship of the Ring", Year: 2001, Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", AudioCodec: "TrueHD", HDR: true, Group: "DON", Edition: "Extended"}},
+		{"Dune.Part.Two.2024.2160p.AMZN.WEB-DL.DDP5.1.Atmos.DV.HDR10.H.265-FLUX.mkv", ReleaseInfo{Title: "Dune Part Two", Year: 2024, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265", AudioCodec: "E-AC3", HDR: true, Group: "FLUX"}},
+		{"Oppenheimer.2023.IMAX.2160p.WEB-DL.DDP5.1.Atmos.DV.HDR.H.265-FLUX.mkv", ReleaseInfo{Title: "Oppenheimer", Year: 2023, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265", AudioCodec: "E-AC3", HDR: true, Group: "FLUX", Edition: "IMAX"}},
+		{"Mad.Max.Fury.Road.2015.Black.and.Chrome.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Mad Max Fury Road", Year: 2015, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"S.H.I.E.L.D.2020.1080p.mkv", ReleaseInfo{Title: "S.H.I.E.L.D", Year: 2020, Resolution: "1080p"}},
+		{"Mr. Nobody (2009) 1080p BluRay.mkv", ReleaseInfo{Title: "Mr. Nobody", Year: 2009, Resolution: "1080p", Source: "BluRay"}},
+		{"Mr.Robot.2015.mkv", ReleaseInfo{Title: "Mr Robot", Year: 2015}},
+		{"Amelie.2001.FRENCH.1080p.BluRay.x264.DTS-HDChina.mkv", ReleaseInfo{Title: "Amelie", Year: 2001, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS", Group: "HDChina"}},
+		{"Alien.1979.REMASTERED.1080p.BluRay.x265.HEVC.10bit.AAC.5.1-Tigole.mkv", ReleaseInfo{Title: "Alien", Year: 1979, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.265", AudioCodec: "AAC", Group: "Tigole", Edition: "Remastered"}},
+		{"Movie.Title.2020.PROPER.1080p.WEB.H264-GROUP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", Group: "GROUP"}},
+		{"Movie.Title.2020.REPACK.720p.HDTV.x264-GROUP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", Source: "HDTV", VideoCodec: "H.264", Group: "GROUP"}},
+		{"Movie Title 2020 1080p HDRip XviD AC3-EVO.avi", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "HDRip", VideoCodec: "XviD", AudioCodec: "AC3", Group: "EVO"}},
+		{"Movie.Title.2020.HDCAM.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "CAM", VideoCodec: "H.264", Group: "GRP"}},
+		{"Movie.Title.2020.CAM.XviD-GRP.avi", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "CAM", VideoCodec: "XviD", Group: "GRP"}},
+		{"Movie.Title.2020.TS.XviD-GRP.avi", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "Telesync", VideoCodec: "XviD", Group: "GRP"}},
+		{"Movie.Title.2020.DVDSCR.XviD-GRP.avi", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "Screener", VideoCodec: "XviD", Group: "GRP"}},
+		{"Movie.Title.2020.DVD5.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "DVD"}},
+		{"Movie.Title.2020.NTSC.DVD9.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "DVD"}},
+		{"Movie.Title.2020.1080i.HDTV.MPEG-2.AC3-GRP.ts", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080i", Source: "HDTV", VideoCodec: "MPEG-2", AudioCodec: "AC3", Group: "GRP"}},
+		{"Movie.Title.2020.576p.PAL.DVD.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "576p", Source: "DVD"}},
+		{"Movie_Title_2020_720p_BRRip_x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", Source: "BRRip", VideoCodec: "H.264"}},
+		{"Movie.Title.2020.BDRip.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "BDRip", VideoCodec: "H.264", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.BluRay.REMUX.AVC.DTS-HD.MA.5.1-FGT.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "Remux", VideoCodec: "H.264", AudioCodec: "DTS-HD MA", Group: "FGT"}},
+		{"Movie.Title.2020.1080p.BluRay.Remux.VC-1.TrueHD.5.1-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "Remux", VideoCodec: "VC-1", AudioCodec: "TrueHD", Group: "GRP"}},
+		{"Movie.Title.2020.2160p.UHD.BluRay.REMUX.HDR.HEVC.Atmos-EPSiLON.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "Remux", VideoCodec: "H.265", HDR: true, Group: "EPSiLON"}},
+		{"Movie.Title.2020.2160p.WEB-DL.AV1.Opus.5.1-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "AV1", AudioCodec: "Opus", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.WEB-DL.VP9.Opus-GRP.webm", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "VP9", AudioCodec: "Opus", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.BluRay.FLAC.2.0.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "FLAC", Group: "GRP"}},
+		{"Movie.Title.2020.720p.WEB-DL.AAC2.0.H.264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "AAC", Group: "GRP"}},
+		{"Movie.Title.2020.720p.WEB-DL.DD+5.1.H.264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.WEB-DL.EAC3.5.1.H.264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.BluRay.DTS-X.7.1.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS:X", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.BluRay.DTS.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.BluRay.DTS-ES.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.BluRay.LPCM.2.0.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "PCM", Group: "GRP"}},
+		{"Movie.Title.2020.480p.DVDRip.MP3.XviD.avi", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "480p", Source: "DVDRip", VideoCodec: "XviD", AudioCodec: "MP3"}},
+		{"Movie.Title.2020.DVDRip.DivX-GRP.avi", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "DVDRip", VideoCodec: "DivX", Group: "GRP"}},
+		{"Movie.Title.2020.2160p.HDR10Plus.WEB-DL.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "WEB-DL", HDR: true}},
+		{"Movie.Title.2020.2160p.DoVi.WEB-DL.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "WEB-DL", HDR: true}},
+		{"Movie.Title.2020.2160p.Dolby.Vision.WEB-DL.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "WEB-DL", HDR: true}},
+		{"Movie.Title.2020.4K.HDR.WEBRip.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "WEBRip", HDR: true}},
+		{"Movie.Title.2020.UNRATED.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Unrated"}},
+		{"Movie.Title.2020.Theatrical.Cut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Theatrical"}},
+		{"Movie.Title.2020.Criterion.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Criterion"}},
+		{"Movie.Title.2020.Special.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Special Edition"}},
+		{"Movie.Title.2020.25th.Anniversary.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Anniversary Edition"}},
+		{"Movie.Title.2020.Extended.Cut.Remastered.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Extended, Remastered"}},
+		{"Movie Title (2020) {edition-Director's Cut}.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Edition: "Director's Cut"}},
+		{"Movie Title (2020) {edition-Extended} 1080p.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Edition: "Extended"}},
+		{"[HorribleSubs] Some Anime Movie [1080p].mkv", ReleaseInfo{Title: "Some Anime Movie", Resolution: "1080p", Group: "HorribleSubs"}},
+		{"[Judas] Akira (1988) [BD 2160p 4K UHD][HEVC x265 10bit][Dual-Audio][Eng-Subs].mkv", ReleaseInfo{Title: "Akira", Year: 1988, Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", Group: "Judas"}},
+		{"Movie.Title.2020.MULTi.1080p.BluRay.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "GRP"}},
+		{"Movie.Title.2020.LIMITED.1080p.BluRay.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "GRP"}},
+		{"Movie.Title.2020.INTERNAL.1080p.BluRay.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.BluRay.x264", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Movie.Title.2020", ReleaseInfo{Title: "Movie Title", Year: 2020}},
+		{"Movie.Title", ReleaseInfo{Title: "Movie Title"}},
+		{"movie title 2020.mkv", ReleaseInfo{Title: "movie title", Year: 2020}},
+		{"Star.Wars.Episode.IV.A.New.Hope.1977.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Star Wars Episode IV A New Hope", Year: 1977, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Tron.Legacy.2010.3D.HSBS.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Tron Legacy", Year: 2010, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Step.Up.3D.2010.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Step Up 3D", Year: 2010, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"The.Real.Thing.2002.720p.mkv", ReleaseInfo{Title: "The Real Thing", Year: 2002, Resolution: "720p"}},
+		{"Pal.Joey.1957.720p.mkv", ReleaseInfo{Title: "Pal Joey", Year: 1957, Resolution: "720p"}},
+		{"Web.of.Lies.2009.1080p.WEBRip.x264.mkv", ReleaseInfo{Title: "Web of Lies", Year: 2009, Resolution: "1080p", Source: "WEBRip", VideoCodec: "H.264"}},
+		{"Cam.2018.1080p.NF.WEB-DL.DD5.1.x264-NTG.mkv", ReleaseInfo{Title: "Cam", Year: 2018, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "AC3", Group: "NTG"}},
+		{"Extended.Family.2022.1080p.mkv", ReleaseInfo{Title: "Extended Family", Year: 2022, Resolution: "1080p"}},
+		{"The.Complete.Works.2011.mkv", ReleaseInfo{Title: "The Complete Works", Year: 2011}},
+		{"WALL-E.2008.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "WALL-E", Year: 2008, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"X-Men.Days.of.Future.Past.2014.Rogue.Cut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "X-Men Days of Future Past", Year: 2014, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Mission.Impossible.Dead.Reckoning.Part.One.2023.1080p.WEB-DL.mkv", ReleaseInfo{Title: "Mission Impossible Dead Reckoning Part One", Year: 2023, Resolution: "1080p", Source: "WEB-DL"}},
+		{"The Movie - 2019 - 1080p.mkv", ReleaseInfo{Title: "The Movie", Year: 2019, Resolution: "1080p"}},
+		{"Movie.Title.1080p.BluRay.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.BluRay.x264-GRP[rarbg].mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.BluRay.x264-GRP.mkv.part", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "GRP"}},
+		{"Some Movie 1080p.mkv", ReleaseInfo{Title: "Some Movie", Resolution: "1080p"}},
+		{"Some Movie.mp4", ReleaseInfo{Title: "Some Movie"}},
+		{"Movie.Title.2020.HC.HDRip.XviD.avi", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "HDRip", VideoCodec: "XviD"}},
+		{"Movie.Title.2020.BD50.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "BluRay"}},
+		{"Movie.Title.2020.1080p.BluRay.DD5.1.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "AC3"}},
+		{"Movie.Title.2020.1080p.BluRay.AC3.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "AC3"}},
+		{"Movie.Title.2020.1080p.AMZN.WEBRip.DDP5.1.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEBRip", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "GRP"}},
+		{"Movie.Title.2020.HYBRID.2160p.WEB-DL.DV.HDR.DDP.5.1.H265.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265", AudioCodec: "E-AC3", HDR: true}},
+		{"Movie.Title.2020.SDR.2160p.WEB-DL.H265.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265"}},
+		{"Movie.Title.2020.1080p.HEVC.x265-MeGusta.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", VideoCodec: "H.265", Group: "MeGusta"}},
+		{"Movie.Title.(2020).1080p.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p"}},
+		{"Movie Title [2020] 1080p.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p"}},
+		{"Movie.Title.2020.720p.HDTV.x264.AAC-GRP.mp4", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", Source: "HDTV", VideoCodec: "H.264", AudioCodec: "AAC", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.HMAX.WEB-DL.DD5.1.H.264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "AC3", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.DSNP.WEB-DL.DDP5.1.H.264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "GRP"}},
+		{"Movie.Title.2020.IMAX.Enhanced.2160p.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Edition: "IMAX"}},
+		{"Movie.Title.2020.Open.Matte.1080p.WEB-DL.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", Edition: "Open Matte"}},
+		{"Movie.Title.2020.Ultimate.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Ultimate Edition"}},
+		{"Movie.Title.2020.Collectors.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Collector's Edition"}},
+		{"Movie.Title.2020.Uncut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Uncut"}},
+		{"Apollo.13.1995.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Apollo 13", Year: 1995, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Apollo 13 (1995).mkv", ReleaseInfo{Title: "Apollo 13", Year: 1995}},
+		{"Se7en.1995.REMASTERED.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Se7en", Year: 1995, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Remastered"}},
+		{"The.Hateful.Eight.2015.1080p.BluRay.x264.DTS.mkv", ReleaseInfo{Title: "The Hateful Eight", Year: 2015, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS"}},
+		{"District.9.2009.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "District 9", Year: 2009, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Fantastic.4.2015.1080p.mkv", ReleaseInfo{Title: "Fantastic 4", Year: 2015, Resolution: "1080p"}},
+		{"The.Godfather.1972.REMASTERED.1080p.BluRay.x264.DTS-HD.MA.5.1-SWTYBLZ.mkv", ReleaseInfo{Title: "The Godfather", Year: 1972, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS-HD MA", Group: "SWTYBLZ", Edition: "Remastered"}},
+		{"The.Godfather.Part.II.1974.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "The Godfather Part II", Year: 1974, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Pulp.Fiction.1994.720p.BrRip.x264.YIFY.mp4", ReleaseInfo{Title: "Pulp Fiction", Year: 1994, Resolution: "720p", Source: "BRRip", VideoCodec: "H.264"}},
+		{"Pulp Fiction (1994) 1080p BrRip x264 - YIFY.mp4", ReleaseInfo{Title: "Pulp Fiction", Year: 1994, Resolution: "1080p", Source: "BRRip", VideoCodec: "H.264", Group: "YIFY"}},
+		{"Fight.Club.1999.10th.Anniversary.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Fight Club", Year: 1999, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Anniversary Edition"}},
+		{"Gladiator.2000.Extended.Remastered.1080p.BluRay.DTS.x264-GRP.mkv", ReleaseInfo{Title: "Gladiator", Year: 2000, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS", Group: "GRP", Edition: "Extended, Remastered"}},
+		{"Kill.Bill.Vol.1.2003.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Kill Bill Vol 1", Year: 2003, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Kill Bill - Volume 1 (2003).mkv", ReleaseInfo{Title: "Kill Bill - Volume 1", Year: 2003}},
+		{"Avengers.Endgame.2019.2160p.UHD.BluRay.x265.10bit.HDR.TrueHD.7.1.Atmos-TERMiNAL.mkv", ReleaseInfo{Title: "Avengers Endgame", Year: 2019, Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", AudioCodec: "TrueHD", HDR: true, Group: "TERMiNAL"}},
+		{"Avengers Endgame (2019) (2160p BluRay x265 HEVC 10bit HDR AAC 7.1 Tigole).mkv", ReleaseInfo{Title: "Avengers Endgame", Year: 2019, Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", AudioCodec: "AAC", HDR: true}},
+		{"Joker.2019.1080p.WEBRip.x264-RARBG.mp4", ReleaseInfo{Title: "Joker", Year: 2019, Resolution: "1080p", Source: "WEBRip", VideoCodec: "H.264", Group: "RARBG"}},
+		{"Parasite.2019.KOREAN.1080p.BluRay.H264.AAC-VXT.mp4", ReleaseInfo{Title: "Parasite", Year: 2019, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "AAC", Group: "VXT"}},
+		{"Spirited.Away.2001.JAPANESE.1080p.BluRay.x264.DTS-FGT.mkv", ReleaseInfo{Title: "Spirited Away", Year: 2001, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS", Group: "FGT"}},
+		{"Amélie.2001.1080p.BluRay.mkv", ReleaseInfo{Title: "Amélie", Year: 2001, Resolution: "1080p", Source: "BluRay"}},
+		{"Léon.The.Professional.1994.Extended.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Léon The Professional", Year: 1994, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Extended"}},
+		{"Crouching.Tiger.Hidden.Dragon.2000.CHINESE.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Crouching Tiger Hidden Dragon", Year: 2000, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"The.Good.the.Bad.and.the.Ugly.1966.Extended.Remastered.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "The Good the Bad and the Ugly", Year: 1966, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Extended, Remastered"}},
+		{"Apocalypse.Now.1979.Final.Cut.2160p.UHD.BluRay.x265.mkv", ReleaseInfo{Title: "Apocalypse Now", Year: 1979, Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", Edition: "Final Cut"}},
+		{"Apocalypse.Now.Redux.2001.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Apocalypse Now Redux", Year: 2001, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Terminator.2.Judgment.Day.1991.REMASTERED.2160p.UHD.BluRay.x265.HDR.mkv", ReleaseInfo{Title: "Terminator 2 Judgment Day", Year: 1991, Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", HDR: true, Edition: "Remastered"}},
+		{"Back.to.the.Future.Part.III.1990.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Back to the Future Part III", Year: 1990, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Toy.Story.4.2019.1080p.BluRay.x264-SPARKS.mkv", ReleaseInfo{Title: "Toy Story 4", Year: 2019, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "SPARKS"}},
+		{"Up.2009.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Up", Year: 2009, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"It.2017.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "It", Year: 2017, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Her.2013.720p.BluRay.x264.mkv", ReleaseInfo{Title: "Her", Year: 2013, Resolution: "720p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"M.1931.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "M", Year: 1931, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Us.2019.1080p.WEB-DL.DD5.1.H264-FGT.mkv", ReleaseInfo{Title: "Us", Year: 2019, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "AC3", Group: "FGT"}},
+		{"Nope.2022.2160p.WEB-DL.DDP5.1.Atmos.DV.HDR.H.265-FLUX.mkv", ReleaseInfo{Title: "Nope", Year: 2022, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265", AudioCodec: "E-AC3", HDR: true, Group: "FLUX"}},
+		{"Tenet.2020.IMAX.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Tenet", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "IMAX"}},
+		{"Interstellar.2014.IMAX.2160p.UHD.BluRay.x265.10bit.HDR.DTS-HD.MA.5.1.mkv", ReleaseInfo{Title: "Interstellar", Year: 2014, Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", AudioCodec: "DTS-HD MA", HDR: true, Edition: "IMAX"}},
+		{"The.Dark.Knight.2008.IMAX.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "The Dark Knight", Year: 2008, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "IMAX"}},
+		{"Batman.v.Superman.Dawn.of.Justice.2016.Ultimate.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Batman v Superman Dawn of Justice", Year: 2016, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Ultimate Edition"}},
+		{"Zack.Snyders.Justice.League.2021.1080p.HMAX.WEB-DL.DDP5.1.Atmos.x264-GRP.mkv", ReleaseInfo{Title: "Zack Snyders Justice League", Year: 2021, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "GRP"}},
+		{"Avatar.2009.Extended.Collectors.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Avatar", Year: 2009, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Extended, Collector's Edition"}},
+		{"Kingdom.of.Heaven.2005.Directors.Cut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Kingdom of Heaven", Year: 2005, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Director's Cut"}},
+		{"Donnie.Darko.2001.Directors.Cut.720p.BluRay.x264.mkv", ReleaseInfo{Title: "Donnie Darko", Year: 2001, Resolution: "720p", Source: "BluRay", VideoCodec: "H.264", Edition: "Director's Cut"}},
+		{"Watchmen.2009.Ultimate.Cut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Watchmen", Year: 2009, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Ultimate Edition"}},
+		{"Amadeus.1984.Directors.Cut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Amadeus", Year: 1984, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Director's Cut"}},
+		{"The.Exorcist.1973.Extended.Directors.Cut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "The Exorcist", Year: 1973, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Extended, Director's Cut"}},
+		{"Snatch.2000.1080p.BluRay.x264.DTS-HD.MA.5.1-GRP.mkv", ReleaseInfo{Title: "Snatch", Year: 2000, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS-HD MA", Group: "GRP"}},
+		{"Lock.Stock.and.Two.Smoking.Barrels.1998.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Lock Stock and Two Smoking Barrels", Year: 1998, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Jaws.1975.1080p.BluRay.x264.DTS.mkv", ReleaseInfo{Title: "Jaws", Year: 1975, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS"}},
+		{"Jurassic.Park.1993.2160p.UHD.BluRay.x265.HDR.DTS-X.mkv", ReleaseInfo{Title: "Jurassic Park", Year: 1993, Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", AudioCodec: "DTS:X", HDR: true}},
+		{"E.T.the.Extra-Terrestrial.1982.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "E.T the Extra-Terrestrial", Year: 1982, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Schindlers.List.1993.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Schindlers List", Year: 1993, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Casablanca.1942.1080p.BluRay.x264.FLAC.1.0.mkv", ReleaseInfo{Title: "Casablanca", Year: 1942, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "FLAC"}},
+		{"Metropolis.1927.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Metropolis", Year: 1927, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Citizen.Kane.1941.720p.BluRay.x264.mkv", ReleaseInfo{Title: "Citizen Kane", Year: 1941, Resolution: "720p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Seven.Samurai.1954.Criterion.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Seven Samurai", Year: 1954, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Criterion"}},
+		{"Rashomon.1950.Criterion.Collection.1080p.BluRay.mkv", ReleaseInfo{Title: "Rashomon", Year: 1950, Resolution: "1080p", Source: "BluRay", Edition: "Criterion"}},
+		{"Tokyo.Story.1953.480p.DVDRip.XviD.mkv", ReleaseInfo{Title: "Tokyo Story", Year: 1953, Resolution: "480p", Source: "DVDRip", VideoCodec: "XviD"}},
+		{"The.Shining.1980.Extended.Cut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "The Shining", Year: 1980, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Extended"}},
+		{"The.Thing.1982.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "The Thing", Year: 1982, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Halloween.1978.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Halloween", Year: 1978, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Halloween.2018.1080p.WEB-DL.H264.AC3-EVO.mkv", ReleaseInfo{Title: "Halloween", Year: 2018, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "AC3", Group: "EVO"}},
+		{"Scream.2022.1080p.WEBRip.x265-RARBG.mp4", ReleaseInfo{Title: "Scream", Year: 2022, Resolution: "1080p", Source: "WEBRip", VideoCodec: "H.265", Group: "RARBG"}},
+		{"Get.Out.2017.1080p.BluRay.x264-DRONES.mkv", ReleaseInfo{Title: "Get Out", Year: 2017, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "DRONES"}},
+		{"Hereditary.2018.1080p.BluRay.x264-SPARKS.mkv", ReleaseInfo{Title: "Hereditary", Year: 2018, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Group: "SPARKS"}},
+		{"Midsommar.2019.Directors.Cut.1080p.WEB-DL.H264.mkv", ReleaseInfo{Title: "Midsommar", Year: 2019, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", Edition: "Director's Cut"}},
+		{"Top.Gun.Maverick.2022.IMAX.2160p.WEB-DL.DDP5.1.Atmos.DV.HDR.H.265.mkv", ReleaseInfo{Title: "Top Gun Maverick", Year: 2022, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265", AudioCodec: "E-AC3", HDR: true, Edition: "IMAX"}},
+		{"Everything.Everywhere.All.at.Once.2022.1080p.WEB-DL.mkv", ReleaseInfo{Title: "Everything Everywhere All at Once", Year: 2022, Resolution: "1080p", Source: "WEB-DL"}},
+		{"No.Time.to.Die.2021.2160p.UHD.BluRay.REMUX.HDR.HEVC.TrueHD.7.1.Atmos-FraMeSToR.mkv", ReleaseInfo{Title: "No Time to Die", Year: 2021, Resolution: "2160p", Source: "Remux", VideoCodec: "H.265", AudioCodec: "TrueHD", HDR: true, Group: "FraMeSToR"}},
+		{"Barbie.2023.1080p.WEBRip.x264.AAC5.1-YTS.MX.mp4", ReleaseInfo{Title: "Barbie", Year: 2023, Resolution: "1080p", Source: "WEBRip", VideoCodec: "H.264", AudioCodec: "AAC", Group: "YTS.MX"}},
+		{"The.Batman.2022.1080p.HMAX.WEB-DL.DDP5.1.Atmos.H.264-CMRG.mkv", ReleaseInfo{Title: "The Batman", Year: 2022, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "CMRG"}},
+		{"Knives.Out.2019.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Knives Out", Year: 2019, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Glass.Onion.A.Knives.Out.Mystery.2022.1080p.NF.WEB-DL.DDP5.1.Atmos.H.264-CMRG.mkv", ReleaseInfo{Title: "Glass Onion A Knives Out Mystery", Year: 2022, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "CMRG"}},
+		{"The.Irishman.2019.1080p.NF.WEBRip.DDP5.1.x264-NTG.mkv", ReleaseInfo{Title: "The Irishman", Year: 2019, Resolution: "1080p", Source: "WEBRip", VideoCodec: "H.264", AudioCodec: "E-AC3", Group: "NTG"}},
+		{"Roma.2018.2160p.NF.WEBRip.DDP5.1.Atmos.x265.mkv", ReleaseInfo{Title: "Roma", Year: 2018, Resolution: "2160p", Source: "WEBRip", VideoCodec: "H.265", AudioCodec: "E-AC3"}},
+		{"Once.Upon.a.Time.in.Hollywood.2019.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Once Upon a Time in Hollywood", Year: 2019, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Once Upon a Time in the West (1968) [1080p].mkv", ReleaseInfo{Title: "Once Upon a Time in the West", Year: 1968, Resolution: "1080p"}},
+		{"Princess Mononoke (1997) [BluRay] [1080p] [YTS.AM].mp4", ReleaseInfo{Title: "Princess Mononoke", Year: 1997, Resolution: "1080p", Source: "BluRay", Group: "YTS.AM"}},
+		{"The Shawshank Redemption (1994) 1080p.mkv", ReleaseInfo{Title: "The Shawshank Redemption", Year: 1994, Resolution: "1080p"}},
+		{"the.shawshank.redemption.1994.1080p.bluray.x264.mkv", ReleaseInfo{Title: "the shawshank redemption", Year: 1994, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"THE.SHAWSHANK.REDEMPTION.1994.1080P.BLURAY.X264.mkv", ReleaseInfo{Title: "THE SHAWSHANK REDEMPTION", Year: 1994, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Forrest Gump 1994 1080p BluRay x264.mkv", ReleaseInfo{Title: "Forrest Gump", Year: 1994, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Forrest_Gump_1994_1080p_BluRay_x264.mkv", ReleaseInfo{Title: "Forrest Gump", Year: 1994, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Forrest-Gump-1994-1080p-BluRay-x264.mkv", ReleaseInfo{Title: "Forrest Gump", Year: 1994, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Home.Alone.1990.1080p.BluRay.x264.DD5.1-GRP.mkv", ReleaseInfo{Title: "Home Alone", Year: 1990, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "AC3", Group: "GRP"}},
+		{"Home.Alone.2.Lost.in.New.York.1992.720p.BluRay.x264.mkv", ReleaseInfo{Title: "Home Alone 2 Lost in New York", Year: 1992, Resolution: "720p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Die.Hard.1988.1080p.BluRay.x264.DTS-ES.6.1.mkv", ReleaseInfo{Title: "Die Hard", Year: 1988, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS"}},
+		{"Die Hard With a Vengeance (1995).avi", ReleaseInfo{Title: "Die Hard With a Vengeance", Year: 1995}},
+		{"Rocky.IV.1985.Directors.Cut.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Rocky IV", Year: 1985, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Director's Cut"}},
+		{"Rocky.Balboa.2006.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Rocky Balboa", Year: 2006, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Alien³.1992.Special.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Alien³", Year: 1992, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Special Edition"}},
+		{"The.Hobbit.An.Unexpected.Journey.2012.Extended.Edition.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "The Hobbit An Unexpected Journey", Year: 2012, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", Edition: "Extended"}},
+		{"The.Hobbit.An.Unexpected.Journey.2012.3D.1080p.BluRay.Half-SBS.x264.mkv", ReleaseInfo{Title: "The Hobbit An Unexpected Journey", Year: 2012, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Gravity.2013.3D.HOU.1080p.BluRay.x264.mkv", ReleaseInfo{Title: "Gravity", Year: 2013, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{"Avatar.The.Way.of.Water.2022.2160p.DSNP.WEB-DL.DDP5.1.Atmos.DV.HDR.H.265.mkv", ReleaseInfo{Title: "Avatar The Way of Water", Year: 2022, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265", AudioCodec: "E-AC3", HDR: true}},
+		{"Elemental.2023.1080p.DSNP.WEB-DL.DDP5.1.H.264.mkv", ReleaseInfo{Title: "Elemental", Year: 2023, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3"}},
+		{"Movie.Title.2020.1080p.ATVP.WEB-DL.DDP5.1.H.264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3"}},
+		{"Movie.Title.2020.1080p.PCOK.WEB-DL.DDP5.1.H.264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "E-AC3"}},
+		{"Movie.Title.2020.720p.iT.WEB-DL.DD5.1.H.264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "AC3"}},
+		{"Movie.Title.2020.1080p.MA.WEB-DL.DTS-HD.MA.5.1.H.264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "DTS-HD MA"}},
+		{"Movie.Title.2020.PAL.DVDR.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "DVD"}},
+		{"Movie.Title.2020.DVDRip.x264.AC3.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "DVDRip", VideoCodec: "H.264", AudioCodec: "AC3"}},
+		{"Movie.Title.2020.DVD-Rip.XviD.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "DVDRip", VideoCodec: "XviD"}},
+		{"Movie.Title.2020.BluRay.1080p.DTS-HD.HRA.7.1.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS-HD"}},
+		{"Movie.Title.2020.1080p.Blu-ray.AVC.DTS-HD.MA.5.1.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264", AudioCodec: "DTS-HD MA"}},
+		{"Movie.Title.2020.1080p.BD-Rip.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "BDRip", VideoCodec: "H.264"}},
+		{"Movie.Title.2020.1080p.HDTV.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "HDTV", VideoCodec: "H.264"}},
+		{"Movie.Title.2020.PDTV.XviD.avi", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "HDTV", VideoCodec: "XviD"}},
+		{"Movie.Title.2020.720p.WEB.x264-GRP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", Source: "WEB-DL", VideoCodec: "H.264", Group: "GRP"}},
+		{"Movie.Title.2020.1080p.WEBDL.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264"}},
+		{"Movie.Title.2020.1080p.WEB.DL.x264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264"}},
+		{"Movie.Title.2020.2160p.WEB.H265.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "WEB-DL", VideoCodec: "H.265"}},
+		{"Movie.Title.2020.1920x1080.WEB-DL.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", Source: "WEB-DL"}},
+		{"Movie.Title.2020.1280x720.HDTV.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", Source: "HDTV"}},
+		{"Movie.Title.2020.3840x2160.WEB-DL.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", Source: "WEB-DL"}},
+		{"Movie.Title.2020.480p.WEB-DL.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "480p", Source: "WEB-DL"}},
+		{"Movie.Title.2020.720p.HEVC.x265.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", VideoCodec: "H.265"}},
+		{"Movie.Title.2020.1080p.H.265.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", VideoCodec: "H.265"}},
+		{"Movie.Title.2020.1080p.h265.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", VideoCodec: "H.265"}},
+		{"Movie.Title.2020.1080p.HEVC.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", VideoCodec: "H.265"}},
+		{"Movie.Title.2020.1080p.AVC.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", VideoCodec: "H.264"}},
+		{"Movie.Title.2020.1080p.H.264.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", VideoCodec: "H.264"}},
+		{"Movie.Title.2020.DVDRip.XVID.AC3.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Source: "DVDRip", VideoCodec: "XviD", AudioCodec: "AC3"}},
+		{"Movie.Title.2020.2160p.HDR10.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", HDR: true}},
+		{"Movie.Title.2020.2160p.HDR10+.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", HDR: true}},
+		{"Movie.Title.2020.2160p.DV.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p", HDR: true}},
+		{"Movie.Title.2020.2160p.dv.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "2160p"}},
+		{"Movie.Title.2020.1080p.10bit.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p"}},
+		{"Movie.Title.2020.1080p.TrueHD.Atmos.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "TrueHD"}},
+		{"Movie.Title.2020.1080p.DTS-HD.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "DTS-HD"}},
+		{"Movie.Title.2020.1080p.DTS-HD.MA.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "DTS-HD MA"}},
+		{"Movie.Title.2020.1080p.DTSMA.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "DTS-HD MA"}},
+		{"Movie.Title.2020.1080p.DD+.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "E-AC3"}},
+		{"Movie.Title.2020.1080p.DDP.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "E-AC3"}},
+		{"Movie.Title.2020.1080p.E-AC-3.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "E-AC3"}},
+		{"Movie.Title.2020.1080p.AC-3.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "AC3"}},
+		{"Movie.Title.2020.1080p.HE-AAC.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "AAC"}},
+		{"Movie.Title.2020.1080p.AAC-LC.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "AAC"}},
+		{"Movie.Title.2020.1080p.FLAC5.1.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "FLAC"}},
+		{"Movie.Title.2020.1080p.MP3.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "MP3"}},
+		{"Movie.Title.2020.1080p.OPUS.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "Opus"}},
+		{"Movie.Title.2020.1080p.PCM.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "PCM"}},
+		{"Movie.Title.2020.1080p.Dolby.Digital.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "AC3"}},
+		{"Movie.Title.2020.1080p.Dolby.Digital.Plus.mkv", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "1080p", AudioCodec: "E-AC3"}},
+		{"Movie.Title.2020.720p.BluRay.x264-[YTS.LT].mp4", ReleaseInfo{Title: "Movie Title", Year: 2020, Resolution: "720p", Source: "BluRay", VideoCodec: "H.264", Group: "YTS.LT"}},
+	}
+	for _, tt := range tests {
+		if got := ParseReleaseName(tt.name); got != tt.want {
+			t.Errorf("ParseReleaseName(%q)\n got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestParseReleaseNameCombinations checks that titles survive being combined
+// with common release tags, whatever separator the name uses
+func TestParseReleaseNameCombinations(t *testing.T) {
+	titles := []struct {
+		words []string
+		title string
+	}{
+		{[]string{"Heat"}, "Heat"},
+		{[]string{"The", "Matrix"}, "The Matrix"},
+		{[]string{"Blade", "Runner", "2049"}, "Blade Runner 2049"},
+		{[]string{"Apollo", "13"}, "Apollo 13"},
+		{[]string{"Charlottes", "Web"}, "Charlottes Web"},
+		{[]string{"The", "Final", "Cut"}, "The Final Cut"},
+		{[]string{"Extended", "Family"}, "Extended Family"},
+		{[]string{"Real", "Steel"}, "Real Steel"},
+	}
+	tags := []struct {
+		words []string
+		want  ReleaseInfo
+	}{
+		{[]string{"1080p", "BluRay", "x264"}, ReleaseInfo{Resolution: "1080p", Source: "BluRay", VideoCodec: "H.264"}},
+		{[]string{"720p", "WEB-DL", "AAC2.0", "H.264"}, ReleaseInfo{Resolution: "720p", Source: "WEB-DL", VideoCodec: "H.264", AudioCodec: "AAC"}},
+		{[]string{"2160p", "UHD", "BluRay", "x265", "HDR", "TrueHD", "7.1"}, ReleaseInfo{Resolution: "2160p", Source: "BluRay", VideoCodec: "H.265", AudioCodec: "TrueHD", HDR: true}},
+		{[]string{"Directors", "Cut", "1080p", "BluRay"}, ReleaseInfo{Resolution: "1080p", Source: "BluRay", Edition: "Director's Cut"}},
+		{[]string{"DVDRip", "XviD", "AC3"}, ReleaseInfo{Source: "DVDRip", VideoCodec: "XviD", AudioCodec: "AC3"}},
+		{[]string{"1080p", "WEB", "H264"}, ReleaseInfo{Resolution: "1080p", Source: "WEB-DL", VideoCodec: "H.264"}},
+		{[]string{"REMUX", "AVC", "DTS-HD", "MA", "5.1"}, ReleaseInfo{Source: "Remux", VideoCodec: "H.264", AudioCodec: "DTS-HD MA"}},
+		{[]string{"EXTENDED", "720p", "HDTV"}, ReleaseInfo{Resolution: "720p", Source: "HDTV", Edition: "Extended"}},
+	}
+	for _, sep := range []string{".", " ", "_"} {
+		for _, title := range titles {
+			for _, tag := range tags {
+				words := append(append(append([]string(nil), title.words...), "1999"), tag.words...)
+				name := ""
+				for i, w := range words {
+					if i > 0 {
+						name += sep
+					}
+					name += w
+				}
+				name += "-GRP.mkv"
+
+				want := tag.want
+				want.Title, want.Year, want.Group = title.title, 1999, "GRP"
+				if got := ParseReleaseName(name); got != want {
+					t.Errorf("ParseReleaseName(%q)\n got %+v\nwant %+v", name, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestScanMoviesStoresReleaseInfo(t *testing.T) {
+	cfg := newTestLibrary(t)
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Aliens (1986)", "Aliens.1986.Directors.Cut.1080p.BluRay.x264.DTS-WiKi.mkv"), "movie")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Home Movie.mkv"), "movie")
+
+	repo := newFakeRepo()
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	aliens, err := repo.GetMediaByPath(context.Background(), filepath.Join(cfg.MoviesDir, "Aliens (1986)", "Aliens.1986.Directors.Cut.1080p.BluRay.x264.DTS-WiKi.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aliens.Title != "Aliens" || aliens.Year.Int64 != 1986 || aliens.Resolution.String != "1080p" || aliens.Source.String != "BluRay" ||
+		aliens.VideoCodec.String != "H.264" || aliens.AudioCodec.String != "DTS" || aliens.ReleaseGroup.String != "WiKi" ||
+		aliens.Edition.String != "Director's Cut" || aliens.HDR {
+		t.Errorf("saved %+v", aliens)
+	}
+
+	home, err := repo.GetMediaByPath(context.Background(), filepath.Join(cfg.MoviesDir, "Home Movie.mkv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if home.Title != "Home Movie" || home.Year.Valid || home.Resolution.Valid || home.ReleaseGroup.Valid {
+		t.Errorf("saved %+v, want just a title", home)
+	}
+}
+
+func TestScanBackfillsReleaseInfo(t *testing.T) {
+	ctx := context.Background()
+	cfg := newTestLibrary(t)
+	path := filepath.Join(cfg.MoviesDir, "Heat.1995.1080p.BluRay.x264-GRP.mkv")
+	writeFile(t, path, "movie")
+	repo := newFakeRepo()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// A row saved before release details were parsed, whose file is unchanged,
+	// except for a resolution read from its headers
+	heat, _ := repo.GetMediaByPath(ctx, path)
+	heat.Source, heat.VideoCodec, heat.ReleaseGroup = sql.NullString{}, sql.NullString{}, sql.NullString{}
+	heat.Resolution = sql.NullString{String: "720p", Valid: true}
+	heat.ReleaseParsed = false
+	repo.media[heat.ID] = heat
+
+	summary, err := ScanMedia(ctx, repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Unchanged != 1 {
+		t.Fatalf("rescan left %d files unchanged, want 1", summary.Unchanged)
+	}
+	heat = repo.media[heat.ID]
+	if !heat.ReleaseParsed || heat.Source.String != "BluRay" || heat.VideoCodec.String != "H.264" ||
+		heat.ReleaseGroup.String != "GRP" || heat.Resolution.String != "720p" {
+		t.Errorf("backfilled %+v", heat)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"transogov2/app/models"
 )
 
@@ -9,14 +10,69 @@ import (
 type MediaRepository interface {
 	SaveMedia(ctx context.Context, media *models.Media) (int64, error)
 	GetMediaByPath(ctx context.Context, path string) (models.Media, error)
+	GetMediaByID(ctx context.Context, id int64) (models.Media, error)
+	GetMediaChildren(ctx context.Context, parentID int64) ([]models.Media, error)
+	LinkMedia(ctx context.Context, id int64, parentID, part sql.NullInt64) error
+	GetMediaVersions(ctx context.Context, id int64) ([]models.Media, error)
+	SetMediaVersionOf(ctx context.Context, id int64, versionOf sql.NullInt64) error
+	GetAllMedia(ctx context.Context) ([]models.Media, error)
+	GetMediaUnder(ctx context.Context, path string) ([]models.Media, error)
+	GetMediaIn(ctx context.Context, dir string) ([]models.Media, error)
+	GetMoviesByTitle(ctx context.Context, title string) ([]models.Media, error)
+	GetMediaByType(ctx context.Context, mediaType string) ([]models.Media, error)
+	UpdateMediaMetadata(ctx context.Context, id int64, meta models.Metadata) error
+	GetMediaWithoutRelease(ctx context.Context) ([]models.Media, error)
+	SetMediaRelease(ctx context.Context, id int64, release models.Release) error
+	SetMediaArtwork(ctx context.Context, id int64, poster, fanart sql.NullString) error
+	SetMediaMetadataLookup(ctx context.Context, id int64, lookup models.MetadataLookup) error
+	SetMediaMissingSince(ctx context.Context, id int64, since sql.NullTime) error
+	DeleteMedia(ctx context.Context, id int64) error
+	FindMissingMediaByFingerprint(ctx context.Context, fingerprint string) (models.Media, error)
+	UpdateMediaPath(ctx context.Context, id int64, path string) error
+	UpdateMediaFingerprint(ctx context.Context, id int64, fingerprint string) error
+	SaveMediaInfo(ctx context.Context, id int64, info models.MediaInfo) error
+	GetMediaStreams(ctx context.Context, mediaID int64) ([]models.MediaStream, error)
+	GetMediaChapters(ctx context.Context, mediaID int64) ([]models.Chapter, error)
+	SetMediaSubtitles(ctx context.Context, mediaID int64, subtitles []models.Subtitle) error
+	GetMediaSubtitles(ctx context.Context, mediaID int64) ([]models.Subtitle, error)
 	SaveTVShow(ctx context.Context, tvshow *models.TVShow) (int64, error)
 	GetTVShowByPath(ctx context.Context, path string) (models.TVShow, error)
 	GetAllTVShows(ctx context.Context) ([]models.TVShow, error)
 	GetTVShowByID(ctx context.Context, id int64) (models.TVShow, error)
+	UpdateTVShowMetadata(ctx context.Context, id int64, meta models.Metadata) error
+	SetTVShowArtwork(ctx context.Context, id int64, poster, fanart sql.NullString) error
+	SetTVShowMetadataLookup(ctx context.Context, id int64, lookup models.MetadataLookup) error
+	SetTVShowEpisodeOrder(ctx context.Context, id int64, order string) error
+	DeleteTVShowIfEmpty(ctx context.Context, id int64) (bool, error)
 	GetSeasonsByTVShowID(ctx context.Context, tvshowID int64) ([]models.Season, error)
+	GetSeasonByID(ctx context.Context, id int64) (models.Season, error)
 	GetSeasonByPath(ctx context.Context, path string) (models.Season, error)
+	GetSeasonByPathAndNumber(ctx context.Context, path string, number int) (models.Season, error)
 	SaveSeason(ctx context.Context, season *models.Season) (int64, error)
+	SetSeasonPoster(ctx context.Context, id int64, poster sql.NullString) error
+	DeleteSeasonIfEmpty(ctx context.Context, id int64) (int64, error)
 	GetEpisodesBySeasonID(ctx context.Context, seasonID int64) ([]models.Episode, error)
 	GetEpisodeByPath(ctx context.Context, path string) (models.Episode, error)
 	SaveEpisode(ctx context.Context, episode *models.Episode) (int64, error)
+	GetAllEpisodes(ctx context.Context) ([]models.Episode, error)
+	GetEpisodesUnder(ctx context.Context, path string) ([]models.Episode, error)
+	SetEpisodeMissingSince(ctx context.Context, id int64, since sql.NullTime) error
+	DeleteEpisode(ctx context.Context, id int64) error
+	FindMissingEpisodeByFingerprint(ctx context.Context, fingerprint string) (models.Episode, error)
+	UpdateEpisodeMetadata(ctx context.Context, id int64, meta models.Metadata) error
+	UpdateEpisodePath(ctx context.Context, id, seasonID int64, path string) error
+	UpdateEpisodeFingerprint(ctx context.Context, id int64, fingerprint string) error
+	SetEpisodeNamedSeason(ctx context.Context, id int64, season sql.NullInt64) error
+	SaveEpisodeInfo(ctx context.Context, id int64, info models.MediaInfo) error
+	GetEpisodeStreams(ctx context.Context, episodeID int64) ([]models.MediaStream, error)
+	SetEpisodeSubtitles(ctx context.Context, episodeID int64, subtitles []models.Subtitle) error
+	GetEpisodeSubtitles(ctx context.Context, episodeID int64) ([]models.Subtitle, error)
+	GetSeasonSubtitles(ctx context.Context, seasonID int64) ([]models.Subtitle, error)
+	GetSubtitleByID(ctx context.Context, id int64) (models.Subtitle, error)
+	CreateScanRun(ctx context.Context, run *models.ScanRun) (int64, error)
+	FinishScanRun(ctx context.Context, run *models.ScanRun) error
+	GetRecentScanRuns(ctx context.Context, limit int) ([]models.ScanRun, error)
+	GetScanStates(ctx context.Context) ([]models.ScanState, error)
+	SaveScanStates(ctx context.Context, states []models.ScanState) error
+	DeleteScanStates(ctx context.Context, paths []string) error
 }
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"transogov2/app/models"
+)
+
+// scanCache remembers the modification time of every library directory and the
+// size and modification time of every video file as of the last scan. A directory
+// whose modification time and ignore rules have not changed still has the same
+// entries, so it is not read again and its files are not looked up in the database.
+//
+// Files rewritten in place without touching their directory are only noticed by
+// a full rescan, which ignores the cache.
+type scanCache struct {
+	full     bool
+	filter   *scanFilter
+	prev     map[string]models.ScanState
+	children map[string][]string // directory -> cached entries inside it, sorted
+
+	mu        sync.Mutex
+	next      map[string]models.ScanState
+	expected  map[string]bool // files handed to the scanner
+	failed    []string        // directories that could not be read
+	unchanged int             // files skipped because they had not changed
+}
+
+// loadScanCache loads the state recorded by previous scans. A full rescan treats
+// everything as changed but still records state for the scans after it.
+func loadScanCache(ctx context.Context, repo MediaRepository, filter *scanFilter, full bool) *scanCache {
+	c := &scanCache{
+		full:     full,
+		filter:   filter,
+		prev:     make(map[string]models.ScanState),
+		children: make(map[string][]string),
+		next:     make(map[string]models.ScanState),
+		expected: make(map[string]bool),
+	}
+
+	states, err := repo.GetScanStates(ctx)
+	if err != nil {
+		// Without the cache every directory is simply scanned again
+		log.Printf("Error loading scan state: %v", err)
+		return c
+	}
+	for _, state := range states {
+		c.prev[state.Path] = state
+		parent := filepath.Dir(state.Path)
+		c.children[parent] = append(c.children[parent], state.Path)
+	}
+	for _, paths := range c.children {
+		sort.Strings(paths)
+	}
+	return c
+}
+
+// rescansAll reports whether the scan looks at every file, ignoring the cache
+func (c *scanCache) rescansAll() bool {
+	return c == nil || c.full
+}
+
+// dirUnchanged reports whether dir has the modification time and ignore rules
+// recorded by the last scan
+func (c *scanCache) dirUnchanged(dir string, info fs.FileInfo) bool {
+	if c == nil || c.full {
+		return false
+	}
+	state, ok := c.prev[dir]
+	return ok && state.IsDir && state.ModTime == info.ModTime().UnixNano() && state.Rules == c.filter.stamp(dir)
+}
+
+// fileUnchanged reports whether file has the size, modification time and
+// sidecar files recorded by the last scan
+func (c *scanCache) fileUnchanged(file MediaFile) bool {
+	if c == nil || c.full {
+		return false
+	}
+	state, ok := c.prev[file.Path]
+	return ok && !state.IsDir && state.Size == file.Size && state.ModTime == file.ModTime.UnixNano() && state.Sidecars == file.Sidecars
+}
+
+// treeUnchanged reports whether dir and every cached directory below it are unchanged
+func (c *scanCache) treeUnchanged(dir string) bool {
+	if c == nil || c.full {
+		return false
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !c.dirUnchanged(dir, info) {
+		return false
+	}
+	for _, child := range c.children[dir] {
+		if c.prev[child].IsDir && !c.treeUnchanged(child) {
+			return false
+		}
+	}
+	return true
+}
+
+// subtitlesUnchanged reports whether the cached subtitle folders in dir, such as
+// "Subs", are unchanged. Adding a file to one leaves dir as it was, but the
+// videos in dir pick it up.
+func (c *scanCache) subtitlesUnchanged(dir string) bool {
+	if c == nil {
+		return false
+	}
+	for _, child := range c.children[dir] {
+		if c.prev[child].IsDir && isSubtitleDir(filepath.Base(child)) && !c.treeUnchanged(child) {
+			return false
+		}
+	}
+	return true
+}
+
+// keep carries a cached entry over to the next scan state
+func (c *scanCache) keep(path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next[path] = c.prev[path]
+	if !c.prev[path].IsDir {
+		c.unchanged++
+	}
+}
+
+// keepTree carries dir and every cached entry below it over to the next scan state
+func (c *scanCache) keepTree(dir string) {
+	if c == nil {
+		return
+	}
+	c.keep(dir)
+	for _, child := range c.children[dir] {
+		if c.prev[child].IsDir {
+			c.keepTree(child)
+		} else {
+			c.keep(child)
+		}
+	}
+}
+
+// recordDir records the state of a directory that was read
+func (c *scanCache) recordDir(dir string, info fs.FileInfo) {
+	if c == nil {
+		return
+	}
+	rules := c.filter.stamp(dir)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next[dir] = models.ScanState{Path: dir, IsDir: true, ModTime: info.ModTime().UnixNano(), Rules: rules}
+}
+
+// expect records that a file was handed to the scanner
+func (c *scanCache) expect(path string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expected[path] = true
+}
+
+// scanned records the state of a file that was scanned successfully
+func (c *scanCache) scanned(file MediaFile) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.next[file.Path] = models.ScanState{Path: file.Path, Size: file.Size, ModTime: file.ModTime.UnixNano(), Sidecars: file.Sidecars}
+}
+
+// fail records a directory that could not be scanned completely. Its recorded
+// state is dropped so it is read again next time, but cached entries below it
+// are kept: they are not known to be gone.
+func (c *scanCache) fail(dir string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failed = append(c.failed, dir)
+}
+
+// Unchanged is the number of files skipped because they had not changed
+func (c *scanCache) Unchanged() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.unchanged
+}
+
+// save persists what changed below roots. A directory is only recorded once every
+// file below it was scanned successfully; otherwise its state and that of its
+// parents is dropped so the files that failed are retried next time. After an
+// incomplete (cancelled) scan no directory states are recorded.
+func (c *scanCache) save(ctx context.Context, repo MediaRepository, roots []string, complete bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	dirty := make(map[string]bool)
+	markDirty := func(dir string) {
+		for !dirty[dir] && underAny(dir, roots) {
+			dirty[dir] = true
+			dir = filepath.Dir(dir)
+		}
+	}
+	for path := range c.expected {
+		if _, ok := c.next[path]; !ok {
+			markDirty(filepath.Dir(path))
+		}
+	}
+	for _, dir := range c.failed {
+		markDirty(dir)
+	}
+
+	var changed []models.ScanState
+	for path, state := range c.next {
+		if state.IsDir && (!complete || dirty[path]) {
+			continue
+		}
+		if prev, ok := c.prev[path]; ok && prev == state {
+			continue
+		}
+		changed = append(changed, state)
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].Path < changed[j].Path })
+
+	var deleted []string
+	for path := range c.prev {
+		switch {
+		case dirty[path]:
+		case !complete:
+			continue
+		case !underAny(path, roots), len(c.failed) > 0 && underAny(path, c.failed):
+			continue
+		default:
+			if _, ok := c.next[path]; ok {
+				continue
+			}
+		}
+		deleted = append(deleted, path)
+	}
+	sort.Strings(deleted)
+
+	if len(changed) > 0 {
+		if err := repo.SaveScanStates(ctx, changed); err != nil {
+			return err
+		}
+	}
+	if len(deleted) > 0 {
+		if err := repo.DeleteScanStates(ctx, deleted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
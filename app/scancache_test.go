@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"transogov2/app/models"
+)
+
+// lookupCountingRepo counts the per-file and per-directory database lookups
+type lookupCountingRepo struct {
+	*fakeRepo
+	lookups atomic.Int64
+}
+
+func (r *lookupCountingRepo) GetMediaByPath(ctx context.Context, path string) (models.Media, error) {
+	r.lookups.Add(1)
+	return r.fakeRepo.GetMediaByPath(ctx, path)
+}
+
+func (r *lookupCountingRepo) GetEpisodeByPath(ctx context.Context, path string) (models.Episode, error) {
+	r.lookups.Add(1)
+	return r.fakeRepo.GetEpisodeByPath(ctx, path)
+}
+
+func (r *lookupCountingRepo) GetTVShowByPath(ctx context.Context, path string) (models.TVShow, error) {
+	r.lookups.Add(1)
+	return r.fakeRepo.GetTVShowByPath(ctx, path)
+}
+
+func (r *lookupCountingRepo) GetSeasonByPath(ctx context.Context, path string) (models.Season, error) {
+	r.lookups.Add(1)
+	return r.fakeRepo.GetSeasonByPath(ctx, path)
+}
+
+// scanCounting runs a scan and returns its summary and the number of lookups made
+func scanCounting(t *testing.T, repo *lookupCountingRepo, cfg *ScanConfig, full bool) (ScanSummary, int64) {
+	t.Helper()
+	repo.lookups.Store(0)
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return summary, repo.lookups.Load()
+}
+
+func TestScanMediaSkipsUnchangedDirectories(t *testing.T) {
+	cfg := newTestLibrary(t)
+	generateLibrary(t, cfg, 5, 2, 2, 3)
+	writeFile(t, filepath.Join(cfg.TVDir, "Flat Show", "Flat.Show.E01.mkv"), "flat episode")
+	repo := &lookupCountingRepo{fakeRepo: newFakeRepo()}
+
+	summary, _ := scanCounting(t, repo, cfg, false)
+	if summary.Added != 18 {
+		t.Fatalf("first scan added %d, want 18", summary.Added)
+	}
+
+	summary, lookups := scanCounting(t, repo, cfg, false)
+	if lookups != 0 {
+		t.Errorf("rescan of an unchanged library made %d lookups, want 0", lookups)
+	}
+	if summary.Unchanged != 18 || summary.Added != 0 {
+		t.Errorf("rescan = %+v, want 18 unchanged and nothing added", summary)
+	}
+
+	// A new episode only rescans its own season
+	newEpisode := filepath.Join(cfg.TVDir, "Show 01", "Season 2", "Show 01.S02E04.mkv")
+	writeFile(t, newEpisode, "new episode")
+	summary, lookups = scanCounting(t, repo, cfg, false)
+	if summary.Added != 1 || summary.Unchanged != 18 {
+		t.Errorf("rescan after adding an episode = %+v, want 1 added, 18 unchanged", summary)
+	}
+	// The show, the season and the new file; its unchanged neighbours are skipped
+	if lookups != 3 {
+		t.Errorf("rescan after adding an episode made %d lookups, want 3", lookups)
+	}
+	if _, err := repo.GetEpisodeByPath(context.Background(), newEpisode); err != nil {
+		t.Errorf("new episode not saved: %v", err)
+	}
+
+	// A full rescan ignores the cache
+	summary, lookups = scanCounting(t, repo, cfg, true)
+	if summary.Unchanged != 0 || lookups < 19 {
+		t.Errorf("full rescan = %+v with %d lookups, want every file looked up", summary, lookups)
+	}
+}
+
+func TestScanMediaForgetsRemovedFiles(t *testing.T) {
+	cfg := newTestLibrary(t)
+	generateLibrary(t, cfg, 2, 1, 1, 2)
+	repo := &lookupCountingRepo{fakeRepo: newFakeRepo()}
+	scanCounting(t, repo, cfg, false)
+
+	removedDir := filepath.Join(cfg.MoviesDir, "Movie 001 (2001)")
+	removed := filepath.Join(removedDir, "Movie 001 (2001).mkv")
+	if _, ok := repo.states[removed]; !ok {
+		t.Fatalf("scan state for %s was not recorded", removed)
+	}
+	if err := os.RemoveAll(removedDir); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, _ := scanCounting(t, repo, cfg, false)
+	if summary.Reconcile.Missing != 1 {
+		t.Errorf("rescan = %+v, want 1 missing", summary)
+	}
+	for _, path := range []string{removedDir, removed} {
+		if _, ok := repo.states[path]; ok {
+			t.Errorf("scan state for removed %s was kept", path)
+		}
+	}
+	if _, ok := repo.states[cfg.MoviesDir]; !ok {
+		t.Errorf("scan state for the movies directory is missing")
+	}
+}
+
+// failingSaveRepo fails to save media at the given path until told otherwise
+type failingSaveRepo struct {
+	*fakeRepo
+	fail atomic.Value // path
+}
+
+func (r *failingSaveRepo) SaveMedia(ctx context.Context, media *models.Media) (int64, error) {
+	if path, _ := r.fail.Load().(string); path == media.Path {
+		return 0, errors.New("database unavailable")
+	}
+	return r.fakeRepo.SaveMedia(ctx, media)
+}
+
+func TestScanMediaRetriesFailedFiles(t *testing.T) {
+	cfg := newTestLibrary(t)
+	for i := 0; i < 3; i++ {
+		writeFile(t, filepath.Join(cfg.MoviesDir, "Collection", "Nested", fmt.Sprintf("Movie.%d.mkv", i)), fmt.Sprintf("movie %d", i))
+	}
+	failing := filepath.Join(cfg.MoviesDir, "Collection", "Nested", "Movie.1.mkv")
+	repo := &failingSaveRepo{fakeRepo: newFakeRepo()}
+	repo.fail.Store(failing)
+
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 2 || summary.Errors != 1 {
+		t.Fatalf("first scan = %+v, want 2 added, 1 error", summary)
+	}
+	// Neither the directory nor its parents may be considered up to date
+	for _, dir := range []string{cfg.MoviesDir, filepath.Join(cfg.MoviesDir, "Collection"), filepath.Dir(failing)} {
+		if _, ok := repo.states[dir]; ok {
+			t.Errorf("scan state recorded for %s although a file in it failed", dir)
+		}
+	}
+
+	repo.fail.Store("")
+	summary, err = ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 1 || summary.Unchanged != 2 {
+		t.Errorf("second scan = %+v, want the failed file added and 2 unchanged", summary)
+	}
+	if _, ok := repo.states[filepath.Dir(failing)]; !ok {
+		t.Errorf("scan state not recorded once every file was scanned")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"transogov2/app/models"
+)
+
+// scanHistoryLimit is the number of past runs reported by ScanJobs.Status
+const scanHistoryLimit = 10
+
+// ScanStatus describes the running scan, if any, and recent scan history
+type ScanStatus struct {
+	Running bool
+	Current models.ScanRun   // valid when Running
+	History []models.ScanRun // newest first; includes the current run
+}
+
+// ScanJobs runs media scans one at a time and records every run in the database.
+// Requests to start a scan while one is running are coalesced into the running job.
+type ScanJobs struct {
+	repo MediaRepository
+	// scan and scanPaths perform full and incremental scans; replaced in tests
+	scan      func(ctx context.Context, full bool) (ScanSummary, error)
+	scanPaths func(ctx context.Context, paths []string) (ScanSummary, error)
+
+	mu      sync.Mutex
+	current *models.ScanRun
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// NewScanJobs creates a new ScanJobs manager whose scans publish progress on bus
+func NewScanJobs(repo MediaRepository, cfg *ScanConfig, bus *EventBus) *ScanJobs {
+	return &ScanJobs{
+		repo: repo,
+		scan: func(ctx context.Context, full bool) (ScanSummary, error) {
+			return ScanMedia(ctx, repo, cfg, bus, full)
+		},
+		scanPaths: func(ctx context.Context, paths []string) (ScanSummary, error) {
+			return ScanPaths(ctx, repo, cfg, bus, paths)
+		},
+	}
+}
+
+// Start starts a scan in the background; a full scan ignores the state recorded
+// by previous scans. If a scan is already running no new scan is started and the
+// running one is returned with started set to false.
+func (j *ScanJobs) Start(full bool) (run models.ScanRun, started bool) {
+	return j.start(func(ctx context.Context) (ScanSummary, error) { return j.scan(ctx, full) })
+}
+
+// ScanPaths runs an incremental scan of the given library paths and waits for it
+// to finish. Unlike Start it never coalesces: if another scan is running it waits
+// for that scan to finish first, since the changes may have been missed by it.
+func (j *ScanJobs) ScanPaths(paths []string) {
+	scan := func(ctx context.Context) (ScanSummary, error) { return j.scanPaths(ctx, paths) }
+	for {
+		j.Wait()
+		if _, started := j.start(scan); started {
+			j.Wait()
+			return
+		}
+	}
+}
+
+// start runs scan in the background unless a scan is already running
+func (j *ScanJobs) start(scan func(ctx context.Context) (ScanSummary, error)) (run models.ScanRun, started bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.current != nil {
+		return *j.current, false
+	}
+
+	current := &models.ScanRun{StartedAt: time.Now(), Status: models.ScanStatusRunning}
+	id, err := j.repo.CreateScanRun(context.Background(), current)
+	if err != nil {
+		// The scan itself can still run; it just won't appear in the history
+		log.Printf("Error recording scan run: %v", err)
+	}
+	current.ID = id
+	j.current = current
+	j.done = make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+
+	go j.run(ctx, current, scan, j.done)
+	return *current, true
+}
+
+// run performs a scan and records its outcome
+func (j *ScanJobs) run(ctx context.Context, run *models.ScanRun, scan func(ctx context.Context) (ScanSummary, error), done chan struct{}) {
+	defer close(done)
+
+	summary, err := scan(ctx)
+
+	j.mu.Lock()
+	run.FinishedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	run.Added = summary.Added
+	run.Updated = summary.Updated()
+	run.Removed = summary.Removed()
+	run.Errors = summary.Errors
+	run.Warnings = len(summary.Warnings)
+	run.Status = models.ScanStatusCompleted
+	switch {
+	case ctx.Err() != nil && errors.Is(err, context.Canceled):
+		run.Status = models.ScanStatusCancelled
+	case err != nil:
+		run.Status = models.ScanStatusFailed
+		run.Error = sql.NullString{String: err.Error(), Valid: true}
+	}
+	finished := *run
+	j.current = nil
+	j.cancel()
+	j.cancel = nil
+	j.mu.Unlock()
+
+	if finished.ID != 0 {
+		if err := j.repo.FinishScanRun(context.Background(), &finished); err != nil {
+			log.Printf("Error recording scan run %d: %v", finished.ID, err)
+		}
+	}
+}
+
+// Cancel stops the running scan and waits for it to finish. It returns the
+// recorded run, or false if no scan was running.
+func (j *ScanJobs) Cancel() (run models.ScanRun, cancelled bool) {
+	j.mu.Lock()
+	current, done := j.current, j.done
+	if current == nil {
+		j.mu.Unlock()
+		return models.ScanRun{}, false
+	}
+	j.cancel()
+	j.mu.Unlock()
+
+	<-done
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return *current, true
+}
+
+// Wait blocks until the running scan, if any, has finished
+func (j *ScanJobs) Wait() {
+	j.mu.Lock()
+	done := j.done
+	j.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Status reports the running scan and recent history
+func (j *ScanJobs) Status(ctx context.Context) (ScanStatus, error) {
+	var status ScanStatus
+	j.mu.Lock()
+	if j.current != nil {
+		status.Running = true
+		status.Current = *j.current
+	}
+	j.mu.Unlock()
+
+	history, err := j.repo.GetRecentScanRuns(ctx, scanHistoryLimit)
+	if err != nil {
+		return status, err
+	}
+	status.History = history
+	return status, nil
+}
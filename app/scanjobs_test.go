@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"transogov2/app/models"
+)
+
+func TestScanJobsCoalescesConcurrentStarts(t *testing.T) {
+	repo := newFakeRepo()
+	jobs := NewScanJobs(repo, &ScanConfig{}, nil)
+
+	release := make(chan struct{})
+	calls := 0
+	jobs.scan = func(context.Context, bool) (ScanSummary, error) {
+		calls++
+		<-release
+		return ScanSummary{Added: 3, Moved: 1, Errors: 2, Reconcile: ReconcileResult{Purged: 4}}, nil
+	}
+
+	first, started := jobs.Start(false)
+	if !started {
+		t.Fatal("first Start did not start a scan")
+	}
+	second, started := jobs.Start(false)
+	if started {
+		t.Fatal("second Start started a concurrent scan")
+	}
+	if second.ID != first.ID {
+		t.Errorf("second Start returned run %d, want running run %d", second.ID, first.ID)
+	}
+
+	status, err := jobs.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running || status.Current.ID != first.ID {
+		t.Errorf("status = %+v, want run %d running", status, first.ID)
+	}
+
+	close(release)
+	jobs.Wait()
+
+	if calls != 1 {
+		t.Errorf("scan ran %d times, want 1", calls)
+	}
+	status, err = jobs.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Running {
+		t.Errorf("status still running after the scan finished")
+	}
+	if len(status.History) != 1 {
+		t.Fatalf("history has %d runs, want 1", len(status.History))
+	}
+	run := status.History[0]
+	if run.Status != models.ScanStatusCompleted || !run.FinishedAt.Valid {
+		t.Errorf("run = %+v, want completed with a finish time", run)
+	}
+	if run.Added != 3 || run.Updated != 1 || run.Removed != 4 || run.Errors != 2 {
+		t.Errorf("run counts = %d added, %d updated, %d removed, %d errors; want 3, 1, 4, 2",
+			run.Added, run.Updated, run.Removed, run.Errors)
+	}
+}
+
+func TestScanJobsRecordsFailures(t *testing.T) {
+	repo := newFakeRepo()
+	jobs := NewScanJobs(repo, &ScanConfig{}, nil)
+	jobs.scan = func(context.Context, bool) (ScanSummary, error) {
+		return ScanSummary{}, errors.New("database unavailable")
+	}
+
+	jobs.Start(false)
+	jobs.Wait()
+
+	// A new scan can start once the previous one finished
+	jobs.scan = func(context.Context, bool) (ScanSummary, error) { return ScanSummary{}, nil }
+	if _, started := jobs.Start(false); !started {
+		t.Fatal("Start after a finished scan did not start a new scan")
+	}
+	jobs.Wait()
+
+	status, err := jobs.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status.History) != 2 {
+		t.Fatalf("history has %d runs, want 2", len(status.History))
+	}
+	failed := status.History[1]
+	if failed.Status != models.ScanStatusFailed || failed.Error.String != "database unavailable" {
+		t.Errorf("failed run = %+v, want failed with error message", failed)
+	}
+	if status.History[0].Status != models.ScanStatusCompleted {
+		t.Errorf("latest run status = %q, want completed", status.History[0].Status)
+	}
+}
+
+func TestScanJobsCancel(t *testing.T) {
+	repo := newFakeRepo()
+	jobs := NewScanJobs(repo, &ScanConfig{}, nil)
+	jobs.scan = func(ctx context.Context, full bool) (ScanSummary, error) {
+		<-ctx.Done()
+		return ScanSummary{Added: 2}, ctx.Err()
+	}
+
+	if _, cancelled := jobs.Cancel(); cancelled {
+		t.Fatal("Cancel reported a cancelled scan while none was running")
+	}
+
+	started, _ := jobs.Start(false)
+	run, cancelled := jobs.Cancel()
+	if !cancelled {
+		t.Fatal("Cancel did not cancel the running scan")
+	}
+	if run.ID != started.ID || run.Status != models.ScanStatusCancelled || run.Added != 2 || run.Error.Valid {
+		t.Errorf("cancelled run = %+v, want run %d cancelled with 2 added and no error", run, started.ID)
+	}
+
+	status, err := jobs.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Running {
+		t.Errorf("status still running after Cancel returned")
+	}
+	if len(status.History) != 1 || status.History[0].Status != models.ScanStatusCancelled {
+		t.Errorf("history = %+v, want one cancelled run", status.History)
+	}
+}
@@ -2,51 +2,151 @@ package main
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"transogov2/app/mediainfo"
 	"transogov2/app/models"
 )
 
 // MediaFile represents a media file
 type MediaFile struct {
-	Path string
-	Size int64
+	Path    string
+	Size    int64
+	ModTime time.Time
+	// Sidecars hashes the files read with the video, such as its NFO file, so
+	// that adding one brings an unchanged video back into an incremental scan
+	Sidecars int64
 }
 
-// ScanMediaDirectory scans a directory for media files
-func ScanMediaDirectory(dir, mediaType string) ([]MediaFile, error) {
-	var files []MediaFile
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			log.Printf("Error walking path %s: %v", path, err)
-			return err
+// walkMediaFiles walks a directory in lexical order and calls fn for every video
+// file not excluded by filter. Walking stops at the first error returned by fn or
+// when ctx is cancelled. With a cache, directories and files unchanged since the
+// last scan are skipped; a file whose sidecar files changed is not unchanged.
+func walkMediaFiles(ctx context.Context, filter *scanFilter, cache *scanCache, dir string, fn func(MediaFile) error) error {
+	err := walkDir(ctx, filter, cache, dir, fn)
+	if err != nil {
+		cache.fail(dir)
+		if ctx.Err() == nil {
+			log.Printf("Error walking directory %s: %v", dir, err)
 		}
-		if !info.IsDir() {
-			// Check if it's a video file
-			ext := strings.ToLower(filepath.Ext(path))
-			if isVideoFile(ext) {
-				files = append(files, MediaFile{Path: path, Size: info.Size()})
+	}
+	return err
+}
+
+// walkDir walks dir, which may also be a single file, for walkMediaFiles
+func walkDir(ctx context.Context, filter *scanFilter, cache *scanCache, dir string, fn func(MediaFile) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		log.Printf("Error walking path %s: %v", dir, err)
+		return err
+	}
+	if !info.IsDir() {
+		var sidecars *sidecarIndex
+		if cache != nil {
+			entries, _ := os.ReadDir(filepath.Dir(dir))
+			sidecars = newSidecarIndex(filepath.Dir(dir), entries)
+		}
+		return walkFile(filter, cache, sidecars, dir, info, fn)
+	}
+
+	if cache.dirUnchanged(dir, info) && cache.subtitlesUnchanged(dir) {
+		// Same entries as last time: no need to read the directory
+		cache.keep(dir)
+		for _, child := range cache.children[dir] {
+			isDir := cache.prev[child].IsDir
+			if filter.ignored(child, isDir) {
+				// Excluded since the last scan
+				continue
+			}
+			if !isDir {
+				cache.keep(child)
+				continue
+			}
+			if err := walkDir(ctx, filter, cache, child, fn); err != nil {
+				return err
 			}
 		}
 		return nil
-	})
+	}
+
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		log.Printf("Error walking directory %s: %v", dir, err)
-		return nil, err
+		log.Printf("Error walking path %s: %v", dir, err)
+		return err
+	}
+	var sidecars *sidecarIndex
+	if cache != nil {
+		sidecars = newSidecarIndex(dir, entries)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if filter.ignored(path, entry.IsDir()) {
+			continue
+		}
+		if entry.IsDir() {
+			if err := walkDir(ctx, filter, cache, path, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			log.Printf("Error reading file info %s: %v", path, err)
+			return err
+		}
+		if err := walkFile(filter, cache, sidecars, path, info, fn); err != nil {
+			return err
+		}
 	}
-	return files, nil
+	cache.recordDir(dir, info)
+	return nil
 }
 
-// isVideoFile checks if a file extension is a video format
+// walkFile calls fn for a video file unless it is too small to be more than a
+// sample or it and its sidecar files are unchanged since the last scan. Extras
+// such as trailers are often small, so they are kept whatever their size.
+func walkFile(filter *scanFilter, cache *scanCache, sidecars *sidecarIndex, path string, info fs.FileInfo, fn func(MediaFile) error) error {
+	// Check the size first: sniffing has to open the file
+	root, _ := filter.root(path)
+	if filter.tooSmall(info.Size()) && !isExtra(root, path) || !filter.isVideo(path) {
+		return nil
+	}
+	file := MediaFile{Path: path, Size: info.Size(), ModTime: info.ModTime(), Sidecars: sidecars.stamp(path)}
+	if cache.fileUnchanged(file) {
+		cache.keep(path)
+		return nil
+	}
+	cache.expect(path)
+	return fn(file)
+}
+
+// defaultVideoExtensions are the file extensions recognised as video unless a
+// library is configured with its own list
+var defaultVideoExtensions = []string{
+	".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".webm", ".m4v",
+	".ts", ".m2ts", ".mts", ".mpg", ".mpeg", ".ogv", ".3gp",
+}
+
+// isVideoFile checks if a file extension is one of the default video formats
 func isVideoFile(ext string) bool {
-	videoExts := []string{".mp4", ".mkv", ".avi", ".mov", ".wmv", ".flv", ".webm", ".m4v"}
-	for _, videoExt := range videoExts {
+	for _, videoExt := range defaultVideoExtensions {
 		if ext == videoExt {
 			return true
 		}
@@ -54,192 +154,883 @@ func isVideoFile(ext string) bool {
 	return false
 }
 
-// ScanMedia scans all media directories
-func ScanMedia(repo MediaRepository, moviesDir, tvDir string) {
+// ScanSummary counts what a scan changed
+type ScanSummary struct {
+	Added     int // new media and episode rows
+	Moved     int // existing rows whose file was found at a new path
+	Errors    int // files or directories that could not be scanned or saved
+	Unchanged int // files skipped because they had not changed since the last scan
+	Reconcile ReconcileResult
+	// Warnings describe files that were scanned but look misplaced, such as an
+	// episode whose name gives a different season from its season folder
+	Warnings []string
+}
+
+// Updated is the number of existing rows the scan changed
+func (s ScanSummary) Updated() int {
+	return s.Moved + s.Reconcile.Restored
+}
+
+// Removed is the number of rows the scan deleted
+func (s ScanSummary) Removed() int {
+	return s.Reconcile.Purged
+}
+
+// scanSession holds the state shared by every stage of a single scan: the worker
+// pool that processes files, the running summary and progress publishing
+type scanSession struct {
+	ctx    context.Context
+	bus    *EventBus
+	filter *scanFilter
+	cache  *scanCache
+	dirs   *dirListings
+	prober mediainfo.Prober
+	jobs   chan func()
+	wg     sync.WaitGroup
+
+	mu        sync.Mutex
+	summary   ScanSummary
+	dir       string
+	seen      int
+	moves     []pendingMove
+	vacated   []int64
+	movieDirs map[string]bool // movie folders with files added, changed or gone
+	// lookups are the movies and TV shows added or rescanned, whose metadata
+	// matchMetadata may look up
+	lookups map[lookupKey]bool
+}
+
+// lookupKey names a movie or TV show for metadata lookup
+type lookupKey struct {
+	tvShow bool
+	id     int64
+}
+
+// pendingMove is a new file whose fingerprint matched a missing row when it was
+// examined. Moves are resolved after the worker pool drains, in path order, so
+// which of several identical files inherits a row never depends on scheduling.
+type pendingMove struct {
+	path    string
+	resolve func()
+}
+
+// newScanSession starts a scan session with the given number of workers
+func newScanSession(ctx context.Context, bus *EventBus, filter *scanFilter, cache *scanCache, workers int) *scanSession {
+	s := &scanSession{ctx: ctx, bus: bus, filter: filter, cache: cache, dirs: &dirListings{}, jobs: make(chan func(), max(workers, 1))}
+	for i := 0; i < max(workers, 1); i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for job := range s.jobs {
+				if s.ctx.Err() == nil {
+					job()
+				}
+			}
+		}()
+	}
+	return s
+}
+
+// submit queues a job for the worker pool, blocking while every worker is busy.
+// It returns the context's error once the scan has been cancelled.
+func (s *scanSession) submit(job func()) error {
+	select {
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	case s.jobs <- job:
+		return nil
+	}
+}
+
+// drain waits for the worker pool to finish, resolves pending moves, links movie
+// parts and extras to their movies and removes seasons that were left empty by
+// episodes moving elsewhere
+func (s *scanSession) drain(repo MediaRepository) {
+	close(s.jobs)
+	s.wg.Wait()
+
+	sort.Slice(s.moves, func(i, j int) bool { return s.moves[i].path < s.moves[j].path })
+	for _, m := range s.moves {
+		if s.ctx.Err() != nil {
+			break
+		}
+		m.resolve()
+	}
+	s.moves = nil
+
+	// A full scan links every movie; otherwise only the folders that changed
+	// need it
+	if s.ctx.Err() == nil && (s.cache.rescansAll() || len(s.movieDirs) > 0) {
+		var dirs []string
+		if !s.cache.rescansAll() {
+			dirs = slices.Sorted(maps.Keys(s.movieDirs))
+		}
+		if err := linkMovies(s.ctx, repo, s.filter, dirs); err != nil {
+			log.Printf("Error linking movie parts and extras: %v", err)
+			s.fail()
+		}
+	}
+
+	// Finish this even when cancelled: nothing else would remove these seasons
+	if _, _, err := pruneEmptySeasons(context.WithoutCancel(s.ctx), repo, s.vacated); err != nil {
+		log.Printf("Error removing empty seasons: %v", err)
+		s.fail()
+	}
+	s.vacated = nil
+}
+
+// saveCache records the scan state below roots for the next incremental scan
+func (s *scanSession) saveCache(repo MediaRepository, roots []string) {
+	s.summary.Unchanged = s.cache.Unchanged()
+	complete := s.ctx.Err() == nil
+	if err := s.cache.save(context.WithoutCancel(s.ctx), repo, roots, complete); err != nil {
+		// The next scan just has more to do
+		log.Printf("Error saving scan state: %v", err)
+	}
+}
+
+// file records that a video file is being examined
+func (s *scanSession) file(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = filepath.Dir(path)
+	s.seen++
+	s.bus.Publish(Event{Name: EventScanProgress, Data: s.progress()})
+}
+
+// touchMovie records the movie folder of a movie file that was added, changed or
+// gone, so its movies are linked again
+func (s *scanSession) touchMovie(path string) {
+	root, ok := s.filter.root(path)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.movieDirs == nil {
+		s.movieDirs = make(map[string]bool)
+	}
+	s.movieDirs[movieFolder(root, path)] = true
+}
+
+// lookUp records a movie or TV show added or rescanned, so its metadata is
+// looked up once the scan is done
+func (s *scanSession) lookUp(key lookupKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lookups == nil {
+		s.lookups = make(map[lookupKey]bool)
+	}
+	s.lookups[key] = true
+}
+
+func (s *scanSession) add()  { s.mu.Lock(); s.summary.Added++; s.mu.Unlock() }
+func (s *scanSession) move() { s.mu.Lock(); s.summary.Moved++; s.mu.Unlock() }
+func (s *scanSession) fail() { s.mu.Lock(); s.summary.Errors++; s.mu.Unlock() }
+
+// warn logs and records a scan warning
+func (s *scanSession) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	log.Printf("Warning: %s", msg)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary.Warnings = append(s.summary.Warnings, msg)
+}
+
+// deferMove queues a possible move to be resolved once the worker pool drains
+func (s *scanSession) deferMove(path string, resolve func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moves = append(s.moves, pendingMove{path: path, resolve: resolve})
+}
+
+// vacate records a season an episode moved out of
+func (s *scanSession) vacate(seasonID int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.vacated = append(s.vacated, seasonID)
+}
+
+// finish publishes the final progress event of the scan, which ended with err
+// (nil if it completed)
+func (s *scanSession) finish(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = ""
+	progress := s.progress()
+	progress.Done = true
+	progress.Cancelled = s.ctx.Err() != nil
+	progress.Failed = err != nil && !progress.Cancelled
+	s.bus.Publish(Event{Name: EventScanProgress, Data: progress})
+}
+
+// progress reports how far the scan has got; the caller must hold s.mu
+func (s *scanSession) progress() ScanProgress {
+	return ScanProgress{
+		Dir:    s.dir,
+		Seen:   s.seen,
+		Added:  s.summary.Added,
+		Errors: s.summary.Errors,
+	}
+}
+
+// ScanMedia scans all media directories, publishing progress on bus (which may
+// be nil). Directories unchanged since the last scan are skipped unless full is
+// set. Problems with individual files are counted in the summary; the returned
+// error reports failures that leave the library only partially reconciled, or
+// ctx's error if the scan was cancelled.
+func ScanMedia(ctx context.Context, repo MediaRepository, cfg *ScanConfig, bus *EventBus, full bool) (ScanSummary, error) {
+	var scanErr error
+	now := time.Now()
+	filter := cfg.scanFilter()
+	s := newScanSession(ctx, bus, filter, loadScanCache(ctx, repo, filter, full), cfg.Workers)
+	s.prober = cfg.prober()
+
+	// Rows whose files vanished are only reconciled when both library roots are
+	// available; an unmounted NAS share would otherwise make everything look missing.
+	reconcile := dirAvailable(cfg.MoviesDir) && dirAvailable(cfg.TVDir)
+	if !reconcile {
+		log.Printf("Skipping missing file reconciliation: media directories unavailable")
+	} else {
+		// Mark vanished files first so the scan can match moved files against them
+		result, changed, err := markMissing(ctx, repo, s.filter, s.cache, now)
+		if err != nil {
+			log.Printf("Error marking missing files: %v", err)
+			scanErr = errors.Join(scanErr, fmt.Errorf("marking missing files: %w", err))
+		}
+		s.summary.Reconcile = result
+		for _, path := range changed {
+			s.touchMovie(path)
+		}
+	}
 
 	// Scan movies
-	ScanMovies(repo, moviesDir)
+	ScanMovies(ctx, repo, cfg.MoviesDir, s)
 
 	// Scan TV shows
-	ScanTVShows(repo, tvDir)
+	ScanTVShows(ctx, repo, cfg.TVDir, s)
+
+	// Wait for the worker pool before reconciling
+	s.drain(repo)
+	s.saveCache(repo, []string{cfg.MoviesDir, cfg.TVDir})
+
+	if err := ctx.Err(); err != nil {
+		// Leave purging to the next complete scan
+		s.finish(err)
+		log.Printf("Media scan cancelled: %d added, %d moved, %d unchanged, %d errors",
+			s.summary.Added, s.summary.Moved, s.summary.Unchanged, s.summary.Errors)
+		return s.summary, errors.Join(scanErr, err)
+	}
+
+	backfillReleases(ctx, repo, s)
+	if cfg.Metadata != nil {
+		matchMetadata(ctx, repo, cfg, s)
+	}
+
+	if reconcile {
+		if err := purgeMissing(ctx, repo, cfg.MissingGracePeriod, now, &s.summary.Reconcile); err != nil {
+			log.Printf("Error purging missing files: %v", err)
+			scanErr = errors.Join(scanErr, fmt.Errorf("purging missing files: %w", err))
+		}
+	}
 
-	fmt.Println("Media scan complete")
+	s.finish(scanErr)
+	summary := s.summary
+	log.Printf("Media scan complete: %d added, %d moved, %d unchanged, %d errors, %d warnings, %d missing, %d restored, %d purged, %d seasons and %d TV shows removed",
+		summary.Added, summary.Moved, summary.Unchanged, summary.Errors, len(summary.Warnings), summary.Reconcile.Missing, summary.Reconcile.Restored,
+		summary.Reconcile.Purged, summary.Reconcile.Seasons, summary.Reconcile.TVShows)
+	return summary, scanErr
 }
 
-// ScanMovies scans the movies directory
-func ScanMovies(repo MediaRepository, moviesDir string) {
-	movies, err := ScanMediaDirectory(moviesDir, models.MediaTypeMovie)
+// ScanPaths runs an incremental scan of the given paths, each of which must be a
+// movie or TV show entry directly inside one of the library roots (or a root
+// itself). Rows under those paths whose files vanished are marked missing so that
+// moves between them are detected; purging is left to full scans.
+func ScanPaths(ctx context.Context, repo MediaRepository, cfg *ScanConfig, bus *EventBus, paths []string) (ScanSummary, error) {
+	var scanErr error
+	filter := cfg.scanFilter()
+	s := newScanSession(ctx, bus, filter, loadScanCache(ctx, repo, filter, false), cfg.Workers)
+	s.prober = cfg.prober()
+
+	result, changed, err := markMissing(ctx, repo, s.filter, s.cache, time.Now(), paths...)
 	if err != nil {
+		log.Printf("Error marking missing files: %v", err)
+		scanErr = fmt.Errorf("marking missing files: %w", err)
+	}
+	s.summary.Reconcile = result
+	for _, path := range changed {
+		s.touchMovie(path)
+	}
+
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		if s.filter.excluded(path, dirAvailable(path)) {
+			continue
+		}
+		switch {
+		case path == cfg.TVDir:
+			ScanTVShows(ctx, repo, path, s)
+		case isWithin(cfg.TVDir, path):
+			if dirAvailable(path) {
+				scanTVShow(ctx, repo, path, s)
+			}
+		case isWithin(cfg.MoviesDir, path) || path == cfg.MoviesDir:
+			if _, err := os.Stat(path); err == nil {
+				ScanMovies(ctx, repo, path, s)
+			}
+		default:
+			log.Printf("Skipping %s: not inside a media directory", path)
+		}
+	}
+	s.drain(repo)
+	s.saveCache(repo, paths)
+
+	if err := ctx.Err(); err != nil {
+		scanErr = errors.Join(scanErr, err)
+	} else if cfg.Metadata != nil {
+		matchMetadata(ctx, repo, cfg, s)
+	}
+	s.finish(scanErr)
+	summary := s.summary
+	log.Printf("Incremental scan of %d paths complete: %d added, %d moved, %d unchanged, %d errors, %d missing, %d restored",
+		len(paths), summary.Added, summary.Moved, summary.Unchanged, summary.Errors, summary.Reconcile.Missing, summary.Reconcile.Restored)
+	return summary, scanErr
+}
+
+// isWithin reports whether path is strictly inside dir
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// dirAvailable reports whether dir exists and is a directory
+func dirAvailable(dir string) bool {
+	info, err := os.Stat(dir)
+	return err == nil && info.IsDir()
+}
+
+// ScanMovies walks the movies directory and queues every video file on the
+// session's worker pool
+func ScanMovies(ctx context.Context, repo MediaRepository, moviesDir string, s *scanSession) {
+	err := walkMediaFiles(ctx, s.filter, s.cache, moviesDir, func(movie MediaFile) error {
+		return s.submit(func() { scanMovieFile(ctx, repo, movie, s) })
+	})
+	if err != nil && ctx.Err() == nil {
 		log.Printf("Scan failed for %s: %v", moviesDir, err)
-		return
+		s.fail()
 	}
+}
 
-	for _, movie := range movies {
-		_, err := repo.GetMediaByPath(context.Background(), movie.Path)
-		if err == nil {
-			continue // File already exists
+// scanMovieFile adds a movie file to the database unless it is already known
+func scanMovieFile(ctx context.Context, repo MediaRepository, movie MediaFile, s *scanSession) {
+	s.file(movie.Path)
+	s.touchMovie(movie.Path)
+	existing, err := repo.GetMediaByPath(ctx, movie.Path)
+	if err == nil {
+		// File already exists; backfill the fingerprint for rows saved before
+		// fingerprints were recorded so they can be followed if moved later
+		if !existing.Fingerprint.Valid {
+			if fp, err := fileFingerprint(movie.Path, movie.Size); err == nil {
+				if err := repo.UpdateMediaFingerprint(ctx, existing.ID, fp); err != nil {
+					log.Printf("Error saving fingerprint for %s: %v", movie.Path, err)
+					s.fail()
+					return
+				}
+			}
+		}
+		if !existing.DurationMS.Valid {
+			probeMovie(ctx, repo, existing.ID, movie.Path, s)
 		}
+		if !existing.ExtraType.Valid {
+			importMovieNFO(ctx, repo, existing.ID, movie.Path, s)
+			updateMovieArtwork(ctx, repo, existing, s)
+		}
+		updateMovieSubtitles(ctx, repo, existing, s)
+		s.lookUp(lookupKey{id: existing.ID})
+		s.cache.scanned(movie)
+		return
+	}
+
+	fingerprint, err := fileFingerprint(movie.Path, movie.Size)
+	if err != nil {
+		log.Printf("Error fingerprinting %s: %v", movie.Path, err)
+		s.fail()
+	} else if _, err := repo.FindMissingMediaByFingerprint(ctx, fingerprint); err == nil {
+		// A missing file may have moved here
+		s.deferMove(movie.Path, func() { claimMovedMovie(ctx, repo, movie, fingerprint, s) })
+		return
+	}
+	saveMovie(ctx, repo, movie, fingerprint, s)
+}
 
-		media := &models.Media{
-			Title:         cleanTitle(filepath.Base(movie.Path)),
-			Path:          movie.Path,
-			MediaType:     models.MediaTypeMovie,
-			FileSize:      movie.Size,
-			FileExtension: filepath.Ext(movie.Path),
+// claimMovedMovie gives a missing media row the movie file's new path so it keeps
+// its identity, or saves the file as a new movie if the row was claimed already
+func claimMovedMovie(ctx context.Context, repo MediaRepository, movie MediaFile, fingerprint string, s *scanSession) {
+	moved, err := repo.FindMissingMediaByFingerprint(ctx, fingerprint)
+	if err != nil {
+		saveMovie(ctx, repo, movie, fingerprint, s)
+		return
+	}
+	if err := repo.UpdateMediaPath(ctx, moved.ID, movie.Path); err != nil {
+		log.Printf("Error updating moved media %s: %v", movie.Path, err)
+		s.fail()
+		return
+	}
+	log.Printf("Detected move: %s -> %s", moved.Path, movie.Path)
+	moved.Path = movie.Path
+	updateMovieSubtitles(ctx, repo, moved, s)
+	s.lookUp(lookupKey{id: moved.ID})
+	s.move()
+	s.cache.scanned(movie)
+}
+
+// saveMovie inserts a new movie row, with the streams read from its headers, the
+// metadata of its NFO file if it has one and the artwork and subtitle files next
+// to it. Parts and extras are attached to their movie by linkMovies once the
+// worker pool drains.
+func saveMovie(ctx context.Context, repo MediaRepository, movie MediaFile, fingerprint string, s *scanSession) {
+	release := ParseReleaseName(filepath.Base(movie.Path))
+	root, _ := s.filter.root(movie.Path)
+	extraType, _ := movieExtra(root, movie.Path)
+	var title string
+	var year, part int
+	if extraType != "" {
+		title = extraTitle(movie.Path, extraType)
+	} else {
+		part = moviePart(s.filter, s.dirs, movie.Path)
+		title, year = movieTitle(root, movie.Path, part)
+	}
+	media := &models.Media{
+		Title:         title,
+		Path:          movie.Path,
+		MediaType:     models.MediaTypeMovie,
+		FileSize:      movie.Size,
+		FileExtension: filepath.Ext(movie.Path),
+		Fingerprint:   sql.NullString{String: fingerprint, Valid: fingerprint != ""},
+		Year:          sql.NullInt64{Int64: int64(year), Valid: year != 0},
+		Resolution:    nullString(release.Resolution),
+		Source:        nullString(release.Source),
+		VideoCodec:    nullString(release.VideoCodec),
+		AudioCodec:    nullString(release.AudioCodec),
+		HDR:           release.HDR,
+		ReleaseGroup:  nullString(release.Group),
+		Edition:       nullString(release.Edition),
+		ReleaseParsed: true,
+		Part:          sql.NullInt64{Int64: int64(part), Valid: part != 0},
+		ExtraType:     nullString(extraType),
+	}
+	id, err := repo.SaveMedia(ctx, media)
+	if err != nil {
+		log.Printf("Error saving media: %v", err)
+		s.fail()
+		return
+	}
+	probeMovie(ctx, repo, id, movie.Path, s)
+	media.ID = id
+	if extraType == "" {
+		importMovieNFO(ctx, repo, id, movie.Path, s)
+		updateMovieArtwork(ctx, repo, *media, s)
+	}
+	updateMovieSubtitles(ctx, repo, *media, s)
+	s.lookUp(lookupKey{id: id})
+	s.add()
+	s.cache.scanned(movie)
+}
+
+// backfillReleases parses the release details of the movies saved before they
+// were parsed from file names. Their files are usually unchanged and so skipped
+// by the scan.
+func backfillReleases(ctx context.Context, repo MediaRepository, s *scanSession) {
+	media, err := repo.GetMediaWithoutRelease(ctx)
+	if err != nil {
+		log.Printf("Error retrieving media without release details: %v", err)
+		s.fail()
+		return
+	}
+	for _, m := range media {
+		if ctx.Err() != nil {
+			return
 		}
-		if _, err := repo.SaveMedia(context.Background(), media); err != nil {
-			log.Printf("Error saving media: %v", err)
+		release := ParseReleaseName(filepath.Base(m.Path))
+		err := repo.SetMediaRelease(ctx, m.ID, models.Release{
+			Resolution:   nullString(release.Resolution),
+			Source:       nullString(release.Source),
+			VideoCodec:   nullString(release.VideoCodec),
+			AudioCodec:   nullString(release.AudioCodec),
+			HDR:          release.HDR,
+			ReleaseGroup: nullString(release.Group),
+			Edition:      nullString(release.Edition),
+		})
+		if err != nil {
+			log.Printf("Error saving release details for %s: %v", m.Path, err)
+			s.fail()
 		}
 	}
 }
 
+// nullString converts an empty string to NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
 // ScanTVShows scans the TV shows directory
-func ScanTVShows(repo MediaRepository, tvDir string) {
+func ScanTVShows(ctx context.Context, repo MediaRepository, tvDir string, s *scanSession) {
 
 	// Get all TV show directories
 	tvShows, err := os.ReadDir(tvDir)
 	if err != nil {
 		log.Printf("Error reading TV directory: %v", err)
+		s.cache.fail(tvDir)
+		s.fail()
 		return
 	}
 
 	for _, tvShowDir := range tvShows {
-		if !tvShowDir.IsDir() {
+		if ctx.Err() != nil {
+			return
+		}
+		tvShowPath := filepath.Join(tvDir, tvShowDir.Name())
+		if !tvShowDir.IsDir() || s.filter.ignored(tvShowPath, true) {
 			continue
 		}
+		scanTVShow(ctx, repo, tvShowPath, s)
+	}
+}
 
-		tvShowPath := filepath.Join(tvDir, tvShowDir.Name())
-		tvShowTitle := tvShowDir.Name()
+// scanTVShow adds a TV show directory to the database if needed and scans its seasons
+func scanTVShow(ctx context.Context, repo MediaRepository, tvShowPath string, s *scanSession) {
+	if s.cache.treeUnchanged(tvShowPath) {
+		s.cache.keepTree(tvShowPath)
+		return
+	}
+	tvShowTitle := filepath.Base(tvShowPath)
 
-		// Check if TV show already exists
-		tvShow, err := repo.GetTVShowByPath(context.Background(), tvShowPath)
+	// Check if TV show already exists
+	tvShow, err := repo.GetTVShowByPath(ctx, tvShowPath)
+	if err != nil {
+		// Create new TV show
+		newTVShow := &models.TVShow{
+			Title: tvShowTitle,
+			Path:  tvShowPath,
+		}
+		tvShowID, err := repo.SaveTVShow(ctx, newTVShow)
 		if err != nil {
-			// Create new TV show
-			newTVShow := &models.TVShow{
-				Title: tvShowTitle,
-				Path:  tvShowPath,
-			}
-			tvShowID, err := repo.SaveTVShow(context.Background(), newTVShow)
-			if err != nil {
-				log.Printf("Error saving TV show: %v", err)
-				continue
-			}
-			tvShow.ID = tvShowID
+			log.Printf("Error saving TV show: %v", err)
+			s.cache.fail(tvShowPath)
+			s.fail()
+			return
 		}
-
-		// Scan for seasons
-		scanSeasons(repo, tvShow.ID, tvShowPath)
+		tvShow = *newTVShow
+		tvShow.ID = tvShowID
 	}
+	importTVShowNFO(ctx, repo, tvShow.ID, tvShowPath, s)
+	updateTVShowArtwork(ctx, repo, tvShow, s)
+	s.lookUp(lookupKey{tvShow: true, id: tvShow.ID})
+
+	// Scan for seasons
+	scanSeasons(ctx, repo, tvShow.ID, tvShowPath, s)
 }
 
 // scanSeasons scans for seasons within a TV show directory
-func scanSeasons(repo MediaRepository, tvShowID int64, tvShowPath string) {
+func scanSeasons(ctx context.Context, repo MediaRepository, tvShowID int64, tvShowPath string, s *scanSession) {
 	// Check for season directories
+	info, err := os.Stat(tvShowPath)
+	if err != nil {
+		log.Printf("Error reading TV show directory: %v", err)
+		s.cache.fail(tvShowPath)
+		s.fail()
+		return
+	}
 	entries, err := os.ReadDir(tvShowPath)
 	if err != nil {
 		log.Printf("Error reading TV show directory: %v", err)
+		s.cache.fail(tvShowPath)
+		s.fail()
 		return
 	}
 
-	// Regular expression to match "Season X" or "SX" directories
-	seasonRegex := regexp.MustCompile(`(?i)(season|s)\s*(\d+)`)
+	// Season posters in the show directory are looked for again when it changed,
+	// even for seasons whose own directory did not
+	showChanged := !s.cache.dirUnchanged(tvShowPath, info)
 
 	// First, look for season directories
 	hasSeasonDirs := false
 	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return
+		}
 		if !entry.IsDir() {
 			continue
 		}
 
 		dirName := entry.Name()
-		matches := seasonRegex.FindStringSubmatch(dirName)
-		if len(matches) > 2 {
+		if s.filter.ignored(filepath.Join(tvShowPath, dirName), true) {
+			continue
+		}
+		if seasonNum, ok := seasonDirNumber(dirName); ok {
 			hasSeasonDirs = true
-			seasonNum := 0
-			fmt.Sscanf(matches[2], "%d", &seasonNum)
 			seasonPath := filepath.Join(tvShowPath, dirName)
+			unchanged := s.cache.treeUnchanged(seasonPath)
+			if unchanged && !showChanged {
+				s.cache.keepTree(seasonPath)
+				continue
+			}
 
 			// Check if season already exists
-			season, err := repo.GetSeasonByPath(context.Background(), seasonPath)
+			season, err := repo.GetSeasonByPath(ctx, seasonPath)
 			if err != nil {
 				// Create new season
 				newSeason := &models.Season{
 					TVShowID: tvShowID,
 					Number:   seasonNum,
-					Title:    fmt.Sprintf("Season %d", seasonNum),
+					Title:    seasonTitle(seasonNum),
 					Path:     seasonPath,
 				}
-				seasonID, err := repo.SaveSeason(context.Background(), newSeason)
+				seasonID, err := repo.SaveSeason(ctx, newSeason)
 				if err != nil {
 					log.Printf("Error saving season: %v", err)
+					s.cache.fail(seasonPath)
+					s.fail()
 					continue
 				}
+				season = *newSeason
 				season.ID = seasonID
 			}
+			updateSeasonPoster(ctx, repo, tvShowPath, season, s)
+			if unchanged {
+				s.cache.keepTree(seasonPath)
+				continue
+			}
 
 			// Scan for episodes in this season
-			scanEpisodes(repo, season.ID, seasonPath)
+			scanEpisodes(ctx, repo, season.ID, seasonNum, seasonPath, s)
 		}
 	}
+	if hasSeasonDirs {
+		s.cache.recordDir(tvShowPath, info)
+	}
 
-	// If no season directories found, treat the TV show directory as a single season
+	// If no season directories found, group the episodes in the TV show directory
+	// by the season in their names
 	if !hasSeasonDirs {
-		// Check if default season already exists
-		seasonPath := tvShowPath
-		season, err := repo.GetSeasonByPath(context.Background(), seasonPath)
-		if err != nil {
-			// Create default season
-			newSeason := &models.Season{
-				TVShowID: tvShowID,
-				Number:   1,
-				Title:    "Season 1",
-				Path:     seasonPath,
-			}
-			seasonID, err := repo.SaveSeason(context.Background(), newSeason)
+		scanFlatSeasons(ctx, repo, tvShowID, tvShowPath, s)
+	}
+}
+
+// scanFlatSeasons scans a TV show stored without season folders. Episodes are
+// grouped into seasons by the season parsed from their names, defaulting to
+// season 1, and the seasons are created as needed. All of them have the show
+// directory as their path.
+func scanFlatSeasons(ctx context.Context, repo MediaRepository, tvShowID int64, tvShowPath string, s *scanSession) {
+	seasonIDs := make(map[int]int64)
+	err := walkMediaFiles(ctx, s.filter, s.cache, tvShowPath, func(file MediaFile) error {
+		info := ExtractEpisodeInfo(file.Path)
+		seasonNum := info.Season
+		if seasonNum == 0 && !info.HasSeason {
+			seasonNum = 1
+		}
+		seasonID, ok := seasonIDs[seasonNum]
+		if !ok {
+			season, err := flatSeason(ctx, repo, tvShowID, seasonNum, tvShowPath)
 			if err != nil {
-				log.Printf("Error saving default season: %v", err)
-				return
+				log.Printf("Error saving season %d of %s: %v", seasonNum, tvShowPath, err)
+				s.fail()
+				return nil
 			}
-			season.ID = seasonID
+			updateSeasonPoster(ctx, repo, tvShowPath, season, s)
+			seasonID = season.ID
+			seasonIDs[seasonNum] = seasonID
 		}
+		return s.submit(func() { scanEpisodeFile(ctx, repo, seasonID, file, info, s) })
+	})
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Error scanning TV show directory: %v", err)
+		s.fail()
+	}
+}
 
-		// Scan for episodes in the TV show directory
-		scanEpisodes(repo, season.ID, seasonPath)
+// flatSeason returns the numbered season of a TV show without season folders,
+// creating it if needed. It is looked up by the show's path so a season folder
+// with the same number is never taken for it.
+func flatSeason(ctx context.Context, repo MediaRepository, tvShowID int64, number int, tvShowPath string) (models.Season, error) {
+	season, err := repo.GetSeasonByPathAndNumber(ctx, tvShowPath, number)
+	if !errors.Is(err, sql.ErrNoRows) {
+		return season, err
+	}
+	season = models.Season{
+		TVShowID: tvShowID,
+		Number:   number,
+		Title:    seasonTitle(number),
+		Path:     tvShowPath,
 	}
+	season.ID, err = repo.SaveSeason(ctx, &season)
+	return season, err
 }
 
-// scanEpisodes scans for episodes within a season directory
-func scanEpisodes(repo MediaRepository, seasonID int64, seasonPath string) {
-	// Get all files in the season directory
-	files, err := ScanMediaDirectory(seasonPath, models.MediaTypeTVShow)
-	if err != nil {
+// Season directory names: "Season X" or "SX", and the specials folders that
+// hold season 0
+var (
+	seasonDirRe   = regexp.MustCompile(`(?i)(season|s)\s*(\d+)`)
+	specialsDirRe = regexp.MustCompile(`(?i)^(specials?|extras)$`)
+)
+
+// seasonDirNumber returns the season number of a season directory, or false if
+// the directory is not one. "Specials", "Extras" and "Season 00" are season 0.
+func seasonDirNumber(name string) (int, bool) {
+	if specialsDirRe.MatchString(name) {
+		return 0, true
+	}
+	matches := seasonDirRe.FindStringSubmatch(name)
+	if matches == nil {
+		return 0, false
+	}
+	number, err := strconv.Atoi(matches[2])
+	return number, err == nil
+}
+
+// seasonTitle returns the display title of a season
+func seasonTitle(number int) string {
+	if number == 0 {
+		return "Specials"
+	}
+	return fmt.Sprintf("Season %d", number)
+}
+
+// scanEpisodes walks a season directory and queues every video file on the
+// session's worker pool. Files named as episodes of a different season are
+// still filed under this one, with a warning.
+func scanEpisodes(ctx context.Context, repo MediaRepository, seasonID int64, seasonNum int, seasonPath string, s *scanSession) {
+	err := walkMediaFiles(ctx, s.filter, s.cache, seasonPath, func(file MediaFile) error {
+		info := extractSeasonFolderEpisode(file.Path, seasonNum)
+		if info.HasSeason && info.Season != seasonNum {
+			s.warn("%s is named as season %d but is in the folder for season %d", file.Path, info.Season, seasonNum)
+		}
+		return s.submit(func() { scanEpisodeFile(ctx, repo, seasonID, file, info, s) })
+	})
+	if err != nil && ctx.Err() == nil {
 		log.Printf("Error scanning season directory: %v", err)
-		return
+		s.fail()
 	}
+}
 
-	for _, file := range files {
-		// Check if episode already exists
-		_, err := repo.GetEpisodeByPath(context.Background(), file.Path)
-		if err == nil {
-			continue // Episode already exists
+// scanEpisodeFile adds an episode file to the database unless it is already
+// known. info is the episode info parsed from its name.
+func scanEpisodeFile(ctx context.Context, repo MediaRepository, seasonID int64, file MediaFile, info EpisodeInfo, s *scanSession) {
+	s.file(file.Path)
+	// Check if episode already exists
+	existing, err := repo.GetEpisodeByPath(ctx, file.Path)
+	if err == nil {
+		// The file may now belong to another season, as when the episodes of a
+		// show without season folders are regrouped
+		if existing.SeasonID != seasonID {
+			if err := repo.UpdateEpisodePath(ctx, existing.ID, seasonID, file.Path); err != nil {
+				log.Printf("Error moving %s to another season: %v", file.Path, err)
+				s.fail()
+				return
+			}
+			s.vacate(existing.SeasonID)
+		}
+		if named := namedSeason(info); existing.NamedSeason != named {
+			if err := repo.SetEpisodeNamedSeason(ctx, existing.ID, named); err != nil {
+				log.Printf("Error saving named season for %s: %v", file.Path, err)
+				s.fail()
+				return
+			}
+		}
+		// Backfill the fingerprint so the episode can be followed if moved later
+		if !existing.Fingerprint.Valid {
+			if fp, err := fileFingerprint(file.Path, file.Size); err == nil {
+				if err := repo.UpdateEpisodeFingerprint(ctx, existing.ID, fp); err != nil {
+					log.Printf("Error saving fingerprint for %s: %v", file.Path, err)
+					s.fail()
+					return
+				}
+			}
 		}
+		if !existing.DurationMS.Valid {
+			probeEpisode(ctx, repo, existing.ID, file.Path, s)
+		}
+		importEpisodeNFO(ctx, repo, existing.ID, file.Path, s)
+		updateEpisodeSubtitles(ctx, repo, existing.ID, file.Path, s)
+		s.cache.scanned(file)
+		return // Episode already exists
+	}
 
-		// Extract episode information
-		_, episodeNum, title := ExtractEpisodeInfo(file.Path)
+	fingerprint, err := fileFingerprint(file.Path, file.Size)
+	if err != nil {
+		log.Printf("Error fingerprinting %s: %v", file.Path, err)
+		s.fail()
+	} else if _, err := repo.FindMissingEpisodeByFingerprint(ctx, fingerprint); err == nil {
+		// A missing episode may have moved here
+		s.deferMove(file.Path, func() { claimMovedEpisode(ctx, repo, seasonID, file, info, fingerprint, s) })
+		return
+	}
+	saveEpisode(ctx, repo, seasonID, file, info, fingerprint, s)
+}
 
-		// Create new episode
-		newEpisode := &models.Episode{
-			SeasonID: seasonID,
-			Number:   episodeNum,
-			Title:    title,
-			Path:     file.Path,
-			FileSize: file.Size,
-		}
+// claimMovedEpisode gives a missing episode row the file's new path and season so
+// it keeps its identity, or saves the file as a new episode if the row was claimed already
+func claimMovedEpisode(ctx context.Context, repo MediaRepository, seasonID int64, file MediaFile, info EpisodeInfo, fingerprint string, s *scanSession) {
+	moved, err := repo.FindMissingEpisodeByFingerprint(ctx, fingerprint)
+	if err != nil {
+		saveEpisode(ctx, repo, seasonID, file, info, fingerprint, s)
+		return
+	}
+	if err := repo.UpdateEpisodePath(ctx, moved.ID, seasonID, file.Path); err != nil {
+		log.Printf("Error updating moved episode %s: %v", file.Path, err)
+		s.fail()
+		return
+	}
+	log.Printf("Detected move: %s -> %s", moved.Path, file.Path)
+	if err := repo.SetEpisodeNamedSeason(ctx, moved.ID, namedSeason(info)); err != nil {
+		log.Printf("Error saving named season for %s: %v", file.Path, err)
+		s.fail()
+	}
+	if moved.SeasonID != seasonID {
+		// The old season may now be empty
+		s.vacate(moved.SeasonID)
+	}
+	updateEpisodeSubtitles(ctx, repo, moved.ID, file.Path, s)
+	s.move()
+	s.cache.scanned(file)
+}
 
-		if _, err := repo.SaveEpisode(context.Background(), newEpisode); err != nil {
-			log.Printf("Error saving episode: %v", err)
-		}
+// saveEpisode inserts a new episode row, with the streams read from its headers,
+// the metadata of its NFO file if it has one and the subtitle files next to it
+func saveEpisode(ctx context.Context, repo MediaRepository, seasonID int64, file MediaFile, info EpisodeInfo, fingerprint string, s *scanSession) {
+	// Create new episode
+	newEpisode := &models.Episode{
+		SeasonID:    seasonID,
+		Number:      info.Episode,
+		Title:       info.Title,
+		Path:        file.Path,
+		FileSize:    file.Size,
+		Fingerprint: sql.NullString{String: fingerprint, Valid: fingerprint != ""},
+		LastNumber:  sql.NullInt64{Int64: int64(info.LastEpisode), Valid: info.LastEpisode > info.Episode},
+		AirDate:     sql.NullTime{Time: info.AirDate, Valid: !info.AirDate.IsZero()},
+		// Absolute numbers are only known for names that use them
+		AbsoluteNumber: sql.NullInt64{Int64: int64(info.Absolute), Valid: info.Absolute > 0},
+		NamedSeason:    namedSeason(info),
 	}
+
+	id, err := repo.SaveEpisode(ctx, newEpisode)
+	if err != nil {
+		log.Printf("Error saving episode: %v", err)
+		s.fail()
+		return
+	}
+	probeEpisode(ctx, repo, id, file.Path, s)
+	importEpisodeNFO(ctx, repo, id, file.Path, s)
+	updateEpisodeSubtitles(ctx, repo, id, file.Path, s)
+	s.add()
+	s.cache.scanned(file)
+}
+
+// namedSeason returns the season given by an episode's name, if it has one
+func namedSeason(info EpisodeInfo) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(info.Season), Valid: info.HasSeason}
 }
 
 // cleanTitle removes file extensions and common suffixes from a title
@@ -300,42 +1091,3 @@ func cleanTitle(filename string) string {
 
 	return title
 }
-
-// ExtractEpisodeInfo extracts episode number and title from a file path
-func ExtractEpisodeInfo(filePath string) (seasonNum, episodeNum int, title string) {
-	// Example: "TV.Show.S01E05.Episode.Title.mp4"
-	// Example: "TV.Show.Season.1.Episode.5.Episode.Title.mp4"
-	// Example: "TV.Show.E05.Episode.Title.mp4" (assuming single season)
-
-	filename := filepath.Base(filePath)
-	cleanedTitle := cleanTitle(filename) // Use the existing cleanTitle function
-
-	// Regex to find SXXEXX or Season X Episode X patterns
-	re := regexp.MustCompile(`(?i)(s(\d+))?e(\d+)\.?(.+)`)
-	matches := re.FindStringSubmatch(cleanedTitle)
-
-	if len(matches) > 4 {
-		// Found SXXEXX or EXX pattern
-		if matches[2] != "" {
-			seasonNum, _ = strconv.Atoi(matches[2])
-		} else {
-			seasonNum = 1 // Default to season 1 if not specified
-		}
-		episodeNum, _ = strconv.Atoi(matches[3])
-		title = strings.TrimSpace(strings.ReplaceAll(matches[4], ".", " "))
-	} else {
-		// Fallback if no clear SXXEXX or EXX pattern, try to extract just episode number
-		re = regexp.MustCompile(`(?i)episode\.?(\d+)\.?(.+)`)
-		matches = re.FindStringSubmatch(cleanedTitle)
-		if len(matches) > 2 {
-			episodeNum, _ = strconv.Atoi(matches[1])
-			title = strings.TrimSpace(strings.ReplaceAll(matches[2], ".", " "))
-		} else {
-			// No clear episode info, use cleaned filename as title
-			title = cleanedTitle
-			episodeNum = 0 // Indicate no episode number found
-		}
-	}
-
-	return seasonNum, episodeNum, title
-}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"transogov2/app/models"
+)
+
+// slowRepo adds a fixed delay to the per-file lookups and inserts to simulate
+// database round trips over the network
+type slowRepo struct {
+	*fakeRepo
+	delay time.Duration
+}
+
+func (r *slowRepo) GetMediaByPath(ctx context.Context, path string) (models.Media, error) {
+	time.Sleep(r.delay)
+	return r.fakeRepo.GetMediaByPath(ctx, path)
+}
+
+func (r *slowRepo) SaveMedia(ctx context.Context, media *models.Media) (int64, error) {
+	time.Sleep(r.delay)
+	return r.fakeRepo.SaveMedia(ctx, media)
+}
+
+func (r *slowRepo) GetEpisodeByPath(ctx context.Context, path string) (models.Episode, error) {
+	time.Sleep(r.delay)
+	return r.fakeRepo.GetEpisodeByPath(ctx, path)
+}
+
+func (r *slowRepo) SaveEpisode(ctx context.Context, episode *models.Episode) (int64, error) {
+	time.Sleep(r.delay)
+	return r.fakeRepo.SaveEpisode(ctx, episode)
+}
+
+// generateLibrary creates a library of small movie and episode files
+func generateLibrary(tb testing.TB, cfg *ScanConfig, movies, shows, seasons, episodes int) {
+	tb.Helper()
+	for i := 0; i < movies; i++ {
+		name := fmt.Sprintf("Movie %03d (2001)", i)
+		writeFile(tb, filepath.Join(cfg.MoviesDir, name, name+".mkv"), "movie "+name)
+	}
+	for i := 0; i < shows; i++ {
+		show := fmt.Sprintf("Show %02d", i)
+		for s := 1; s <= seasons; s++ {
+			for e := 1; e <= episodes; e++ {
+				name := fmt.Sprintf("%s.S%02dE%02d.mkv", show, s, e)
+				writeFile(tb, filepath.Join(cfg.TVDir, show, fmt.Sprintf("Season %d", s), name), "episode "+name)
+			}
+		}
+	}
+}
+
+// scanSequential is the scanner as it was before files were handed to a worker
+// pool: one walk that looks up, fingerprints and saves each file in turn. It
+// is kept as the baseline of BenchmarkScanMedia, and does only the per-file
+// work that scanner did, without the media info, NFO, artwork and subtitle
+// reads added since.
+func scanSequential(ctx context.Context, repo MediaRepository, cfg *ScanConfig) error {
+	walk := func(dir string, fn func(MediaFile) error) error {
+		return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || !isVideoFile(strings.ToLower(filepath.Ext(path))) {
+				return err
+			}
+			return fn(MediaFile{Path: path, Size: info.Size()})
+		})
+	}
+
+	err := walk(cfg.MoviesDir, func(movie MediaFile) error {
+		if _, err := repo.GetMediaByPath(ctx, movie.Path); err == nil {
+			return nil
+		}
+		fingerprint, err := fileFingerprint(movie.Path, movie.Size)
+		if err != nil {
+			return err
+		}
+		if _, err := repo.FindMissingMediaByFingerprint(ctx, fingerprint); err == nil {
+			return nil
+		}
+		_, err = repo.SaveMedia(ctx, &models.Media{
+			Title:         cleanTitle(filepath.Base(movie.Path)),
+			Path:          movie.Path,
+			MediaType:     models.MediaTypeMovie,
+			FileSize:      movie.Size,
+			FileExtension: filepath.Ext(movie.Path),
+			Fingerprint:   sql.NullString{String: fingerprint, Valid: true},
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	shows, err := os.ReadDir(cfg.TVDir)
+	if err != nil {
+		return err
+	}
+	for _, show := range shows {
+		showPath := filepath.Join(cfg.TVDir, show.Name())
+		tvShow, err := repo.GetTVShowByPath(ctx, showPath)
+		if err != nil {
+			if tvShow.ID, err = repo.SaveTVShow(ctx, &models.TVShow{Title: show.Name(), Path: showPath}); err != nil {
+				return err
+			}
+		}
+		seasons, err := os.ReadDir(showPath)
+		if err != nil {
+			return err
+		}
+		for number, entry := range seasons {
+			seasonPath := filepath.Join(showPath, entry.Name())
+			season, err := repo.GetSeasonByPath(ctx, seasonPath)
+			if err != nil {
+				season = models.Season{TVShowID: tvShow.ID, Number: number + 1, Title: entry.Name(), Path: seasonPath}
+				if season.ID, err = repo.SaveSeason(ctx, &season); err != nil {
+					return err
+				}
+			}
+			err = walk(seasonPath, func(file MediaFile) error {
+				if _, err := repo.GetEpisodeByPath(ctx, file.Path); err == nil {
+					return nil
+				}
+				fingerprint, err := fileFingerprint(file.Path, file.Size)
+				if err != nil {
+					return err
+				}
+				if _, err := repo.FindMissingEpisodeByFingerprint(ctx, fingerprint); err == nil {
+					return nil
+				}
+				info := ExtractEpisodeInfo(file.Path)
+				_, err = repo.SaveEpisode(ctx, &models.Episode{
+					SeasonID:    season.ID,
+					Number:      info.Episode,
+					Title:       info.Title,
+					Path:        file.Path,
+					FileSize:    file.Size,
+					Fingerprint: sql.NullString{String: fingerprint, Valid: true},
+				})
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// BenchmarkScanMedia measures a first scan of a generated library with
+// simulated database latency: the sequential scanner the worker pool replaced,
+// then the pool with several sizes
+func BenchmarkScanMedia(b *testing.B) {
+	cfg := newTestLibrary(b)
+	generateLibrary(b, cfg, 100, 5, 2, 10)
+
+	b.Run("sequential", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			repo := &slowRepo{fakeRepo: newFakeRepo(), delay: 200 * time.Microsecond}
+			if err := scanSequential(context.Background(), repo, cfg); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	for _, workers := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			cfg := *cfg
+			cfg.Workers = workers
+			for i := 0; i < b.N; i++ {
+				repo := &slowRepo{fakeRepo: newFakeRepo(), delay: 200 * time.Microsecond}
+				if _, err := ScanMedia(context.Background(), repo, &cfg, nil, false); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRescanUnchanged measures a rescan of a library that has not changed
+// since the previous scan, with and without the scan state cache
+func BenchmarkRescanUnchanged(b *testing.B) {
+	cfg := newTestLibrary(b)
+	cfg.Workers = 4
+	generateLibrary(b, cfg, 500, 10, 5, 10)
+
+	for _, full := range []bool{false, true} {
+		b.Run(fmt.Sprintf("full=%v", full), func(b *testing.B) {
+			repo := &slowRepo{fakeRepo: newFakeRepo(), delay: 200 * time.Microsecond}
+			if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := ScanMedia(context.Background(), repo, cfg, nil, full); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
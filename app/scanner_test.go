@@ -1,8 +1,18 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"transogov2/app/models"
 )
 
 func TestIsVideoFile(t *testing.T) {
@@ -15,6 +25,11 @@ func TestIsVideoFile(t *testing.T) {
 		{".txt", false},
 		{".jpg", false},
 		{".MP4", true}, // Case insensitivity
+		{".ts", true},
+		{".m2ts", true},
+		{".mpg", true},
+		{".ogv", true},
+		{".3gp", true},
 		{"", false},
 	}
 
@@ -60,3 +75,384 @@ func TestCleanTitle(t *testing.T) {
 		})
 	}
 }
+
+// newTestLibrary creates empty movie and TV directories and a config pointing at them
+func newTestLibrary(t testing.TB) *ScanConfig {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &ScanConfig{
+		MoviesDir:          filepath.Join(dir, "movies"),
+		TVDir:              filepath.Join(dir, "tv"),
+		MissingGracePeriod: 24 * time.Hour,
+	}
+	for _, d := range []string{cfg.MoviesDir, cfg.TVDir} {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+func TestScanMediaDetectsMovedMovie(t *testing.T) {
+	cfg := newTestLibrary(t)
+	repo := newFakeRepo()
+
+	oldPath := filepath.Join(cfg.MoviesDir, "Unsorted", "Heat.1995.mkv")
+	writeFile(t, oldPath, "heat movie contents")
+	if summary, _ := ScanMedia(context.Background(), repo, cfg, nil, false); summary.Added != 1 {
+		t.Fatalf("first scan added %d, want 1", summary.Added)
+	}
+	original, err := repo.GetMediaByPath(context.Background(), oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newPath := filepath.Join(cfg.MoviesDir, "Heat (1995)", "Heat.1995.mkv")
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Moved != 1 || summary.Added != 0 {
+		t.Fatalf("second scan = %+v, want 1 moved, 0 added", summary)
+	}
+	moved, err := repo.GetMediaByPath(context.Background(), newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.ID != original.ID {
+		t.Errorf("moved media has ID %d, want %d", moved.ID, original.ID)
+	}
+	if moved.MissingSince.Valid {
+		t.Errorf("moved media is still marked missing")
+	}
+	if len(repo.media) != 1 {
+		t.Errorf("repository has %d media rows, want 1", len(repo.media))
+	}
+}
+
+func TestScanMediaDetectsMovedEpisode(t *testing.T) {
+	cfg := newTestLibrary(t)
+	repo := newFakeRepo()
+
+	oldPath := filepath.Join(cfg.TVDir, "Show", "Show.S01E01.Pilot.mkv")
+	writeFile(t, oldPath, "pilot contents")
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	original, err := repo.GetEpisodeByPath(context.Background(), oldPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reorganise the flat show folder into a season folder
+	newPath := filepath.Join(cfg.TVDir, "Show", "Season 1", "Show.S01E01.Pilot.mkv")
+	if err := os.MkdirAll(filepath.Dir(newPath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		t.Fatal(err)
+	}
+
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Moved != 1 || summary.Added != 0 {
+		t.Fatalf("second scan = %+v, want 1 moved, 0 added", summary)
+	}
+	moved, err := repo.GetEpisodeByPath(context.Background(), newPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.ID != original.ID {
+		t.Errorf("moved episode has ID %d, want %d", moved.ID, original.ID)
+	}
+	if moved.SeasonID == original.SeasonID {
+		t.Errorf("moved episode still belongs to its old season")
+	}
+	if _, ok := repo.seasons[original.SeasonID]; ok {
+		t.Errorf("vacated season was not removed")
+	}
+}
+
+func TestScanMediaWorkerPoolIsDeterministic(t *testing.T) {
+	cfg := newTestLibrary(t)
+	generateLibrary(t, cfg, 30, 3, 2, 5)
+
+	// snapshot lists the scanned paths and titles, which must not depend on the worker count
+	snapshot := func(repo *fakeRepo) map[string]string {
+		rows := make(map[string]string)
+		for _, m := range repo.media {
+			rows[m.Path] = m.Title
+		}
+		for _, e := range repo.episodes {
+			rows[e.Path] = fmt.Sprintf("%d %s", e.Number, e.Title)
+		}
+		return rows
+	}
+
+	sequential := newFakeRepo()
+	cfg.Workers = 1
+	want, err := ScanMedia(context.Background(), sequential, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{2, 8, 32} {
+		t.Run(fmt.Sprintf("workers=%d", workers), func(t *testing.T) {
+			repo := newFakeRepo()
+			cfg := *cfg
+			cfg.Workers = workers
+			got, err := ScanMedia(context.Background(), repo, &cfg, nil, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("summary = %+v, want %+v", got, want)
+			}
+			if !reflect.DeepEqual(snapshot(repo), snapshot(sequential)) {
+				t.Errorf("scan with %d workers produced different rows than the sequential scan", workers)
+			}
+		})
+	}
+}
+
+func TestScanMediaResolvesDuplicateMovesInPathOrder(t *testing.T) {
+	cfg := newTestLibrary(t)
+	cfg.Workers = 8
+	repo := newFakeRepo()
+
+	oldPath := filepath.Join(cfg.MoviesDir, "Old", "Film.mkv")
+	writeFile(t, oldPath, "film contents")
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := repo.GetMediaByPath(context.Background(), oldPath)
+
+	// The file vanished and two identical copies appeared
+	os.RemoveAll(filepath.Dir(oldPath))
+	copies := []string{
+		filepath.Join(cfg.MoviesDir, "B", "Film.mkv"),
+		filepath.Join(cfg.MoviesDir, "A", "Film.mkv"),
+	}
+	for _, path := range copies {
+		writeFile(t, path, "film contents")
+	}
+
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Moved != 1 || summary.Added != 1 {
+		t.Fatalf("summary = %+v, want 1 moved and 1 added", summary)
+	}
+	first, _ := repo.GetMediaByPath(context.Background(), copies[1])
+	if first.ID != original.ID {
+		t.Errorf("the first copy in path order did not inherit the missing row")
+	}
+}
+
+// cancellingRepo cancels a scan once it has saved a number of media rows
+type cancellingRepo struct {
+	*fakeRepo
+	cancel func()
+	after  int
+	saved  int
+}
+
+func (r *cancellingRepo) SaveMedia(ctx context.Context, media *models.Media) (int64, error) {
+	r.saved++
+	if r.saved == r.after {
+		r.cancel()
+	}
+	return r.fakeRepo.SaveMedia(ctx, media)
+}
+
+func TestScanMediaStopsWhenCancelled(t *testing.T) {
+	cfg := newTestLibrary(t)
+	cfg.Workers = 1
+	for i := 0; i < 20; i++ {
+		writeFile(t, filepath.Join(cfg.MoviesDir, fmt.Sprintf("Movie.%02d.mkv", i)), fmt.Sprintf("movie %d", i))
+	}
+	writeFile(t, filepath.Join(cfg.TVDir, "Show", "Season 1", "Show.S01E01.mkv"), "episode")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := &cancellingRepo{fakeRepo: newFakeRepo(), cancel: cancel, after: 3}
+
+	// A row that has been missing past the grace period is only purged by a
+	// scan that runs to completion
+	gone := filepath.Join(cfg.MoviesDir, "Gone.mkv")
+	goneID, _ := repo.SaveMedia(context.Background(), &models.Media{Title: "Gone", Path: gone, MediaType: models.MediaTypeMovie})
+	repo.SetMediaMissingSince(context.Background(), goneID, sql.NullTime{Time: time.Now().Add(-48 * time.Hour), Valid: true})
+
+	summary, err := ScanMedia(ctx, repo, cfg, nil, false)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("ScanMedia error = %v, want context.Canceled", err)
+	}
+	if summary.Added >= 20 {
+		t.Errorf("cancelled scan added %d movies, want it to stop early", summary.Added)
+	}
+	if summary.Removed() != 0 {
+		t.Errorf("cancelled scan purged %d rows, want 0", summary.Removed())
+	}
+	if _, ok := repo.media[goneID]; !ok {
+		t.Errorf("cancelled scan purged a missing row")
+	}
+	if len(repo.tvshows) != 0 {
+		t.Errorf("cancelled scan went on to scan TV shows")
+	}
+}
+
+func TestScanTVShowsGroupsFlatShowsBySeason(t *testing.T) {
+	cfg := newTestLibrary(t)
+	show := filepath.Join(cfg.TVDir, "Flat Show")
+	writeFile(t, filepath.Join(show, "Flat.Show.S01E01.mkv"), "s1e1")
+	writeFile(t, filepath.Join(show, "Flat.Show.S01E02.mkv"), "s1e2")
+	writeFile(t, filepath.Join(show, "Flat.Show.S02E01.mkv"), "s2e1")
+	writeFile(t, filepath.Join(show, "Flat Show - 3x01.mkv"), "s3e1")
+	writeFile(t, filepath.Join(show, "Flat.Show.Bonus.mkv"), "bonus")
+
+	repo := newFakeRepo()
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 5 || len(summary.Warnings) != 0 {
+		t.Errorf("scan added %d with warnings %v, want 5 and none", summary.Added, summary.Warnings)
+	}
+
+	tvshow, err := repo.GetTVShowByPath(context.Background(), show)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seasons, _ := repo.GetSeasonsByTVShowID(context.Background(), tvshow.ID)
+	counts := make(map[int]int)
+	for _, season := range seasons {
+		episodes, _ := repo.GetEpisodesBySeasonID(context.Background(), season.ID)
+		counts[season.Number] = len(episodes)
+		if season.Path != show {
+			t.Errorf("season %d has path %q, want the show directory", season.Number, season.Path)
+		}
+	}
+	// Files without a season go in season 1
+	if want := map[int]int{1: 3, 2: 1, 3: 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("episodes per season = %v, want %v", counts, want)
+	}
+}
+
+func TestScanTVShowsRegroupsFlatShowEpisodes(t *testing.T) {
+	cfg := newTestLibrary(t)
+	show := filepath.Join(cfg.TVDir, "Flat Show")
+	path := filepath.Join(show, "Flat.Show.S02E01.mkv")
+	writeFile(t, path, "s2e1")
+
+	// An episode filed under season 1 before seasons were parsed from names
+	repo := newFakeRepo()
+	ctx := context.Background()
+	showID, _ := repo.SaveTVShow(ctx, &models.TVShow{Title: "Flat Show", Path: show})
+	oldSeasonID, _ := repo.SaveSeason(ctx, &models.Season{TVShowID: showID, Number: 1, Title: "Season 1", Path: show})
+	episodeID, _ := repo.SaveEpisode(ctx, &models.Episode{SeasonID: oldSeasonID, Number: 1, Title: "Episode 1", Path: path})
+
+	if _, err := ScanMedia(ctx, repo, cfg, nil, true); err != nil {
+		t.Fatal(err)
+	}
+
+	episode, err := repo.GetEpisodeByPath(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	season, _ := repo.GetSeasonByPathAndNumber(ctx, show, 2)
+	if episode.ID != episodeID || episode.SeasonID != season.ID || season.ID == 0 {
+		t.Errorf("episode %d is in season %d, want episode %d in season 2 (%d)", episode.ID, episode.SeasonID, episodeID, season.ID)
+	}
+	if _, err := repo.GetSeasonByPathAndNumber(ctx, show, 1); err == nil {
+		t.Error("the emptied season 1 was not removed")
+	}
+}
+
+func TestScanTVShowsWarnsAboutSeasonMismatch(t *testing.T) {
+	cfg := newTestLibrary(t)
+	season := filepath.Join(cfg.TVDir, "Show", "Season 2")
+	writeFile(t, filepath.Join(season, "Show.S02E01.mkv"), "right")
+	writeFile(t, filepath.Join(season, "Show.S03E01.mkv"), "wrong")
+	writeFile(t, filepath.Join(season, "Show.E05.mkv"), "unnumbered")
+
+	repo := newFakeRepo()
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Warnings) != 1 || !strings.Contains(summary.Warnings[0], "Show.S03E01.mkv") {
+		t.Errorf("warnings = %q, want one for Show.S03E01.mkv", summary.Warnings)
+	}
+	// The folder wins
+	episode, _ := repo.GetEpisodeByPath(context.Background(), filepath.Join(season, "Show.S03E01.mkv"))
+	if s, _ := repo.GetSeasonByPath(context.Background(), season); episode.SeasonID != s.ID {
+		t.Errorf("mismatched episode filed in season %d, want the folder's season %d", episode.SeasonID, s.ID)
+	}
+	if episode.NamedSeason.Int64 != 3 || !episode.NamedSeason.Valid {
+		t.Errorf("named season = %v, want 3", episode.NamedSeason)
+	}
+}
+
+func TestScanTVShowsKeepsFlatSeasonsApartFromFolders(t *testing.T) {
+	cfg := newTestLibrary(t)
+	show := filepath.Join(cfg.TVDir, "Flat Show")
+	path := filepath.Join(show, "Flat.Show.S02E01.mkv")
+	writeFile(t, path, "s2e1")
+
+	// A season 2 left behind by a season folder that was flattened
+	repo := newFakeRepo()
+	ctx := context.Background()
+	showID, _ := repo.SaveTVShow(ctx, &models.TVShow{Title: "Flat Show", Path: show})
+	folderID, _ := repo.SaveSeason(ctx, &models.Season{TVShowID: showID, Number: 2, Title: "Season 2", Path: filepath.Join(show, "Season 2")})
+
+	if _, err := ScanMedia(ctx, repo, cfg, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	episode, _ := repo.GetEpisodeByPath(ctx, path)
+	season, err := repo.GetSeasonByPathAndNumber(ctx, show, 2)
+	if err != nil || season.ID == folderID || episode.SeasonID != season.ID {
+		t.Errorf("episode is in season %d, want the flat season 2 (%d) rather than the folder's (%d)", episode.SeasonID, season.ID, folderID)
+	}
+}
+
+func TestScanTVShowsRecognisesSpecials(t *testing.T) {
+	cfg := newTestLibrary(t)
+	for _, dir := range []string{"Specials", "Extras", "Season 00", "specials"} {
+		show := filepath.Join(cfg.TVDir, "Show with "+dir)
+		writeFile(t, filepath.Join(show, "Season 1", "Show.S01E01.mkv"), dir+" regular")
+		writeFile(t, filepath.Join(show, dir, "Show.S00E01.mkv"), dir+" special")
+	}
+
+	repo := newFakeRepo()
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Warnings) != 0 {
+		t.Errorf("warnings = %q, want none", summary.Warnings)
+	}
+	for _, dir := range []string{"Specials", "Extras", "Season 00", "specials"} {
+		season, err := repo.GetSeasonByPath(context.Background(), filepath.Join(cfg.TVDir, "Show with "+dir, dir))
+		if err != nil {
+			t.Errorf("%s: no season: %v", dir, err)
+			continue
+		}
+		if season.Number != 0 || season.Title != "Specials" {
+			t.Errorf("%s: season %d %q, want season 0 \"Specials\"", dir, season.Number, season.Title)
+		}
+		episodes, _ := repo.GetEpisodesBySeasonID(context.Background(), season.ID)
+		if len(episodes) != 1 {
+			t.Errorf("%s: %d episodes, want 1", dir, len(episodes))
+		}
+	}
+}
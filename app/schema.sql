@@ -6,9 +6,30 @@ CREATE TABLE media (
     file_size BIGINT NOT NULL,
     file_extension TEXT NOT NULL,
     poster_path TEXT,
+    fanart_path TEXT,
     rating TEXT,
     year INTEGER,
-    description TEXT
+    description TEXT,
+    missing_since TIMESTAMPTZ,
+    fingerprint TEXT,
+    duration_ms BIGINT,
+    resolution TEXT,
+    source TEXT,
+    video_codec TEXT,
+    audio_codec TEXT,
+    hdr BOOLEAN NOT NULL DEFAULT FALSE,
+    release_group TEXT,
+    edition TEXT,
+    release_parsed BOOLEAN NOT NULL DEFAULT FALSE,
+    parent_id INTEGER REFERENCES media(id) ON DELETE SET NULL,
+    part INTEGER,
+    extra_type TEXT,
+    version_of INTEGER REFERENCES media(id) ON DELETE SET NULL,
+    metadata_checked_at TIMESTAMPTZ,
+    metadata_misses INTEGER NOT NULL DEFAULT 0,
+    imdb_id TEXT,
+    tmdb_id TEXT,
+    tvdb_id TEXT
 );
 
 CREATE TABLE tvshows (
@@ -16,9 +37,16 @@ CREATE TABLE tvshows (
     title TEXT NOT NULL,
     path TEXT NOT NULL,
     poster_path TEXT,
+    fanart_path TEXT,
     rating TEXT,
     year INTEGER,
-    description TEXT
+    description TEXT,
+    episode_order TEXT NOT NULL DEFAULT 'aired',
+    metadata_checked_at TIMESTAMPTZ,
+    metadata_misses INTEGER NOT NULL DEFAULT 0,
+    imdb_id TEXT,
+    tmdb_id TEXT,
+    tvdb_id TEXT
 );
 
 CREATE TABLE seasons (
@@ -26,7 +54,8 @@ CREATE TABLE seasons (
     tvshow_id INTEGER NOT NULL REFERENCES tvshows(id) ON DELETE CASCADE,
     number INTEGER NOT NULL,
     title TEXT NOT NULL,
-    path TEXT NOT NULL
+    path TEXT NOT NULL,
+    poster_path TEXT
 );
 
 CREATE TABLE episodes (
@@ -36,5 +65,95 @@ CREATE TABLE episodes (
     title TEXT NOT NULL,
     path TEXT NOT NULL,
     file_size BIGINT NOT NULL,
-    rating TEXT
+    rating TEXT,
+    missing_since TIMESTAMPTZ,
+    fingerprint TEXT,
+    duration_ms BIGINT,
+    last_number INTEGER,
+    air_date DATE,
+    absolute_number INTEGER,
+    named_season INTEGER,
+    description TEXT,
+    imdb_id TEXT,
+    tmdb_id TEXT,
+    tvdb_id TEXT
+);
+
+CREATE TABLE media_streams (
+    id SERIAL PRIMARY KEY,
+    media_id INTEGER REFERENCES media(id) ON DELETE CASCADE,
+    episode_id INTEGER REFERENCES episodes(id) ON DELETE CASCADE,
+    stream_index INTEGER NOT NULL,
+    stream_type TEXT NOT NULL,
+    codec TEXT NOT NULL,
+    codec_id TEXT NOT NULL,
+    language TEXT,
+    title TEXT,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    forced BOOLEAN NOT NULL DEFAULT FALSE,
+    width INTEGER,
+    height INTEGER,
+    frame_rate DOUBLE PRECISION,
+    channels INTEGER,
+    sample_rate INTEGER,
+    CHECK ((media_id IS NULL) <> (episode_id IS NULL))
+);
+
+CREATE INDEX media_streams_media_idx ON media_streams (media_id, stream_index) WHERE media_id IS NOT NULL;
+CREATE INDEX media_streams_episode_idx ON media_streams (episode_id, stream_index) WHERE episode_id IS NOT NULL;
+
+CREATE TABLE chapters (
+    id SERIAL PRIMARY KEY,
+    media_id INTEGER REFERENCES media(id) ON DELETE CASCADE,
+    episode_id INTEGER REFERENCES episodes(id) ON DELETE CASCADE,
+    chapter_index INTEGER NOT NULL,
+    start_ms BIGINT NOT NULL,
+    end_ms BIGINT,
+    title TEXT,
+    CHECK ((media_id IS NULL) <> (episode_id IS NULL))
+);
+
+CREATE INDEX chapters_media_idx ON chapters (media_id, chapter_index) WHERE media_id IS NOT NULL;
+CREATE INDEX chapters_episode_idx ON chapters (episode_id, chapter_index) WHERE episode_id IS NOT NULL;
+
+CREATE TABLE subtitles (
+    id SERIAL PRIMARY KEY,
+    media_id INTEGER REFERENCES media(id) ON DELETE CASCADE,
+    episode_id INTEGER REFERENCES episodes(id) ON DELETE CASCADE,
+    path TEXT NOT NULL,
+    format TEXT NOT NULL,
+    language TEXT,
+    forced BOOLEAN NOT NULL DEFAULT FALSE,
+    sdh BOOLEAN NOT NULL DEFAULT FALSE,
+    CHECK ((media_id IS NULL) <> (episode_id IS NULL))
+);
+
+CREATE INDEX subtitles_media_idx ON subtitles (media_id) WHERE media_id IS NOT NULL;
+CREATE INDEX subtitles_episode_idx ON subtitles (episode_id) WHERE episode_id IS NOT NULL;
+
+CREATE INDEX media_parent_idx ON media (parent_id) WHERE parent_id IS NOT NULL;
+CREATE INDEX media_version_of_idx ON media (version_of) WHERE version_of IS NOT NULL;
+CREATE INDEX media_fingerprint_idx ON media (fingerprint) WHERE missing_since IS NOT NULL;
+CREATE INDEX episodes_fingerprint_idx ON episodes (fingerprint) WHERE missing_since IS NOT NULL;
+
+CREATE TABLE scan_runs (
+    id SERIAL PRIMARY KEY,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ,
+    status TEXT NOT NULL,
+    added INTEGER NOT NULL DEFAULT 0,
+    updated INTEGER NOT NULL DEFAULT 0,
+    removed INTEGER NOT NULL DEFAULT 0,
+    errors INTEGER NOT NULL DEFAULT 0,
+    warnings INTEGER NOT NULL DEFAULT 0,
+    error TEXT
+);
+
+CREATE TABLE scan_state (
+    path TEXT PRIMARY KEY,
+    is_dir BOOLEAN NOT NULL DEFAULT FALSE,
+    size BIGINT NOT NULL DEFAULT 0,
+    mod_time BIGINT NOT NULL,
+    rules BIGINT NOT NULL DEFAULT 0,
+    sidecars BIGINT NOT NULL DEFAULT 0
 );
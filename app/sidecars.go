@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// dirListings reads each directory once per scan and shares its entries
+// between the videos in it, which each look next to themselves for artwork,
+// subtitles and the other parts of their movie. The nil value reads directories
+// afresh every time.
+type dirListings struct {
+	mu   sync.Mutex
+	dirs map[string]*dirListing
+}
+
+// dirListing is a directory read by dirListings
+type dirListing struct {
+	once    sync.Once
+	entries []os.DirEntry
+	err     error
+}
+
+// read returns the entries of dir, sorted by name
+func (l *dirListings) read(dir string) ([]os.DirEntry, error) {
+	if l == nil {
+		return os.ReadDir(dir)
+	}
+	l.mu.Lock()
+	if l.dirs == nil {
+		l.dirs = make(map[string]*dirListing)
+	}
+	d, ok := l.dirs[dir]
+	if !ok {
+		d = &dirListing{}
+		l.dirs[dir] = d
+	}
+	l.mu.Unlock()
+	d.once.Do(func() { d.entries, d.err = os.ReadDir(dir) })
+	return d.entries, d.err
+}
+
+// sidecarExtensions are the extensions of the files read next to a video
+var sidecarExtensions = slices.Concat([]string{".nfo"}, artworkExtensions, subtitleExtensions)
+
+// isSidecar reports whether a file name has one of the sidecar extensions
+func isSidecar(name string) bool {
+	return slices.Contains(sidecarExtensions, strings.ToLower(filepath.Ext(name)))
+}
+
+// sidecarIndex holds the sidecar files of a directory, so the scan cache can
+// tell when those of a video changed although the video did not. A sidecar
+// named after a video, such as "Heat.nfo" for "Heat.mkv", goes with that video;
+// one named after none of the files in the directory, such as "movie.nfo",
+// goes with all of them, as do the subtitle folders, such as "Subs/" and
+// "Subs/Heat/", whose modification times change as files come and go.
+type sidecarIndex struct {
+	stems    []string // lowercased stems of the other files
+	sidecars []sidecarFile
+}
+
+// sidecarFile is a sidecar file as listed in its directory
+type sidecarFile struct {
+	name    string // lowercased
+	size    int64
+	modTime int64
+}
+
+// newSidecarIndex indexes the entries of a directory
+func newSidecarIndex(dir string, entries []fs.DirEntry) *sidecarIndex {
+	idx := &sidecarIndex{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if isSubtitleDir(entry.Name()) {
+				idx.addSubtitleDir(filepath.Join(dir, entry.Name()))
+			}
+			continue
+		}
+		name := strings.ToLower(entry.Name())
+		if !isSidecar(name) {
+			// Dotfiles such as .DS_Store name no video
+			if stem := strings.TrimSuffix(name, filepath.Ext(name)); stem != "" && !strings.HasPrefix(name, ".") {
+				idx.stems = append(idx.stems, stem)
+			}
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Gone since the directory was read
+			continue
+		}
+		idx.sidecars = append(idx.sidecars, sidecarFile{name: name, size: info.Size(), modTime: info.ModTime().UnixNano()})
+	}
+	return idx
+}
+
+// addSubtitleDir adds a subtitle folder and the folders in it
+func (idx *sidecarIndex) addSubtitleDir(dir string) {
+	name := strings.ToLower(filepath.Base(dir)) + "/"
+	info, err := os.Stat(dir)
+	if err != nil {
+		return
+	}
+	idx.sidecars = append(idx.sidecars, sidecarFile{name: name, modTime: info.ModTime().UnixNano()})
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			idx.sidecars = append(idx.sidecars, sidecarFile{name: name + strings.ToLower(entry.Name()) + "/", modTime: info.ModTime().UnixNano()})
+		}
+	}
+}
+
+// stamp hashes the names, sizes and modification times of the sidecar files
+// that go with a video. It is 0 without an index.
+func (idx *sidecarIndex) stamp(path string) int64 {
+	if idx == nil {
+		return 0
+	}
+	name := strings.ToLower(filepath.Base(path))
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	h := fnv.New64a()
+	for _, sidecar := range idx.sidecars {
+		if !namedAfter(sidecar.name, stem) && idx.named(sidecar.name) {
+			continue
+		}
+		fmt.Fprintf(h, "%q %d %d ", sidecar.name, sidecar.size, sidecar.modTime)
+	}
+	return int64(h.Sum64())
+}
+
+// named reports whether a sidecar file is named after one of the files in the
+// directory
+func (idx *sidecarIndex) named(name string) bool {
+	for _, stem := range idx.stems {
+		if namedAfter(name, stem) {
+			return true
+		}
+	}
+	return false
+}
+
+// namedAfter reports whether a sidecar file name starts with a video's stem,
+// followed by a separator or nothing, as "heat.nfo" and "heat-poster.jpg" do
+// for "heat" but "heatwave.nfo" does not
+func namedAfter(name, stem string) bool {
+	if stem == "" || !strings.HasPrefix(name, stem) {
+		return false
+	}
+	rest := name[len(stem):]
+	return rest == "" || strings.ContainsRune(".-_", rune(rest[0]))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+)
+
+// Container formats recognised by sniffContainer
+const (
+	ContainerMatroska = "matroska" // Matroska and WebM
+	ContainerMP4      = "mp4"      // ISO base media: MP4, MOV, M4V, 3GP
+	ContainerMPEGTS   = "mpegts"   // MPEG transport stream
+	ContainerM2TS     = "m2ts"     // Blu-ray transport stream with timecodes
+	ContainerAVI      = "avi"
+)
+
+// sniffLength is how much of a file sniffContainer reads: enough for three
+// transport stream packets
+const sniffLength = 3 * 192
+
+// Transport stream packet sizes
+const (
+	tsPacketSize   = 188
+	m2tsPacketSize = 192 // 4-byte timecode followed by a TS packet
+	tsSyncByte     = 0x47
+)
+
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// sniffContainer identifies a video container from the magic bytes at the start
+// of a file. It returns an empty string if the format is not recognised.
+func sniffContainer(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	buf := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return detectContainer(buf[:n]), nil
+}
+
+// detectContainer identifies a video container from a file's leading bytes
+func detectContainer(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, ebmlMagic):
+		return ContainerMatroska
+	case len(b) >= 8 && string(b[4:8]) == "ftyp":
+		return ContainerMP4
+	case len(b) >= 12 && string(b[0:4]) == "RIFF" && string(b[8:12]) == "AVI ":
+		return ContainerAVI
+	case syncBytes(b, 0, tsPacketSize):
+		return ContainerMPEGTS
+	case syncBytes(b, 4, m2tsPacketSize):
+		return ContainerM2TS
+	}
+	return ""
+}
+
+// syncBytes reports whether b holds at least two transport stream packets of the
+// given size with a sync byte at offset in each. A single 0x47 byte is too common
+// to mean anything on its own.
+func syncBytes(b []byte, offset, size int) bool {
+	packets := 0
+	for i := offset; i < len(b); i += size {
+		if b[i] != tsSyncByte {
+			return false
+		}
+		packets++
+	}
+	return packets >= 2
+}
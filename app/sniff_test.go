@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tsPackets builds n transport stream packets of the given size with the sync
+// byte at offset
+func tsPackets(n, size, offset int) []byte {
+	b := make([]byte, n*size)
+	for i := 0; i < n; i++ {
+		b[i*size+offset] = tsSyncByte
+	}
+	return b
+}
+
+// Leading bytes of each container, padded like the start of a real file
+var containerHeaders = map[string][]byte{
+	ContainerMatroska: append([]byte{0x1A, 0x45, 0xDF, 0xA3, 0x9F, 0x42, 0x86, 0x81, 0x01}, []byte("webm")...),
+	ContainerMP4:      append([]byte{0x00, 0x00, 0x00, 0x20}, []byte("ftypisom\x00\x00\x02\x00isomiso2avc1mp41")...),
+	ContainerAVI:      append([]byte("RIFF\x10\x00\x00\x00AVI LIST"), make([]byte, 64)...),
+	ContainerMPEGTS:   tsPackets(4, tsPacketSize, 0),
+	ContainerM2TS:     tsPackets(4, m2tsPacketSize, 4),
+}
+
+func TestDetectContainer(t *testing.T) {
+	for want, header := range containerHeaders {
+		if got := detectContainer(header); got != want {
+			t.Errorf("detectContainer(%s header) = %q, want %q", want, got, want)
+		}
+	}
+
+	notVideo := map[string][]byte{
+		"empty":            nil,
+		"text":             []byte("This is a subtitle file, not a video\n"),
+		"truncated EBML":   {0x1A, 0x45},
+		"RIFF WAVE":        []byte("RIFF\x10\x00\x00\x00WAVEfmt "),
+		"single sync byte": append([]byte{tsSyncByte}, bytes.Repeat([]byte{0}, 400)...),
+		"short TS":         tsPackets(1, tsPacketSize, 0),
+	}
+	for name, header := range notVideo {
+		if got := detectContainer(header); got != "" {
+			t.Errorf("detectContainer(%s) = %q, want none", name, got)
+		}
+	}
+}
+
+func TestSniffContainerReadsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recording")
+	if err := os.WriteFile(path, append(containerHeaders[ContainerMPEGTS], make([]byte, 4096)...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := sniffContainer(path)
+	if err != nil || got != ContainerMPEGTS {
+		t.Errorf("sniffContainer = %q, %v; want %q", got, err, ContainerMPEGTS)
+	}
+	if _, err := sniffContainer(filepath.Join(dir, "missing")); err == nil {
+		t.Errorf("sniffContainer of a missing file returned no error")
+	}
+}
+
+func TestScanMediaExtensionsPerLibrary(t *testing.T) {
+	cfg := newTestLibrary(t)
+	cfg.MovieExtensions = []string{"mkv", ".TS"}
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Heat.1995.mkv"), "movie")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Recording.ts"), "movie")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Old.avi"), "movie")
+	// The TV library keeps the default extensions
+	writeFile(t, filepath.Join(cfg.TVDir, "Show", "Season 1", "Show.S01E01.avi"), "episode")
+	writeFile(t, filepath.Join(cfg.TVDir, "Show", "Season 1", "Show.S01E02.3gp"), "episode")
+
+	repo := newFakeRepo()
+	if _, err := ScanMedia(context.Background(), repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"Heat.1995.mkv", "Recording.ts"} {
+		if _, err := repo.GetMediaByPath(context.Background(), filepath.Join(cfg.MoviesDir, path)); err != nil {
+			t.Errorf("%s was not scanned", path)
+		}
+	}
+	if _, err := repo.GetMediaByPath(context.Background(), filepath.Join(cfg.MoviesDir, "Old.avi")); err == nil {
+		t.Errorf("Old.avi was scanned although .avi is not a movie extension")
+	}
+	if len(repo.episodes) != 2 {
+		t.Errorf("scanned %d episodes, want 2", len(repo.episodes))
+	}
+}
+
+func TestScanMediaSniffsUnrecognisedFiles(t *testing.T) {
+	cfg := newTestLibrary(t)
+	cfg.Sniff = true
+	mkv := string(containerHeaders[ContainerMatroska])
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Heat (1995)", "Heat.1995"), mkv)             // no extension
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Alien (1979)", "Alien.1979.bin"), mkv)       // mislabelled
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Alien (1979)", "Alien.1979.nfo"), "<movie>") // not a video
+	writeFile(t, filepath.Join(cfg.TVDir, "Show", "Season 1", "Show.S01E01.dat"), string(containerHeaders[ContainerM2TS]))
+
+	repo := newFakeRepo()
+	summary, err := ScanMedia(context.Background(), repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Added != 3 {
+		t.Errorf("scan added %d, want 3", summary.Added)
+	}
+	if _, err := repo.GetMediaByPath(context.Background(), filepath.Join(cfg.MoviesDir, "Alien (1979)", "Alien.1979.nfo")); err == nil {
+		t.Errorf("NFO file was scanned as a video")
+	}
+
+	// Without sniffing only recognised extensions count
+	cfg.Sniff = false
+	repo = newFakeRepo()
+	if summary, _ := ScanMedia(context.Background(), repo, cfg, nil, false); summary.Added != 0 {
+		t.Errorf("scan without sniffing added %d, want 0", summary.Added)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"transogov2/app/views/components"
+)
+
+// sseFlushInterval limits how often events are written to a client. Only the
+// latest event of each name is sent, so a fast scan doesn't flood the browser.
+const sseFlushInterval = 250 * time.Millisecond
+
+// EventsHandler streams events from the event bus as Server-Sent Events. Each
+// event's data is an HTML fragment for htmx's SSE extension to swap in.
+func (h *Handlers) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe := h.events.Subscribe(64)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(sseFlushInterval)
+	defer ticker.Stop()
+
+	var order []string
+	pending := make(map[string]Event)
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-events:
+			if _, ok := pending[e.Name]; !ok {
+				order = append(order, e.Name)
+			}
+			pending[e.Name] = e
+		case <-ticker.C:
+			if len(order) == 0 {
+				continue
+			}
+			for _, name := range order {
+				if err := writeSSE(w, r, pending[name]); err != nil {
+					log.Printf("Error writing event %s: %v", name, err)
+					return
+				}
+			}
+			order = order[:0]
+			clear(pending)
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE renders an event and writes it in the text/event-stream format
+func writeSSE(w http.ResponseWriter, r *http.Request, e Event) error {
+	var buf bytes.Buffer
+	switch data := e.Data.(type) {
+	case ScanProgress:
+		state := components.ScanRunning
+		switch {
+		case data.Cancelled:
+			state = components.ScanCancelled
+		case data.Failed:
+			state = components.ScanFailed
+		case data.Done:
+			state = components.ScanComplete
+		}
+		err := components.ScanProgress(data.Dir, data.Seen, data.Added, data.Errors, state).Render(r.Context(), &buf)
+		if err != nil {
+			return err
+		}
+	default:
+		fmt.Fprint(&buf, data)
+	}
+
+	if _, err := fmt.Fprintf(w, "event: %s\n", e.Name); err != nil {
+		return err
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if _, err := fmt.Fprintf(w, "data: %s\n", line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprint(w, "\n")
+	return err
+}
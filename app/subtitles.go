@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"transogov2/app/models"
+	"transogov2/app/webvtt"
+)
+
+// subtitleExtensions are the subtitle formats picked up next to video files
+var subtitleExtensions = []string{".srt", ".ass", ".ssa", ".vtt"}
+
+// subtitleDirNames are the names of folders holding the subtitles of the videos
+// next to them, matched case-insensitively
+var subtitleDirNames = []string{"subs", "subtitles"}
+
+// subtitleLanguages lists the ISO 639-2 code Matroska files use for a language,
+// followed by the other codes and names it goes by in subtitle file names
+var subtitleLanguages = [][]string{
+	{"eng", "en", "english"},
+	{"fre", "fr", "fra", "french", "francais"},
+	{"ger", "de", "deu", "german", "deutsch"},
+	{"spa", "es", "spanish", "espanol"},
+	{"ita", "it", "italian", "italiano"},
+	{"por", "pt", "portuguese", "brazilian"},
+	{"dut", "nl", "nld", "dutch"},
+	{"swe", "sv", "swedish"},
+	{"nor", "nb", "nob", "norwegian"},
+	{"dan", "da", "danish"},
+	{"fin", "fi", "finnish"},
+	{"pol", "pl", "polish"},
+	{"rus", "ru", "russian"},
+	{"jpn", "ja", "japanese"},
+	{"kor", "ko", "korean"},
+	{"chi", "zh", "zho", "chinese"},
+	{"ara", "ar", "arabic"},
+	{"hin", "hi", "hindi"},
+	{"tur", "tr", "turkish"},
+	{"gre", "el", "ell", "greek"},
+	{"heb", "he", "hebrew"},
+	{"cze", "cs", "ces", "czech"},
+	{"hun", "hu", "hungarian"},
+}
+
+// languageCodes maps every code and name in subtitleLanguages to its ISO 639-2 code
+var languageCodes = func() map[string]string {
+	codes := make(map[string]string)
+	for _, names := range subtitleLanguages {
+		for _, name := range names {
+			codes[name] = names[0]
+		}
+	}
+	return codes
+}()
+
+// isSubtitleFile checks if a file extension is one of the subtitle formats
+func isSubtitleFile(ext string) bool {
+	return slices.Contains(subtitleExtensions, strings.ToLower(ext))
+}
+
+// isSubtitleDir checks if a folder name is one of subtitleDirNames
+func isSubtitleDir(name string) bool {
+	return slices.Contains(subtitleDirNames, strings.ToLower(name))
+}
+
+// subtitleWords splits the tags of a subtitle file name into lower-case words
+func subtitleWords(tags string) []string {
+	return strings.FieldsFunc(strings.ToLower(tags), func(r rune) bool {
+		return r == '.' || r == '_' || r == '-' || r == ' ' || r == '(' || r == ')' || r == '[' || r == ']'
+	})
+}
+
+// onlySubtitleTags reports whether the rest of a subtitle file name after the
+// name of a video holds nothing but languages and flags, as ".en.forced" and
+// ".pt-BR" do, rather than naming another video, as ".Resurrection.en" does
+// after "Alien" and ".2160p.en" after "Heat.1995".
+func onlySubtitleTags(tags string) bool {
+	prev := ""
+	for _, word := range subtitleWords(tags) {
+		switch {
+		case languageCodes[word] != "":
+		case word == "forced" || word == "foreign" || word == "sdh" || word == "cc" || word == "hoh":
+		case len(word) == 2 && languageCodes[prev] != "":
+			// A region, as in "pt-BR"
+		default:
+			return false
+		}
+		prev = word
+	}
+	return true
+}
+
+// parseSubtitleName reads the language and flags from the part of a subtitle
+// file name that does not name its video, such as ".en.forced" in
+// "Heat.en.forced.srt" or "2_English" in "Subs/Heat/2_English.srt". "hi" is
+// Hindi unless it follows a language, as in ".en.hi".
+func parseSubtitleName(path, tags string) models.Subtitle {
+	sub := models.Subtitle{
+		Path:   path,
+		Format: strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."),
+	}
+	for _, word := range subtitleWords(tags) {
+		switch {
+		case word == "forced" || word == "foreign":
+			sub.Forced = true
+		case word == "sdh" || word == "cc" || word == "hoh" || (word == "hi" && sub.Language.Valid):
+			sub.SDH = true
+		case !sub.Language.Valid && languageCodes[word] != "":
+			sub.Language = nullString(languageCodes[word])
+		}
+	}
+	return sub
+}
+
+// findSubtitles returns the subtitle files of a video: those named after it next
+// to it or in a Subs folder beside it, such as "Heat.en.srt" and
+// "Subs/Heat.en.srt", and every file in "Subs/Heat/". A video with a folder of
+// its own, as a movie in a movie folder, also gets the other files directly in
+// its Subs folder, such as "Subs/2_English.srt".
+func findSubtitles(dirs *dirListings, path string, ownFolder bool) []models.Subtitle {
+	dir := filepath.Dir(path)
+	stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var subtitles []models.Subtitle
+
+	// named reports whether a subtitle file is named after the video, with
+	// nothing but languages and flags after its name, and returns those
+	named := func(name string) (string, bool) {
+		base := strings.TrimSuffix(name, filepath.Ext(name))
+		if len(base) < len(stem) || !strings.EqualFold(base[:len(stem)], stem) {
+			return "", false
+		}
+		rest := base[len(stem):]
+		return rest, rest == "" || rest[0] == '.' && onlySubtitleTags(rest)
+	}
+	// add adds the subtitle files in a directory, with all set for those not
+	// named after the video
+	add := func(dir string, all bool) []os.DirEntry {
+		entries, err := dirs.read(dir)
+		if err != nil {
+			log.Printf("Error reading directory %s: %v", dir, err)
+			return nil
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !isSubtitleFile(filepath.Ext(name)) {
+				continue
+			}
+			if tags, ok := named(name); ok {
+				subtitles = append(subtitles, parseSubtitleName(filepath.Join(dir, name), tags))
+			} else if all {
+				subtitles = append(subtitles, parseSubtitleName(filepath.Join(dir, name), strings.TrimSuffix(name, filepath.Ext(name))))
+			}
+		}
+		return entries
+	}
+
+	for _, entry := range add(dir, false) {
+		if !entry.IsDir() || !isSubtitleDir(entry.Name()) {
+			continue
+		}
+		subsDir := filepath.Join(dir, entry.Name())
+		for _, sub := range add(subsDir, ownFolder) {
+			if sub.IsDir() && strings.EqualFold(sub.Name(), stem) {
+				add(filepath.Join(subsDir, sub.Name()), true)
+			}
+		}
+	}
+	return subtitles
+}
+
+// sameSubtitles reports whether two lists of subtitle files have the same files
+// with the same languages and flags, in any order
+func sameSubtitles(a, b []models.Subtitle) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	byPath := make(map[string]models.Subtitle, len(a))
+	for _, sub := range a {
+		byPath[sub.Path] = sub
+	}
+	for _, sub := range b {
+		other, ok := byPath[sub.Path]
+		if !ok || other.Format != sub.Format || other.Language != sub.Language || other.Forced != sub.Forced || other.SDH != sub.SDH {
+			return false
+		}
+	}
+	return true
+}
+
+// updateMovieSubtitles stores the subtitle files found for a movie if they changed
+func updateMovieSubtitles(ctx context.Context, repo MediaRepository, media models.Media, s *scanSession) {
+	root, _ := s.filter.root(media.Path)
+	found := findSubtitles(s.dirs, media.Path, filepath.Dir(media.Path) != root && !media.ExtraType.Valid)
+	current, err := repo.GetMediaSubtitles(ctx, media.ID)
+	if err != nil {
+		log.Printf("Error retrieving subtitles for %s: %v", media.Path, err)
+		s.fail()
+		return
+	}
+	if sameSubtitles(found, current) {
+		return
+	}
+	if err := repo.SetMediaSubtitles(ctx, media.ID, found); err != nil {
+		log.Printf("Error saving subtitles for %s: %v", media.Path, err)
+		s.fail()
+	}
+}
+
+// updateEpisodeSubtitles stores the subtitle files found for an episode if they
+// changed. Episodes share their folder, so only subtitles named after the
+// episode are its own.
+func updateEpisodeSubtitles(ctx context.Context, repo MediaRepository, id int64, path string, s *scanSession) {
+	found := findSubtitles(s.dirs, path, false)
+	current, err := repo.GetEpisodeSubtitles(ctx, id)
+	if err != nil {
+		log.Printf("Error retrieving subtitles for %s: %v", path, err)
+		s.fail()
+		return
+	}
+	if sameSubtitles(found, current) {
+		return
+	}
+	if err := repo.SetEpisodeSubtitles(ctx, id, found); err != nil {
+		log.Printf("Error saving subtitles for %s: %v", path, err)
+		s.fail()
+	}
+}
+
+// maxSubtitleSize caps the size of subtitle files converted for the player
+const maxSubtitleSize = 10 << 20
+
+// maxCachedSubtitleBytes is about how much memory the cues of the subtitle files
+// converted for the player may take
+const maxCachedSubtitleBytes = 32 << 20
+
+// vttCache keeps the cues of the subtitle files played most recently, so
+// reloading the player or moving the subtitles does not read and parse them
+// again. The cues are kept without an offset, which is applied as they are
+// written. Entries are keyed by the file's size and modification time, so
+// edited files are parsed afresh. The zero value is ready to use.
+type vttCache struct {
+	// limit is the most bytes of cues kept; zero means maxCachedSubtitleBytes
+	limit int
+
+	mu      sync.Mutex
+	entries map[vttKey]webvtt.Cues
+	order   []vttKey // least recently used first
+	size    int      // bytes of cues kept
+}
+
+// vttKey identifies a version of a subtitle file
+type vttKey struct {
+	path    string
+	size    int64
+	modTime int64
+}
+
+// convert returns a subtitle file as WebVTT shifted by offset, parsing it
+// unless its cues are cached. info is the file's current state.
+func (c *vttCache) convert(sub models.Subtitle, info fs.FileInfo, offset time.Duration) ([]byte, error) {
+	key := vttKey{path: sub.Path, size: info.Size(), modTime: info.ModTime().UnixNano()}
+	if cues, ok := c.get(key); ok {
+		return cues.WebVTT(offset), nil
+	}
+
+	if info.Size() > maxSubtitleSize {
+		return nil, fmt.Errorf("subtitle file is larger than %d bytes", maxSubtitleSize)
+	}
+	raw, err := os.ReadFile(sub.Path)
+	if err != nil {
+		return nil, err
+	}
+	cues, err := webvtt.Parse(sub.Format, raw)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, cues)
+	return cues.WebVTT(offset), nil
+}
+
+// get returns the cached cues of a file and marks them as used
+func (c *vttCache) get(key vttKey) (webvtt.Cues, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cues, ok := c.entries[key]
+	if ok {
+		c.order = append(slices.DeleteFunc(c.order, func(k vttKey) bool { return k == key }), key)
+	}
+	return cues, ok
+}
+
+// put caches the cues of a file, dropping the least recently used ones to stay
+// within the limit. Cues larger than the limit are not kept.
+func (c *vttCache) put(key vttKey, cues webvtt.Cues) {
+	limit := c.limit
+	if limit == 0 {
+		limit = maxCachedSubtitleBytes
+	}
+	size := cues.Size()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok || size > limit {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[vttKey]webvtt.Cues)
+	}
+	for c.size+size > limit {
+		oldest := c.order[0]
+		c.size -= c.entries[oldest].Size()
+		delete(c.entries, oldest)
+		c.order = c.order[1:]
+	}
+	c.entries[key] = cues
+	c.order = append(c.order, key)
+	c.size += size
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"transogov2/app/models"
+	"transogov2/app/webvtt"
+)
+
+func TestParseSubtitleName(t *testing.T) {
+	tests := []struct {
+		tags     string
+		language string
+		forced   bool
+		sdh      bool
+	}{
+		{".en", "eng", false, false},
+		{".eng", "eng", false, false},
+		{".forced.eng", "eng", true, false},
+		{".English.SDH", "eng", false, true},
+		{".en.hi", "eng", false, true},
+		{".hi", "hin", false, false},
+		{".pt-BR", "por", false, false},
+		{".de.cc.forced", "ger", true, true},
+		{"2_English", "eng", false, false},
+		{"3_French (Forced)", "fre", true, false},
+		{"", "", false, false},
+		{".commentary", "", false, false},
+	}
+	for _, tt := range tests {
+		sub := parseSubtitleName("/movies/Heat.SRT", tt.tags)
+		if sub.Language.String != tt.language || sub.Forced != tt.forced || sub.SDH != tt.sdh || sub.Format != "srt" {
+			t.Errorf("parseSubtitleName(%q) = %q, forced %v, SDH %v, format %q, want %q, %v, %v, srt",
+				tt.tags, sub.Language.String, sub.Forced, sub.SDH, sub.Format, tt.language, tt.forced, tt.sdh)
+		}
+	}
+}
+
+// subtitlePaths lists the paths of subtitle files relative to dir
+func subtitlePaths(t *testing.T, dir string, subtitles []models.Subtitle) string {
+	t.Helper()
+	var paths []string
+	for _, sub := range subtitles {
+		rel, err := filepath.Rel(dir, sub.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.ToSlash(rel))
+	}
+	return strings.Join(paths, ",")
+}
+
+func TestFindSubtitles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"Heat.mkv",
+		"Heat.srt",
+		"Heat.en.srt",
+		"Heat.forced.eng.ass",
+		"Heat.nfo",
+		"Heat.pt-BR.sdh.srt",
+		"Heat 2.en.srt", // another video's
+		"Heatwave.srt",
+		"Heat.1995.2160p.mkv",
+		"Heat.1995.2160p.en.srt",
+		"Alien.mkv",
+		"Alien.Resurrection.mkv",
+		"Alien.Resurrection.en.srt",
+		"Subs/Heat.fr.srt",
+		"Subs/2_English.srt",
+		"Subs/Heat/3_Spanish.srt",
+		"Subs/Other/4_German.srt",
+	} {
+		writeFile(t, filepath.Join(dir, name), "")
+	}
+
+	got := subtitlePaths(t, dir, findSubtitles(nil, filepath.Join(dir, "Heat.mkv"), true))
+	if want := "Heat.en.srt,Heat.forced.eng.ass,Heat.pt-BR.sdh.srt,Heat.srt,Subs/2_English.srt,Subs/Heat.fr.srt,Subs/Heat/3_Spanish.srt"; got != want {
+		t.Errorf("subtitles in a movie folder = %s, want %s", got, want)
+	}
+	// Videos sharing a folder only get the files named after them
+	got = subtitlePaths(t, dir, findSubtitles(nil, filepath.Join(dir, "Heat.mkv"), false))
+	if want := "Heat.en.srt,Heat.forced.eng.ass,Heat.pt-BR.sdh.srt,Heat.srt,Subs/Heat.fr.srt,Subs/Heat/3_Spanish.srt"; got != want {
+		t.Errorf("subtitles in a shared folder = %s, want %s", got, want)
+	}
+
+	// Names that only start with the video's name belong to other videos
+	tests := []struct{ video, want string }{
+		{"Heat.1995.2160p.mkv", "Heat.1995.2160p.en.srt"},
+		{"Alien.mkv", ""},
+		{"Alien.Resurrection.mkv", "Alien.Resurrection.en.srt"},
+	}
+	for _, tt := range tests {
+		if got := subtitlePaths(t, dir, findSubtitles(nil, filepath.Join(dir, tt.video), false)); got != tt.want {
+			t.Errorf("subtitles of %s = %s, want %s", tt.video, got, tt.want)
+		}
+	}
+}
+
+func TestScanFindsSubtitles(t *testing.T) {
+	cfg := newTestLibrary(t)
+	moviePath := filepath.Join(cfg.MoviesDir, "Heat (1995)", "Heat.1995.1080p.mkv")
+	writeFile(t, moviePath, "movie")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Heat (1995)", "Heat.1995.1080p.en.srt"), "")
+	writeFile(t, filepath.Join(cfg.MoviesDir, "Heat (1995)", "Subs", "2_French.srt"), "")
+	episodePath := filepath.Join(cfg.TVDir, "The Wire", "Season 1", "The.Wire.S01E01.mkv")
+	writeFile(t, episodePath, "episode")
+	writeFile(t, filepath.Join(cfg.TVDir, "The Wire", "Season 1", "The.Wire.S01E01.forced.eng.srt"), "")
+	writeFile(t, filepath.Join(cfg.TVDir, "The Wire", "Season 1", "The.Wire.S01E02.en.srt"), "")
+
+	repo := newFakeRepo()
+	ctx := context.Background()
+	summary, err := ScanMedia(ctx, repo, cfg, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Subtitle files are not media of their own
+	if summary.Added != 2 {
+		t.Errorf("added %d files, want the movie and the episode", summary.Added)
+	}
+
+	heat, _ := repo.GetMediaByPath(ctx, moviePath)
+	subtitles, _ := repo.GetMediaSubtitles(ctx, heat.ID)
+	dir := filepath.Dir(moviePath)
+	if got := subtitlePaths(t, dir, subtitles); got != "Heat.1995.1080p.en.srt,Subs/2_French.srt" {
+		t.Errorf("Heat subtitles = %s", got)
+	}
+	if len(subtitles) == 2 && subtitles[1].Language.String != "fre" {
+		t.Errorf("Subs/2_French.srt language = %q, want fre", subtitles[1].Language.String)
+	}
+
+	episode, _ := repo.GetEpisodeByPath(ctx, episodePath)
+	subtitles, _ = repo.GetEpisodeSubtitles(ctx, episode.ID)
+	if len(subtitles) != 1 || !subtitles[0].Forced || subtitles[0].Language.String != "eng" {
+		t.Errorf("episode subtitles = %+v, want one forced English file", subtitles)
+	}
+
+	// Unchanged subtitles keep their IDs on a full rescan, removed ones go
+	id := subtitles[0].ID
+	if err := os.Remove(filepath.Join(dir, "Subs", "2_French.srt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ScanMedia(ctx, repo, cfg, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if subtitles, _ := repo.GetEpisodeSubtitles(ctx, episode.ID); len(subtitles) != 1 || subtitles[0].ID != id {
+		t.Errorf("episode subtitles after a rescan = %+v, want the same row", subtitles)
+	}
+	if subtitles, _ := repo.GetMediaSubtitles(ctx, heat.ID); subtitlePaths(t, dir, subtitles) != "Heat.1995.1080p.en.srt" {
+		t.Errorf("Heat subtitles after a rescan = %s, want the remaining file", subtitlePaths(t, dir, subtitles))
+	}
+}
+
+func TestIncrementalScanFindsAddedSubtitles(t *testing.T) {
+	cfg := newTestLibrary(t)
+	movieDir := filepath.Join(cfg.MoviesDir, "Heat (1995)")
+	moviePath := filepath.Join(movieDir, "Heat.1995.1080p.mkv")
+	writeFile(t, moviePath, "movie")
+	writeFile(t, filepath.Join(movieDir, "Subs", "Heat.1995.1080p", "2_French.srt"), "")
+
+	repo := newFakeRepo()
+	ctx := context.Background()
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	heat, _ := repo.GetMediaByPath(ctx, moviePath)
+
+	// Added next to the unchanged video
+	writeFile(t, filepath.Join(movieDir, "Heat.1995.1080p.en.srt"), "")
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	subtitles, _ := repo.GetMediaSubtitles(ctx, heat.ID)
+	if got := subtitlePaths(t, movieDir, subtitles); got != "Heat.1995.1080p.en.srt,Subs/Heat.1995.1080p/2_French.srt" {
+		t.Errorf("Heat subtitles = %s, want the added file", got)
+	}
+
+	// Added to a subtitle folder, leaving the movie folder as it was
+	writeFile(t, filepath.Join(movieDir, "Subs", "Heat.1995.1080p", "3_Spanish.srt"), "")
+	if _, err := ScanMedia(ctx, repo, cfg, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	subtitles, _ = repo.GetMediaSubtitles(ctx, heat.ID)
+	if got := subtitlePaths(t, movieDir, subtitles); got != "Heat.1995.1080p.en.srt,Subs/Heat.1995.1080p/2_French.srt,Subs/Heat.1995.1080p/3_Spanish.srt" {
+		t.Errorf("Heat subtitles = %s, want the file added to Subs", got)
+	}
+}
+
+func TestVTTCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Heat.en.srt")
+	writeFile(t, path, "00:00:01,000 --> 00:00:02,000\nHello\n")
+	sub := models.Subtitle{Path: path, Format: "srt"}
+	var cache vttCache
+
+	convert := func(offset time.Duration) string {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := cache.convert(sub, info, offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+	first := convert(0)
+	if !strings.Contains(first, "Hello") {
+		t.Fatalf("converted = %q", first)
+	}
+
+	// A rewrite that keeps the size and modification time is not noticed
+	info, _ := os.Stat(path)
+	writeFile(t, path, "00:00:01,000 --> 00:00:02,000\nHallo\n")
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	if got := convert(0); got != first {
+		t.Errorf("converted again = %q, want the cached %q", got, first)
+	}
+	// Other offsets shift the cached cues; edited files are parsed afresh
+	if got := convert(time.Second); !strings.Contains(got, "00:00:02.000 --> 00:00:03.000\nHello") {
+		t.Errorf("converted with an offset = %q, want the cached cues shifted", got)
+	}
+	if err := os.Chtimes(path, info.ModTime().Add(time.Minute), info.ModTime().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if got := convert(0); !strings.Contains(got, "Hallo") {
+		t.Errorf("converted after an edit = %q, want the new text", got)
+	}
+}
+
+func TestVTTCacheLimit(t *testing.T) {
+	dir := t.TempDir()
+	cues, err := webvtt.Parse("srt", []byte("00:00:01,000 --> 00:00:02,000\nHello\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := vttCache{limit: 3 * cues.Size()}
+	convert := func(name string) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err != nil {
+			writeFile(t, path, "00:00:01,000 --> 00:00:02,000\nHello\n")
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cache.convert(models.Subtitle{Path: path, Format: "srt"}, info, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cached := func() string {
+		var names []string
+		for _, key := range cache.order {
+			names = append(names, filepath.Base(key.path))
+		}
+		return strings.Join(names, ",")
+	}
+
+	for _, name := range []string{"a.srt", "b.srt", "c.srt", "a.srt", "d.srt"} {
+		convert(name)
+	}
+	// The least recently used file goes first
+	if got := cached(); got != "c.srt,a.srt,d.srt" || len(cache.entries) != 3 || cache.size != 3*cues.Size() {
+		t.Errorf("cache holds %s (%d entries, %d bytes), want c.srt,a.srt,d.srt in %d bytes", got, len(cache.entries), cache.size, 3*cues.Size())
+	}
+	// Files larger than the limit are not kept
+	writeFile(t, filepath.Join(dir, "long.srt"), strings.Repeat("00:00:01,000 --> 00:00:02,000\nHello\n\n", 4))
+	convert("long.srt")
+	if got := cached(); got != "c.srt,a.srt,d.srt" {
+		t.Errorf("cache holds %s after a file over the limit, want it unchanged", got)
+	}
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"transogov2/app/models"
+)
+
+// maxTMDBResponse caps the size of API responses and downloaded images
+const maxTMDBResponse = 20 << 20
+
+// maxTMDBRetries is how often a rate-limited request is retried
+const maxTMDBRetries = 3
+
+// TMDBProvider is a MetadataProvider for The Movie Database API, or any API
+// compatible with it. Requests are rate limited and successful responses are
+// cached on disk.
+type TMDBProvider struct {
+	baseURL      string
+	imageBaseURL string
+	apiKey       string
+	accessToken  string
+	language     string
+	client       *http.Client
+	limiter      *rateLimiter
+	cache        *responseCache
+}
+
+// NewTMDBProvider creates a TMDB client from the metadata configuration
+func NewTMDBProvider(cfg *MetadataConfig) *TMDBProvider {
+	cache := &responseCache{ttl: cfg.CacheTTL}
+	if cfg.CacheDir != "" {
+		cache.dir = filepath.Join(cfg.CacheDir, "tmdb")
+	}
+	return &TMDBProvider{
+		baseURL:      strings.TrimSuffix(cfg.TMDBBaseURL, "/"),
+		imageBaseURL: strings.TrimSuffix(cfg.TMDBImageBaseURL, "/"),
+		apiKey:       cfg.TMDBAPIKey,
+		accessToken:  cfg.TMDBAccessToken,
+		language:     cfg.Language,
+		client:       &http.Client{Timeout: 30 * time.Second},
+		limiter:      newRateLimiter(cfg.RateLimit),
+		cache:        cache,
+	}
+}
+
+// tmdbMovie is a movie as returned by the movie details and search endpoints
+type tmdbMovie struct {
+	ID            int64   `json:"id"`
+	Title         string  `json:"title"`
+	OriginalTitle string  `json:"original_title"`
+	ReleaseDate   string  `json:"release_date"`
+	Overview      string  `json:"overview"`
+	VoteAverage   float64 `json:"vote_average"`
+	PosterPath    string  `json:"poster_path"`
+	BackdropPath  string  `json:"backdrop_path"`
+	IMDbID        string  `json:"imdb_id"`
+}
+
+// tmdbTVShow is a TV show as returned by the TV details and search endpoints
+type tmdbTVShow struct {
+	ID           int64           `json:"id"`
+	Name         string          `json:"name"`
+	OriginalName string          `json:"original_name"`
+	FirstAirDate string          `json:"first_air_date"`
+	Overview     string          `json:"overview"`
+	VoteAverage  float64         `json:"vote_average"`
+	PosterPath   string          `json:"poster_path"`
+	BackdropPath string          `json:"backdrop_path"`
+	ExternalIDs  tmdbExternalIDs `json:"external_ids"`
+}
+
+// tmdbExternalIDs are the IDs appended to TV show details
+type tmdbExternalIDs struct {
+	IMDbID string `json:"imdb_id"`
+	TVDbID int64  `json:"tvdb_id"`
+}
+
+// SearchMovies searches for movies by title, and release year if not 0
+func (p *TMDBProvider) SearchMovies(ctx context.Context, title string, year int) ([]MetadataMatch, error) {
+	query := url.Values{"query": {title}}
+	if year != 0 {
+		query.Set("year", strconv.Itoa(year))
+	}
+	var page struct {
+		Results []tmdbMovie `json:"results"`
+	}
+	if err := p.get(ctx, "/search/movie", query, &page); err != nil {
+		return nil, err
+	}
+	matches := make([]MetadataMatch, 0, len(page.Results))
+	for _, m := range page.Results {
+		matches = append(matches, MetadataMatch{
+			ID:            strconv.FormatInt(m.ID, 10),
+			Title:         m.Title,
+			OriginalTitle: m.OriginalTitle,
+			Year:          int(tmdbYear(m.ReleaseDate).Int64),
+		})
+	}
+	return matches, nil
+}
+
+// SearchTVShows searches for TV shows by title, and first air year if not 0
+func (p *TMDBProvider) SearchTVShows(ctx context.Context, title string, year int) ([]MetadataMatch, error) {
+	query := url.Values{"query": {title}}
+	if year != 0 {
+		query.Set("first_air_date_year", strconv.Itoa(year))
+	}
+	var page struct {
+		Results []tmdbTVShow `json:"results"`
+	}
+	if err := p.get(ctx, "/search/tv", query, &page); err != nil {
+		return nil, err
+	}
+	matches := make([]MetadataMatch, 0, len(page.Results))
+	for _, s := range page.Results {
+		matches = append(matches, MetadataMatch{
+			ID:            strconv.FormatInt(s.ID, 10),
+			Title:         s.Name,
+			OriginalTitle: s.OriginalName,
+			Year:          int(tmdbYear(s.FirstAirDate).Int64),
+		})
+	}
+	return matches, nil
+}
+
+// Movie fetches a movie by its TMDB ID
+func (p *TMDBProvider) Movie(ctx context.Context, id string) (ProviderMetadata, error) {
+	var m tmdbMovie
+	if err := p.get(ctx, "/movie/"+url.PathEscape(id), nil, &m); err != nil {
+		return ProviderMetadata{}, err
+	}
+	meta := ProviderMetadata{
+		Metadata: models.Metadata{
+			Title:       nullString(m.Title),
+			Year:        tmdbYear(m.ReleaseDate),
+			Description: nullString(m.Overview),
+			Rating:      tmdbRating(m.VoteAverage),
+		},
+		Poster: m.PosterPath,
+		Fanart: m.BackdropPath,
+	}
+	meta.TMDbID = nullString(strconv.FormatInt(m.ID, 10))
+	meta.IMDbID = nullString(m.IMDbID)
+	return meta, nil
+}
+
+// TVShow fetches a TV show by its TMDB ID
+func (p *TMDBProvider) TVShow(ctx context.Context, id string) (ProviderMetadata, error) {
+	var s tmdbTVShow
+	query := url.Values{"append_to_response": {"external_ids"}}
+	if err := p.get(ctx, "/tv/"+url.PathEscape(id), query, &s); err != nil {
+		return ProviderMetadata{}, err
+	}
+	meta := ProviderMetadata{
+		Metadata: models.Metadata{
+			Title:       nullString(s.Name),
+			Year:        tmdbYear(s.FirstAirDate),
+			Description: nullString(s.Overview),
+			Rating:      tmdbRating(s.VoteAverage),
+			ExternalIDs: s.ExternalIDs.ids(),
+		},
+		Poster: s.PosterPath,
+		Fanart: s.BackdropPath,
+	}
+	meta.TMDbID = nullString(strconv.FormatInt(s.ID, 10))
+	return meta, nil
+}
+
+// Artwork downloads an image by the path given in API responses
+func (p *TMDBProvider) Artwork(ctx context.Context, ref string) ([]byte, error) {
+	if !strings.HasPrefix(ref, "/") || strings.Contains(ref, "..") {
+		return nil, fmt.Errorf("invalid artwork path %q", ref)
+	}
+	return p.fetch(ctx, p.imageBaseURL+ref, false)
+}
+
+// get calls an API endpoint and decodes its JSON response into v, using the
+// cached response if there is a fresh one
+func (p *TMDBProvider) get(ctx context.Context, endpoint string, query url.Values, v any) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	if p.language != "" {
+		query.Set("language", p.language)
+	}
+	// The API key is left out of the cache key
+	key := endpoint + "?" + query.Encode()
+	if data, ok := p.cache.get(key); ok {
+		return json.Unmarshal(data, v)
+	}
+
+	if p.apiKey != "" {
+		query.Set("api_key", p.apiKey)
+	}
+	data, err := p.fetch(ctx, p.baseURL+endpoint+"?"+query.Encode(), true)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("decoding %s: %w", endpoint, err)
+	}
+	p.cache.put(key, data)
+	return nil
+}
+
+// fetch makes a rate-limited GET request, retrying when the server says there
+// are too many requests
+func (p *TMDBProvider) fetch(ctx context.Context, rawURL string, auth bool) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if err := p.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		if auth && p.accessToken != "" {
+			req.Header.Set("Authorization", "Bearer "+p.accessToken)
+		}
+		req.Header.Set("Accept", "application/json")
+		resp, err := p.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxTMDBResponse))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			return data, nil
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, ErrMetadataNotFound
+		case resp.StatusCode == http.StatusUnauthorized:
+			return nil, errors.New("TMDB rejected the API key")
+		case resp.StatusCode == http.StatusTooManyRequests && attempt < maxTMDBRetries:
+			if err := sleepContext(ctx, retryAfter(resp.Header.Get("Retry-After"))); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("TMDB request failed: %s", resp.Status)
+		}
+	}
+}
+
+// ids converts the external IDs of a TMDB response
+func (e tmdbExternalIDs) ids() models.ExternalIDs {
+	ids := models.ExternalIDs{IMDbID: nullString(e.IMDbID)}
+	if e.TVDbID != 0 {
+		ids.TVDbID = nullString(strconv.FormatInt(e.TVDbID, 10))
+	}
+	return ids
+}
+
+// tmdbDate parses a date as given by TMDB; unknown dates are empty
+func tmdbDate(s string) sql.NullTime {
+	t, err := time.Parse("2006-01-02", s)
+	return sql.NullTime{Time: t, Valid: err == nil}
+}
+
+// tmdbYear returns the year of a TMDB date
+func tmdbYear(s string) sql.NullInt64 {
+	date := tmdbDate(s)
+	return sql.NullInt64{Int64: int64(date.Time.Year()), Valid: date.Valid}
+}
+
+// tmdbRating formats an average vote like NFO ratings; 0 means no votes
+func tmdbRating(vote float64) sql.NullString {
+	if vote <= 0 {
+		return sql.NullString{}
+	}
+	return nullString(strconv.FormatFloat(vote, 'f', 1, 64))
+}
+
+// retryAfter parses a Retry-After header given in seconds, defaulting to one
+// second and waiting at most a minute
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds < 0 {
+		return time.Second
+	}
+	return min(time.Duration(seconds)*time.Second, time.Minute)
+}
+
+// sleepContext waits for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateLimiter spaces out requests evenly
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// newRateLimiter creates a limiter allowing perSecond requests a second; 0 or
+// less means no limit
+func newRateLimiter(perSecond float64) *rateLimiter {
+	if perSecond <= 0 {
+		return &rateLimiter{}
+	}
+	return &rateLimiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// wait blocks until the next request may be made
+func (l *rateLimiter) wait(ctx context.Context) error {
+	if err := ctx.Err(); err != nil || l.interval <= 0 {
+		return err
+	}
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+	return sleepContext(ctx, at.Sub(now))
+}
+
+// responsePruneInterval is how often a response cache removes its expired files
+const responsePruneInterval = time.Hour
+
+// responseCache keeps API responses on disk for ttl. Expired responses are
+// removed as they are found, so the cache holds little more than what was
+// fetched within ttl. A cache without a directory keeps nothing.
+type responseCache struct {
+	dir string
+	ttl time.Duration
+
+	mu     sync.Mutex
+	pruned time.Time // when expired files were last removed
+}
+
+// file returns the cache file of a key
+func (c *responseCache) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".json")
+}
+
+// get returns the cached response for a key if it is fresh
+func (c *responseCache) get(key string) ([]byte, bool) {
+	if c.dir == "" || c.ttl <= 0 {
+		return nil, false
+	}
+	name := c.file(key)
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, false
+	}
+	if time.Since(info.ModTime()) > c.ttl {
+		os.Remove(name)
+		return nil, false
+	}
+	data, err := os.ReadFile(name)
+	return data, err == nil
+}
+
+// put caches a response; failures only cost a request later
+func (c *responseCache) put(key string, data []byte) {
+	if c.dir == "" || c.ttl <= 0 {
+		return
+	}
+	if err := writeFileAtomic(c.file(key), data); err != nil {
+		log.Printf("Error caching metadata response: %v", err)
+	}
+	c.prune()
+}
+
+// prune removes the expired responses, at most once per responsePruneInterval
+func (c *responseCache) prune() {
+	c.mu.Lock()
+	if time.Since(c.pruned) < responsePruneInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.pruned = time.Now()
+	c.mu.Unlock()
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		log.Printf("Error pruning metadata cache: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || time.Since(info.ModTime()) <= c.ttl {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, entry.Name())); err != nil {
+			log.Printf("Error pruning metadata cache: %v", err)
+		}
+	}
+}
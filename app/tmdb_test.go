@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// tmdbResponses are the canned responses of the stand-in TMDB API, by path
+var tmdbResponses = map[string]string{
+	"/search/movie": `{"page": 1, "results": [
+		{"id": 1, "title": "Heat Wave", "release_date": "1995-03-01"},
+		{"id": 949, "title": "Heat", "original_title": "Heat", "release_date": "1995-12-15"},
+		{"id": 2, "title": "Heat", "release_date": "1986-03-14"}]}`,
+	"/movie/949": `{"id": 949, "title": "Heat", "release_date": "1995-12-15", "imdb_id": "tt0113277",
+		"overview": "Obsessive master thief Neil McCauley leads a top-notch crew.", "vote_average": 7.94,
+		"poster_path": "/heat-poster.jpg", "backdrop_path": "/heat-backdrop.jpg"}`,
+	"/search/tv": `{"page": 1, "results": [{"id": 1438, "name": "The Wire", "first_air_date": "2002-06-02"}]}`,
+	"/tv/1438": `{"id": 1438, "name": "The Wire", "first_air_date": "2002-06-02", "overview": "Told from the points of view of both the Baltimore homicide and narcotics detectives.",
+		"vote_average": 8.6, "poster_path": "/wire-poster.jpg", "backdrop_path": null,
+		"external_ids": {"imdb_id": "tt0306414", "tvdb_id": 79126}}`,
+	"/images/heat-poster.jpg":   "heat poster",
+	"/images/heat-backdrop.jpg": "heat backdrop",
+	"/images/wire-poster.jpg":   "wire poster",
+}
+
+// newTMDBServer starts a stand-in TMDB API and returns a configuration pointing
+// at it, with a response cache in a temporary directory, and a count of the
+// requests it served
+func newTMDBServer(t *testing.T) (*MetadataConfig, *atomic.Int32) {
+	t.Helper()
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.URL.Query().Get("api_key") != "secret" && filepath.Dir(r.URL.Path) != "/images" {
+			http.Error(w, `{"status_message": "Invalid API key"}`, http.StatusUnauthorized)
+			return
+		}
+		body, ok := tmdbResponses[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return &MetadataConfig{
+		TMDBAPIKey:       "secret",
+		TMDBBaseURL:      srv.URL,
+		TMDBImageBaseURL: srv.URL + "/images",
+		Language:         "en-US",
+		CacheDir:         t.TempDir(),
+		CacheTTL:         time.Hour,
+	}, &requests
+}
+
+func TestTMDBProvider(t *testing.T) {
+	cfg, _ := newTMDBServer(t)
+	p := NewTMDBProvider(cfg)
+	ctx := context.Background()
+
+	matches, err := p.SearchMovies(ctx, "Heat", 1995)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 3 || matches[1] != (MetadataMatch{ID: "949", Title: "Heat", OriginalTitle: "Heat", Year: 1995}) {
+		t.Errorf("SearchMovies = %+v", matches)
+	}
+
+	movie, err := p.Movie(ctx, "949")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.Year.Int64 != 1995 || movie.Rating.String != "7.9" || movie.IMDbID.String != "tt0113277" || movie.TMDbID.String != "949" ||
+		!movie.Description.Valid || movie.Poster != "/heat-poster.jpg" || movie.Fanart != "/heat-backdrop.jpg" {
+		t.Errorf("Movie = %+v", movie)
+	}
+
+	show, err := p.TVShow(ctx, "1438")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if show.Title.String != "The Wire" || show.Year.Int64 != 2002 || show.TVDbID.String != "79126" || show.IMDbID.String != "tt0306414" || show.Fanart != "" {
+		t.Errorf("TVShow = %+v", show)
+	}
+
+	if data, err := p.Artwork(ctx, movie.Poster); err != nil || string(data) != "heat poster" {
+		t.Errorf("Artwork = %q, %v", data, err)
+	}
+	if _, err := p.Movie(ctx, "404"); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("unknown movie: error %v, want ErrMetadataNotFound", err)
+	}
+
+	cfg.TMDBAPIKey = "wrong"
+	cfg.CacheDir = ""
+	if _, err := NewTMDBProvider(cfg).Movie(ctx, "949"); err == nil {
+		t.Error("a rejected API key gave no error")
+	}
+}
+
+func TestTMDBProviderCachesResponses(t *testing.T) {
+	cfg, requests := newTMDBServer(t)
+	ctx := context.Background()
+	if _, err := NewTMDBProvider(cfg).Movie(ctx, "949"); err != nil {
+		t.Fatal(err)
+	}
+	// The cache outlives the client
+	if _, err := NewTMDBProvider(cfg).Movie(ctx, "949"); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("%d requests for the same movie, want 1", n)
+	}
+
+	// Stale responses are fetched again
+	files, _ := filepath.Glob(filepath.Join(cfg.CacheDir, "tmdb", "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("cache holds %d files, want 1", len(files))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(files[0], old, old); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTMDBProvider(cfg).Movie(ctx, "949"); err != nil {
+		t.Fatal(err)
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("%d requests after the cached response went stale, want 2", n)
+	}
+}
+
+func TestResponseCachePrunesExpiredResponses(t *testing.T) {
+	c := &responseCache{dir: t.TempDir(), ttl: time.Hour}
+	c.put("old", []byte("old"))
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(c.file("old"), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pruning waits for its interval
+	c.put("new", []byte("new"))
+	if _, err := os.Stat(c.file("old")); err != nil {
+		t.Fatalf("expired response pruned before the interval passed: %v", err)
+	}
+	c.pruned = time.Now().Add(-responsePruneInterval)
+	c.put("newer", []byte("newer"))
+	if _, err := os.Stat(c.file("old")); !os.IsNotExist(err) {
+		t.Errorf("expired response still cached: %v", err)
+	}
+	if data, ok := c.get("new"); !ok || string(data) != "new" {
+		t.Errorf("get(new) = %q, %v after pruning", data, ok)
+	}
+}
+
+func TestTMDBProviderRetriesWhenRateLimited(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		if requests.Add(1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(tmdbResponses["/movie/949"]))
+	}))
+	defer srv.Close()
+
+	p := NewTMDBProvider(&MetadataConfig{TMDBAccessToken: "token", TMDBBaseURL: srv.URL})
+	movie, err := p.Movie(context.Background(), "949")
+	if err != nil || movie.TMDbID.String != "949" {
+		t.Fatalf("Movie = %+v, %v after two rate-limited attempts", movie, err)
+	}
+	if n := requests.Load(); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(100)
+	ctx := context.Background()
+	start := time.Now()
+	for range 5 {
+		if err := l.wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("5 requests at 100 a second took %v, want at least 40ms", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := newRateLimiter(0.001).wait(cancelled); err == nil {
+		t.Error("waiting with a cancelled context gave no error")
+	}
+}
@@ -0,0 +1,119 @@
+package pages_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+	"transogov2/app/models"
+	"transogov2/app/views/pages"
+	"transogov2/app/views/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMediaComponent(t *testing.T) {
+	movie := models.Media{ID: 1, Title: "The Abyss", Path: "/movies/The Abyss (1989)/The.Abyss.cd1.avi", Part: sql.NullInt64{Int64: 1, Valid: true}}
+	parts := []models.Media{
+		movie,
+		{ID: 2, Title: "The Abyss", Path: "/movies/The Abyss (1989)/The.Abyss.cd2.avi", Part: sql.NullInt64{Int64: 2, Valid: true}},
+	}
+	extras := []models.Media{
+		{ID: 3, Title: "Teaser", ExtraType: sql.NullString{String: models.ExtraTypeTrailer, Valid: true}},
+		{ID: 4, Title: "Commentary", ExtraType: sql.NullString{String: models.ExtraTypeOther, Valid: true}},
+	}
+
+	rendered := testutils.MustRender(pages.Media(movie, nil, parts, extras, nil, nil, nil, 0))
+	assert.Contains(t, rendered, "Part 2: <span")
+	assert.Contains(t, rendered, "The.Abyss.cd2.avi")
+	assert.Contains(t, rendered, `href="/media/3"`)
+	assert.Contains(t, rendered, ">Trailer<")
+	assert.Contains(t, rendered, ">Extra<")
+	assert.Contains(t, rendered, "Back to Library")
+
+	rendered = testutils.MustRender(pages.Media(parts[1], nil, nil, nil, nil, nil, nil, 0))
+	assert.NotContains(t, rendered, "Parts")
+	assert.NotContains(t, rendered, "Extras")
+	assert.NotContains(t, rendered, "Versions")
+}
+
+func TestMediaVersionPicker(t *testing.T) {
+	versions := []models.Media{
+		{ID: 1, Title: "Heat", Resolution: sql.NullString{String: "1080p", Valid: true}, VideoCodec: sql.NullString{String: "H.264", Valid: true}, FileSize: 8 << 30},
+		{ID: 2, Title: "Heat", Resolution: sql.NullString{String: "2160p", Valid: true}, VideoCodec: sql.NullString{String: "H.265", Valid: true}, HDR: true, FileSize: 60 << 30, VersionOf: sql.NullInt64{Int64: 1, Valid: true}},
+		{ID: 3, Title: "Heat", Edition: sql.NullString{String: "Director's Cut", Valid: true}, FileSize: 1536 << 20, VersionOf: sql.NullInt64{Int64: 1, Valid: true}},
+	}
+
+	rendered := testutils.MustRender(pages.Media(versions[1], versions, nil, nil, nil, nil, nil, 0))
+	assert.Contains(t, rendered, "Versions")
+	assert.Contains(t, rendered, `<a href="/media/1" class=`)
+	assert.Contains(t, rendered, `<a href="/media/2" aria-current="page"`)
+	assert.Contains(t, rendered, "1080p · H.264 · 8.0 GB")
+	assert.Contains(t, rendered, "2160p · H.265 · HDR · 60.0 GB")
+	assert.Contains(t, rendered, "Director&#39;s Cut · 1.5 GB")
+}
+
+func TestMediaStreams(t *testing.T) {
+	movie := models.Media{ID: 1, Title: "Heat", DurationMS: sql.NullInt64{Int64: 10_224_000, Valid: true}}
+	streams := []models.MediaStream{
+		{Index: 0, Type: models.StreamTypeVideo, Codec: "H.264", Width: sql.NullInt64{Int64: 1920, Valid: true}, Height: sql.NullInt64{Int64: 800, Valid: true}, FrameRate: sql.NullFloat64{Float64: 23.976, Valid: true}},
+		{Index: 1, Type: models.StreamTypeAudio, Codec: "DTS", Language: sql.NullString{String: "eng", Valid: true}, Channels: sql.NullInt64{Int64: 6, Valid: true}, Default: true},
+		{Index: 2, Type: models.StreamTypeAudio, Codec: "AC3", Language: sql.NullString{String: "fre", Valid: true}, Channels: sql.NullInt64{Int64: 2, Valid: true}, Title: sql.NullString{String: "Commentary", Valid: true}},
+		{Index: 3, Type: models.StreamTypeSubtitle, Codec: "PGS", Language: sql.NullString{String: "eng", Valid: true}, Forced: true},
+	}
+
+	rendered := testutils.MustRender(pages.Media(movie, nil, nil, nil, streams, nil, nil, 0))
+	assert.Contains(t, rendered, ">2h 50m<")
+	assert.Contains(t, rendered, "Media Info")
+	assert.Contains(t, rendered, "H.264 · 1920×800 · 23.976 fps")
+	assert.Contains(t, rendered, "English · DTS · 5.1")
+	assert.Contains(t, rendered, "French · AC3 · Stereo · Commentary")
+	assert.Contains(t, rendered, "English · PGS (forced)")
+	assert.Contains(t, rendered, ">Subtitles<")
+
+	rendered = testutils.MustRender(pages.Media(models.Media{ID: 2, Title: "Alien"}, nil, nil, nil, nil, nil, nil, 0))
+	assert.NotContains(t, rendered, "Media Info")
+}
+
+func TestMediaChapters(t *testing.T) {
+	movie := models.Media{ID: 1, Title: "Heat"}
+	chapters := []models.Chapter{
+		{Index: 0, StartMS: 0, EndMS: sql.NullInt64{Int64: 300_000, Valid: true}, Title: sql.NullString{String: "Opening", Valid: true}},
+		{Index: 1, StartMS: 3_723_500},
+	}
+
+	rendered := testutils.MustRender(pages.Media(movie, nil, nil, nil, nil, chapters, nil, 0))
+	assert.Contains(t, rendered, "Chapters")
+	assert.Contains(t, rendered, `href="/media/1?t=0#player"`)
+	assert.Contains(t, rendered, "Opening")
+	assert.Contains(t, rendered, `href="/media/1?t=3723.5#player"`)
+	assert.Contains(t, rendered, ">1:02:03</span>")
+	assert.Contains(t, rendered, "Chapter 2")
+	assert.Contains(t, rendered, `src="/media/1/video"`)
+	assert.NotContains(t, rendered, "autoplay")
+
+	rendered = testutils.MustRender(pages.Media(movie, nil, nil, nil, nil, chapters, nil, 3723500*time.Millisecond))
+	assert.Contains(t, rendered, `src="/media/1/video#t=3723.5"`)
+	assert.Contains(t, rendered, "autoplay")
+
+	rendered = testutils.MustRender(pages.Media(models.Media{ID: 2, Title: "Alien"}, nil, nil, nil, nil, nil, nil, 0))
+	assert.NotContains(t, rendered, "Chapters")
+}
+
+func TestMediaSubtitles(t *testing.T) {
+	movie := models.Media{ID: 1, Title: "Heat"}
+	subtitles := []models.Subtitle{
+		{Path: "/movies/Heat/Heat.en.srt", Format: "srt", Language: sql.NullString{String: "eng", Valid: true}},
+		{ID: 1, Path: "/movies/Heat/Heat.fre.forced.ass", Format: "ass", Language: sql.NullString{String: "fre", Valid: true}, Forced: true},
+		{ID: 2, Path: "/movies/Heat/Heat.sdh.srt", Format: "srt", SDH: true},
+	}
+
+	rendered := testutils.MustRender(pages.Media(movie, nil, nil, nil, nil, nil, subtitles, 0))
+	assert.Contains(t, rendered, ">English · SRT<")
+	assert.Contains(t, rendered, ">French (forced) · ASS<")
+	assert.Contains(t, rendered, `<track kind="subtitles" src="/subtitles/0.vtt" srclang="eng" label="English">`)
+	assert.Contains(t, rendered, `label="French (forced)"`)
+	assert.Contains(t, rendered, `<track kind="captions" src="/subtitles/2.vtt" label="Unknown language (SDH)">`)
+
+	rendered = testutils.MustRender(pages.Media(movie, nil, nil, nil, nil, nil, nil, 0))
+	assert.NotContains(t, rendered, "Subtitles")
+}
@@ -0,0 +1,44 @@
+package pages_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"transogov2/app/models"
+	"transogov2/app/views/pages"
+	"transogov2/app/views/tests/testutils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeasonComponent(t *testing.T) {
+	tvshow := testutils.MockTVShow()
+	season := testutils.MockSeasons(tvshow.ID, 1)[0]
+
+	double := models.Episode{
+		ID:          10,
+		SeasonID:    season.ID,
+		Number:      3,
+		LastNumber:  sql.NullInt64{Int64: 4, Valid: true},
+		Title:       "Two Parter",
+		Path:        "/test/path/Season 1/Test.Show.S01E03E04.mkv",
+		Description: sql.NullString{String: "Both halves of the finale.", Valid: true},
+	}
+	episodes := append(testutils.MockEpisodes(season.ID, 2), double)
+
+	subtitles := map[int64][]models.Subtitle{
+		double.ID: {
+			{Path: "/test/path/Season 1/Test.Show.S01E03E04.en.srt", Format: "srt", Language: sql.NullString{String: "eng", Valid: true}},
+			{Path: "/test/path/Season 1/Test.Show.S01E03E04.en.sdh.ass", Format: "ass", Language: sql.NullString{String: "eng", Valid: true}, SDH: true},
+			{Path: "/test/path/Season 1/Test.Show.S01E03E04.forced.srt", Format: "srt", Forced: true},
+		},
+	}
+
+	rendered := testutils.MustRender(pages.Season(tvshow, season, episodes, subtitles))
+	for _, s := range []string{"Test Show - Season 1", "Episode 1", "Episode 2", "Two Parter", ">3–4<", "Both halves of the finale.",
+		"Subtitles: English · SRT, English (SDH) · ASS, Unknown language (forced) · SRT"} {
+		assert.Contains(t, rendered, s)
+	}
+	assert.NotContains(t, rendered, ">3<")
+	assert.Equal(t, 1, strings.Count(rendered, "Subtitles:"))
+}
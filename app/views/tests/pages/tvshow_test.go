@@ -1,6 +1,7 @@
 package pages_test
 
 import (
+	"database/sql"
 	"testing"
 	"transogov2/app/models"
 	"transogov2/app/views/pages"
@@ -46,3 +47,30 @@ func TestTVShowComponent(t *testing.T) {
 		})
 	}
 }
+
+func TestTVShowEpisodeOrderSelect(t *testing.T) {
+	tvshow := testutils.MockTVShow()
+	rendered := testutils.MustRender(pages.TVShow(tvshow, nil))
+	assert.Contains(t, rendered, `action="/tvshow/1/order"`)
+	assert.Contains(t, rendered, `<option value="aired" selected>`)
+
+	tvshow.EpisodeOrder = models.EpisodeOrderAbsolute
+	rendered = testutils.MustRender(pages.TVShow(tvshow, nil))
+	assert.Contains(t, rendered, `<option value="absolute" selected>`)
+	assert.NotContains(t, rendered, `<option value="aired" selected>`)
+}
+
+func TestTVShowArtwork(t *testing.T) {
+	tvshow := testutils.MockTVShow()
+	tvshow.FanartPath = sql.NullString{String: "/test/fanart.jpg", Valid: true}
+	seasons := testutils.MockSeasons(tvshow.ID, 2)
+	seasons[1].PosterPath = sql.NullString{String: "/test/season02-poster.jpg", Valid: true}
+	rendered := testutils.MustRender(pages.TVShow(tvshow, seasons))
+
+	assert.Contains(t, rendered, `src="/artwork/tvshow-poster/1"`)
+	assert.Contains(t, rendered, `src="/artwork/tvshow-fanart/1"`)
+	assert.Contains(t, rendered, `src="/artwork/season-poster/2"`)
+	assert.NotContains(t, rendered, "/artwork/season-poster/1")
+	// Paths on disk never reach the page
+	assert.NotContains(t, rendered, "/test/")
+}
@@ -45,3 +45,18 @@ func MockSeasons(tvshowID int64, count int) []models.Season {
 	}
 	return seasons
 }
+
+// MockEpisodes creates a slice of single-episode Episode models for a Season
+func MockEpisodes(seasonID int64, count int) []models.Episode {
+	episodes := make([]models.Episode, count)
+	for i := 0; i < count; i++ {
+		episodes[i] = models.Episode{
+			ID:       int64(i + 1),
+			SeasonID: seasonID,
+			Number:   i + 1,
+			Title:    fmt.Sprintf("Episode %d", i+1),
+			Path:     fmt.Sprintf("/test/path/Season 1/Test.Show.S01E%02d.mkv", i+1),
+		}
+	}
+	return episodes
+}
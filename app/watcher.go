@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Watch modes
+const (
+	WatchModeAuto    = "auto"    // native events, polling for network mounts
+	WatchModeNative  = "native"  // inotify on Linux
+	WatchModePolling = "polling" // periodic directory walks
+)
+
+// errNativeWatchUnsupported is returned where no native watcher is available
+var errNativeWatchUnsupported = errors.New("native filesystem watching is not supported on this platform")
+
+// changeSource reports paths that changed below the watched roots
+type changeSource interface {
+	Changes() <-chan string
+	Close() error
+}
+
+// Watcher monitors the library directories and runs incremental scans of the
+// movies and TV shows that changed. Bursts of events are debounced, and a scan
+// only starts once the affected files have stopped growing.
+type Watcher struct {
+	cfg    *ScanConfig
+	source changeSource
+	// scan runs an incremental scan of the given paths and blocks until it is done
+	scan func(paths []string)
+
+	// pending maps a scan target to its last event and its last size snapshot
+	pending map[string]*pendingTarget
+}
+
+// pendingTarget tracks a changed path while waiting for it to settle
+type pendingTarget struct {
+	lastEvent time.Time
+	checked   time.Time
+	snapshot  string
+}
+
+// NewWatcher creates a Watcher for the configured library directories that
+// schedules incremental scans on jobs
+func NewWatcher(cfg *ScanConfig, jobs *ScanJobs) (*Watcher, error) {
+	source, err := newChangeSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Watcher{
+		cfg:     cfg,
+		source:  source,
+		scan:    jobs.ScanPaths,
+		pending: make(map[string]*pendingTarget),
+	}, nil
+}
+
+// newChangeSource picks the native or polling change source according to the
+// configured watch mode
+func newChangeSource(cfg *ScanConfig) (changeSource, error) {
+	roots := []string{cfg.MoviesDir, cfg.TVDir}
+	switch cfg.WatchMode {
+	case WatchModePolling:
+		return newPollSource(roots, cfg.WatchPollInterval), nil
+	case WatchModeNative:
+		return newNativeSource(roots)
+	default:
+		for _, root := range roots {
+			if isNetworkMount(root) {
+				log.Printf("%s is on a network filesystem, watching by polling", root)
+				return newPollSource(roots, cfg.WatchPollInterval), nil
+			}
+		}
+		source, err := newNativeSource(roots)
+		if err != nil {
+			log.Printf("Native filesystem watching unavailable, falling back to polling: %v", err)
+			return newPollSource(roots, cfg.WatchPollInterval), nil
+		}
+		return source, nil
+	}
+}
+
+// Run processes change events until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) {
+	defer w.source.Close()
+
+	tick := max(min(w.cfg.WatchDebounce, w.cfg.WatchSettle)/2, 10*time.Millisecond)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	// Scans run in the background so events keep being collected meanwhile
+	var scanDone chan struct{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case path, ok := <-w.source.Changes():
+			if !ok {
+				return
+			}
+			if target, ok := watchTarget(w.cfg, path); ok {
+				w.touch(target, time.Now())
+			}
+		case <-scanDone:
+			scanDone = nil
+		case now := <-ticker.C:
+			if scanDone != nil {
+				continue
+			}
+			if ready := w.ready(now); len(ready) > 0 {
+				log.Printf("Library changed, scanning %s", strings.Join(ready, ", "))
+				scanDone = make(chan struct{})
+				go func(done chan struct{}) {
+					defer close(done)
+					w.scan(ready)
+				}(scanDone)
+			}
+		}
+	}
+}
+
+// touch records an event for a scan target, restarting its debounce period
+func (w *Watcher) touch(target string, now time.Time) {
+	p, ok := w.pending[target]
+	if !ok {
+		p = &pendingTarget{}
+		w.pending[target] = p
+	}
+	p.lastEvent = now
+	p.checked = time.Time{}
+}
+
+// ready returns the pending targets that have been quiet for the debounce period
+// and whose files have not changed size for the settle period
+func (w *Watcher) ready(now time.Time) []string {
+	var ready []string
+	for target, p := range w.pending {
+		if now.Sub(p.lastEvent) < w.cfg.WatchDebounce {
+			continue
+		}
+		if !p.checked.IsZero() && now.Sub(p.checked) < w.cfg.WatchSettle {
+			continue
+		}
+		snapshot := sizeSnapshot(target)
+		if p.checked.IsZero() || snapshot != p.snapshot {
+			// First look, or still growing: check again after the settle period
+			p.snapshot = snapshot
+			p.checked = now
+			continue
+		}
+		ready = append(ready, target)
+		delete(w.pending, target)
+	}
+	sort.Strings(ready)
+	return ready
+}
+
+// sizeSnapshot summarises the names and sizes of the files below path so that
+// a file still being written can be detected by comparing snapshots
+func sizeSnapshot(path string) string {
+	var b strings.Builder
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d\n", p, info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+	return b.String()
+}
+
+// watchTarget maps a changed path to the unit that should be rescanned: the movie
+// file or folder directly inside the movies directory, or the show directory
+// inside the TV directory. A change to a root itself targets the whole root.
+func watchTarget(cfg *ScanConfig, path string) (string, bool) {
+	for _, root := range []string{cfg.MoviesDir, cfg.TVDir} {
+		if path == root {
+			return root, true
+		}
+		if !isWithin(root, path) {
+			continue
+		}
+		rel, _ := filepath.Rel(root, path)
+		first, _, _ := strings.Cut(rel, string(filepath.Separator))
+		return filepath.Join(root, first), true
+	}
+	return "", false
+}
+
+// pollSource reports changes by periodically walking the roots and comparing
+// file sizes and modification times. It works on network mounts, which do not
+// deliver native change events.
+type pollSource struct {
+	changes chan string
+	stop    chan struct{}
+}
+
+func newPollSource(roots []string, interval time.Duration) *pollSource {
+	p := &pollSource{changes: make(chan string, 256), stop: make(chan struct{})}
+	// Take the first snapshot before returning so no change after this is missed
+	go p.run(roots, pollSnapshot(roots), interval)
+	return p
+}
+
+func (p *pollSource) Changes() <-chan string { return p.changes }
+
+func (p *pollSource) Close() error {
+	close(p.stop)
+	return nil
+}
+
+func (p *pollSource) run(roots []string, prev map[string]string, interval time.Duration) {
+	defer close(p.changes)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		cur := pollSnapshot(roots)
+		for path, state := range cur {
+			if prev[path] != state {
+				p.send(path)
+			}
+		}
+		for path := range prev {
+			if _, ok := cur[path]; !ok {
+				p.send(path)
+			}
+		}
+		prev = cur
+	}
+}
+
+func (p *pollSource) send(path string) {
+	select {
+	case p.changes <- path:
+	case <-p.stop:
+	}
+}
+
+// pollSnapshot records the size and modification time of every entry below roots
+func pollSnapshot(roots []string) map[string]string {
+	snapshot := make(map[string]string)
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || path == root {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			snapshot[path] = fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return snapshot
+}
+
+// addWatchesRecursive calls add for dir and every directory below it
+func addWatchesRecursive(dir string, add func(string) error) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := add(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,162 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the events that can change what the scanner would find
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF
+
+// inotifySource reports changes using Linux inotify. inotify watches are not
+// recursive, so every directory gets its own watch and new directories are added
+// as they appear.
+type inotifySource struct {
+	file    *os.File
+	changes chan string
+	done    chan struct{}
+
+	mu      sync.Mutex
+	watches map[int32]string // watch descriptor -> directory
+	roots   []string
+}
+
+// newNativeSource watches roots and every directory below them with inotify
+func newNativeSource(roots []string) (changeSource, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	s := &inotifySource{
+		// A non-blocking descriptor is handled by the runtime poller, so Close
+		// unblocks a pending Read
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		changes: make(chan string, 256),
+		done:    make(chan struct{}),
+		watches: make(map[int32]string),
+		roots:   roots,
+	}
+	for _, root := range roots {
+		if err := addWatchesRecursive(root, s.add); err != nil {
+			s.file.Close()
+			return nil, err
+		}
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *inotifySource) Changes() <-chan string { return s.changes }
+
+func (s *inotifySource) Close() error {
+	close(s.done)
+	return s.file.Close()
+}
+
+// send reports a changed path unless the source has been closed
+func (s *inotifySource) send(path string) {
+	select {
+	case s.changes <- path:
+	case <-s.done:
+	}
+}
+
+// add watches a single directory
+func (s *inotifySource) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(int(s.file.Fd()), dir, inotifyMask|syscall.IN_ONLYDIR)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	s.mu.Lock()
+	s.watches[int32(wd)] = dir
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *inotifySource) run() {
+	defer close(s.changes)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := s.file.Read(buf)
+		if err != nil {
+			return // closed
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+			offset += syscall.SizeofInotifyEvent + int(event.Len)
+			s.handle(event, string(bytes.TrimRight(nameBytes, "\x00")))
+		}
+	}
+}
+
+func (s *inotifySource) handle(event *syscall.InotifyEvent, name string) {
+	if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+		// Events were lost; report the roots so everything gets rescanned
+		log.Printf("inotify event queue overflowed, rescanning library roots")
+		for _, root := range s.roots {
+			s.send(root)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	dir, ok := s.watches[event.Wd]
+	if event.Mask&syscall.IN_IGNORED != 0 {
+		delete(s.watches, event.Wd)
+	}
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	path := dir
+	if name != "" {
+		path = filepath.Join(dir, name)
+	}
+	if event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		// Watch new directories, including any created inside them before the
+		// watch was in place
+		if err := addWatchesRecursive(path, s.add); err != nil {
+			log.Printf("Error watching %s: %v", path, err)
+		}
+	}
+	s.send(path)
+}
+
+// Filesystem magic numbers for network filesystems, from statfs(2). They are
+// 32-bit values, which Statfs_t.Type holds as a signed int32 on 32-bit
+// platforms, so they are compared as uint32.
+var networkFilesystems = map[uint32]string{
+	0x6969:     "nfs",
+	0x517B:     "smb",
+	0xFE534D42: "smb2",
+	0xFF534D42: "cifs",
+	0x65735546: "fuse",
+	0x01021997: "9p",
+}
+
+// isNetworkMount reports whether path is on a network filesystem, where inotify
+// does not see changes made by other machines
+func isNetworkMount(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return isNetworkFilesystem(st.Type)
+}
+
+// isNetworkFilesystem reports whether a Statfs_t.Type is one of
+// networkFilesystems
+func isNetworkFilesystem[T int32 | int64 | uint32](typ T) bool {
+	_, ok := networkFilesystems[uint32(typ)]
+	return ok
+}
@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestIsNetworkFilesystem(t *testing.T) {
+	smb2, cifs, ext4 := uint32(0xFE534D42), uint32(0xFF534D42), uint32(0xEF53)
+	// Statfs_t.Type is an int32 on 32-bit platforms, where the SMB magic
+	// numbers are negative
+	if !isNetworkFilesystem(int32(smb2)) || !isNetworkFilesystem(int32(cifs)) {
+		t.Error("SMB2 and CIFS are not network filesystems as int32 types")
+	}
+	if !isNetworkFilesystem(int64(smb2)) || !isNetworkFilesystem(int64(0x6969)) {
+		t.Error("SMB2 and NFS are not network filesystems as int64 types")
+	}
+	if isNetworkFilesystem(int64(ext4)) {
+		t.Error("ext4 is a network filesystem")
+	}
+}
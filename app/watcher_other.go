@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+// newNativeSource is not available on this platform; callers fall back to polling
+func newNativeSource(roots []string) (changeSource, error) {
+	return nil, errNativeWatchUnsupported
+}
+
+// isNetworkMount cannot tell network filesystems apart on this platform
+func isNetworkMount(path string) bool {
+	return false
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"transogov2/app/models"
+)
+
+func TestWatchTarget(t *testing.T) {
+	cfg := &ScanConfig{MoviesDir: "/media/movies", TVDir: "/media/tv"}
+
+	tests := []struct {
+		path   string
+		target string
+		ok     bool
+	}{
+		{"/media/movies/Heat.1995.mkv", "/media/movies/Heat.1995.mkv", true},
+		{"/media/movies/Heat (1995)/Heat.mkv", "/media/movies/Heat (1995)", true},
+		{"/media/tv/Show/Season 1/Show.S01E01.mkv", "/media/tv/Show", true},
+		{"/media/tv/Show", "/media/tv/Show", true},
+		{"/media/tv", "/media/tv", true},
+		{"/media/movies", "/media/movies", true},
+		{"/media/other/file.mkv", "", false},
+		{"/media/tvshows/file.mkv", "", false},
+	}
+	for _, tt := range tests {
+		target, ok := watchTarget(cfg, tt.path)
+		if target != tt.target || ok != tt.ok {
+			t.Errorf("watchTarget(%q) = %q, %v; want %q, %v", tt.path, target, ok, tt.target, tt.ok)
+		}
+	}
+}
+
+func TestWatcherWaitsForFilesToSettle(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &ScanConfig{MoviesDir: dir, WatchDebounce: time.Second, WatchSettle: time.Second}
+	w := &Watcher{cfg: cfg, pending: make(map[string]*pendingTarget)}
+
+	path := filepath.Join(dir, "Heat.1995.mkv")
+	writeFile(t, path, "partial")
+	start := time.Now()
+	w.touch(path, start)
+
+	if ready := w.ready(start.Add(500 * time.Millisecond)); len(ready) != 0 {
+		t.Fatalf("ready during debounce = %v", ready)
+	}
+	// The first look only takes a snapshot
+	if ready := w.ready(start.Add(time.Second)); len(ready) != 0 {
+		t.Fatalf("ready on first look = %v", ready)
+	}
+
+	// Still being copied: the size changes before the settle period ends
+	writeFile(t, path, "partial and then some more")
+	if ready := w.ready(start.Add(2 * time.Second)); len(ready) != 0 {
+		t.Fatalf("ready while growing = %v", ready)
+	}
+
+	ready := w.ready(start.Add(3 * time.Second))
+	if len(ready) != 1 || ready[0] != path {
+		t.Fatalf("ready after settling = %v, want [%s]", ready, path)
+	}
+	if len(w.pending) != 0 {
+		t.Errorf("target still pending after being scanned")
+	}
+}
+
+// testWatcher runs a watcher with short timings against a real scan of cfg and
+// returns the repository it scans into
+func testWatcher(t *testing.T, cfg *ScanConfig) *fakeRepo {
+	t.Helper()
+	cfg.WatchPollInterval = 20 * time.Millisecond
+	cfg.WatchDebounce = 50 * time.Millisecond
+	cfg.WatchSettle = 50 * time.Millisecond
+
+	repo := newFakeRepo()
+	jobs := NewScanJobs(repo, cfg, nil)
+	w, err := NewWatcher(cfg, jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		jobs.Wait()
+	})
+	return repo
+}
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func testWatcherPicksUpChanges(t *testing.T, mode string) {
+	cfg := newTestLibrary(t)
+	cfg.WatchMode = mode
+	repo := testWatcher(t, cfg)
+	ctx := context.Background()
+
+	moviePath := filepath.Join(cfg.MoviesDir, "Heat (1995)", "Heat.1995.mkv")
+	writeFile(t, moviePath, "heat")
+	episodePath := filepath.Join(cfg.TVDir, "Show", "Season 1", "Show.S01E01.mkv")
+	writeFile(t, episodePath, "episode")
+
+	waitFor(t, "the new movie to be added", func() bool {
+		_, err := repo.GetMediaByPath(ctx, moviePath)
+		return err == nil
+	})
+	waitFor(t, "the new episode to be added", func() bool {
+		_, err := repo.GetEpisodeByPath(ctx, episodePath)
+		return err == nil
+	})
+
+	if err := os.Remove(moviePath); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the deleted movie to be marked missing", func() bool {
+		m, err := repo.GetMediaByPath(ctx, moviePath)
+		return err == nil && m.MissingSince.Valid
+	})
+}
+
+func TestWatcherPolling(t *testing.T) {
+	testWatcherPicksUpChanges(t, WatchModePolling)
+}
+
+func TestWatcherNative(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("native watching is only implemented on Linux")
+	}
+	testWatcherPicksUpChanges(t, WatchModeNative)
+}
+
+func TestWatcherScansOnlyChangedShow(t *testing.T) {
+	cfg := newTestLibrary(t)
+	cfg.WatchMode = WatchModePolling
+	ctx := context.Background()
+
+	// An existing show whose episode is already gone on disk must not be touched
+	// by an incremental scan of a different show
+	repo := testWatcher(t, cfg)
+	showID, _ := repo.SaveTVShow(ctx, &models.TVShow{Title: "Old", Path: filepath.Join(cfg.TVDir, "Old")})
+	seasonID, _ := repo.SaveSeason(ctx, &models.Season{TVShowID: showID, Number: 1, Path: filepath.Join(cfg.TVDir, "Old", "Season 1")})
+	oldEpisode := filepath.Join(cfg.TVDir, "Old", "Season 1", "Old.S01E01.mkv")
+	repo.SaveEpisode(ctx, &models.Episode{SeasonID: seasonID, Number: 1, Path: oldEpisode})
+
+	newEpisode := filepath.Join(cfg.TVDir, "New", "Season 1", "New.S01E01.mkv")
+	writeFile(t, newEpisode, "episode")
+	waitFor(t, "the new episode to be added", func() bool {
+		_, err := repo.GetEpisodeByPath(ctx, newEpisode)
+		return err == nil
+	})
+
+	e, err := repo.GetEpisodeByPath(ctx, oldEpisode)
+	if err != nil {
+		t.Fatalf("episode of unchanged show lost: %v", err)
+	}
+	if e.MissingSince.Valid {
+		t.Errorf("episode of unchanged show was marked missing")
+	}
+}
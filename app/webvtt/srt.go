@@ -0,0 +1,79 @@
+package webvtt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// srtTag matches an HTML-like tag in SRT text, such as "<i>" or
+// `<font color="#ffff00">`
+var srtTag = regexp.MustCompile(`^</?([a-zA-Z]+)(\s[^<>]*)?>`)
+
+// parseSRT reads the cues of a SubRip file. Cues need not be numbered or
+// separated by blank lines, as long as each starts with its timing line.
+func parseSRT(text string) []cue {
+	var cues []cue
+	var lines []string
+	var current *cue
+	flush := func() {
+		if current != nil {
+			current.text = joinLines(lines)
+			cues = append(cues, *current)
+		}
+		current, lines = nil, nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if start, end, ok := parseTiming(line); ok {
+			// A number right before the timing line numbers the new cue
+			if n := len(lines); n > 0 {
+				if _, isNumber := number(strings.TrimSpace(lines[n-1])); isNumber {
+					lines = lines[:n-1]
+				}
+			}
+			flush()
+			current = &cue{start: start, end: end}
+			continue
+		}
+		if current == nil {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		lines = append(lines, srtText(line))
+	}
+	flush()
+	return cues
+}
+
+// srtText converts a line of SRT text to WebVTT. Bold, italic and underline tags
+// are kept, other tags such as <font> and SSA override codes such as {\an8}
+// are removed, and everything else is escaped.
+func srtText(line string) string {
+	var b strings.Builder
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case '<':
+			if m := srtTag.FindStringSubmatch(line[i:]); m != nil {
+				if tag := strings.ToLower(m[1]); tag == "b" || tag == "i" || tag == "u" {
+					if m[0][1] == '/' {
+						b.WriteString("</" + tag + ">")
+					} else {
+						b.WriteString("<" + tag + ">")
+					}
+				}
+				i += len(m[0])
+				continue
+			}
+		case '{':
+			if end := strings.IndexByte(line[i:], '}'); end > 0 && strings.HasPrefix(line[i+1:], `\`) {
+				i += end + 1
+				continue
+			}
+		}
+		b.WriteString(escape(line[i : i+1]))
+		i++
+	}
+	return b.String()
+}
@@ -0,0 +1,106 @@
+package webvtt
+
+import (
+	"sort"
+	"strings"
+)
+
+// ssaFields is the order of the fields of a dialogue line in files whose events
+// have no Format line. SSA has "Marked" where ASS has "Layer", and neither is used.
+var ssaFields = []string{"layer", "start", "end", "style", "name", "marginl", "marginr", "marginv", "effect", "text"}
+
+// parseASS reads the dialogue lines of the [Events] section of an SSA or ASS
+// file, in order of their start times. Comments, styles and every override code
+// are left out, as is the text of drawings.
+func parseASS(text string) []cue {
+	var cues []cue
+	inEvents := false
+	fields := ssaFields
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inEvents = strings.EqualFold(line, "[Events]")
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !inEvents || !ok {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "format":
+			fields = strings.Split(strings.ToLower(strings.ReplaceAll(value, " ", "")), ",")
+		case "dialogue":
+			values := strings.SplitN(value, ",", len(fields))
+			if len(values) < len(fields) {
+				continue
+			}
+			var c cue
+			var startOK, endOK bool
+			for i, field := range fields {
+				switch field {
+				case "start":
+					c.start, startOK = parseTimestamp(values[i])
+				case "end":
+					c.end, endOK = parseTimestamp(values[i])
+				case "text":
+					c.text = ssaText(values[i])
+				}
+			}
+			if startOK && endOK {
+				cues = append(cues, c)
+			}
+		}
+	}
+	// Events are often listed by style or layer rather than by time
+	sort.SliceStable(cues, func(i, j int) bool { return cues[i].start < cues[j].start })
+	return cues
+}
+
+// ssaText converts the text of a dialogue line to WebVTT: override blocks such
+// as {\i1} are removed, along with the shapes drawn between {\p1} and {\p0}, and
+// the \N and \n line breaks and \h hard spaces are converted
+func ssaText(s string) string {
+	var b strings.Builder
+	drawing := false
+	for i := 0; i < len(s); {
+		if s[i] == '{' {
+			if end := strings.IndexByte(s[i:], '}'); end > 0 {
+				drawing = drawingMode(s[i+1:i+end], drawing)
+				i += end + 1
+				continue
+			}
+		}
+		if drawing {
+			i++
+			continue
+		}
+		if s[i] == '\\' && i+1 < len(s) {
+			switch s[i+1] {
+			case 'N', 'n':
+				b.WriteByte('\n')
+				i += 2
+				continue
+			case 'h':
+				b.WriteByte(' ')
+				i += 2
+				continue
+			}
+		}
+		b.WriteString(escape(s[i : i+1]))
+		i++
+	}
+	return joinLines(strings.Split(b.String(), "\n"))
+}
+
+// drawingMode returns whether text after an override block is a drawing: \p
+// with a scale above 0 starts one and \p0 ends it
+func drawingMode(block string, drawing bool) bool {
+	for _, code := range strings.Split(block, `\`) {
+		if rest, ok := strings.CutPrefix(code, "p"); ok {
+			if n, ok := number(strings.TrimSpace(rest)); ok {
+				drawing = n > 0
+			}
+		}
+	}
+	return drawing
+}
@@ -0,0 +1,237 @@
+// Package webvtt converts SubRip (SRT) and SubStation Alpha (SSA and ASS)
+// subtitles to WebVTT, the only text track format browsers play, in pure Go.
+// Only the dialogue and its timing are kept; SRT's bold, italic and underline
+// tags survive, any other styling is stripped.
+package webvtt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrUnknownFormat is returned for subtitle formats that cannot be converted
+var ErrUnknownFormat = errors.New("unknown subtitle format")
+
+// ErrNoCues is returned for files with text but no subtitles, which are usually
+// in another format than their extension says
+var ErrNoCues = errors.New("no subtitles found")
+
+// cue is a piece of text shown between two times, already escaped for WebVTT
+type cue struct {
+	start, end time.Duration
+	text       string
+}
+
+// Cues are the subtitles of a file as read by Parse, to be written as WebVTT
+// with any offset
+type Cues []cue
+
+// Convert converts a subtitle file in the given format, "srt", "ass", "ssa" or
+// "vtt", to WebVTT, with every cue shifted by offset. Cues shifted to before the
+// start of the video are dropped, or cut if they are still showing at its start.
+func Convert(format string, data []byte, offset time.Duration) ([]byte, error) {
+	cues, err := Parse(format, data)
+	if err != nil {
+		return nil, err
+	}
+	return cues.WebVTT(offset), nil
+}
+
+// Parse reads the cues of a subtitle file in the given format, "srt", "ass",
+// "ssa" or "vtt"
+func Parse(format string, data []byte) (Cues, error) {
+	text := decode(data)
+	var cues []cue
+	switch strings.ToLower(format) {
+	case "srt":
+		cues = parseSRT(text)
+	case "ass", "ssa":
+		cues = parseASS(text)
+	case "vtt":
+		cues = parseVTT(text)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	if len(cues) == 0 && strings.TrimSpace(text) != "" && !strings.HasPrefix(text, "WEBVTT") {
+		return nil, ErrNoCues
+	}
+	return cues, nil
+}
+
+// WebVTT formats the cues as a WebVTT file, shifted by offset as in Convert
+func (cues Cues) WebVTT(offset time.Duration) []byte {
+	var b bytes.Buffer
+	b.WriteString("WEBVTT\n")
+	for _, c := range cues {
+		start, end := c.start+offset, c.end+offset
+		if end <= start || end <= 0 || c.text == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s --> %s\n%s\n", timestamp(max(start, 0)), timestamp(end), c.text)
+	}
+	return b.Bytes()
+}
+
+// cueSize is the memory a cue takes besides its text: two times and a string
+const cueSize = 40
+
+// Size is about the number of bytes of memory the cues take
+func (cues Cues) Size() int {
+	size := 0
+	for _, c := range cues {
+		size += cueSize + len(c.text)
+	}
+	return size
+}
+
+// timestamp formats a time as WebVTT does, such as "01:02:03.450"
+func timestamp(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// parseTimestamp parses a time such as "01:02:03,450" in SRT, "1:02:03.45" in
+// SSA or "02:03.450" in WebVTT. Fractions are of a second whatever their number
+// of digits.
+func parseTimestamp(s string) (time.Duration, bool) {
+	fields := strings.Split(strings.TrimSpace(s), ":")
+	if len(fields) < 2 || len(fields) > 3 {
+		return 0, false
+	}
+	secs, frac, _ := strings.Cut(strings.ReplaceAll(fields[len(fields)-1], ",", "."), ".")
+	fields[len(fields)-1] = secs
+	var d time.Duration
+	for _, f := range fields {
+		n, ok := number(f)
+		if !ok {
+			return 0, false
+		}
+		d = d*60 + time.Duration(n)
+	}
+	d *= time.Second
+	if len(frac) > 3 {
+		frac = frac[:3]
+	}
+	if frac != "" {
+		n, ok := number(frac + strings.Repeat("0", 3-len(frac)))
+		if !ok {
+			return 0, false
+		}
+		d += time.Duration(n) * time.Millisecond
+	}
+	return d, true
+}
+
+// number parses a non-empty string of ASCII digits
+func number(s string) (int, bool) {
+	if s == "" || len(s) > 9 {
+		return 0, false
+	}
+	n := 0
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+		n = n*10 + int(r-'0')
+	}
+	return n, true
+}
+
+// parseTiming parses a cue timing line such as "00:00:01,000 --> 00:00:02,500",
+// ignoring anything after the end time, such as SRT coordinates or WebVTT cue
+// settings
+func parseTiming(line string) (start, end time.Duration, ok bool) {
+	from, to, found := strings.Cut(line, "-->")
+	if !found {
+		return 0, 0, false
+	}
+	fields := strings.Fields(to)
+	if len(fields) == 0 {
+		return 0, 0, false
+	}
+	start, ok1 := parseTimestamp(from)
+	end, ok2 := parseTimestamp(fields[0])
+	return start, end, ok1 && ok2
+}
+
+// parseVTT reads the cues of a WebVTT file, whose text is kept as it is.
+// Comments, styles, regions, cue identifiers and cue settings are left out.
+func parseVTT(text string) []cue {
+	var cues []cue
+	for _, block := range strings.Split(text, "\n\n") {
+		lines := strings.Split(strings.Trim(block, "\n"), "\n")
+		for i, line := range lines {
+			if i > 1 || !strings.Contains(line, "-->") {
+				continue
+			}
+			if start, end, ok := parseTiming(line); ok {
+				cues = append(cues, cue{start: start, end: end, text: joinLines(lines[i+1:])})
+			}
+			break
+		}
+	}
+	return cues
+}
+
+// decode converts subtitle text to UTF-8 with "\n" line endings. Files with a
+// UTF-16 byte order mark are UTF-16, and files that are not valid UTF-8 are
+// taken to be Windows-1252, which most older subtitles in Western languages use.
+func decode(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		data = data[3:]
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}), bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		bigEndian := data[0] == 0xFE
+		units := make([]uint16, 0, len(data)/2-1)
+		for i := 2; i+1 < len(data); i += 2 {
+			if bigEndian {
+				units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+			} else {
+				units = append(units, uint16(data[i+1])<<8|uint16(data[i]))
+			}
+		}
+		data = []byte(string(utf16.Decode(units)))
+	}
+	text := string(data)
+	if !utf8.ValidString(text) {
+		runes := make([]rune, len(data))
+		for i, c := range data {
+			runes[i] = rune(c)
+			if c >= 0x80 && c < 0xA0 && windows1252[c-0x80] != 0 {
+				runes[i] = windows1252[c-0x80]
+			}
+		}
+		text = string(runes)
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.ReplaceAll(text, "\r", "\n")
+}
+
+// windows1252 holds the characters Windows-1252 has in place of the C1 control
+// codes 0x80 to 0x9F of Latin-1, or 0 where it has none
+var windows1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// escape escapes the characters WebVTT gives a meaning in cue text
+func escape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// joinLines trims the lines of a cue's text and leaves out empty ones, since a
+// blank line would end the cue
+func joinLines(lines []string) string {
+	kept := lines[:0:0]
+	for _, line := range lines {
+		if line = strings.TrimSpace(line); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
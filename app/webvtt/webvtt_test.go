@@ -0,0 +1,95 @@
+package webvtt
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// The .golden files in testdata hold the expected WebVTT output; run the tests
+// with -update to rewrite them after a deliberate change
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		file   string
+		offset time.Duration
+		golden string
+	}{
+		{"sample.srt", 0, "sample.srt.golden"},
+		{"sample.srt", -2 * time.Second, "sample.srt.offset.golden"},
+		{"latin1.srt", 0, "latin1.srt.golden"},
+		{"utf16.srt", 0, "utf16.srt.golden"},
+		{"empty.srt", 0, "empty.srt.golden"},
+		{"sample.ass", 0, "sample.ass.golden"},
+		{"sample.ass", 1500 * time.Millisecond, "sample.ass.offset.golden"},
+		{"sample.ssa", 0, "sample.ssa.golden"},
+		{"sample.vtt", 0, "sample.vtt.golden"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Convert(filepath.Ext(tt.file)[1:], data, tt.offset)
+			if err != nil {
+				t.Fatalf("Convert: %v", err)
+			}
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Convert(%s, %v) =\n%s\nwant\n%s", tt.file, tt.offset, got, want)
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "notsubtitles.srt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Convert("srt", data, 0); !errors.Is(err, ErrNoCues) {
+		t.Errorf("Convert(notsubtitles.srt) error = %v, want ErrNoCues", err)
+	}
+	if _, err := Convert("sub", data, 0); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("Convert(sub) error = %v, want ErrUnknownFormat", err)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"00:00:01,000", time.Second, true},
+		{"01:02:03.450", time.Hour + 2*time.Minute + 3450*time.Millisecond, true},
+		{"1:02:03.45", time.Hour + 2*time.Minute + 3450*time.Millisecond, true},
+		{"02:03.4", 2*time.Minute + 3400*time.Millisecond, true},
+		{" 00:00:05 ", 5 * time.Second, true},
+		{"00:00:01.2345", 1234 * time.Millisecond, true},
+		{"5", 0, false},
+		{"00:xx:01,000", 0, false},
+		{"1:2:3:4", 0, false},
+		{"00:00:-1,000", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseTimestamp(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("parseTimestamp(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}